@@ -23,8 +23,12 @@ type CassandraConfig struct {
 	Query                    string                `json:"query" yaml:"query"`
 	ArgsMapping              string                `json:"args_mapping" yaml:"args_mapping"`
 	Consistency              string                `json:"consistency" yaml:"consistency"`
+	TTL                      string                `json:"ttl" yaml:"ttl"`
 	Timeout                  string                `json:"timeout" yaml:"timeout"`
 	LoggedBatch              bool                  `json:"logged_batch" yaml:"logged_batch"`
+	BatchType                string                `json:"batch_type" yaml:"batch_type"`
+	GroupByPartition         bool                  `json:"group_by_partition" yaml:"group_by_partition"`
+	LWTNotApplied            string                `json:"lwt_not_applied" yaml:"lwt_not_applied"`
 	// TODO: V4 Remove this and replace with explicit values.
 	retries.Config `json:",inline" yaml:",inline"`
 	MaxInFlight    int                `json:"max_in_flight" yaml:"max_in_flight"`
@@ -51,10 +55,14 @@ func NewCassandraConfig() CassandraConfig {
 		Query:                    "",
 		ArgsMapping:              "",
 		Consistency:              "QUORUM",
+		TTL:                      "",
 		Timeout:                  "600ms",
 		Config:                   rConf,
 		MaxInFlight:              64,
 		Batching:                 batchconfig.NewConfig(),
 		LoggedBatch:              true,
+		BatchType:                "",
+		GroupByPartition:         false,
+		LWTNotApplied:            "error",
 	}
 }
@@ -4,15 +4,21 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gocql/gocql"
 
+	"github.com/usedatabrew/benthos/v4/internal/batch"
 	"github.com/usedatabrew/benthos/v4/internal/batch/policy"
+	"github.com/usedatabrew/benthos/v4/internal/bloblang/field"
 	"github.com/usedatabrew/benthos/v4/internal/bloblang/mapping"
 	"github.com/usedatabrew/benthos/v4/internal/bloblang/query"
 	"github.com/usedatabrew/benthos/v4/internal/bundle"
@@ -46,7 +52,15 @@ Runs a query against a Cassandra database for each message in order to insert da
 		Description: output.Description(true, true, `
 Query arguments can be set using a bloblang array for the fields using the `+"`args_mapping`"+` field.
 
-When populating timestamp columns the value must either be a string in ISO 8601 format (2006-01-02T15:04:05Z07:00), or an integer representing unix time in seconds.`),
+When populating timestamp columns the value must either be a string in ISO 8601 format (2006-01-02T15:04:05Z07:00), or an integer representing unix time in seconds.
+
+### Batches
+
+Batches of messages are written with a single batch statement of the type set by `+"`batch_type`"+`. Since the consistency of a batch applies to all of its statements, messages resolving to different consistency levels are written with separate batches. When `+"`group_by_partition`"+` is enabled batches are further split into a batch per partition key, each of which is routed directly to a replica of its partition, which avoids the coordinator of a batch having to forward statements to other nodes.
+
+### Lightweight Transactions
+
+Queries containing an `+"`IF`"+` condition, such as `+"`INSERT ... IF NOT EXISTS`"+` or `+"`UPDATE ... IF foo = ?`"+`, are executed as lightweight transactions. These are executed individually for each message rather than as a batch, and the `+"`[applied]`"+` result of each is set as the metadata field `+"`cassandra_lwt_applied`"+` of the message. The field `+"`lwt_not_applied`"+` determines whether messages that were not applied are treated as errors.`),
 		Examples: []docs.AnnotatedExample{
 			{
 				Title:   "Basic Inserts",
@@ -111,14 +125,38 @@ output:
 				"A [Bloblang mapping](/docs/guides/bloblang/about) that can be used to provide arguments to Cassandra queries. The result of the query must be an array containing a matching number of elements to the query arguments.").AtVersion("3.55.0"),
 			docs.FieldString(
 				"consistency",
-				"The consistency level to use.",
-			).HasOptions(
-				"ANY", "ONE", "TWO", "THREE", "QUORUM", "ALL", "LOCAL_QUORUM", "EACH_QUORUM", "LOCAL_ONE",
-			).Advanced(),
+				"The consistency level to use, one of `ANY`, `ONE`, `TWO`, `THREE`, `QUORUM`, `ALL`, `LOCAL_QUORUM`, `EACH_QUORUM` or `LOCAL_ONE`. This field supports interpolation functions, allowing the consistency level to be set per message.",
+				"QUORUM", `${! meta("consistency") }`,
+			).IsInterpolated().Advanced(),
+			docs.FieldString(
+				"ttl",
+				"An optional time to live of the data written by each message as a duration string, after which it expires. When set the query must be an `INSERT` or `UPDATE` statement without a `USING` clause, and a `USING TTL` clause is added to it. This field supports interpolation functions, where an empty result writes data without a TTL.",
+				"24h", `${! meta("ttl").or("") }`,
+			).IsInterpolated().Advanced().AtVersion("4.24.0"),
 			docs.FieldBool(
 				"logged_batch",
-				"If enabled the driver will perform a logged batch. Disabling this prompts unlogged batches to be used instead, which are less efficient but necessary for alternative storages that do not support logged batches.",
+				"If enabled the driver will perform a logged batch. Disabling this prompts unlogged batches to be used instead, which are less efficient but necessary for alternative storages that do not support logged batches. This field is ignored when `batch_type` is set.",
 			).Advanced(),
+			docs.FieldString(
+				"batch_type",
+				"The type of batch used for writing batches of messages. When empty the type is determined by `logged_batch`.",
+			).HasAnnotatedOptions(
+				"", "Use a logged batch when `logged_batch` is enabled, otherwise an unlogged batch.",
+				"LOGGED", "A logged batch, which guarantees that either all or none of the statements of a batch are eventually applied.",
+				"UNLOGGED", "An unlogged batch, which avoids the overhead of the batch log.",
+				"COUNTER", "A batch of counter updates, which is required for queries that update counter columns.",
+			).Advanced().AtVersion("4.24.0"),
+			docs.FieldBool(
+				"group_by_partition",
+				"Whether to split batches into a batch per partition key, each of which is routed to a replica of its partition. This requires the partition key columns of the table to be bound by the query arguments.",
+			).Advanced().AtVersion("4.24.0"),
+			docs.FieldString(
+				"lwt_not_applied",
+				"Determines how lightweight transactions that were not applied are handled.",
+			).HasAnnotatedOptions(
+				"error", "The message is failed, allowing it to be handled with a [`fallback`](/docs/components/outputs/fallback) output or retried.",
+				"metadata", "The message is acknowledged, with the result only recorded in the metadata field `cassandra_lwt_applied`.",
+			).Advanced().AtVersion("4.24.0"),
 			docs.FieldInt("max_retries", "The maximum number of retries before giving up on a request.").Advanced(),
 			docs.FieldObject("backoff", "Control time intervals between retry attempts.").WithChildren(
 				docs.FieldString("initial_interval", "The initial period to wait between retry attempts."),
@@ -148,8 +186,15 @@ type cassandraWriter struct {
 	session  *gocql.Session
 	connLock sync.RWMutex
 
-	argsMapping *mapping.Executor
-	batchType   gocql.BatchType
+	query       string
+	ttlFirst    bool
+	conditional bool
+
+	argsMapping        *mapping.Executor
+	consistency        *field.Expression
+	defaultConsistency gocql.Consistency
+	ttl                *field.Expression
+	batchType          gocql.BatchType
 }
 
 func newCassandraWriter(conf output.CassandraConfig, mgr bundle.NewManagement) (*cassandraWriter, error) {
@@ -157,6 +202,7 @@ func newCassandraWriter(conf output.CassandraConfig, mgr bundle.NewManagement) (
 		log:   mgr.Logger(),
 		stats: mgr.Metrics(),
 		conf:  conf,
+		query: conf.Query,
 	}
 
 	var err error
@@ -174,11 +220,24 @@ func newCassandraWriter(conf output.CassandraConfig, mgr bundle.NewManagement) (
 	if err = c.parseArgs(mgr); err != nil {
 		return nil, fmt.Errorf("parsing args: %w", err)
 	}
-	c.batchType = gocql.UnloggedBatch
-	if c.conf.LoggedBatch {
-		c.batchType = gocql.LoggedBatch
+	if c.batchType, err = parseBatchType(c.conf.BatchType, c.conf.LoggedBatch); err != nil {
+		return nil, err
+	}
+	switch c.conf.LWTNotApplied {
+	case "error", "metadata":
+	default:
+		return nil, fmt.Errorf("unrecognised lwt_not_applied value: %v", c.conf.LWTNotApplied)
 	}
+	c.conditional = isConditionalQuery(c.query)
 
+	if c.conf.TTL != "" {
+		if c.ttl, err = mgr.BloblEnvironment().NewField(c.conf.TTL); err != nil {
+			return nil, fmt.Errorf("failed to parse ttl expression: %v", err)
+		}
+		if c.query, c.ttlFirst, err = ttlQuery(c.query); err != nil {
+			return nil, err
+		}
+	}
 	return &c, nil
 }
 
@@ -189,9 +248,89 @@ func (c *cassandraWriter) parseArgs(mgr bundle.NewManagement) error {
 			return fmt.Errorf("parsing args_mapping: %w", err)
 		}
 	}
+
+	var err error
+	if c.consistency, err = mgr.BloblEnvironment().NewField(c.conf.Consistency); err != nil {
+		return fmt.Errorf("failed to parse consistency expression: %v", err)
+	}
+	c.defaultConsistency = gocql.Quorum
+	if c.consistency.NumDynamicExpressions() == 0 {
+		if c.defaultConsistency, err = gocql.ParseConsistencyWrapper(c.conf.Consistency); err != nil {
+			return fmt.Errorf("parsing consistency: %w", err)
+		}
+		c.consistency = nil
+	}
 	return nil
 }
 
+// parseBatchType returns the type of batch to use, where an empty type falls
+// back to the deprecated logged batch flag.
+func parseBatchType(batchType string, logged bool) (gocql.BatchType, error) {
+	switch strings.ToUpper(batchType) {
+	case "":
+		if logged {
+			return gocql.LoggedBatch, nil
+		}
+		return gocql.UnloggedBatch, nil
+	case "LOGGED":
+		return gocql.LoggedBatch, nil
+	case "UNLOGGED":
+		return gocql.UnloggedBatch, nil
+	case "COUNTER":
+		return gocql.CounterBatch, nil
+	}
+	return 0, fmt.Errorf("unrecognised batch type: %v", batchType)
+}
+
+var (
+	conditionalQueryRegexp = regexp.MustCompile(`(?is)\bIF\b`)
+	insertQueryRegexp      = regexp.MustCompile(`(?is)^\s*INSERT\b`)
+	updateQueryRegexp      = regexp.MustCompile(`(?is)^(\s*UPDATE\s+\S+)(\s.*)$`)
+	usingQueryRegexp       = regexp.MustCompile(`(?is)\bUSING\b`)
+)
+
+// isConditionalQuery returns whether a query is a lightweight transaction,
+// which is the case when it contains an IF clause.
+func isConditionalQuery(query string) bool {
+	return conditionalQueryRegexp.MatchString(stripCQLLiterals(query))
+}
+
+// stripCQLLiterals removes string literals and quoted identifiers from a
+// query so that their contents are not mistaken for keywords.
+func stripCQLLiterals(query string) string {
+	var b strings.Builder
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ttlQuery adds a USING TTL clause to a query, returning whether the TTL is
+// bound before the other arguments of the query.
+func ttlQuery(query string) (string, bool, error) {
+	stripped := stripCQLLiterals(query)
+	if usingQueryRegexp.MatchString(stripped) {
+		return "", false, errors.New("a ttl cannot be set for queries that already contain a USING clause")
+	}
+	if insertQueryRegexp.MatchString(stripped) {
+		return strings.TrimRight(strings.TrimSpace(query), ";") + " USING TTL ?", false, nil
+	}
+	if updateQueryRegexp.MatchString(query) {
+		return updateQueryRegexp.ReplaceAllString(query, "$1 USING TTL ?$2"), true, nil
+	}
+	return "", false, errors.New("a ttl can only be set for INSERT and UPDATE queries")
+}
+
 func (c *cassandraWriter) Connect(ctx context.Context) error {
 	c.connLock.Lock()
 	defer c.connLock.Unlock()
@@ -215,8 +354,9 @@ func (c *cassandraWriter) Connect(ctx context.Context) error {
 		}
 	}
 	conn.DisableInitialHostLookup = c.conf.DisableInitialHostLookup
-	if conn.Consistency, err = gocql.ParseConsistencyWrapper(c.conf.Consistency); err != nil {
-		return fmt.Errorf("parsing consistency: %w", err)
+	conn.Consistency = c.defaultConsistency
+	if c.conf.GroupByPartition {
+		conn.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
 	}
 
 	conn.RetryPolicy = &decorator{
@@ -240,6 +380,13 @@ func (c *cassandraWriter) Connect(ctx context.Context) error {
 	return nil
 }
 
+// cassandraStatement is the query of a single message of a batch.
+type cassandraStatement struct {
+	index       int
+	values      []any
+	consistency gocql.Consistency
+}
+
 func (c *cassandraWriter) WriteBatch(ctx context.Context, msg message.Batch) error {
 	c.connLock.RLock()
 	session := c.session
@@ -249,35 +396,169 @@ func (c *cassandraWriter) WriteBatch(ctx context.Context, msg message.Batch) err
 		return component.ErrNotConnected
 	}
 
-	if msg.Len() == 1 {
-		return c.writeRow(session, msg)
+	stmts := make([]cassandraStatement, msg.Len())
+	for i := range stmts {
+		var err error
+		if stmts[i], err = c.statement(msg, i); err != nil {
+			return err
+		}
+	}
+
+	if c.conditional {
+		return c.writeConditional(ctx, session, msg, stmts)
 	}
-	return c.writeBatch(session, msg)
+	if len(stmts) == 1 {
+		return c.writeRow(ctx, session, stmts[0])
+	}
+
+	groups := c.groupStatements(session, stmts)
+	if len(groups) == 1 {
+		return c.writeBatch(ctx, session, groups[0])
+	}
+
+	errs := map[int]error{}
+	for _, group := range groups {
+		if err := c.writeBatch(ctx, session, group); err != nil {
+			for _, stmt := range group {
+				errs[stmt.index] = err
+			}
+		}
+	}
+	return batchErrorFrom(msg, errs)
 }
 
-func (c *cassandraWriter) writeRow(session *gocql.Session, msg message.Batch) error {
-	values, err := c.mapArgs(msg, 0)
-	if err != nil {
-		return fmt.Errorf("parsing args: %w", err)
+// statement resolves the query arguments, TTL and consistency of a message.
+func (c *cassandraWriter) statement(msg message.Batch, index int) (stmt cassandraStatement, err error) {
+	stmt.index = index
+	if stmt.values, err = c.mapArgs(msg, index); err != nil {
+		return stmt, fmt.Errorf("parsing args for part: %d: %w", index, err)
+	}
+
+	stmt.consistency = c.defaultConsistency
+	if c.consistency != nil {
+		consistencyStr, err := c.consistency.String(index, msg)
+		if err != nil {
+			return stmt, fmt.Errorf("consistency interpolation error: %w", err)
+		}
+		if stmt.consistency, err = gocql.ParseConsistencyWrapper(consistencyStr); err != nil {
+			return stmt, fmt.Errorf("parsing consistency for part: %d: %w", index, err)
+		}
+	}
+
+	if c.ttl != nil {
+		ttlStr, err := c.ttl.String(index, msg)
+		if err != nil {
+			return stmt, fmt.Errorf("ttl interpolation error: %w", err)
+		}
+		var ttl time.Duration
+		if ttlStr != "" {
+			if ttl, err = time.ParseDuration(ttlStr); err != nil {
+				return stmt, fmt.Errorf("parsing ttl for part: %d: %w", index, err)
+			}
+		}
+		// A TTL of zero writes data that does not expire.
+		ttlSeconds := int(ttl / time.Second)
+		if c.ttlFirst {
+			stmt.values = append([]any{ttlSeconds}, stmt.values...)
+		} else {
+			stmt.values = append(stmt.values, ttlSeconds)
+		}
+	}
+	return stmt, nil
+}
+
+// groupStatements splits statements into groups that can be written with a
+// single batch, preserving the order of statements within each group.
+func (c *cassandraWriter) groupStatements(session *gocql.Session, stmts []cassandraStatement) [][]cassandraStatement {
+	type groupKey struct {
+		consistency  gocql.Consistency
+		partitionKey string
+	}
+
+	var keys []groupKey
+	groups := map[groupKey][]cassandraStatement{}
+	for _, stmt := range stmts {
+		key := groupKey{consistency: stmt.consistency}
+		if c.conf.GroupByPartition {
+			routingKey, err := session.Query(c.query, stmt.values...).GetRoutingKey()
+			if err != nil {
+				c.log.Debugf("Failed to obtain partition key of message: %v\n", err)
+			}
+			key.partitionKey = string(routingKey)
+		}
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], stmt)
 	}
-	return session.Query(c.conf.Query, values...).Exec()
+
+	result := make([][]cassandraStatement, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, groups[k])
+	}
+	return result
 }
 
-func (c *cassandraWriter) writeBatch(session *gocql.Session, msg message.Batch) error {
-	batch := session.NewBatch(c.batchType)
+func (c *cassandraWriter) writeRow(ctx context.Context, session *gocql.Session, stmt cassandraStatement) error {
+	return session.Query(c.query, stmt.values...).
+		Consistency(stmt.consistency).
+		WithContext(ctx).
+		Exec()
+}
+
+func (c *cassandraWriter) writeBatch(ctx context.Context, session *gocql.Session, stmts []cassandraStatement) error {
+	if len(stmts) == 1 {
+		return c.writeRow(ctx, session, stmts[0])
+	}
+
+	batch := session.NewBatch(c.batchType).WithContext(ctx)
+	batch.SetConsistency(stmts[0].consistency)
+	for _, stmt := range stmts {
+		batch.Query(c.query, stmt.values...)
+	}
+	return session.ExecuteBatch(batch)
+}
 
-	if err := msg.Iter(func(i int, p *message.Part) error {
-		values, err := c.mapArgs(msg, i)
+// writeConditional executes the lightweight transaction of each message
+// individually, recording whether each was applied within its metadata.
+func (c *cassandraWriter) writeConditional(ctx context.Context, session *gocql.Session, msg message.Batch, stmts []cassandraStatement) error {
+	errs := map[int]error{}
+	for _, stmt := range stmts {
+		applied, err := session.Query(c.query, stmt.values...).
+			Consistency(stmt.consistency).
+			WithContext(ctx).
+			MapScanCAS(map[string]any{})
 		if err != nil {
-			return fmt.Errorf("parsing args for part: %d: %w", i, err)
+			errs[stmt.index] = err
+			continue
+		}
+
+		msg.Get(stmt.index).MetaSetMut("cassandra_lwt_applied", strconv.FormatBool(applied))
+		if !applied && c.conf.LWTNotApplied == "error" {
+			errs[stmt.index] = errors.New("lightweight transaction was not applied")
 		}
-		batch.Query(c.conf.Query, values...)
+	}
+	return batchErrorFrom(msg, errs)
+}
+
+// batchErrorFrom returns an error for the messages of a batch that failed,
+// which is nil when there are none.
+func batchErrorFrom(msg message.Batch, errs map[int]error) error {
+	if len(errs) == 0 {
 		return nil
-	}); err != nil {
-		return err
+	}
+	if msg.Len() == 1 {
+		return errs[0]
 	}
 
-	return session.ExecuteBatch(batch)
+	var batchErr *batch.Error
+	for i, err := range errs {
+		if batchErr == nil {
+			batchErr = batch.NewError(msg, err)
+		}
+		batchErr.Failed(i, err)
+	}
+	return batchErr
 }
 
 func (c *cassandraWriter) mapArgs(msg message.Batch, index int) ([]any, error) {
@@ -0,0 +1,159 @@
+package cassandra
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/internal/component/output"
+	"github.com/usedatabrew/benthos/v4/internal/manager/mock"
+	"github.com/usedatabrew/benthos/v4/internal/message"
+)
+
+func TestCassandraTTLQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+		first    bool
+		errs     bool
+	}{
+		{
+			query:    "INSERT INTO foo.bar (id, content) VALUES (?, ?)",
+			expected: "INSERT INTO foo.bar (id, content) VALUES (?, ?) USING TTL ?",
+		},
+		{
+			query:    "insert into foo.bar (id) values (?) if not exists;",
+			expected: "insert into foo.bar (id) values (?) if not exists USING TTL ?",
+		},
+		{
+			query:    "UPDATE foo.bar SET content = ? WHERE id = ?",
+			expected: "UPDATE foo.bar USING TTL ? SET content = ? WHERE id = ?",
+			first:    true,
+		},
+		{
+			query:    "INSERT INTO foo.bar (id, content) VALUES (?, 'using')",
+			expected: "INSERT INTO foo.bar (id, content) VALUES (?, 'using') USING TTL ?",
+		},
+		{
+			query: "INSERT INTO foo.bar (id) VALUES (?) USING TIMESTAMP 10",
+			errs:  true,
+		},
+		{
+			query: "DELETE FROM foo.bar WHERE id = ?",
+			errs:  true,
+		},
+	}
+
+	for _, test := range tests {
+		query, first, err := ttlQuery(test.query)
+		if test.errs {
+			assert.Error(t, err, test.query)
+			continue
+		}
+		require.NoError(t, err, test.query)
+		assert.Equal(t, test.expected, query)
+		assert.Equal(t, test.first, first, test.query)
+	}
+}
+
+func TestCassandraConditionalQuery(t *testing.T) {
+	assert.True(t, isConditionalQuery("INSERT INTO foo.bar (id) VALUES (?) IF NOT EXISTS"))
+	assert.True(t, isConditionalQuery("update foo.bar set a = ? where id = ? if a = ?"))
+	assert.False(t, isConditionalQuery("INSERT INTO foo.bar (id, content) VALUES (?, 'if')"))
+	assert.False(t, isConditionalQuery(`INSERT INTO foo.bar (id, "if") VALUES (?, ?)`))
+	assert.False(t, isConditionalQuery("INSERT INTO foo.diff (id) VALUES (?)"))
+}
+
+func TestCassandraBatchType(t *testing.T) {
+	for _, test := range []struct {
+		batchType string
+		logged    bool
+		expected  gocql.BatchType
+	}{
+		{batchType: "", logged: true, expected: gocql.LoggedBatch},
+		{batchType: "", logged: false, expected: gocql.UnloggedBatch},
+		{batchType: "UNLOGGED", logged: true, expected: gocql.UnloggedBatch},
+		{batchType: "counter", logged: true, expected: gocql.CounterBatch},
+		{batchType: "LOGGED", logged: false, expected: gocql.LoggedBatch},
+	} {
+		batchType, err := parseBatchType(test.batchType, test.logged)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, batchType, test.batchType)
+	}
+
+	_, err := parseBatchType("nope", true)
+	require.Error(t, err)
+}
+
+func TestCassandraWriterStatements(t *testing.T) {
+	conf := output.NewCassandraConfig()
+	conf.Query = "UPDATE foo.bar SET content = ? WHERE id = ?"
+	conf.ArgsMapping = `root = [ this.content, this.id ]`
+	conf.Consistency = `${! meta("consistency") }`
+	conf.TTL = `${! meta("ttl").or("") }`
+
+	w, err := newCassandraWriter(conf, mock.NewManager())
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATE foo.bar USING TTL ? SET content = ? WHERE id = ?", w.query)
+	assert.False(t, w.conditional)
+
+	msg := message.QuickBatch([][]byte{
+		[]byte(`{"id":"a","content":"foo"}`),
+		[]byte(`{"id":"b","content":"bar"}`),
+		[]byte(`{"id":"c","content":"baz"}`),
+	})
+	msg.Get(0).MetaSetMut("consistency", "ONE")
+	msg.Get(0).MetaSetMut("ttl", "1h")
+	msg.Get(1).MetaSetMut("consistency", "LOCAL_QUORUM")
+	msg.Get(2).MetaSetMut("consistency", "ONE")
+	msg.Get(2).MetaSetMut("ttl", "90s")
+
+	var stmts []cassandraStatement
+	for i := 0; i < msg.Len(); i++ {
+		stmt, err := w.statement(msg, i)
+		require.NoError(t, err)
+		stmts = append(stmts, stmt)
+	}
+
+	assert.Equal(t, gocql.One, stmts[0].consistency)
+	assert.Equal(t, gocql.LocalQuorum, stmts[1].consistency)
+	assert.Equal(t, 3600, stmts[0].values[0])
+	assert.Equal(t, 0, stmts[1].values[0])
+	assert.Equal(t, 90, stmts[2].values[0])
+	assert.Len(t, stmts[0].values, 3)
+
+	groups := w.groupStatements(nil, stmts)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []int{0, 2}, []int{groups[0][0].index, groups[0][1].index})
+	assert.Equal(t, 1, groups[1][0].index)
+
+	msg.Get(1).MetaSetMut("consistency", "NOPE")
+	_, err = w.statement(msg, 1)
+	require.Error(t, err)
+}
+
+func TestCassandraWriterConfigErrors(t *testing.T) {
+	conf := output.NewCassandraConfig()
+	conf.Query = "DELETE FROM foo.bar WHERE id = ?"
+	conf.TTL = "1h"
+	_, err := newCassandraWriter(conf, mock.NewManager())
+	require.Error(t, err)
+
+	conf = output.NewCassandraConfig()
+	conf.Consistency = "NOPE"
+	_, err = newCassandraWriter(conf, mock.NewManager())
+	require.Error(t, err)
+
+	conf = output.NewCassandraConfig()
+	conf.LWTNotApplied = "ignore"
+	_, err = newCassandraWriter(conf, mock.NewManager())
+	require.Error(t, err)
+
+	conf = output.NewCassandraConfig()
+	conf.Query = "INSERT INTO foo.bar (id) VALUES (?) IF NOT EXISTS"
+	w, err := newCassandraWriter(conf, mock.NewManager())
+	require.NoError(t, err)
+	assert.True(t, w.conditional)
+}
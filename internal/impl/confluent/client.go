@@ -74,7 +74,7 @@ type SchemaReference struct {
 func (c *schemaRegistryClient) GetSchemaByID(ctx context.Context, id int) (resPayload SchemaInfo, err error) {
 	var resCode int
 	var resBody []byte
-	if resCode, resBody, err = c.doRequest(ctx, "GET", fmt.Sprintf("/schemas/ids/%v", id)); err != nil {
+	if resCode, resBody, err = c.doRequest(ctx, "GET", fmt.Sprintf("/schemas/ids/%v", id), nil); err != nil {
 		err = fmt.Errorf("request failed for schema '%v': %v", id, err)
 		c.mgr.Logger().Errorf(err.Error())
 		return
@@ -109,7 +109,7 @@ func (c *schemaRegistryClient) GetSchemaBySubjectAndVersion(ctx context.Context,
 
 	var resCode int
 	var resBody []byte
-	if resCode, resBody, err = c.doRequest(ctx, "GET", path); err != nil {
+	if resCode, resBody, err = c.doRequest(ctx, "GET", path, nil); err != nil {
 		err = fmt.Errorf("request failed for schema subject '%v': %v", subject, err)
 		c.mgr.Logger().Errorf(err.Error())
 		return
@@ -134,6 +134,88 @@ func (c *schemaRegistryClient) GetSchemaBySubjectAndVersion(ctx context.Context,
 	return
 }
 
+type schemaRequest struct {
+	Schema     string            `json:"schema"`
+	Type       string            `json:"schemaType,omitempty"`
+	References []SchemaReference `json:"references,omitempty"`
+}
+
+func newSchemaRequest(info SchemaInfo) ([]byte, error) {
+	return json.Marshal(schemaRequest{
+		Schema:     info.Schema,
+		Type:       info.Type,
+		References: info.References,
+	})
+}
+
+// CreateSchema registers a schema under a subject, returning the ID of the
+// schema. Registering a schema that is already registered under the subject
+// returns the ID of the existing schema.
+func (c *schemaRegistryClient) CreateSchema(ctx context.Context, subject string, info SchemaInfo) (id int, err error) {
+	var reqBody []byte
+	if reqBody, err = newSchemaRequest(info); err != nil {
+		return
+	}
+
+	var resCode int
+	var resBody []byte
+	if resCode, resBody, err = c.doRequest(ctx, "POST", fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject)), reqBody); err != nil {
+		err = fmt.Errorf("request failed to register schema under subject '%v': %v", subject, err)
+		c.mgr.Logger().Errorf(err.Error())
+		return
+	}
+
+	if resCode == http.StatusNotFound {
+		err = fmt.Errorf("schema subject '%v' could not be registered", subject)
+		c.mgr.Logger().Errorf(err.Error())
+		return
+	}
+
+	var resPayload struct {
+		ID int `json:"id"`
+	}
+	if err = json.Unmarshal(resBody, &resPayload); err != nil {
+		c.mgr.Logger().Errorf("failed to parse response for schema subject '%v' registration: %v", subject, err)
+		return
+	}
+	return resPayload.ID, nil
+}
+
+// LookupSchema obtains the schema info of a schema already registered under a
+// subject.
+func (c *schemaRegistryClient) LookupSchema(ctx context.Context, subject string, info SchemaInfo) (resPayload SchemaInfo, err error) {
+	var reqBody []byte
+	if reqBody, err = newSchemaRequest(info); err != nil {
+		return
+	}
+
+	var resCode int
+	var resBody []byte
+	if resCode, resBody, err = c.doRequest(ctx, "POST", fmt.Sprintf("/subjects/%s", url.PathEscape(subject)), reqBody); err != nil {
+		err = fmt.Errorf("request failed to look up schema under subject '%v': %v", subject, err)
+		c.mgr.Logger().Errorf(err.Error())
+		return
+	}
+
+	if resCode == http.StatusNotFound {
+		err = fmt.Errorf("schema not registered under subject '%v'", subject)
+		c.mgr.Logger().Errorf(err.Error())
+		return
+	}
+
+	if len(resBody) == 0 {
+		c.mgr.Logger().Errorf("request to look up schema under subject '%v' returned an empty body", subject)
+		err = errors.New("schema request returned an empty body")
+		return
+	}
+
+	if err = json.Unmarshal(resBody, &resPayload); err != nil {
+		c.mgr.Logger().Errorf("failed to parse response for schema subject '%v': %v", subject, err)
+		return
+	}
+	return
+}
+
 type RefWalkFn func(ctx context.Context, name string, info SchemaInfo) error
 
 // For each reference provided the schema info is obtained and the provided
@@ -169,20 +251,16 @@ func (c *schemaRegistryClient) walkReferencesTracked(ctx context.Context, seen m
 	return nil
 }
 
-func (c *schemaRegistryClient) doRequest(ctx context.Context, verb, reqPath string) (resCode int, resBody []byte, err error) {
+func (c *schemaRegistryClient) doRequest(ctx context.Context, verb, reqPath string, reqBody []byte) (resCode int, resBody []byte, err error) {
 	reqURL := *c.schemaRegistryBaseURL
 	reqURL.Path = path.Join(reqURL.Path, reqPath)
 
-	var req *http.Request
-	if req, err = http.NewRequestWithContext(ctx, verb, reqURL.String(), http.NoBody); err != nil {
-		return
-	}
-	req.Header.Add("Accept", "application/vnd.schemaregistry.v1+json")
-	if err = c.requestSigner(c.mgr.FS(), req); err != nil {
-		return
-	}
-
 	for i := 0; i < 3; i++ {
+		var req *http.Request
+		if req, err = c.newRequest(ctx, verb, reqURL.String(), reqBody); err != nil {
+			return
+		}
+
 		var res *http.Response
 		if res, err = c.client.Do(req); err != nil {
 			c.mgr.Logger().Errorf("request failed: %v", err)
@@ -212,3 +290,23 @@ func (c *schemaRegistryClient) doRequest(ctx context.Context, verb, reqPath stri
 	}
 	return
 }
+
+func (c *schemaRegistryClient) newRequest(ctx context.Context, verb, reqURL string, reqBody []byte) (*http.Request, error) {
+	var body io.Reader = http.NoBody
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, verb, reqURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/vnd.schemaregistry.v1+json")
+	if reqBody != nil {
+		req.Header.Add("Content-Type", "application/vnd.schemaregistry.v1+json")
+	}
+	if err := c.requestSigner(c.mgr.FS(), req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
@@ -305,17 +305,7 @@ func (s *schemaRegistryEncoder) getLatestEncoder(subject string) (schemaEncoder,
 
 	s.logger.Tracef("Loaded new codec for subject %v: %s", subject, resPayload.Schema)
 
-	var encoder schemaEncoder
-	switch resPayload.Type {
-	case "PROTOBUF":
-		encoder, err = s.getProtobufEncoder(ctx, resPayload)
-	case "", "AVRO":
-		encoder, err = s.getAvroEncoder(ctx, resPayload)
-	case "JSON":
-		encoder, err = s.getJSONEncoder(ctx, resPayload)
-	default:
-		err = fmt.Errorf("schema type %v not supported", resPayload.Type)
-	}
+	encoder, err := s.getSchemaEncoder(ctx, resPayload)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -323,6 +313,18 @@ func (s *schemaRegistryEncoder) getLatestEncoder(subject string) (schemaEncoder,
 	return encoder, resPayload.ID, nil
 }
 
+func (s *schemaRegistryEncoder) getSchemaEncoder(ctx context.Context, info SchemaInfo) (schemaEncoder, error) {
+	switch info.Type {
+	case "PROTOBUF":
+		return s.getProtobufEncoder(ctx, info)
+	case "", "AVRO":
+		return s.getAvroEncoder(ctx, info)
+	case "JSON":
+		return s.getJSONEncoder(ctx, info)
+	}
+	return nil, fmt.Errorf("schema type %v not supported", info.Type)
+}
+
 func (s *schemaRegistryEncoder) getEncoder(subject string) (schemaEncoder, int, error) {
 	s.cacheMut.RLock()
 	c, ok := s.schemas[subject]
@@ -3,7 +3,9 @@ package confluent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/linkedin/goavro/v2"
 
@@ -121,3 +123,22 @@ func (s *schemaRegistryDecoder) getAvroDecoder(ctx context.Context, info SchemaI
 
 	return decoder, nil
 }
+
+// avroRecordName returns the full name of the named type defined by an Avro
+// schema.
+func avroRecordName(schema string) (string, error) {
+	var def struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	}
+	if err := json.Unmarshal([]byte(schema), &def); err != nil {
+		return "", fmt.Errorf("failed to parse schema as a named type: %w", err)
+	}
+	if def.Name == "" {
+		return "", errors.New("schema does not define a named type")
+	}
+	if def.Namespace == "" || strings.Contains(def.Name, ".") {
+		return def.Name, nil
+	}
+	return def.Namespace + "." + def.Name, nil
+}
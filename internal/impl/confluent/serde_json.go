@@ -2,6 +2,8 @@ package confluent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/xeipuuv/gojsonschema"
@@ -64,3 +66,17 @@ func getJSONTranscoder(ctx context.Context, cl *schemaRegistryClient, info Schem
 		return nil
 	}, nil
 }
+
+// jsonRecordName returns the title of a JSON schema.
+func jsonRecordName(schema string) (string, error) {
+	var def struct {
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal([]byte(schema), &def); err != nil {
+		return "", fmt.Errorf("failed to parse json schema: %w", err)
+	}
+	if def.Title == "" {
+		return "", errors.New("json schema does not have a title")
+	}
+	return def.Title, nil
+}
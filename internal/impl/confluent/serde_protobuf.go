@@ -3,6 +3,7 @@ package confluent
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -309,3 +310,21 @@ func toMessageIndexes(descriptor protoreflect.Descriptor, count int) []int {
 		return append(msgIndexes, index)
 	}
 }
+
+// protobufRecordName returns the full name of the first message defined by a
+// protobuf schema.
+func protobufRecordName(schema string) (string, error) {
+	files, _, err := protobuf.RegistriesFromMap(map[string]string{".": schema})
+	if err != nil {
+		return "", fmt.Errorf("failed to parse proto schema: %v", err)
+	}
+
+	targetFile, err := files.FindFileByPath(".")
+	if err != nil {
+		return "", err
+	}
+	if targetFile.Messages().Len() == 0 {
+		return "", errors.New("proto schema does not define any messages")
+	}
+	return string(targetFile.Messages().Get(0).FullName()), nil
+}
@@ -0,0 +1,337 @@
+package confluent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/usedatabrew/benthos/v4/internal/httpclient"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	rsFieldURL                 = "url"
+	rsFieldRefreshPeriod       = "refresh_period"
+	rsFieldKey                 = "key"
+	rsFieldValue               = "value"
+	rsFieldTLS                 = "tls"
+	rsFieldEnabled             = "enabled"
+	rsFieldSubjectNameStrategy = "subject_name_strategy"
+	rsFieldRecordName          = "record_name"
+	rsFieldSchema              = "schema"
+	rsFieldSchemaType          = "schema_type"
+	rsFieldAutoRegister        = "auto_register"
+	rsFieldAvroRawJSON         = "avro_raw_json"
+)
+
+const (
+	subjectNameStrategyTopic       = "topic_name"
+	subjectNameStrategyRecord      = "record_name"
+	subjectNameStrategyTopicRecord = "topic_record_name"
+)
+
+func recordSerializerSideField(name, part string, enabled bool) *service.ConfigField {
+	return service.NewObjectField(name,
+		service.NewBoolField(rsFieldEnabled).
+			Description(fmt.Sprintf("Whether the %v of each record should be serialized.", part)).
+			Default(enabled),
+		service.NewStringAnnotatedEnumField(rsFieldSubjectNameStrategy, map[string]string{
+			subjectNameStrategyTopic:       fmt.Sprintf("The subject is the topic of the record suffixed with `-%v`.", name),
+			subjectNameStrategyRecord:      "The subject is the fully-qualified name of the record type.",
+			subjectNameStrategyTopicRecord: "The subject is the topic of the record and the fully-qualified name of the record type separated by `-`.",
+		}).
+			Description("The strategy used to determine the subject of the schema from the topic of each record.").
+			Default(subjectNameStrategyTopic),
+		service.NewStringField(rsFieldRecordName).
+			Description("The fully-qualified name of the record type, which is used by the subject name strategies `record_name` and `topic_record_name`. When a `schema` is specified the name is obtained from it by default: the full name of an Avro schema, the full name of the first message of a Protobuf schema, or the title of a JSON schema.").
+			Example("com.example.User").
+			Optional(),
+		service.NewStringField(rsFieldSchema).
+			Description("An optional schema to serialize with, which must already be registered under the subject unless `auto_register` is `true`. When omitted the latest schema registered under the subject is used.").
+			Optional(),
+		service.NewStringEnumField(rsFieldSchemaType, "AVRO", "PROTOBUF", "JSON").
+			Description("The type of the `schema`.").
+			Default("AVRO"),
+		service.NewBoolField(rsFieldAutoRegister).
+			Description("Whether the `schema` should be registered under the subject when it isn't already.").
+			Default(false),
+		service.NewBoolField(rsFieldAvroRawJSON).
+			Description("Whether documents serialized with Avro schemas are formatted as normal JSON rather than [Avro JSON](https://avro.apache.org/docs/current/specification/_print/#json-encoding).").
+			Advanced().
+			Default(false),
+	).Description(fmt.Sprintf("Determines how the %v of each record is serialized.", part))
+}
+
+// RecordSerializerField returns a config field for serializing the keys and
+// values of records written to Kafka with schemas from a Confluent Schema
+// Registry service.
+func RecordSerializerField(name string) *service.ConfigField {
+	fields := []*service.ConfigField{
+		service.NewURLField(rsFieldURL).Description("The base URL of the schema registry service."),
+		service.NewDurationField(rsFieldRefreshPeriod).
+			Description("The period after which the latest schema of a subject is refreshed, this is done by polling the schema registry service. This field is only relevant when a `schema` is not specified.").
+			Default("10m").
+			Advanced(),
+		recordSerializerSideField(rsFieldKey, "key", false),
+		recordSerializerSideField(rsFieldValue, "value", true),
+	}
+	fields = append(fields, httpclient.AuthFieldSpecs()...)
+	fields = append(fields, service.NewTLSField(rsFieldTLS))
+
+	return service.NewObjectField(name, fields...).
+		Description(`Serialize the keys and values of records with schemas from a [Confluent Schema Registry service](https://docs.confluent.io/platform/current/schema-registry/index.html), in the same format as the ` + "[`schema_registry_encode` processor](/docs/components/processors/schema_registry_encode)" + `.
+
+The subject of the schema of each record is determined by a subject name strategy, either from the topic of the record or the name of the record type. Schemas are either obtained from the latest version of the subject, or specified in the config, in which case they can be automatically registered under the subject. Empty keys are never serialized.`).
+		Example(map[string]any{
+			"url": "http://localhost:8081",
+			"value": map[string]any{
+				"subject_name_strategy": subjectNameStrategyTopicRecord,
+				"schema":                `{"type":"record","name":"User","namespace":"com.example","fields":[{"name":"name","type":"string"}]}`,
+				"auto_register":         true,
+			},
+		}).
+		Advanced().
+		Optional()
+}
+
+//------------------------------------------------------------------------------
+
+// RecordSerializer serializes the keys and values of records written to Kafka
+// with schemas from a Confluent Schema Registry service.
+type RecordSerializer struct {
+	key   *subjectSerializer
+	value *subjectSerializer
+}
+
+// RecordSerializerFromParsed creates a RecordSerializer from a parsed config
+// of a RecordSerializerField.
+func RecordSerializerFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (*RecordSerializer, error) {
+	urlStr, err := conf.FieldString(rsFieldURL)
+	if err != nil {
+		return nil, err
+	}
+	refreshPeriod, err := conf.FieldDuration(rsFieldRefreshPeriod)
+	if err != nil {
+		return nil, err
+	}
+	authSigner, err := httpclient.AuthSignerFromParsed(conf)
+	if err != nil {
+		return nil, err
+	}
+	tlsConf, err := conf.FieldTLS(rsFieldTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	newEncoder := func(avroRawJSON bool) (*schemaRegistryEncoder, error) {
+		refreshTicker := refreshPeriod / 10
+		if refreshTicker < time.Second {
+			refreshTicker = time.Second
+		}
+		return newSchemaRegistryEncoder(urlStr, authSigner, tlsConf, nil, avroRawJSON, refreshPeriod, refreshTicker, mgr)
+	}
+
+	r := &RecordSerializer{}
+	if r.key, err = subjectSerializerFromParsed(conf.Namespace(rsFieldKey), rsFieldKey, newEncoder); err != nil {
+		return nil, fmt.Errorf("key: %w", err)
+	}
+	if r.value, err = subjectSerializerFromParsed(conf.Namespace(rsFieldValue), rsFieldValue, newEncoder); err != nil {
+		return nil, fmt.Errorf("value: %w", err)
+	}
+	return r, nil
+}
+
+// SerializeKey serializes the key of a record written to a topic, the key is
+// returned unchanged when it is empty or key serialization is disabled.
+func (r *RecordSerializer) SerializeKey(ctx context.Context, topic string, key []byte) ([]byte, error) {
+	if r.key == nil || len(key) == 0 {
+		return key, nil
+	}
+	return r.key.serialize(ctx, topic, key)
+}
+
+// SerializeValue serializes the value of a record written to a topic, the
+// value is returned unchanged when value serialization is disabled.
+func (r *RecordSerializer) SerializeValue(ctx context.Context, topic string, value []byte) ([]byte, error) {
+	if r.value == nil {
+		return value, nil
+	}
+	return r.value.serialize(ctx, topic, value)
+}
+
+// Close stops the refreshing of schemas.
+func (r *RecordSerializer) Close(ctx context.Context) error {
+	for _, s := range []*subjectSerializer{r.key, r.value} {
+		if s == nil {
+			continue
+		}
+		if err := s.encoder.Close(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+type registeredSchemaEncoder struct {
+	id      int
+	encoder schemaEncoder
+}
+
+// subjectSerializer serializes either the keys or the values of records.
+type subjectSerializer struct {
+	encoder    *schemaRegistryEncoder
+	suffix     string
+	strategy   string
+	recordName string
+
+	// When a schema is specified it is registered, or looked up, once for each
+	// subject.
+	schema       *SchemaInfo
+	autoRegister bool
+	registered   map[string]registeredSchemaEncoder
+	regMut       sync.Mutex
+}
+
+func subjectSerializerFromParsed(
+	conf *service.ParsedConfig,
+	suffix string,
+	newEncoder func(avroRawJSON bool) (*schemaRegistryEncoder, error),
+) (*subjectSerializer, error) {
+	if enabled, err := conf.FieldBool(rsFieldEnabled); err != nil || !enabled {
+		return nil, err
+	}
+
+	s := &subjectSerializer{
+		suffix:     suffix,
+		registered: map[string]registeredSchemaEncoder{},
+	}
+
+	var err error
+	if s.strategy, err = conf.FieldString(rsFieldSubjectNameStrategy); err != nil {
+		return nil, err
+	}
+	if s.autoRegister, err = conf.FieldBool(rsFieldAutoRegister); err != nil {
+		return nil, err
+	}
+
+	if conf.Contains(rsFieldSchema) {
+		info := SchemaInfo{}
+		if info.Schema, err = conf.FieldString(rsFieldSchema); err != nil {
+			return nil, err
+		}
+		if info.Type, err = conf.FieldString(rsFieldSchemaType); err != nil {
+			return nil, err
+		}
+		s.schema = &info
+	} else if s.autoRegister {
+		return nil, errors.New("a schema must be specified in order to auto register it")
+	}
+
+	if conf.Contains(rsFieldRecordName) {
+		if s.recordName, err = conf.FieldString(rsFieldRecordName); err != nil {
+			return nil, err
+		}
+	}
+	if s.strategy != subjectNameStrategyTopic && s.recordName == "" {
+		if s.schema == nil {
+			return nil, fmt.Errorf("either a record_name or a schema must be specified with the subject name strategy %v", s.strategy)
+		}
+		if s.recordName, err = recordNameFromSchema(*s.schema); err != nil {
+			return nil, fmt.Errorf("failed to obtain record name from schema: %w", err)
+		}
+	}
+
+	avroRawJSON, err := conf.FieldBool(rsFieldAvroRawJSON)
+	if err != nil {
+		return nil, err
+	}
+	if s.encoder, err = newEncoder(avroRawJSON); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func recordNameFromSchema(info SchemaInfo) (string, error) {
+	switch info.Type {
+	case "PROTOBUF":
+		return protobufRecordName(info.Schema)
+	case "", "AVRO":
+		return avroRecordName(info.Schema)
+	case "JSON":
+		return jsonRecordName(info.Schema)
+	}
+	return "", fmt.Errorf("schema type %v not supported", info.Type)
+}
+
+func (s *subjectSerializer) subject(topic string) string {
+	switch s.strategy {
+	case subjectNameStrategyRecord:
+		return s.recordName
+	case subjectNameStrategyTopicRecord:
+		return topic + "-" + s.recordName
+	}
+	return topic + "-" + s.suffix
+}
+
+func (s *subjectSerializer) getRegisteredEncoder(ctx context.Context, subject string) (schemaEncoder, int, error) {
+	s.regMut.Lock()
+	defer s.regMut.Unlock()
+
+	if r, exists := s.registered[subject]; exists {
+		return r.encoder, r.id, nil
+	}
+
+	info := *s.schema
+	if s.autoRegister {
+		id, err := s.encoder.client.CreateSchema(ctx, subject, info)
+		if err != nil {
+			return nil, 0, err
+		}
+		info.ID = id
+	} else {
+		regInfo, err := s.encoder.client.LookupSchema(ctx, subject, info)
+		if err != nil {
+			return nil, 0, err
+		}
+		info.ID = regInfo.ID
+	}
+
+	encoder, err := s.encoder.getSchemaEncoder(ctx, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.registered[subject] = registeredSchemaEncoder{id: info.ID, encoder: encoder}
+	return encoder, info.ID, nil
+}
+
+func (s *subjectSerializer) serialize(ctx context.Context, topic string, data []byte) ([]byte, error) {
+	subject := s.subject(topic)
+
+	var encoder schemaEncoder
+	var id int
+	var err error
+	if s.schema != nil {
+		encoder, id, err = s.getRegisteredEncoder(ctx, subject)
+	} else {
+		encoder, id, err = s.encoder.getEncoder(subject)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg := service.NewMessage(data)
+	if err := encoder(msg); err != nil {
+		return nil, err
+	}
+
+	rawBytes, err := msg.AsBytes()
+	if err != nil {
+		return nil, errors.New("unable to reference encoded message as bytes")
+	}
+	return insertID(id, rawBytes)
+}
@@ -0,0 +1,256 @@
+package confluent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+type testRegistryRequest struct {
+	method string
+	path   string
+	body   schemaRequest
+}
+
+func runSchemaRegistryRequestServer(t testing.TB, fn func(req testRegistryRequest) ([]byte, error)) string {
+	t.Helper()
+
+	var reqMut sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqMut.Lock()
+		defer reqMut.Unlock()
+
+		req := testRegistryRequest{method: r.Method, path: r.URL.Path}
+		if r.Method == "POST" {
+			b, err := io.ReadAll(r.Body)
+			if err == nil {
+				err = json.Unmarshal(b, &req.body)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		b, err := fn(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(b) == 0 {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts.URL
+}
+
+func testRecordSerializer(t testing.TB, urlStr, conf string) *RecordSerializer {
+	t.Helper()
+
+	spec := service.NewConfigSpec().Field(RecordSerializerField("schema_registry"))
+	pConf, err := spec.ParseYAML(`
+schema_registry:
+  url: `+urlStr+`
+`+conf, nil)
+	require.NoError(t, err)
+
+	r, err := RecordSerializerFromParsed(pConf.Namespace("schema_registry"), service.MockResources())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, r.Close(context.Background()))
+	})
+	return r
+}
+
+func TestRecordSerializerConfigErrors(t *testing.T) {
+	spec := service.NewConfigSpec().Field(RecordSerializerField("schema_registry"))
+
+	for _, test := range []struct {
+		name string
+		conf string
+		errs string
+	}{
+		{
+			name: "auto register without schema",
+			conf: `
+schema_registry:
+  url: http://localhost:8081
+  value:
+    auto_register: true
+`,
+			errs: "value: a schema must be specified in order to auto register it",
+		},
+		{
+			name: "record name strategy without record name",
+			conf: `
+schema_registry:
+  url: http://localhost:8081
+  key:
+    enabled: true
+    subject_name_strategy: record_name
+`,
+			errs: "key: either a record_name or a schema must be specified",
+		},
+		{
+			name: "record name strategy with unnamed schema",
+			conf: `
+schema_registry:
+  url: http://localhost:8081
+  value:
+    subject_name_strategy: topic_record_name
+    schema: '"string"'
+`,
+			errs: "failed to obtain record name from schema",
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pConf, err := spec.ParseYAML(test.conf, nil)
+			require.NoError(t, err)
+
+			_, err = RecordSerializerFromParsed(pConf.Namespace("schema_registry"), service.MockResources())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errs)
+		})
+	}
+}
+
+func TestRecordNameFromSchema(t *testing.T) {
+	for _, test := range []struct {
+		info     SchemaInfo
+		expected string
+	}{
+		{info: SchemaInfo{Schema: testSchema}, expected: "foo.namespace.com.identity"},
+		{info: SchemaInfo{Type: "AVRO", Schema: `{"type":"record","name":"a.b.c","namespace":"d","fields":[]}`}, expected: "a.b.c"},
+		{info: SchemaInfo{Type: "PROTOBUF", Schema: testProtoSchema}, expected: "ksql.users"},
+		{info: SchemaInfo{Type: "JSON", Schema: `{"title":"Identity","type":"object"}`}, expected: "Identity"},
+	} {
+		name, err := recordNameFromSchema(test.info)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, name)
+	}
+}
+
+func TestRecordSerializerLatestSchema(t *testing.T) {
+	latest := mustJBytes(t, map[string]any{"id": 3, "schema": testSchema})
+	urlStr := runSchemaRegistryRequestServer(t, func(req testRegistryRequest) ([]byte, error) {
+		if req.method == "GET" && req.path == "/subjects/foo-value/versions/latest" {
+			return latest, nil
+		}
+		return nil, nil
+	})
+
+	r := testRecordSerializer(t, urlStr, "")
+
+	value, err := r.SerializeValue(context.Background(), "foo", []byte(`{"Name":"foo","MaybeHobby":null}`))
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\x00\x00\x00\x03\x06foo\x00\x00", string(value))
+
+	// Keys are not serialized by default.
+	key, err := r.SerializeKey(context.Background(), "foo", []byte("bar"))
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(key))
+
+	_, err = r.SerializeValue(context.Background(), "bar", []byte(`{"Name":"foo","MaybeHobby":null}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "schema subject 'bar-value' not found by registry")
+}
+
+func TestRecordSerializerAutoRegister(t *testing.T) {
+	var registered []string
+	urlStr := runSchemaRegistryRequestServer(t, func(req testRegistryRequest) ([]byte, error) {
+		if req.method != "POST" {
+			return nil, nil
+		}
+		switch req.path {
+		case "/subjects/foo-foo.namespace.com.identity/versions":
+			assert.Equal(t, testSchema, req.body.Schema)
+			assert.Equal(t, "AVRO", req.body.Type)
+		case "/subjects/foo-key/versions":
+			assert.Equal(t, testJSONSchema, req.body.Schema)
+			assert.Equal(t, "JSON", req.body.Type)
+		default:
+			return nil, nil
+		}
+		registered = append(registered, req.path)
+		return mustJBytes(t, map[string]any{"id": 4}), nil
+	})
+
+	r := testRecordSerializer(t, urlStr, `
+  key:
+    enabled: true
+    schema: `+strconv.Quote(testJSONSchema)+`
+    schema_type: JSON
+    auto_register: true
+  value:
+    subject_name_strategy: topic_record_name
+    schema: `+strconv.Quote(testSchema)+`
+    auto_register: true
+`)
+
+	for i := 0; i < 2; i++ {
+		value, err := r.SerializeValue(context.Background(), "foo", []byte(`{"Name":"foo","MaybeHobby":null}`))
+		require.NoError(t, err)
+		assert.Equal(t, "\x00\x00\x00\x00\x04\x06foo\x00\x00", string(value))
+
+		key, err := r.SerializeKey(context.Background(), "foo", []byte(`{"Name":"foo"}`))
+		require.NoError(t, err)
+		assert.Equal(t, "\x00\x00\x00\x00\x04"+`{"Name":"foo"}`, string(key))
+	}
+
+	_, err := r.SerializeKey(context.Background(), "foo", []byte(`{"Address":"nope"}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "json message does not conform to schema")
+
+	// Empty keys are not serialized.
+	key, err := r.SerializeKey(context.Background(), "foo", nil)
+	require.NoError(t, err)
+	assert.Empty(t, key)
+
+	// Schemas are only registered once per subject.
+	assert.Equal(t, []string{
+		"/subjects/foo-foo.namespace.com.identity/versions",
+		"/subjects/foo-key/versions",
+	}, registered)
+}
+
+func TestRecordSerializerLookupSchema(t *testing.T) {
+	urlStr := runSchemaRegistryRequestServer(t, func(req testRegistryRequest) ([]byte, error) {
+		if req.method == "POST" && req.path == "/subjects/ksql.users" {
+			assert.Equal(t, testProtoSchema, req.body.Schema)
+			assert.Equal(t, "PROTOBUF", req.body.Type)
+			return mustJBytes(t, map[string]any{
+				"subject": "ksql.users",
+				"id":      5,
+				"version": 1,
+				"schema":  testProtoSchema,
+			}), nil
+		}
+		return nil, nil
+	})
+
+	r := testRecordSerializer(t, urlStr, `
+  value:
+    subject_name_strategy: record_name
+    schema: `+strconv.Quote(testProtoSchema)+`
+    schema_type: PROTOBUF
+`)
+
+	value, err := r.SerializeValue(context.Background(), "foo", []byte(`{"userid":"foo"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\x00\x00\x00\x05\x00\x12\x03foo", string(value))
+}
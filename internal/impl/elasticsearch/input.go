@@ -0,0 +1,633 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+
+	"github.com/usedatabrew/benthos/v4/internal/httpclient"
+	"github.com/usedatabrew/benthos/v4/internal/shutdown"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	esiFieldIndex               = "index"
+	esiFieldQuery               = "query"
+	esiFieldBatchSize           = "batch_size"
+	esiFieldMode                = "mode"
+	esiFieldKeepAlive           = "keep_alive"
+	esiFieldSlices              = "slices"
+	esiFieldTail                = "tail"
+	esiFieldTailTimestampField  = "timestamp_field"
+	esiFieldTailTiebreakerField = "tiebreaker_field"
+	esiFieldTailInterval        = "interval"
+
+	esiModeAuto        = "auto"
+	esiModePointInTime = "point_in_time"
+	esiModeScroll      = "scroll"
+)
+
+// InputSpec returns the config spec for an elasticsearch input.
+func InputSpec() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Services").
+		Summary(`Executes a query against Elasticsearch or OpenSearch indexes and creates a message for each document matched.`).
+		Description(`
+Documents are read page by page using a [point in time](https://www.elastic.co/guide/en/elasticsearch/reference/current/point-in-time-api.html) and `+"`search_after`"+`, which provides a consistent view of the indexes for the duration of the read. When the cluster does not support points in time, such as Elasticsearch versions prior to 7.12 and OpenSearch, the input falls back to the scroll API. Once all documents have been read this input shuts down, allowing the pipeline to gracefully terminate (or the next input in a [sequence](/docs/components/inputs/sequence) to execute).
+
+Large indexes can be read faster by setting `+"`slices`"+`, which splits the read into multiple [slices](https://www.elastic.co/guide/en/elasticsearch/reference/current/paginate-search-results.html#slice-scroll) that are read concurrently and merged into the stream in no particular order.
+
+Alternatively, when the field `+"`tail`"+` is set the input runs indefinitely, reading documents in order of a timestamp field and polling for documents added after the last document read.
+
+### Metadata
+
+This input adds the following metadata fields to each message:
+
+`+"```text"+`
+- elasticsearch_index
+- elasticsearch_id
+`+"```"+`
+
+You can access these metadata fields using [function interpolation](/docs/configuration/interpolation#bloblang-queries).`).
+		Fields(
+			service.NewStringListField(esoFieldURLs).
+				Description("A list of URLs to connect to. If an item of the list contains commas it will be expanded into multiple URLs.").
+				Example([]string{"http://localhost:9200"}),
+			service.NewStringListField(esiFieldIndex).
+				Description("A list of indexes to read from, which may contain wildcards.").
+				Example([]string{"logs-*"}),
+			service.NewStringField(esiFieldQuery).
+				Description("A [query](https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl.html) in JSON format selecting the documents to read.").
+				Example(`{"range":{"@timestamp":{"gte":"now-1d/d"}}}`).
+				Default(`{"match_all":{}}`),
+			service.NewIntField(esiFieldBatchSize).
+				Description("The maximum number of documents requested by each search.").
+				Default(1000),
+			service.NewStringAnnotatedEnumField(esiFieldMode, map[string]string{
+				esiModeAuto:        "Read with a point in time, falling back to the scroll API when points in time are not supported by the cluster.",
+				esiModePointInTime: "Read with a point in time and `search_after`, which requires Elasticsearch 7.12 or later.",
+				esiModeScroll:      "Read with the scroll API.",
+			}).
+				Description("The mechanism used to read documents, this field is ignored when `tail` is set.").
+				Default(esiModeAuto).
+				Advanced(),
+			service.NewStringField(esiFieldKeepAlive).
+				Description("The period for which the point in time or scroll context is kept alive between searches.").
+				Default("1m").
+				Advanced(),
+			service.NewIntField(esiFieldSlices).
+				Description("The number of slices the read is split into, each of which is read concurrently. This field is ignored when `tail` is set.").
+				Default(1),
+			service.NewObjectField(esiFieldTail,
+				service.NewStringField(esiFieldTailTimestampField).
+					Description("A field containing the time documents were added, documents are read in ascending order of this field and only documents following the last document read are selected by subsequent searches.").
+					Example("@timestamp"),
+				service.NewStringField(esiFieldTailTiebreakerField).
+					Description("An optional field with a unique value for each document, such as a keyword identifier, used to order documents sharing the same timestamp. This should be set when timestamps are not unique, otherwise documents sharing the timestamp of the last document of a page may be skipped.").
+					Default(""),
+				service.NewDurationField(esiFieldTailInterval).
+					Description("The period to wait before searching for new documents once all existing documents have been read.").
+					Default("10s"),
+			).
+				Description("When set the input runs indefinitely, reading documents in order of a timestamp field and periodically searching for new documents. Documents indexed with a timestamp earlier than that of documents already read are not selected.").
+				Optional(),
+			service.NewBoolField(esoFieldSniff).
+				Description("Prompts Benthos to sniff for brokers to connect to when establishing a connection.").
+				Advanced().
+				Default(true),
+			service.NewBoolField(esoFieldHealthcheck).
+				Description("Whether to enable healthchecks.").
+				Advanced().
+				Default(true),
+			service.NewDurationField(esoFieldTimeout).
+				Description("The maximum time to wait before abandoning a request (and trying again).").
+				Advanced().
+				Default("30s"),
+			service.NewTLSToggledField(esoFieldTLS),
+			httpclient.BasicAuthField(),
+			AWSField(),
+			service.NewBoolField(esoFieldGzipCompression).
+				Description("Enable gzip compression on the request side.").
+				Advanced().
+				Default(false),
+		).
+		Example("Reindex Between Clusters", `
+Here we copy all documents of an index from one cluster into another, reading with four concurrent slices and keeping the document identifiers:`, `
+input:
+  elasticsearch:
+    urls: [ http://old-cluster:9200 ]
+    index: [ products ]
+    slices: 4
+
+output:
+  elasticsearch:
+    urls: [ http://new-cluster:9200 ]
+    index: products
+    id: ${! @elasticsearch_id }
+`).
+		Example("Tail an Index", `
+Here we continuously read log documents as they are added, ordered by their timestamp with a unique event identifier breaking ties:`, `
+input:
+  elasticsearch:
+    urls: [ http://localhost:9200 ]
+    index: [ logs-* ]
+    query: '{"term":{"level":"error"}}'
+    tail:
+      timestamp_field: '@timestamp'
+      tiebreaker_field: event.id
+      interval: 30s
+`)
+}
+
+func init() {
+	err := service.RegisterInput("elasticsearch", InputSpec(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+			i, err := InputFromParsed(conf, mgr)
+			if err != nil {
+				return nil, err
+			}
+			return service.AutoRetryNacks(i), nil
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type esiTailConfig struct {
+	timestampField  string
+	tiebreakerField string
+	interval        time.Duration
+}
+
+type esiConfig struct {
+	urls       []string
+	clientOpts []elastic.ClientOptionFunc
+
+	indexes   []string
+	query     json.RawMessage
+	batchSize int
+	mode      string
+	keepAlive string
+	slices    int
+	tail      *esiTailConfig
+}
+
+func esiConfigFromParsed(pConf *service.ParsedConfig) (conf esiConfig, err error) {
+	if conf.urls, conf.clientOpts, err = clientOptsFromParsed(pConf); err != nil {
+		return
+	}
+	conf.clientOpts = append(conf.clientOpts, elastic.SetDecoder(&elastic.NumberDecoder{}))
+
+	var indexes []string
+	if indexes, err = pConf.FieldStringList(esiFieldIndex); err != nil {
+		return
+	}
+	for _, i := range indexes {
+		for _, splitIndex := range strings.Split(i, ",") {
+			if len(splitIndex) > 0 {
+				conf.indexes = append(conf.indexes, splitIndex)
+			}
+		}
+	}
+	if len(conf.indexes) == 0 {
+		err = errors.New("at least one index must be specified")
+		return
+	}
+
+	var queryStr string
+	if queryStr, err = pConf.FieldString(esiFieldQuery); err != nil {
+		return
+	}
+	if !json.Valid([]byte(queryStr)) {
+		err = fmt.Errorf("query is not valid JSON: %v", queryStr)
+		return
+	}
+	conf.query = json.RawMessage(queryStr)
+
+	if conf.batchSize, err = pConf.FieldInt(esiFieldBatchSize); err != nil {
+		return
+	}
+	if conf.batchSize < 1 {
+		err = fmt.Errorf("batch size must be at least 1, got %v", conf.batchSize)
+		return
+	}
+	if conf.mode, err = pConf.FieldString(esiFieldMode); err != nil {
+		return
+	}
+	if conf.keepAlive, err = pConf.FieldString(esiFieldKeepAlive); err != nil {
+		return
+	}
+	if conf.slices, err = pConf.FieldInt(esiFieldSlices); err != nil {
+		return
+	}
+	if conf.slices < 1 {
+		err = fmt.Errorf("slices must be at least 1, got %v", conf.slices)
+		return
+	}
+
+	if pConf.Contains(esiFieldTail) {
+		tConf := pConf.Namespace(esiFieldTail)
+		conf.tail = &esiTailConfig{}
+		if conf.tail.timestampField, err = tConf.FieldString(esiFieldTailTimestampField); err != nil {
+			return
+		}
+		if conf.tail.tiebreakerField, err = tConf.FieldString(esiFieldTailTiebreakerField); err != nil {
+			return
+		}
+		if conf.tail.interval, err = tConf.FieldDuration(esiFieldTailInterval); err != nil {
+			return
+		}
+	}
+	return
+}
+
+//------------------------------------------------------------------------------
+
+type esiHit struct {
+	hit *elastic.SearchHit
+	err error
+}
+
+// Input implements service.Input for elasticsearch.
+type Input struct {
+	log  *service.Logger
+	conf esiConfig
+
+	clientMut sync.Mutex
+	client    *elastic.Client
+	hits      chan esiHit
+	readersWG sync.WaitGroup
+
+	pitMut sync.Mutex
+	pitID  string
+
+	shutSig *shutdown.Signaller
+}
+
+// InputFromParsed returns an elasticsearch input from a parsed config.
+func InputFromParsed(pConf *service.ParsedConfig, mgr *service.Resources) (*Input, error) {
+	conf, err := esiConfigFromParsed(pConf)
+	if err != nil {
+		return nil, err
+	}
+	return &Input{
+		log:     mgr.Logger(),
+		conf:    conf,
+		shutSig: shutdown.NewSignaller(),
+	}, nil
+}
+
+//------------------------------------------------------------------------------
+
+func (e *Input) Connect(ctx context.Context) error {
+	e.clientMut.Lock()
+	defer e.clientMut.Unlock()
+
+	if e.client != nil {
+		return nil
+	}
+
+	client, err := elastic.NewClient(e.conf.clientOpts...)
+	if err != nil {
+		return err
+	}
+
+	var readers []func(ctx context.Context) error
+	switch {
+	case e.conf.tail != nil:
+		readers = append(readers, func(ctx context.Context) error {
+			return e.readTail(ctx, client)
+		})
+	case e.conf.mode != esiModeScroll:
+		supported, err := pointInTimeSupported(ctx, client)
+		if err != nil {
+			client.Stop()
+			return fmt.Errorf("failed to obtain cluster version: %w", err)
+		}
+		if !supported {
+			if e.conf.mode == esiModePointInTime {
+				client.Stop()
+				return errors.New("reading with a point in time requires Elasticsearch 7.12 or later")
+			}
+			e.log.Infof("Reading with the scroll API as points in time are not supported by the cluster")
+		} else {
+			res, err := client.OpenPointInTime(e.conf.indexes...).KeepAlive(e.conf.keepAlive).Do(ctx)
+			if err == nil {
+				e.pitID = res.Id
+				for i := 0; i < e.conf.slices; i++ {
+					slice := i
+					readers = append(readers, func(ctx context.Context) error {
+						return e.readPointInTime(ctx, client, slice)
+					})
+				}
+				break
+			}
+			if e.conf.mode == esiModePointInTime || !isUnsupportedErr(err) {
+				client.Stop()
+				return fmt.Errorf("failed to open point in time: %w", err)
+			}
+			e.log.Warnf("Falling back to the scroll API as a point in time could not be opened: %v", err)
+		}
+		fallthrough
+	default:
+		for i := 0; i < e.conf.slices; i++ {
+			slice := i
+			readers = append(readers, func(ctx context.Context) error {
+				return e.readScroll(ctx, client, slice)
+			})
+		}
+	}
+
+	e.client = client
+	e.hits = make(chan esiHit)
+
+	readCtx, done := e.shutSig.CloseNowCtx(context.Background())
+	for _, r := range readers {
+		r := r
+		e.readersWG.Add(1)
+		go func() {
+			defer e.readersWG.Done()
+			if err := r(readCtx); err != nil && readCtx.Err() == nil {
+				e.log.Errorf("Failed to read documents: %v", err)
+			}
+		}()
+	}
+
+	go func() {
+		e.readersWG.Wait()
+		done()
+		close(e.hits)
+		e.closePointInTime(client)
+
+		<-e.shutSig.CloseNowChan()
+		client.Stop()
+		e.shutSig.ShutdownComplete()
+	}()
+
+	e.log.Infof("Reading documents from Elasticsearch indexes %v at urls: %s", e.conf.indexes, e.conf.urls)
+	return nil
+}
+
+// pointInTimeSupported returns whether a cluster supports reading with a point
+// in time sorted by `_shard_doc`, which was added in Elasticsearch 7.12 and is
+// not supported by OpenSearch.
+func pointInTimeSupported(ctx context.Context, client *elastic.Client) (bool, error) {
+	res, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodGet,
+		Path:   "/",
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var info struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(res.Body, &info); err != nil {
+		return false, err
+	}
+	if info.Version.Distribution == "opensearch" {
+		return false, nil
+	}
+
+	var major, minor int
+	if _, err := fmt.Sscanf(info.Version.Number, "%d.%d", &major, &minor); err != nil {
+		return false, fmt.Errorf("failed to parse version %q: %w", info.Version.Number, err)
+	}
+	return major > 7 || (major == 7 && minor >= 12), nil
+}
+
+// isUnsupportedErr returns whether an error indicates that the point in time
+// API is not supported by a cluster.
+func isUnsupportedErr(err error) bool {
+	return elastic.IsStatusCode(err, http.StatusNotFound) || elastic.IsStatusCode(err, http.StatusBadRequest)
+}
+
+func (e *Input) closePointInTime(client *elastic.Client) {
+	e.pitMut.Lock()
+	pitID := e.pitID
+	e.pitID = ""
+	e.pitMut.Unlock()
+	if pitID == "" {
+		return
+	}
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*10)
+	defer done()
+	if _, err := client.ClosePointInTime(pitID).Do(ctx); err != nil {
+		e.log.Warnf("Failed to close point in time: %v", err)
+	}
+}
+
+// searchBody returns the body of a search request for a page of documents.
+func (e *Input) searchBody(sort []any, slice int) map[string]any {
+	body := map[string]any{
+		"query":            e.conf.query,
+		"size":             e.conf.batchSize,
+		"sort":             sort,
+		"track_total_hits": false,
+	}
+	if e.conf.slices > 1 && e.conf.tail == nil {
+		body["slice"] = map[string]any{
+			"id":  slice,
+			"max": e.conf.slices,
+		}
+	}
+	return body
+}
+
+// send a hit to be read, returning false if the input is closing.
+func (e *Input) send(ctx context.Context, h esiHit) bool {
+	select {
+	case e.hits <- h:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryWait reports a failed search and waits before it is retried, returning
+// false if the input is closing.
+func (e *Input) retryWait(ctx context.Context, err error) bool {
+	if !e.send(ctx, esiHit{err: err}) {
+		return false
+	}
+	select {
+	case <-time.After(time.Second):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (e *Input) readPointInTime(ctx context.Context, client *elastic.Client, slice int) error {
+	var searchAfter []any
+	for {
+		e.pitMut.Lock()
+		pitID := e.pitID
+		e.pitMut.Unlock()
+
+		body := e.searchBody([]any{"_shard_doc"}, slice)
+		body["pit"] = elastic.NewPointInTimeWithKeepAlive(pitID, e.conf.keepAlive)
+		if searchAfter != nil {
+			body["search_after"] = searchAfter
+		}
+
+		res, err := client.Search().Source(body).Do(ctx)
+		if err != nil {
+			if !e.retryWait(ctx, fmt.Errorf("search of slice %v failed: %w", slice, err)) {
+				return ctx.Err()
+			}
+			continue
+		}
+		if res.PitId != "" {
+			e.pitMut.Lock()
+			e.pitID = res.PitId
+			e.pitMut.Unlock()
+		}
+
+		if res.Hits == nil || len(res.Hits.Hits) == 0 {
+			return nil
+		}
+		for _, hit := range res.Hits.Hits {
+			if !e.send(ctx, esiHit{hit: hit}) {
+				return ctx.Err()
+			}
+			searchAfter = hit.Sort
+		}
+	}
+}
+
+func (e *Input) readScroll(ctx context.Context, client *elastic.Client, slice int) error {
+	scroll := client.Scroll(e.conf.indexes...).
+		KeepAlive(e.conf.keepAlive).
+		Body(e.searchBody([]any{"_doc"}, slice))
+	defer func() {
+		clearCtx, done := context.WithTimeout(context.Background(), time.Second*10)
+		defer done()
+		if err := scroll.Clear(clearCtx); err != nil {
+			e.log.Warnf("Failed to clear scroll: %v", err)
+		}
+	}()
+
+	for {
+		res, err := scroll.Do(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if !e.retryWait(ctx, fmt.Errorf("scroll of slice %v failed: %w", slice, err)) {
+				return ctx.Err()
+			}
+			continue
+		}
+		for _, hit := range res.Hits.Hits {
+			if !e.send(ctx, esiHit{hit: hit}) {
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func (e *Input) readTail(ctx context.Context, client *elastic.Client) error {
+	sort := []any{map[string]any{e.conf.tail.timestampField: "asc"}}
+	if e.conf.tail.tiebreakerField != "" {
+		sort = append(sort, map[string]any{e.conf.tail.tiebreakerField: "asc"})
+	}
+
+	var searchAfter []any
+	for {
+		body := e.searchBody(sort, 0)
+		if searchAfter != nil {
+			body["search_after"] = searchAfter
+		}
+
+		res, err := client.Search(e.conf.indexes...).Source(body).Do(ctx)
+		if err != nil {
+			if !e.retryWait(ctx, fmt.Errorf("search failed: %w", err)) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		var hits []*elastic.SearchHit
+		if res.Hits != nil {
+			hits = res.Hits.Hits
+		}
+		for _, hit := range hits {
+			if !e.send(ctx, esiHit{hit: hit}) {
+				return ctx.Err()
+			}
+			searchAfter = hit.Sort
+		}
+
+		if len(hits) < e.conf.batchSize {
+			select {
+			case <-time.After(e.conf.tail.interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func (e *Input) Read(ctx context.Context) (*service.Message, service.AckFunc, error) {
+	e.clientMut.Lock()
+	hits := e.hits
+	e.clientMut.Unlock()
+	if hits == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	var h esiHit
+	var open bool
+	select {
+	case h, open = <-hits:
+		if !open {
+			return nil, nil, service.ErrEndOfInput
+		}
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	if h.err != nil {
+		return nil, nil, h.err
+	}
+
+	msg := service.NewMessage(h.hit.Source)
+	msg.MetaSetMut("elasticsearch_index", h.hit.Index)
+	msg.MetaSetMut("elasticsearch_id", h.hit.Id)
+	return msg, func(ctx context.Context, err error) error {
+		// Nacks are handled by AutoRetryNacks.
+		return nil
+	}, nil
+}
+
+func (e *Input) Close(ctx context.Context) error {
+	e.shutSig.CloseNow()
+	e.clientMut.Lock()
+	isNil := e.client == nil
+	e.clientMut.Unlock()
+	if isNil {
+		return nil
+	}
+	select {
+	case <-e.shutSig.HasClosedChan():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+// fakeSearchServer serves documents numbered from zero in pages, where the
+// documents of a slice are those whose number modulo the number of slices is
+// the id of the slice.
+type fakeSearchServer struct {
+	t       *testing.T
+	docs    int
+	version string
+	noPIT   bool
+	pitErr  int
+	mut     sync.Mutex
+	paths   []string
+	scrolls map[string][]int
+}
+
+type fakeSearchBody struct {
+	Size  int `json:"size"`
+	Slice *struct {
+		ID  int `json:"id"`
+		Max int `json:"max"`
+	} `json:"slice"`
+	SearchAfter []int `json:"search_after"`
+	PIT         *struct {
+		ID string `json:"id"`
+	} `json:"pit"`
+}
+
+func (f *fakeSearchServer) sliceDocs(body fakeSearchBody, after int) (docs []int) {
+	for i := after + 1; i < f.docs; i++ {
+		if body.Slice == nil || i%body.Slice.Max == body.Slice.ID {
+			docs = append(docs, i)
+		}
+	}
+	return
+}
+
+func (f *fakeSearchServer) hits(docs []int) map[string]any {
+	hits := []any{}
+	for _, d := range docs {
+		hits = append(hits, map[string]any{
+			"_index":  "things",
+			"_id":     fmt.Sprintf("doc%d", d),
+			"_source": map[string]any{"n": d},
+			"sort":    []any{d},
+		})
+	}
+	return map[string]any{"hits": map[string]any{"hits": hits}}
+}
+
+func (f *fakeSearchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.paths = append(f.paths, r.Method+" "+r.URL.Path)
+
+	rawBody, err := io.ReadAll(r.Body)
+	assert.NoError(f.t, err)
+
+	var body fakeSearchBody
+	if r.Method == http.MethodPost && r.URL.Path != "/things/_pit" {
+		assert.NoError(f.t, json.Unmarshal(rawBody, &body))
+	}
+
+	var res any
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		version := f.version
+		if version == "" {
+			version = "7.17.0"
+		}
+		res = map[string]any{"version": map[string]any{"number": version}}
+	case r.URL.Path == "/things/_pit":
+		if f.noPIT {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"type":"not_found","reason":"no handler"},"status":404}`))
+			return
+		}
+		if f.pitErr != 0 {
+			w.WriteHeader(f.pitErr)
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"error":{"type":"security_exception","reason":"nope"},"status":%d}`, f.pitErr)))
+			return
+		}
+		res = map[string]any{"id": "foopit"}
+	case r.URL.Path == "/_pit":
+		res = map[string]any{"succeeded": true, "num_freed": 1}
+	case r.URL.Path == "/_search":
+		assert.Equal(f.t, "foopit", body.PIT.ID)
+		after := -1
+		if len(body.SearchAfter) > 0 {
+			after = body.SearchAfter[0]
+		}
+		docs := f.sliceDocs(body, after)
+		if len(docs) > body.Size {
+			docs = docs[:body.Size]
+		}
+		res = f.hits(docs)
+	case r.URL.Path == "/things/_search":
+		scrollID := fmt.Sprintf("scroll%d", len(f.scrolls))
+		docs := f.sliceDocs(body, -1)
+		if len(docs) > body.Size {
+			f.scrolls[scrollID] = docs[body.Size:]
+			docs = docs[:body.Size]
+		}
+		hits := f.hits(docs)
+		hits["_scroll_id"] = scrollID
+		res = hits
+	case r.URL.Path == "/_search/scroll" && r.Method == http.MethodDelete:
+		res = map[string]any{"succeeded": true}
+	case r.URL.Path == "/_search/scroll":
+		var scrollBody struct {
+			ScrollID string `json:"scroll_id"`
+		}
+		assert.NoError(f.t, json.Unmarshal(rawBody, &scrollBody))
+		docs := f.scrolls[scrollBody.ScrollID]
+		if len(docs) > 2 {
+			f.scrolls[scrollBody.ScrollID] = docs[2:]
+			docs = docs[:2]
+		} else {
+			delete(f.scrolls, scrollBody.ScrollID)
+		}
+		hits := f.hits(docs)
+		hits["_scroll_id"] = scrollBody.ScrollID
+		res = hits
+	default:
+		f.t.Errorf("unexpected request: %v %v", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	assert.NoError(f.t, json.NewEncoder(w).Encode(res))
+}
+
+func readAllDocs(t *testing.T, input *Input) (docs []string, ids map[string]struct{}) {
+	t.Helper()
+
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	require.NoError(t, input.Connect(tCtx))
+
+	ids = map[string]struct{}{}
+	for {
+		msg, ackFn, err := input.Read(tCtx)
+		if errors.Is(err, service.ErrEndOfInput) {
+			break
+		}
+		require.NoError(t, err)
+
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		docs = append(docs, string(b))
+
+		id, _ := msg.MetaGet("elasticsearch_id")
+		ids[id] = struct{}{}
+		require.NoError(t, ackFn(tCtx, nil))
+	}
+	require.NoError(t, input.Close(tCtx))
+
+	sort.Strings(docs)
+	return
+}
+
+func testInput(t *testing.T, url, extra string) *Input {
+	t.Helper()
+
+	conf, err := InputSpec().ParseYAML(fmt.Sprintf(`
+urls: [ %v ]
+index: [ things ]
+sniff: false
+healthcheck: false
+batch_size: 2
+%v
+`, url, extra), nil)
+	require.NoError(t, err)
+
+	input, err := InputFromParsed(conf, service.MockResources())
+	require.NoError(t, err)
+	return input
+}
+
+func expectedDocs(n int) (docs []string) {
+	for i := 0; i < n; i++ {
+		docs = append(docs, fmt.Sprintf(`{"n":%d}`, i))
+	}
+	sort.Strings(docs)
+	return
+}
+
+func TestInputPointInTimeSlices(t *testing.T) {
+	fake := &fakeSearchServer{t: t, docs: 11}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	docs, ids := readAllDocs(t, testInput(t, server.URL, "slices: 3"))
+	assert.Equal(t, expectedDocs(11), docs)
+	assert.Len(t, ids, 11)
+
+	fake.mut.Lock()
+	defer fake.mut.Unlock()
+	assert.Equal(t, []string{"GET /", "POST /things/_pit"}, fake.paths[:2])
+	assert.Equal(t, "DELETE /_pit", fake.paths[len(fake.paths)-1])
+}
+
+func TestInputScrollFallback(t *testing.T) {
+	fake := &fakeSearchServer{t: t, docs: 7, noPIT: true, scrolls: map[string][]int{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	docs, ids := readAllDocs(t, testInput(t, server.URL, "slices: 2"))
+	assert.Equal(t, expectedDocs(7), docs)
+	assert.Len(t, ids, 7)
+
+	fake.mut.Lock()
+	defer fake.mut.Unlock()
+	assert.Empty(t, fake.scrolls)
+
+	var pitRequests int
+	for _, p := range fake.paths {
+		if strings.HasSuffix(p, "_pit") {
+			pitRequests++
+		}
+	}
+	assert.Equal(t, 1, pitRequests)
+}
+
+func TestInputPointInTimeRequired(t *testing.T) {
+	fake := &fakeSearchServer{t: t, noPIT: true}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	input := testInput(t, server.URL, "mode: point_in_time")
+	require.Error(t, input.Connect(context.Background()))
+}
+
+func TestInputPointInTimeVersion(t *testing.T) {
+	fake := &fakeSearchServer{t: t, docs: 5, version: "7.11.2", scrolls: map[string][]int{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	// Points in time sorted by shard are not supported prior to 7.12, and
+	// therefore the scroll API is used without attempting to open one.
+	docs, _ := readAllDocs(t, testInput(t, server.URL, ""))
+	assert.Equal(t, expectedDocs(5), docs)
+
+	fake.mut.Lock()
+	for _, p := range fake.paths {
+		assert.False(t, strings.HasSuffix(p, "_pit"), p)
+	}
+	fake.mut.Unlock()
+
+	input := testInput(t, server.URL, "mode: point_in_time")
+	require.ErrorContains(t, input.Connect(context.Background()), "requires Elasticsearch 7.12 or later")
+}
+
+func TestInputPointInTimeErrors(t *testing.T) {
+	fake := &fakeSearchServer{t: t, pitErr: http.StatusForbidden}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	// Only errors indicating that points in time are unsupported cause a
+	// fallback to the scroll API.
+	input := testInput(t, server.URL, "")
+	require.ErrorContains(t, input.Connect(context.Background()), "failed to open point in time")
+}
+
+func TestInputTail(t *testing.T) {
+	var mut sync.Mutex
+	var requests []map[string]any
+	docs := 3
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/things/_search", r.URL.Path)
+
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		mut.Lock()
+		requests = append(requests, body)
+		after := -1
+		if sa, exists := body["search_after"].([]any); exists {
+			after = int(sa[0].(float64))
+		}
+		var hits []any
+		for i := after + 1; i < docs && len(hits) < 2; i++ {
+			hits = append(hits, map[string]any{
+				"_index":  "things",
+				"_id":     fmt.Sprintf("doc%d", i),
+				"_source": map[string]any{"n": i},
+				"sort":    []any{i, fmt.Sprintf("doc%d", i)},
+			})
+		}
+		mut.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{"hits": map[string]any{"hits": hits}}))
+	}))
+	t.Cleanup(server.Close)
+
+	input := testInput(t, server.URL, `
+tail:
+  timestamp_field: ts
+  tiebreaker_field: id
+  interval: 10ms
+`)
+
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+	require.NoError(t, input.Connect(tCtx))
+
+	readN := func(n int) (res []string) {
+		for len(res) < n {
+			msg, _, err := input.Read(tCtx)
+			require.NoError(t, err)
+			b, err := msg.AsBytes()
+			require.NoError(t, err)
+			res = append(res, string(b))
+		}
+		return
+	}
+
+	assert.Equal(t, []string{`{"n":0}`, `{"n":1}`, `{"n":2}`}, readN(3))
+
+	mut.Lock()
+	docs = 5
+	mut.Unlock()
+	assert.Equal(t, []string{`{"n":3}`, `{"n":4}`}, readN(2))
+
+	require.NoError(t, input.Close(tCtx))
+
+	mut.Lock()
+	defer mut.Unlock()
+	assert.Equal(t, []any{map[string]any{"ts": "asc"}, map[string]any{"id": "asc"}}, requests[0]["sort"])
+	assert.Nil(t, requests[0]["search_after"])
+	assert.Equal(t, []any{1.0, "doc1"}, requests[1]["search_after"])
+}
@@ -56,7 +56,9 @@ type esoConfig struct {
 	typeStr     *service.InterpolatedString
 }
 
-func esoConfigFromParsed(pConf *service.ParsedConfig) (conf esoConfig, err error) {
+// clientOptsFromParsed returns the URLs and client options of the connection
+// fields shared by the elasticsearch components.
+func clientOptsFromParsed(pConf *service.ParsedConfig) (urls []string, opts []elastic.ClientOptionFunc, err error) {
 	var tmpURLs []string
 	if tmpURLs, err = pConf.FieldStringList(esoFieldURLs); err != nil {
 		return
@@ -64,7 +66,7 @@ func esoConfigFromParsed(pConf *service.ParsedConfig) (conf esoConfig, err error
 	for _, u := range tmpURLs {
 		for _, splitURL := range strings.Split(u, ",") {
 			if len(splitURL) > 0 {
-				conf.urls = append(conf.urls, splitURL)
+				urls = append(urls, splitURL)
 			}
 		}
 	}
@@ -76,8 +78,8 @@ func esoConfigFromParsed(pConf *service.ParsedConfig) (conf esoConfig, err error
 	if healthCheck, err = pConf.FieldBool(esoFieldHealthcheck); err != nil {
 		return
 	}
-	conf.clientOpts = []elastic.ClientOptionFunc{
-		elastic.SetURL(conf.urls...),
+	opts = []elastic.ClientOptionFunc{
+		elastic.SetURL(urls...),
 		elastic.SetSniff(sniff),
 		elastic.SetHealthcheck(healthCheck),
 	}
@@ -92,7 +94,7 @@ func esoConfigFromParsed(pConf *service.ParsedConfig) (conf esoConfig, err error
 			if password, err = authConf.FieldString(esoFieldAuthPassword); err != nil {
 				return
 			}
-			conf.clientOpts = append(conf.clientOpts, elastic.SetBasicAuth(username, password))
+			opts = append(opts, elastic.SetBasicAuth(username, password))
 		}
 	}
 
@@ -106,14 +108,14 @@ func esoConfigFromParsed(pConf *service.ParsedConfig) (conf esoConfig, err error
 	if tlsConf, tlsEnabled, err = pConf.FieldTLSToggled(esoFieldTLS); err != nil {
 		return
 	} else if tlsEnabled {
-		conf.clientOpts = append(conf.clientOpts, elastic.SetHttpClient(&http.Client{
+		opts = append(opts, elastic.SetHttpClient(&http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: tlsConf,
 			},
 			Timeout: timeout,
 		}))
 	} else {
-		conf.clientOpts = append(conf.clientOpts, elastic.SetHttpClient(&http.Client{
+		opts = append(opts, elastic.SetHttpClient(&http.Client{
 			Timeout: timeout,
 		}))
 	}
@@ -122,14 +124,21 @@ func esoConfigFromParsed(pConf *service.ParsedConfig) (conf esoConfig, err error
 	if awsOpts, err = AWSOptFn(pConf.Namespace(esoFieldAWS)); err != nil {
 		return
 	}
-	conf.clientOpts = append(conf.clientOpts, awsOpts...)
+	opts = append(opts, awsOpts...)
 
 	var gzipCompression bool
 	if gzipCompression, err = pConf.FieldBool(esoFieldGzipCompression); err != nil {
 		return
 	}
 	if gzipCompression {
-		conf.clientOpts = append(conf.clientOpts, elastic.SetGzip(true))
+		opts = append(opts, elastic.SetGzip(true))
+	}
+	return
+}
+
+func esoConfigFromParsed(pConf *service.ParsedConfig) (conf esoConfig, err error) {
+	if conf.urls, conf.clientOpts, err = clientOptsFromParsed(pConf); err != nil {
+		return
 	}
 
 	if conf.backoffCtor, err = pure.CommonRetryBackOffCtorFromParsed(pConf); err != nil {
@@ -0,0 +1,366 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	ftmFieldTopicManagement    = "topic_management"
+	ftmFieldEnabled            = "enabled"
+	ftmFieldPartitions         = "partitions"
+	ftmFieldReplicationFactor  = "replication_factor"
+	ftmFieldConfigs            = "configs"
+	ftmFieldIncreasePartitions = "increase_partitions"
+)
+
+func franzTopicManagementField() *service.ConfigField {
+	return service.NewObjectField(ftmFieldTopicManagement,
+		service.NewBoolField(ftmFieldEnabled).
+			Description("Whether to create topics that do not exist.").
+			Default(false),
+		service.NewIntField(ftmFieldPartitions).
+			Description("The number of partitions of created topics, or `-1` to use the default of the broker.").
+			Default(-1),
+		service.NewIntField(ftmFieldReplicationFactor).
+			Description("The replication factor of created topics, or `-1` to use the default of the broker.").
+			Default(-1),
+		service.NewStringMapField(ftmFieldConfigs).
+			Description("Configs to set on created topics, such as `retention.ms` and `cleanup.policy`.").
+			Default(map[string]any{}).
+			Example(map[string]any{
+				"cleanup.policy": "compact",
+				"retention.ms":   "604800000",
+			}),
+		service.NewBoolField(ftmFieldIncreasePartitions).
+			Description("Whether to increase the number of partitions of existing topics that have fewer partitions than `partitions`. The number of partitions of a topic is never decreased.").
+			Default(false),
+	).
+		Description("Create topics that do not exist before writing messages to them, rather than relying on the automatic topic creation of the broker, which is disabled when topic management is enabled. The existence of each topic is checked the first time it is written to.").
+		Optional().
+		Advanced().
+		Version("4.24.0")
+}
+
+// franzTopicSpec describes the topics created by kafka_franz components.
+type franzTopicSpec struct {
+	partitions         int32
+	replicationFactor  int16
+	configs            map[string]string
+	increasePartitions bool
+}
+
+func franzTopicSpecFromParsed(conf *service.ParsedConfig) (spec *franzTopicSpec, err error) {
+	spec = &franzTopicSpec{}
+
+	var partitions, replicationFactor int
+	if partitions, err = conf.FieldInt(ftmFieldPartitions); err != nil {
+		return nil, err
+	}
+	if partitions == 0 || partitions < -1 {
+		return nil, fmt.Errorf("invalid number of partitions %v, must be positive or -1", partitions)
+	}
+	spec.partitions = int32(partitions)
+
+	if replicationFactor, err = conf.FieldInt(ftmFieldReplicationFactor); err != nil {
+		return nil, err
+	}
+	if replicationFactor == 0 || replicationFactor < -1 {
+		return nil, fmt.Errorf("invalid replication factor %v, must be positive or -1", replicationFactor)
+	}
+	spec.replicationFactor = int16(replicationFactor)
+
+	if spec.configs, err = conf.FieldStringMap(ftmFieldConfigs); err != nil {
+		return nil, err
+	}
+	if spec.increasePartitions, err = conf.FieldBool(ftmFieldIncreasePartitions); err != nil {
+		return nil, err
+	}
+	if spec.increasePartitions && spec.partitions < 0 {
+		return nil, errors.New("partitions must be specified in order to increase partitions")
+	}
+	return spec, nil
+}
+
+//------------------------------------------------------------------------------
+
+// franzAdminErr converts the error code of an admin response into an error,
+// including the error message of the broker when provided.
+func franzAdminErr(code int16, msg *string) error {
+	err := kerr.ErrorForCode(code)
+	if err != nil && msg != nil && *msg != "" {
+		err = fmt.Errorf("%w: %v", err, *msg)
+	}
+	return err
+}
+
+func timeoutMillis(timeout time.Duration) int32 {
+	return int32(timeout.Milliseconds())
+}
+
+// franzCreateTopics creates topics by the spec of each and returns the result
+// for each topic, where topics that already exist are not considered errors.
+func franzCreateTopics(ctx context.Context, cl *kgo.Client, timeout time.Duration, specs map[string]*franzTopicSpec) (map[string]error, error) {
+	topics := make([]string, 0, len(specs))
+	for topic := range specs {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	req := kmsg.NewPtrCreateTopicsRequest()
+	req.TimeoutMillis = timeoutMillis(timeout)
+	for _, topic := range topics {
+		spec := specs[topic]
+
+		configNames := make([]string, 0, len(spec.configs))
+		for k := range spec.configs {
+			configNames = append(configNames, k)
+		}
+		sort.Strings(configNames)
+
+		reqTopic := kmsg.NewCreateTopicsRequestTopic()
+		reqTopic.Topic = topic
+		reqTopic.NumPartitions = spec.partitions
+		reqTopic.ReplicationFactor = spec.replicationFactor
+		for _, name := range configNames {
+			reqConfig := kmsg.NewCreateTopicsRequestTopicConfig()
+			reqConfig.Name = name
+			reqConfig.Value = kmsg.StringPtr(spec.configs[name])
+			reqTopic.Configs = append(reqTopic.Configs, reqConfig)
+		}
+		req.Topics = append(req.Topics, reqTopic)
+	}
+
+	res, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]error, len(topics))
+	for _, t := range res.Topics {
+		if err := franzAdminErr(t.ErrorCode, t.ErrorMessage); err != nil && !errors.Is(err, kerr.TopicAlreadyExists) {
+			results[t.Topic] = err
+		} else {
+			results[t.Topic] = nil
+		}
+	}
+	return results, nil
+}
+
+// franzDeleteTopics deletes topics and returns the result for each topic, where
+// topics that do not exist are not considered errors.
+func franzDeleteTopics(ctx context.Context, cl *kgo.Client, timeout time.Duration, topics []string) (map[string]error, error) {
+	req := kmsg.NewPtrDeleteTopicsRequest()
+	req.TimeoutMillis = timeoutMillis(timeout)
+	req.TopicNames = topics
+	for _, topic := range topics {
+		reqTopic := kmsg.NewDeleteTopicsRequestTopic()
+		reqTopic.Topic = kmsg.StringPtr(topic)
+		req.Topics = append(req.Topics, reqTopic)
+	}
+
+	res, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]error, len(topics))
+	for _, t := range res.Topics {
+		if t.Topic == nil {
+			continue
+		}
+		if err := franzAdminErr(t.ErrorCode, t.ErrorMessage); err != nil && !errors.Is(err, kerr.UnknownTopicOrPartition) {
+			results[*t.Topic] = err
+		} else {
+			results[*t.Topic] = nil
+		}
+	}
+	return results, nil
+}
+
+// franzAlterTopicConfigs sets the configs of topics, where configs with an
+// empty value are reset to their defaults.
+func franzAlterTopicConfigs(ctx context.Context, cl *kgo.Client, configs map[string]map[string]string) (map[string]error, error) {
+	req := kmsg.NewPtrIncrementalAlterConfigsRequest()
+	for topic, topicConfigs := range configs {
+		resource := kmsg.NewIncrementalAlterConfigsRequestResource()
+		resource.ResourceType = kmsg.ConfigResourceTypeTopic
+		resource.ResourceName = topic
+		for name, value := range topicConfigs {
+			reqConfig := kmsg.NewIncrementalAlterConfigsRequestResourceConfig()
+			reqConfig.Name = name
+			if value == "" {
+				reqConfig.Op = kmsg.IncrementalAlterConfigOpDelete
+			} else {
+				reqConfig.Op = kmsg.IncrementalAlterConfigOpSet
+				reqConfig.Value = kmsg.StringPtr(value)
+			}
+			resource.Configs = append(resource.Configs, reqConfig)
+		}
+		req.Resources = append(req.Resources, resource)
+	}
+
+	res, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]error, len(configs))
+	for _, r := range res.Resources {
+		results[r.ResourceName] = franzAdminErr(r.ErrorCode, r.ErrorMessage)
+	}
+	return results, nil
+}
+
+// franzCreatePartitions increases the number of partitions of topics to a
+// total count.
+func franzCreatePartitions(ctx context.Context, cl *kgo.Client, timeout time.Duration, counts map[string]int32) (map[string]error, error) {
+	req := kmsg.NewPtrCreatePartitionsRequest()
+	req.TimeoutMillis = timeoutMillis(timeout)
+	for topic, count := range counts {
+		reqTopic := kmsg.NewCreatePartitionsRequestTopic()
+		reqTopic.Topic = topic
+		reqTopic.Count = count
+		req.Topics = append(req.Topics, reqTopic)
+	}
+
+	res, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]error, len(counts))
+	for _, t := range res.Topics {
+		results[t.Topic] = franzAdminErr(t.ErrorCode, t.ErrorMessage)
+	}
+	return results, nil
+}
+
+// franzPartitionCounts returns the number of partitions of topics.
+func franzPartitionCounts(ctx context.Context, cl *kgo.Client, topics []string) (map[string]int32, error) {
+	req := kmsg.NewPtrMetadataRequest()
+	for _, topic := range topics {
+		reqTopic := kmsg.NewMetadataRequestTopic()
+		reqTopic.Topic = kmsg.StringPtr(topic)
+		req.Topics = append(req.Topics, reqTopic)
+	}
+
+	res, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int32, len(topics))
+	for _, t := range res.Topics {
+		if t.Topic == nil {
+			continue
+		}
+		if err := kerr.ErrorForCode(t.ErrorCode); err != nil {
+			return nil, fmt.Errorf("failed to obtain metadata of topic %v: %w", *t.Topic, err)
+		}
+		counts[*t.Topic] = int32(len(t.Partitions))
+	}
+	return counts, nil
+}
+
+//------------------------------------------------------------------------------
+
+// franzTopicManager creates topics written to by an output that do not exist.
+type franzTopicManager struct {
+	spec    *franzTopicSpec
+	timeout time.Duration
+
+	mut   sync.Mutex
+	known map[string]struct{}
+}
+
+func newFranzTopicManager(spec *franzTopicSpec, timeout time.Duration) *franzTopicManager {
+	return &franzTopicManager{
+		spec:    spec,
+		timeout: timeout,
+		known:   map[string]struct{}{},
+	}
+}
+
+// ensureTopics creates any topics of records that have not been seen before
+// and do not exist, and increases the partitions of existing topics when
+// configured to do so.
+func (m *franzTopicManager) ensureTopics(ctx context.Context, cl *kgo.Client, records []*kgo.Record) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	var topics []string
+	specs := map[string]*franzTopicSpec{}
+	for _, r := range records {
+		if _, exists := m.known[r.Topic]; exists {
+			continue
+		}
+		if _, exists := specs[r.Topic]; exists {
+			continue
+		}
+		specs[r.Topic] = m.spec
+		topics = append(topics, r.Topic)
+	}
+	if len(topics) == 0 {
+		return nil
+	}
+
+	results, err := franzCreateTopics(ctx, cl, m.timeout, specs)
+	if err != nil {
+		return fmt.Errorf("failed to create topics: %w", err)
+	}
+	for _, topic := range topics {
+		if err := results[topic]; err != nil {
+			return fmt.Errorf("failed to create topic %v: %w", topic, err)
+		}
+	}
+
+	if m.spec.increasePartitions {
+		if err := m.increasePartitions(ctx, cl, topics); err != nil {
+			return err
+		}
+	}
+
+	for _, topic := range topics {
+		m.known[topic] = struct{}{}
+	}
+	return nil
+}
+
+func (m *franzTopicManager) increasePartitions(ctx context.Context, cl *kgo.Client, topics []string) error {
+	counts, err := franzPartitionCounts(ctx, cl, topics)
+	if err != nil {
+		return err
+	}
+
+	increase := map[string]int32{}
+	for _, topic := range topics {
+		if count, exists := counts[topic]; exists && count < m.spec.partitions {
+			increase[topic] = m.spec.partitions
+		}
+	}
+	if len(increase) == 0 {
+		return nil
+	}
+
+	results, err := franzCreatePartitions(ctx, cl, m.timeout, increase)
+	if err != nil {
+		return fmt.Errorf("failed to increase partitions: %w", err)
+	}
+	for topic := range increase {
+		if err := results[topic]; err != nil {
+			return fmt.Errorf("failed to increase partitions of topic %v: %w", topic, err)
+		}
+	}
+	return nil
+}
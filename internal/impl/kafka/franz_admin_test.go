@@ -0,0 +1,179 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func TestFranzTopicSpecFromParsed(t *testing.T) {
+	spec := service.NewConfigSpec().Field(franzTopicManagementField())
+
+	for _, test := range []struct {
+		name     string
+		conf     string
+		expected *franzTopicSpec
+		errs     string
+	}{
+		{
+			name: "defaults",
+			conf: `topic_management: {}`,
+			expected: &franzTopicSpec{
+				partitions:        -1,
+				replicationFactor: -1,
+				configs:           map[string]string{},
+			},
+		},
+		{
+			name: "all fields",
+			conf: `
+topic_management:
+  partitions: 6
+  replication_factor: 3
+  increase_partitions: true
+  configs:
+    cleanup.policy: compact
+`,
+			expected: &franzTopicSpec{
+				partitions:         6,
+				replicationFactor:  3,
+				configs:            map[string]string{"cleanup.policy": "compact"},
+				increasePartitions: true,
+			},
+		},
+		{
+			name: "zero partitions",
+			conf: `
+topic_management:
+  partitions: 0
+`,
+			errs: "invalid number of partitions",
+		},
+		{
+			name: "increase without partitions",
+			conf: `
+topic_management:
+  increase_partitions: true
+`,
+			errs: "partitions must be specified",
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pConf, err := spec.ParseYAML(test.conf, nil)
+			require.NoError(t, err)
+
+			topicSpec, err := franzTopicSpecFromParsed(pConf.Namespace(ftmFieldTopicManagement))
+			if test.errs != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errs)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, topicSpec)
+		})
+	}
+}
+
+func TestKafkaAdminProcessorConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		conf string
+		errs string
+	}{
+		{
+			name: "create topic",
+			conf: `
+seed_brokers: [ localhost:9092 ]
+operation: create_topic
+topic: '${! json("topic") }'
+partitions: 3
+configs:
+  retention.ms: '${! json("retention") }'
+`,
+		},
+		{
+			name: "alter configs without configs",
+			conf: `
+seed_brokers: [ localhost:9092 ]
+operation: alter_configs
+topic: foo
+`,
+			errs: "configs must be specified",
+		},
+		{
+			name: "create partitions without partitions",
+			conf: `
+seed_brokers: [ localhost:9092 ]
+operation: create_partitions
+topic: foo
+`,
+			errs: "partitions must be specified",
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pConf, err := kafkaAdminProcessorConfig().ParseYAML(test.conf, nil)
+			require.NoError(t, err)
+
+			proc, err := newKafkaAdminProcessorFromConfig(pConf, service.MockResources())
+			if test.errs != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errs)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, proc.Close(context.Background()))
+		})
+	}
+}
+
+func TestFranzOutputTopicManagementEnabled(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		conf    string
+		enabled bool
+	}{
+		{
+			name: "absent",
+			conf: `
+seed_brokers: [ localhost:9092 ]
+topic: foo
+`,
+		},
+		{
+			name: "disabled",
+			conf: `
+seed_brokers: [ localhost:9092 ]
+topic: foo
+topic_management:
+  partitions: 3
+`,
+		},
+		{
+			name: "enabled",
+			conf: `
+seed_brokers: [ localhost:9092 ]
+topic: foo
+topic_management:
+  enabled: true
+  partitions: 3
+`,
+			enabled: true,
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pConf, err := franzKafkaOutputConfig().ParseYAML(test.conf, nil)
+			require.NoError(t, err)
+
+			w, err := newFranzKafkaWriterFromConfig(pConf, service.MockResources())
+			require.NoError(t, err)
+			assert.Equal(t, test.enabled, w.topicManager != nil)
+		})
+	}
+}
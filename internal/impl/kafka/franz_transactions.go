@@ -0,0 +1,241 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+// franzTxnGroup tracks the partitions assigned to a kafka_franz input that
+// leaves the commits of its consumer group offsets to the transactions of a
+// kafka_franz output.
+//
+// Each assignment of a partition is given a unique identifier, which allows an
+// output to detect messages consumed from a partition that has since been
+// revoked, and whose offsets must therefore not be committed as the partition
+// may already be consumed by another member of the group.
+type franzTxnGroup struct {
+	group string
+
+	mut         sync.RWMutex
+	client      *kgo.Client
+	assignments map[string]map[int32]uint64
+	nextID      uint64
+}
+
+func newFranzTxnGroup(group string) *franzTxnGroup {
+	return &franzTxnGroup{
+		group:       group,
+		assignments: map[string]map[int32]uint64{},
+	}
+}
+
+func (g *franzTxnGroup) setClient(cl *kgo.Client) {
+	g.mut.Lock()
+	g.client = cl
+	g.mut.Unlock()
+}
+
+func (g *franzTxnGroup) assign(m map[string][]int32) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	for topic, partitions := range m {
+		parts := g.assignments[topic]
+		if parts == nil {
+			parts = map[int32]uint64{}
+			g.assignments[topic] = parts
+		}
+		for _, p := range partitions {
+			g.nextID++
+			parts[p] = g.nextID
+		}
+	}
+}
+
+// revoke removes partitions from the assignment, blocking until any
+// transaction committing offsets of the group has ended.
+func (g *franzTxnGroup) revoke(m map[string][]int32) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	for topic, partitions := range m {
+		parts := g.assignments[topic]
+		for _, p := range partitions {
+			delete(parts, p)
+		}
+		if len(parts) == 0 {
+			delete(g.assignments, topic)
+		}
+	}
+}
+
+// revokeAll removes all partitions from the assignment, which is necessary
+// when the client of the input is closed.
+func (g *franzTxnGroup) revokeAll() {
+	g.mut.Lock()
+	g.assignments = map[string]map[int32]uint64{}
+	g.client = nil
+	g.mut.Unlock()
+}
+
+func (g *franzTxnGroup) assignment(topic string, partition int32) uint64 {
+	g.mut.RLock()
+	defer g.mut.RUnlock()
+	return g.assignments[topic][partition]
+}
+
+// franzTxnRecord identifies the consumed record that a message originates from.
+type franzTxnRecord struct {
+	group       *franzTxnGroup
+	assignment  uint64
+	topic       string
+	partition   int32
+	offset      int64
+	leaderEpoch int32
+}
+
+type franzTxnRecordKey struct{}
+
+func withFranzTxnRecord(msg *service.Message, r *franzTxnRecord) *service.Message {
+	return msg.WithContext(context.WithValue(msg.Context(), franzTxnRecordKey{}, r))
+}
+
+func franzTxnRecordFromMessage(msg *service.Message) (*franzTxnRecord, bool) {
+	r, ok := msg.Context().Value(franzTxnRecordKey{}).(*franzTxnRecord)
+	return r, ok
+}
+
+//------------------------------------------------------------------------------
+
+// franzTxnOffsets are the offsets to commit for each consumer group within a
+// transaction, where each offset is that of the next record to consume.
+type franzTxnOffsets map[*franzTxnGroup]map[string]map[int32]kgo.EpochOffset
+
+// franzTxnOffsetsFromBatch returns the offsets to commit for the messages of a
+// batch, along with the indexes of messages that should be written. Messages
+// consumed from partitions that are no longer assigned to their input are
+// excluded.
+//
+// The read locks of all groups referenced by the batch are held on return, and
+// must be released with unlock once the transaction has ended.
+func franzTxnOffsetsFromBatch(b service.MessageBatch) (offsets franzTxnOffsets, indexes []int) {
+	offsets = franzTxnOffsets{}
+	for i, msg := range b {
+		r, ok := franzTxnRecordFromMessage(msg)
+		if !ok {
+			indexes = append(indexes, i)
+			continue
+		}
+
+		groupOffsets, exists := offsets[r.group]
+		if !exists {
+			r.group.mut.RLock()
+			groupOffsets = map[string]map[int32]kgo.EpochOffset{}
+			offsets[r.group] = groupOffsets
+		}
+		if r.group.assignments[r.topic][r.partition] != r.assignment {
+			continue
+		}
+		indexes = append(indexes, i)
+
+		parts := groupOffsets[r.topic]
+		if parts == nil {
+			parts = map[int32]kgo.EpochOffset{}
+			groupOffsets[r.topic] = parts
+		}
+		if current, exists := parts[r.partition]; !exists || current.Offset <= r.offset {
+			parts[r.partition] = kgo.EpochOffset{Epoch: r.leaderEpoch, Offset: r.offset + 1}
+		}
+	}
+	return
+}
+
+func (o franzTxnOffsets) unlock() {
+	for g := range o {
+		g.mut.RUnlock()
+	}
+}
+
+// commit adds the offsets of each group to the current transaction of the
+// client.
+func (o franzTxnOffsets) commit(ctx context.Context, cl *kgo.Client, transactionalID string) error {
+	for g, topics := range o {
+		if len(topics) == 0 || g.client == nil {
+			continue
+		}
+
+		memberID, generation := g.client.GroupMetadata()
+		if generation < 0 {
+			return fmt.Errorf("consumer group %v is not joined", g.group)
+		}
+
+		producerID, producerEpoch, err := cl.ProducerID(ctx)
+		if err != nil {
+			return err
+		}
+
+		addReq := kmsg.NewPtrAddOffsetsToTxnRequest()
+		addReq.TransactionalID = transactionalID
+		addReq.ProducerID = producerID
+		addReq.ProducerEpoch = producerEpoch
+		addReq.Group = g.group
+
+		addRes, err := addReq.RequestWith(ctx, cl)
+		if err != nil {
+			return err
+		}
+		if err := kerr.ErrorForCode(addRes.ErrorCode); err != nil {
+			return fmt.Errorf("failed to add offsets of consumer group %v to transaction: %w", g.group, err)
+		}
+
+		commitReq := kmsg.NewPtrTxnOffsetCommitRequest()
+		commitReq.TransactionalID = transactionalID
+		commitReq.Group = g.group
+		commitReq.ProducerID = producerID
+		commitReq.ProducerEpoch = producerEpoch
+		commitReq.Generation = generation
+		commitReq.MemberID = memberID
+		for topic, partitions := range topics {
+			reqTopic := kmsg.NewTxnOffsetCommitRequestTopic()
+			reqTopic.Topic = topic
+			for partition, offset := range partitions {
+				reqPart := kmsg.NewTxnOffsetCommitRequestTopicPartition()
+				reqPart.Partition = partition
+				reqPart.Offset = offset.Offset
+				reqPart.LeaderEpoch = offset.Epoch
+				reqTopic.Partitions = append(reqTopic.Partitions, reqPart)
+			}
+			commitReq.Topics = append(commitReq.Topics, reqTopic)
+		}
+
+		commitRes, err := commitReq.RequestWith(ctx, cl)
+		if err != nil {
+			return err
+		}
+		for _, t := range commitRes.Topics {
+			for _, p := range t.Partitions {
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+					return fmt.Errorf("failed to commit offset of topic %v partition %v for consumer group %v: %w", t.Topic, p.Partition, g.group, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isFencedErr returns whether an error indicates that the transactional
+// producer has been fenced by another producer with the same transactional ID,
+// in which case the client can no longer be used.
+func isFencedErr(err error) bool {
+	return errors.Is(err, kerr.ProducerFenced) ||
+		errors.Is(err, kerr.InvalidProducerEpoch) ||
+		errors.Is(err, kerr.TransactionalIDAuthorizationFailed)
+}
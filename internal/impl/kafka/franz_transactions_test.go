@@ -0,0 +1,116 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func TestFranzTxnOffsetsFromBatch(t *testing.T) {
+	group := newFranzTxnGroup("foo")
+	group.assign(map[string][]int32{
+		"a": {0, 1},
+		"b": {0},
+	})
+
+	txnMsg := func(content, topic string, partition int32, offset int64) *service.Message {
+		return withFranzTxnRecord(service.NewMessage([]byte(content)), &franzTxnRecord{
+			group:       group,
+			assignment:  group.assignment(topic, partition),
+			topic:       topic,
+			partition:   partition,
+			offset:      offset,
+			leaderEpoch: 2,
+		})
+	}
+
+	batch := service.MessageBatch{
+		txnMsg("first", "a", 0, 10),
+		txnMsg("second", "a", 0, 12),
+		txnMsg("third", "a", 0, 11),
+		txnMsg("fourth", "a", 1, 5),
+		service.NewMessage([]byte("fifth")),
+		txnMsg("sixth", "b", 0, 3),
+	}
+
+	// Revoke a partition and then assign it again, messages consumed prior to
+	// the revoke must be excluded.
+	group.revoke(map[string][]int32{"b": {0}})
+	group.assign(map[string][]int32{"b": {0}})
+
+	offsets, indexes := franzTxnOffsetsFromBatch(batch)
+	offsets.unlock()
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, indexes)
+	assert.Equal(t, franzTxnOffsets{
+		group: {
+			"a": {
+				0: kgo.EpochOffset{Epoch: 2, Offset: 13},
+				1: kgo.EpochOffset{Epoch: 2, Offset: 6},
+			},
+		},
+	}, offsets)
+}
+
+func TestFranzTxnGroupRevokeAll(t *testing.T) {
+	group := newFranzTxnGroup("foo")
+	group.assign(map[string][]int32{"a": {0}})
+
+	msg := withFranzTxnRecord(service.NewMessage(nil), &franzTxnRecord{
+		group:      group,
+		assignment: group.assignment("a", 0),
+		topic:      "a",
+	})
+	require.NotZero(t, group.assignment("a", 0))
+
+	group.revokeAll()
+	assert.Zero(t, group.assignment("a", 0))
+
+	offsets, indexes := franzTxnOffsetsFromBatch(service.MessageBatch{msg})
+	offsets.unlock()
+	assert.Empty(t, indexes)
+}
+
+func TestFranzTxnInputLint(t *testing.T) {
+	err := service.NewStreamBuilder().AddInputYAML(`
+kafka_franz:
+  seed_brokers: [ foo:1234 ]
+  topics: [ foo ]
+  transactional_offsets: true
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a consumer group must be specified when transactional offsets are enabled")
+
+	err = service.NewStreamBuilder().AddInputYAML(`
+kafka_franz:
+  seed_brokers: [ foo:1234 ]
+  topics: [ foo ]
+  consumer_group: bar
+  transactional_offsets: true
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a checkpoint limit of 1 must be specified when transactional offsets are enabled")
+
+	require.NoError(t, service.NewStreamBuilder().AddInputYAML(`
+kafka_franz:
+  seed_brokers: [ foo:1234 ]
+  topics: [ foo ]
+  consumer_group: bar
+  checkpoint_limit: 1
+  isolation_level: read_committed
+  transactional_offsets: true
+`))
+
+	err = service.NewStreamBuilder().AddInputYAML(`
+kafka_franz:
+  seed_brokers: [ foo:1234 ]
+  topics: [ foo:0 ]
+  consumer_group: bar
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "this input does not support both a consumer group and explicit topic partitions")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -41,6 +42,12 @@ This input adds the following metadata fields to each message:
 - kafka_tombstone_message
 - All record headers
 ` + "```" + `
+` + consumerLagDocs + `
+### Exactly-Once Delivery
+
+When ` + "`transactional_offsets`" + ` is set to ` + "`true`" + ` this input no longer commits the offsets of consumed messages itself, and instead the offsets are committed by a ` + "[`kafka_franz` output](/docs/components/outputs/kafka_franz)" + ` with a ` + "`transactional_id`" + ` within the same transaction as the messages it produces. This makes it possible to build pipelines that consume from and produce to Kafka with exactly-once semantics, where the output records of a message and the commit of its offset either both succeed or are both discarded.
+
+Messages consumed from partitions that have since been revoked from this consumer are dropped by the output without being written, as the new owner of the partition consumes them again from the last committed offset. In order to preserve the order of commits the ` + "`checkpoint_limit`" + ` must be set to ` + "`1`" + `, and downstream consumers of the output topics should use an ` + "`isolation_level`" + ` of ` + "`read_committed`" + `.
 `).
 		Field(service.NewStringListField("seed_brokers").
 			Description("A list of broker addresses to connect to in order to establish connections. If an item of the list contains commas it will be expanded into multiple addresses.").
@@ -86,6 +93,21 @@ Finally, it's also possible to specify an explicit offset to consume from by add
 			Description("Determines whether to consume from the oldest available offset, otherwise messages are consumed from the latest offset. The setting is applied when creating a new consumer group or the saved offset no longer exists.").
 			Default(true).
 			Advanced()).
+		Field(service.NewStringAnnotatedEnumField("isolation_level", map[string]string{
+			"read_uncommitted": "Consume all records, including those of transactions that are yet to be committed or have been aborted.",
+			"read_committed":   "Only consume records that are not part of a transaction, or are part of a committed transaction.",
+		}).
+			Description("Determines which records written within transactions are consumed.").
+			Default("read_uncommitted").
+			Advanced().
+			Version("4.24.0")).
+		Field(service.NewBoolField("transactional_offsets").
+			Description("Whether the offsets of consumed messages are committed within the transactions of a `kafka_franz` output with a `transactional_id` rather than by this input, providing exactly-once delivery between topics. Requires a `consumer_group` and a `checkpoint_limit` of `1`.").
+			Default(false).
+			Advanced().
+			Version("4.24.0")).
+		Field(franzStartOffsetField()).
+		Field(franzStopAtField()).
 		Field(service.NewTLSToggledField("tls")).
 		Field(saslField()).
 		Field(service.NewBoolField("multi_header").Description("Decode headers into lists to allow handling of multiple values with the same key").Default(false).Advanced()).
@@ -94,12 +116,18 @@ Finally, it's also possible to specify an explicit offset to consume from by add
 			Advanced()).
 		LintRule(`
 let has_topic_partitions = this.topics.any(t -> t.contains(":"))
-root = if $has_topic_partitions {
-  if this.consumer_group.or("") != "" {
-    "this input does not support both a consumer group and explicit topic partitions"
-  } else if this.regexp_topics {
-    "this input does not support both regular expression topics and explicit topic partitions"
-  }
+root = if $has_topic_partitions && this.consumer_group.or("") != "" {
+  "this input does not support both a consumer group and explicit topic partitions"
+} else if $has_topic_partitions && this.regexp_topics.or(false) {
+  "this input does not support both regular expression topics and explicit topic partitions"
+} else if this.transactional_offsets.or(false) && this.consumer_group.or("") == "" {
+  "a consumer group must be specified when transactional offsets are enabled"
+} else if this.transactional_offsets.or(false) && this.checkpoint_limit.or(1024) != 1 {
+  "a checkpoint limit of 1 must be specified when transactional offsets are enabled"
+} else if this.regexp_topics.or(false) && (this.start_offset.or(null) != null || this.stop_at.or(null) != null) {
+  "this input does not support a start offset or stop bound with regular expression topics"
+} else if $has_topic_partitions && this.start_offset.or(null) != null {
+  "this input does not support both a start offset and explicit topic partitions"
 }
 `)
 }
@@ -140,6 +168,14 @@ type franzKafkaReader struct {
 	regexPattern    bool
 	multiHeader     bool
 	batchPolicy     service.BatchPolicy
+	readCommitted   bool
+	txnGroup        *franzTxnGroup
+	startConf       *franzStartConfig
+	stopConf        *franzStopConfig
+
+	positions  *franzPositions
+	reachedEnd atomic.Bool
+	lag        *consumerLagMetrics
 
 	batchChan atomic.Value
 	res       *service.Resources
@@ -161,6 +197,7 @@ func newFranzKafkaReaderFromConfig(conf *service.ParsedConfig, res *service.Reso
 		res:     res,
 		log:     res.Logger(),
 		shutSig: shutdown.NewSignaller(),
+		lag:     newConsumerLagMetrics(res.Metrics()),
 	}
 
 	brokerList, err := conf.FieldStringList("seed_brokers")
@@ -212,8 +249,10 @@ func newFranzKafkaReaderFromConfig(conf *service.ParsedConfig, res *service.Reso
 		return nil, err
 	}
 
-	if f.consumerGroup, err = conf.FieldString("consumer_group"); err != nil {
-		return nil, err
+	if conf.Contains("consumer_group") {
+		if f.consumerGroup, err = conf.FieldString("consumer_group"); err != nil {
+			return nil, err
+		}
 	}
 
 	if f.checkpointLimit, err = conf.FieldInt("checkpoint_limit"); err != nil {
@@ -228,6 +267,49 @@ func newFranzKafkaReaderFromConfig(conf *service.ParsedConfig, res *service.Reso
 		return nil, err
 	}
 
+	isolationLevel, err := conf.FieldString("isolation_level")
+	if err != nil {
+		return nil, err
+	}
+	switch isolationLevel {
+	case "read_uncommitted":
+	case "read_committed":
+		f.readCommitted = true
+	default:
+		return nil, fmt.Errorf("unknown isolation level: %v", isolationLevel)
+	}
+
+	transactionalOffsets, err := conf.FieldBool("transactional_offsets")
+	if err != nil {
+		return nil, err
+	}
+	if transactionalOffsets {
+		if f.consumerGroup == "" {
+			return nil, errors.New("a consumer group must be specified when transactional offsets are enabled")
+		}
+		if f.checkpointLimit != 1 {
+			return nil, errors.New("a checkpoint limit of 1 must be specified when transactional offsets are enabled")
+		}
+		f.txnGroup = newFranzTxnGroup(f.consumerGroup)
+	}
+
+	if conf.Contains(kfiFieldStartOffset) {
+		if f.startConf, err = franzStartConfigFromParsed(conf.Namespace(kfiFieldStartOffset)); err != nil {
+			return nil, fmt.Errorf("failed to parse start offset: %w", err)
+		}
+		if len(f.topicPartitions) > 0 {
+			return nil, errors.New("a start offset cannot be combined with explicit topic partitions")
+		}
+	}
+	if conf.Contains(kfiFieldStopAt) {
+		if f.stopConf, err = franzStopConfigFromParsed(conf.Namespace(kfiFieldStopAt)); err != nil {
+			return nil, fmt.Errorf("failed to parse stop bound: %w", err)
+		}
+	}
+	if f.regexPattern && (f.startConf != nil || f.stopConf != nil) {
+		return nil, errors.New("a start offset or stop bound cannot be combined with regular expression topics")
+	}
+
 	tlsConf, tlsEnabled, err := conf.FieldTLSToggled("tls")
 	if err != nil {
 		return nil, err
@@ -281,6 +363,17 @@ func (f *franzKafkaReader) recordToMessage(record *kgo.Record) *msgWithRecord {
 	record.Key = nil
 	record.Value = nil
 
+	if f.txnGroup != nil {
+		msg = withFranzTxnRecord(msg, &franzTxnRecord{
+			group:       f.txnGroup,
+			assignment:  f.txnGroup.assignment(record.Topic, record.Partition),
+			topic:       record.Topic,
+			partition:   record.Partition,
+			offset:      record.Offset,
+			leaderEpoch: record.LeaderEpoch,
+		})
+	}
+
 	return &msgWithRecord{
 		msg: msg,
 		r:   record,
@@ -459,6 +552,30 @@ func (p *partitionTracker) pauseFetch(limit int) (pauseFetch bool) {
 	return
 }
 
+// flush sends any messages pending within the batcher of the partition.
+func (p *partitionTracker) flush(ctx context.Context) error {
+	if p.batcher == nil {
+		return nil
+	}
+
+	p.batcherLock.Lock()
+	sendBatch, _ := p.batcher.Flush(ctx)
+	sendRecord := p.topBatchRecord
+	p.topBatchRecord = nil
+	p.batcherLock.Unlock()
+
+	if len(sendBatch) == 0 {
+		return nil
+	}
+	return p.sendBatch(ctx, sendBatch, sendRecord)
+}
+
+func (p *partitionTracker) pending() int64 {
+	p.checkpointerLock.Lock()
+	defer p.checkpointerLock.Unlock()
+	return p.checkpointer.Pending()
+}
+
 func (p *partitionTracker) close(ctx context.Context) error {
 	p.shutSig.CloseAtLeisure()
 	select {
@@ -550,6 +667,35 @@ func (c *checkpointTracker) pauseFetch(topic string, partition int32, limit int)
 	return partTracker.pauseFetch(limit)
 }
 
+// flush sends the messages pending within the batchers of all partitions.
+func (c *checkpointTracker) flush(ctx context.Context) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, partitions := range c.topics {
+		for _, tracker := range partitions {
+			if err := tracker.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pending returns the number of messages across all partitions that are yet
+// to be acknowledged.
+func (c *checkpointTracker) pending() (n int64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, partitions := range c.topics {
+		for _, tracker := range partitions {
+			n += tracker.pending()
+		}
+	}
+	return
+}
+
 func (c *checkpointTracker) removeTopicPartitions(ctx context.Context, m map[string][]int32) {
 	c.mut.Lock()
 	defer c.mut.Unlock()
@@ -583,6 +729,27 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 		return service.ErrEndOfInput
 	}
 
+	if f.reachedEnd.Load() {
+		return service.ErrEndOfInput
+	}
+
+	connOpts := []kgo.Opt{
+		kgo.SeedBrokers(f.seedBrokers...),
+		kgo.SASL(f.saslConfs...),
+		kgo.ClientID(f.clientID),
+	}
+	if f.tlsConf != nil {
+		connOpts = append(connOpts, kgo.DialTLSConfig(f.tlsConf))
+	}
+
+	if (f.startConf != nil || f.stopConf != nil) && f.positions == nil {
+		pos, err := f.resolvePositions(ctx, connOpts)
+		if err != nil {
+			return fmt.Errorf("failed to resolve partition offsets: %w", err)
+		}
+		f.positions = pos
+	}
+
 	var initialOffset kgo.Offset
 	if f.startFromOldest {
 		initialOffset = kgo.NewOffset().AtStart()
@@ -594,7 +761,7 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 
 	var cl *kgo.Client
 	commitFn := func(r *kgo.Record) {}
-	if f.consumerGroup != "" {
+	if f.consumerGroup != "" && f.txnGroup == nil {
 		commitFn = func(r *kgo.Record) {
 			if cl == nil {
 				return
@@ -602,39 +769,118 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 			cl.MarkCommitRecords(r)
 		}
 	}
-	checkpoints := newCheckpointTracker(f.res, batchChan, commitFn, f.batchPolicy)
+	releaseFn := func(r *kgo.Record) {
+		f.lag.setCommitted(r.Topic, r.Partition, r.Offset+1)
+		commitFn(r)
+	}
+	checkpoints := newCheckpointTracker(f.res, batchChan, releaseFn, f.batchPolicy)
+
+	consumeTopics, consumePartitions := f.topics, f.topicPartitions
+
+	var bounds *franzBounds
+	if f.positions != nil {
+		if f.consumerGroup == "" {
+			// Without a consumer group we consume the resolved start offset of
+			// each partition explicitly.
+			consumeTopics = nil
+			consumePartitions = map[string]map[int32]kgo.Offset{}
+			for topic, partitions := range f.positions.starts {
+				consumePartitions[topic] = map[int32]kgo.Offset{}
+				for p, offset := range partitions {
+					consumePartitions[topic][p] = kgo.NewOffset().At(offset)
+				}
+			}
+		}
+		if f.stopConf != nil {
+			bounds = newFranzBounds(f.stopConf, f.positions)
+			if f.consumerGroup == "" {
+				bounds.assign(f.positions.partitions, f.positions.starts)
+			}
+		}
+	}
 
-	clientOpts := []kgo.Opt{
-		kgo.SeedBrokers(f.seedBrokers...),
-		kgo.ConsumeTopics(f.topics...),
-		kgo.ConsumePartitions(f.topicPartitions),
+	clientOpts := append(connOpts,
+		kgo.ConsumeTopics(consumeTopics...),
+		kgo.ConsumePartitions(consumePartitions),
 		kgo.ConsumeResetOffset(initialOffset),
-		kgo.SASL(f.saslConfs...),
 		kgo.ConsumerGroup(f.consumerGroup),
-		kgo.ClientID(f.clientID),
 		kgo.Rack(f.rackID),
+	)
+
+	if f.readCommitted {
+		clientOpts = append(clientOpts, kgo.FetchIsolationLevel(kgo.ReadCommitted()))
+	}
+	if bounds != nil {
+		// The final offsets of partitions written to by transactions are
+		// markers that are otherwise never consumed, and therefore we need
+		// them in order to tell when a partition has reached its bound.
+		clientOpts = append(clientOpts, kgo.KeepControlRecords())
 	}
 
-	if f.consumerGroup != "" {
+	if f.txnGroup != nil {
+		// Offsets are committed by the transactions of an output, and
+		// therefore we must ensure that transactions committing offsets of
+		// revoked partitions end before the rebalance completes.
+		clientOpts = append(clientOpts,
+			kgo.OnPartitionsAssigned(func(_ context.Context, _ *kgo.Client, m map[string][]int32) {
+				f.txnGroup.assign(m)
+				if bounds != nil {
+					bounds.assign(m, nil)
+				}
+			}),
+			kgo.OnPartitionsRevoked(func(rctx context.Context, c *kgo.Client, m map[string][]int32) {
+				f.txnGroup.revoke(m)
+				checkpoints.removeTopicPartitions(rctx, m)
+				f.lag.remove(m)
+				if bounds != nil {
+					bounds.revoke(m)
+					c.ResumeFetchPartitions(m)
+				}
+			}),
+			kgo.OnPartitionsLost(func(rctx context.Context, c *kgo.Client, m map[string][]int32) {
+				f.txnGroup.revoke(m)
+				checkpoints.removeTopicPartitions(rctx, m)
+				f.lag.remove(m)
+				if bounds != nil {
+					bounds.revoke(m)
+					c.ResumeFetchPartitions(m)
+				}
+			}),
+			kgo.DisableAutoCommit(),
+			kgo.RequireStableFetchOffsets(),
+			kgo.WithLogger(&kgoLogger{f.log}),
+		)
+	} else if f.consumerGroup != "" {
 		clientOpts = append(clientOpts,
 			kgo.OnPartitionsRevoked(func(rctx context.Context, c *kgo.Client, m map[string][]int32) {
 				if commitErr := c.CommitMarkedOffsets(rctx); commitErr != nil {
 					f.log.Errorf("Commit error on partition revoke: %v", commitErr)
 				}
 				checkpoints.removeTopicPartitions(rctx, m)
+				f.lag.remove(m)
+				if bounds != nil {
+					bounds.revoke(m)
+					c.ResumeFetchPartitions(m)
+				}
 			}),
-			kgo.OnPartitionsLost(func(rctx context.Context, _ *kgo.Client, m map[string][]int32) {
+			kgo.OnPartitionsLost(func(rctx context.Context, c *kgo.Client, m map[string][]int32) {
 				// No point trying to commit our offsets, just clean up our topic map
 				checkpoints.removeTopicPartitions(rctx, m)
+				f.lag.remove(m)
+				if bounds != nil {
+					bounds.revoke(m)
+					c.ResumeFetchPartitions(m)
+				}
 			}),
 			kgo.AutoCommitMarks(),
 			kgo.AutoCommitInterval(f.commitPeriod),
 			kgo.WithLogger(&kgoLogger{f.log}),
 		)
-	}
-
-	if f.tlsConf != nil {
-		clientOpts = append(clientOpts, kgo.DialTLSConfig(f.tlsConf))
+		if bounds != nil {
+			clientOpts = append(clientOpts, kgo.OnPartitionsAssigned(func(_ context.Context, _ *kgo.Client, m map[string][]int32) {
+				bounds.assign(m, nil)
+			}))
+		}
 	}
 
 	if f.regexPattern {
@@ -645,10 +891,16 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 	if cl, err = kgo.NewClient(clientOpts...); err != nil {
 		return err
 	}
+	if f.txnGroup != nil {
+		f.txnGroup.setClient(cl)
+	}
 
 	go func() {
 		defer func() {
 			cl.Close()
+			if f.txnGroup != nil {
+				f.txnGroup.revokeAll()
+			}
 			checkpoints.close()
 			f.storeBatchChan(nil)
 			close(batchChan)
@@ -660,6 +912,14 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 		closeCtx, done := f.shutSig.CloseAtLeisureCtx(context.Background())
 		defer done()
 
+		// High watermarks are also listed independently of fetches, which stop
+		// when partitions are paused due to back pressure.
+		refreshCtx, refreshDone := context.WithCancel(closeCtx)
+		defer refreshDone()
+		go f.lag.refreshHighWatermarks(refreshCtx, consumerLagRefreshPeriod, f.log, func(ctx context.Context, partitions map[string][]int32) (map[string]map[int32]int64, error) {
+			return franzListOffsets(ctx, cl, partitions, -1, f.readCommitted)
+		})
+
 		for {
 			// Using a stall prevention context here because I've realised we
 			// might end up disabling literally all the partitions and topics
@@ -702,10 +962,30 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 			}
 
 			pauseTopicPartitions := map[string][]int32{}
+			fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+				if f.readCommitted {
+					f.lag.setHighWatermark(p.Topic, p.Partition, p.LastStableOffset)
+				} else {
+					f.lag.setHighWatermark(p.Topic, p.Partition, p.HighWatermark)
+				}
+			})
+
 			iter := fetches.RecordIter()
 			for !iter.Done() {
 				record := iter.Next()
-				if checkpoints.addRecord(closeCtx, f.recordToMessage(record), f.checkpointLimit) {
+
+				pause := false
+				if bounds != nil {
+					inBounds, partitionDone := bounds.check(record)
+					pause = partitionDone
+					if !inBounds || record.Attrs.IsControl() {
+						if pause {
+							pauseTopicPartitions[record.Topic] = append(pauseTopicPartitions[record.Topic], record.Partition)
+						}
+						continue
+					}
+				}
+				if checkpoints.addRecord(closeCtx, f.recordToMessage(record), f.checkpointLimit) || pause {
 					pauseTopicPartitions[record.Topic] = append(pauseTopicPartitions[record.Topic], record.Partition)
 				}
 			}
@@ -715,6 +995,9 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 			resumeTopicPartitions := map[string][]int32{}
 			for pausedTopic, pausedPartitions := range cl.PauseFetchPartitions(pauseTopicPartitions) {
 				for _, pausedPartition := range pausedPartitions {
+					if bounds != nil && bounds.isDone(pausedTopic, pausedPartition) {
+						continue
+					}
 					if !checkpoints.pauseFetch(pausedTopic, pausedPartition, f.checkpointLimit) {
 						resumeTopicPartitions[pausedTopic] = append(resumeTopicPartitions[pausedTopic], pausedPartition)
 					}
@@ -723,6 +1006,21 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 			if len(resumeTopicPartitions) > 0 {
 				cl.ResumeFetchPartitions(resumeTopicPartitions)
 			}
+
+			if bounds == nil {
+				continue
+			}
+			if f.consumerGroup != "" {
+				bounds.markPositions(cl.CommittedOffsets())
+			}
+			if bounds.complete() {
+				if err := f.drain(closeCtx, cl, checkpoints); err != nil {
+					return
+				}
+				f.log.Infof("All consumed partitions of Kafka topics %v have reached their stop bounds", f.topics)
+				f.reachedEnd.Store(true)
+				return
+			}
 		}
 	}()
 
@@ -731,6 +1029,88 @@ func (f *franzKafkaReader) Connect(ctx context.Context) error {
 	return nil
 }
 
+// resolvePositions resolves the start and stop offsets of each partition
+// consumed by the input using a temporary client, and positions the consumer
+// group at the start offsets when one is specified.
+func (f *franzKafkaReader) resolvePositions(ctx context.Context, connOpts []kgo.Opt) (*franzPositions, error) {
+	cl, err := kgo.NewClient(connOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+
+	partitions := map[string][]int32{}
+	if len(f.topics) > 0 {
+		counts, err := franzPartitionCounts(ctx, cl, f.topics)
+		if err != nil {
+			return nil, err
+		}
+		for topic, count := range counts {
+			for p := int32(0); p < count; p++ {
+				partitions[topic] = append(partitions[topic], p)
+			}
+		}
+	}
+
+	startConf := f.startConf
+	if len(f.topicPartitions) > 0 {
+		// Explicit partitions may specify their own start offsets, which can
+		// not be combined with a start offset config.
+		startConf = &franzStartConfig{partitionOffsets: map[string]map[int32]int64{}}
+		for topic, parts := range f.topicPartitions {
+			startConf.partitionOffsets[topic] = map[int32]int64{}
+			for p, offset := range parts {
+				partitions[topic] = append(partitions[topic], p)
+				if o := offset.EpochOffset().Offset; o >= 0 {
+					startConf.partitionOffsets[topic][p] = o
+				}
+			}
+		}
+	}
+
+	pos, err := resolveFranzPositions(ctx, cl, partitions, startConf, f.stopConf, f.startFromOldest, f.readCommitted)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.consumerGroup != "" {
+		resetGroup := f.startConf != nil && f.startConf.resetGroup
+		if err := franzCommitStarts(ctx, cl, f.consumerGroup, pos.starts, resetGroup); err != nil {
+			if !isGroupActiveErr(err) {
+				return nil, err
+			}
+			f.log.Warnf("Unable to position consumer group %v at its start offsets as it has active members: %v", f.consumerGroup, err)
+		}
+	}
+	return pos, nil
+}
+
+// drain flushes the pending batches of all partitions and waits for all
+// consumed messages to be acknowledged before committing their offsets.
+func (f *franzKafkaReader) drain(ctx context.Context, cl *kgo.Client, checkpoints *checkpointTracker) error {
+	if err := checkpoints.flush(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for checkpoints.pending() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if f.consumerGroup != "" && f.txnGroup == nil {
+		if err := cl.CommitMarkedOffsets(ctx); err != nil {
+			f.log.Errorf("Failed to commit offsets: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
 func (f *franzKafkaReader) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
 	batchChan := f.getBatchChan()
 	if batchChan == nil {
@@ -742,6 +1122,9 @@ func (f *franzKafkaReader) ReadBatch(ctx context.Context) (service.MessageBatch,
 	select {
 	case mAck, open = <-batchChan:
 		if !open {
+			if f.reachedEnd.Load() {
+				return nil, nil, service.ErrEndOfInput
+			}
 			return nil, nil, service.ErrNotConnected
 		}
 	case <-ctx.Done():
@@ -0,0 +1,554 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	kfiFieldStartOffset      = "start_offset"
+	kfiFieldStopAt           = "stop_at"
+	kfiFieldTimestamp        = "timestamp"
+	kfiFieldBeforeLatest     = "before_latest"
+	kfiFieldPartitionOffsets = "partition_offsets"
+	kfiFieldResetGroup       = "reset_group"
+	kfiFieldLatest           = "latest"
+)
+
+func franzStartOffsetField() *service.ConfigField {
+	return service.NewObjectField(kfiFieldStartOffset,
+		service.NewStringField(kfiFieldTimestamp).
+			Description("An [RFC 3339](https://www.rfc-editor.org/rfc/rfc3339) timestamp, where partitions are consumed from the first record with a timestamp at or after it. Partitions without such a record are consumed from the latest offset.").
+			Example("2023-10-01T00:00:00Z").
+			Optional(),
+		service.NewIntField(kfiFieldBeforeLatest).
+			Description("Consume each partition from this many records before its latest offset, or from its oldest offset when the partition contains fewer records.").
+			Example(1000).
+			Optional(),
+		service.NewIntMapField(kfiFieldPartitionOffsets).
+			Description("Explicit offsets to consume partitions from, keyed by the topic and partition separated by a colon. Partitions not listed are consumed from the `timestamp` or `before_latest` position when specified, otherwise by `start_from_oldest`.").
+			Example(map[string]any{"foo:0": 1200, "foo:1": 3400}).
+			Default(map[string]any{}),
+		service.NewBoolField(kfiFieldResetGroup).
+			Description("Whether to replace the offsets committed by the `consumer_group` with the start position. The offsets of a consumer group can only be reset while the group has no active members, otherwise only partitions without committed offsets are positioned.").
+			Default(false),
+	).
+		Description("An explicit position to start consuming partitions from, which is resolved to an offset for each partition when the input first connects. When a `consumer_group` is specified the start position only applies to partitions without committed offsets, unless `reset_group` is `true`.").
+		Optional().
+		Advanced().
+		Version("4.24.0")
+}
+
+func franzStopAtField() *service.ConfigField {
+	return service.NewObjectField(kfiFieldStopAt,
+		service.NewStringField(kfiFieldTimestamp).
+			Description("An [RFC 3339](https://www.rfc-editor.org/rfc/rfc3339) timestamp, where consumption of a partition stops at the first record with a timestamp at or after it.").
+			Example("2023-10-02T00:00:00Z").
+			Optional(),
+		service.NewBoolField(kfiFieldLatest).
+			Description("Whether to stop consuming partitions at their latest offsets at the time the input first connects.").
+			Default(false),
+		service.NewIntMapField(kfiFieldPartitionOffsets).
+			Description("Explicit offsets to stop consuming partitions at, keyed by the topic and partition separated by a colon. The record at the offset is not consumed, and partitions not listed are only bounded by the `timestamp` or `latest` fields when specified.").
+			Example(map[string]any{"foo:0": 5000}).
+			Default(map[string]any{}),
+	).
+		Description("A bound at which consumption of each partition stops. Once all partitions consumed by the input have reached their bound and all consumed messages have been acknowledged the input shuts down, allowing a pipeline to replay a window of records and then exit. When multiple bounds are specified the earliest applies. When a `consumer_group` is specified each member of the group shuts down once the partitions assigned to it have reached their bounds.").
+		Optional().
+		Advanced().
+		Version("4.24.0")
+}
+
+//------------------------------------------------------------------------------
+
+type franzStartConfig struct {
+	timestamp        time.Time
+	hasBeforeLatest  bool
+	beforeLatest     int64
+	partitionOffsets map[string]map[int32]int64
+	resetGroup       bool
+}
+
+type franzStopConfig struct {
+	timestamp        time.Time
+	latest           bool
+	partitionOffsets map[string]map[int32]int64
+}
+
+func parseFranzTimestamp(conf *service.ParsedConfig) (t time.Time, err error) {
+	if !conf.Contains(kfiFieldTimestamp) {
+		return
+	}
+	var tStr string
+	if tStr, err = conf.FieldString(kfiFieldTimestamp); err != nil || tStr == "" {
+		return
+	}
+	if t, err = time.Parse(time.RFC3339Nano, tStr); err != nil {
+		err = fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+	return
+}
+
+func parseFranzPartitionOffsets(conf *service.ParsedConfig) (map[string]map[int32]int64, error) {
+	offsets, err := conf.FieldIntMap(kfiFieldPartitionOffsets)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]map[int32]int64{}
+	for k, offset := range offsets {
+		i := strings.LastIndex(k, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("partition offset key %q must contain a topic and partition separated by a colon", k)
+		}
+		partition, err := strconv.ParseInt(k[i+1:], 10, 32)
+		if err != nil || partition < 0 {
+			return nil, fmt.Errorf("partition offset key %q contains an invalid partition", k)
+		}
+		if offset < 0 {
+			return nil, fmt.Errorf("partition offset of %q must not be negative", k)
+		}
+		topic := k[:i]
+		if res[topic] == nil {
+			res[topic] = map[int32]int64{}
+		}
+		res[topic][int32(partition)] = int64(offset)
+	}
+	return res, nil
+}
+
+func franzStartConfigFromParsed(conf *service.ParsedConfig) (c *franzStartConfig, err error) {
+	c = &franzStartConfig{}
+	if c.timestamp, err = parseFranzTimestamp(conf); err != nil {
+		return nil, err
+	}
+	if conf.Contains(kfiFieldBeforeLatest) {
+		var beforeLatest int
+		if beforeLatest, err = conf.FieldInt(kfiFieldBeforeLatest); err != nil {
+			return nil, err
+		}
+		if beforeLatest < 0 {
+			return nil, errors.New("before_latest must not be negative")
+		}
+		c.hasBeforeLatest = true
+		c.beforeLatest = int64(beforeLatest)
+	}
+	if !c.timestamp.IsZero() && c.hasBeforeLatest {
+		return nil, errors.New("a start offset cannot have both a timestamp and before_latest")
+	}
+	if c.partitionOffsets, err = parseFranzPartitionOffsets(conf); err != nil {
+		return nil, err
+	}
+	if c.resetGroup, err = conf.FieldBool(kfiFieldResetGroup); err != nil {
+		return nil, err
+	}
+	if c.timestamp.IsZero() && !c.hasBeforeLatest && len(c.partitionOffsets) == 0 {
+		if c.resetGroup {
+			return nil, errors.New("reset_group requires a timestamp, before_latest or partition_offsets to reset the group to")
+		}
+		return nil, nil
+	}
+	return c, nil
+}
+
+func franzStopConfigFromParsed(conf *service.ParsedConfig) (c *franzStopConfig, err error) {
+	c = &franzStopConfig{}
+	if c.timestamp, err = parseFranzTimestamp(conf); err != nil {
+		return nil, err
+	}
+	if c.latest, err = conf.FieldBool(kfiFieldLatest); err != nil {
+		return nil, err
+	}
+	if c.partitionOffsets, err = parseFranzPartitionOffsets(conf); err != nil {
+		return nil, err
+	}
+	if c.timestamp.IsZero() && !c.latest && len(c.partitionOffsets) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+//------------------------------------------------------------------------------
+
+// franzListOffsets returns the offset of each partition for a timestamp, where
+// -2 and -1 are the oldest and latest offsets respectively. Partitions without
+// a record at or after the timestamp have an offset of -1.
+func franzListOffsets(ctx context.Context, cl *kgo.Client, partitions map[string][]int32, timestamp int64, readCommitted bool) (map[string]map[int32]int64, error) {
+	req := kmsg.NewPtrListOffsetsRequest()
+	if readCommitted {
+		req.IsolationLevel = 1
+	}
+	for topic, parts := range partitions {
+		reqTopic := kmsg.NewListOffsetsRequestTopic()
+		reqTopic.Topic = topic
+		for _, p := range parts {
+			reqPart := kmsg.NewListOffsetsRequestTopicPartition()
+			reqPart.Partition = p
+			reqPart.Timestamp = timestamp
+			reqTopic.Partitions = append(reqTopic.Partitions, reqPart)
+		}
+		req.Topics = append(req.Topics, reqTopic)
+	}
+
+	res, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := map[string]map[int32]int64{}
+	for _, t := range res.Topics {
+		for _, p := range t.Partitions {
+			if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+				return nil, fmt.Errorf("failed to list offsets of topic %v partition %v: %w", t.Topic, p.Partition, err)
+			}
+			if offsets[t.Topic] == nil {
+				offsets[t.Topic] = map[int32]int64{}
+			}
+			offsets[t.Topic][p.Partition] = p.Offset
+		}
+	}
+	return offsets, nil
+}
+
+// franzPositions are the resolved start and end offsets of the partitions
+// consumed by an input, where an end offset of -1 means the partition is only
+// bounded by a stop timestamp, if at all.
+type franzPositions struct {
+	partitions map[string][]int32
+	starts     map[string]map[int32]int64
+	ends       map[string]map[int32]int64
+}
+
+// resolveFranzPositions resolves the start and stop configs of an input into
+// offsets for each partition of its topics.
+func resolveFranzPositions(
+	ctx context.Context,
+	cl *kgo.Client,
+	partitions map[string][]int32,
+	startConf *franzStartConfig,
+	stopConf *franzStopConfig,
+	startFromOldest bool,
+	readCommitted bool,
+) (*franzPositions, error) {
+	oldest, err := franzListOffsets(ctx, cl, partitions, -2, readCommitted)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := franzListOffsets(ctx, cl, partitions, -1, readCommitted)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := &franzPositions{
+		partitions: partitions,
+		starts:     map[string]map[int32]int64{},
+	}
+
+	var startTimestamps map[string]map[int32]int64
+	if startConf != nil && !startConf.timestamp.IsZero() {
+		if startTimestamps, err = franzListOffsets(ctx, cl, partitions, startConf.timestamp.UnixMilli(), readCommitted); err != nil {
+			return nil, err
+		}
+	}
+
+	for topic, parts := range partitions {
+		pos.starts[topic] = map[int32]int64{}
+		for _, p := range parts {
+			start := latest[topic][p]
+			if startFromOldest {
+				start = oldest[topic][p]
+			}
+			if startConf != nil {
+				if explicit, exists := startConf.partitionOffsets[topic][p]; exists {
+					start = explicit
+				} else if startTimestamps != nil {
+					if start = startTimestamps[topic][p]; start < 0 {
+						start = latest[topic][p]
+					}
+				} else if startConf.hasBeforeLatest {
+					if start = latest[topic][p] - startConf.beforeLatest; start < oldest[topic][p] {
+						start = oldest[topic][p]
+					}
+				}
+			}
+			pos.starts[topic][p] = start
+		}
+	}
+
+	if stopConf == nil {
+		return pos, nil
+	}
+
+	var stopTimestamps map[string]map[int32]int64
+	if !stopConf.timestamp.IsZero() {
+		if stopTimestamps, err = franzListOffsets(ctx, cl, partitions, stopConf.timestamp.UnixMilli(), readCommitted); err != nil {
+			return nil, err
+		}
+	}
+
+	pos.ends = map[string]map[int32]int64{}
+	for topic, parts := range partitions {
+		pos.ends[topic] = map[int32]int64{}
+		for _, p := range parts {
+			end := int64(-1)
+			lower := func(v int64) {
+				if end < 0 || v < end {
+					end = v
+				}
+			}
+			if explicit, exists := stopConf.partitionOffsets[topic][p]; exists {
+				lower(explicit)
+			}
+			if stopConf.latest {
+				lower(latest[topic][p])
+			}
+			if stopTimestamps != nil {
+				if offset := stopTimestamps[topic][p]; offset >= 0 {
+					lower(offset)
+				} else if !stopConf.timestamp.After(time.Now()) {
+					// No record is yet to reach the timestamp, and as it has
+					// already passed we can bound the partition by its latest
+					// offset.
+					lower(latest[topic][p])
+				}
+			}
+			pos.ends[topic][p] = end
+		}
+	}
+	return pos, nil
+}
+
+// franzCommitStarts commits the start offsets of partitions for a consumer
+// group, either for all partitions or only those without committed offsets.
+func franzCommitStarts(ctx context.Context, cl *kgo.Client, group string, starts map[string]map[int32]int64, all bool) error {
+	commit := starts
+	if !all {
+		fetchReq := kmsg.NewPtrOffsetFetchRequest()
+		fetchReq.Group = group
+		for topic, parts := range starts {
+			reqTopic := kmsg.NewOffsetFetchRequestTopic()
+			reqTopic.Topic = topic
+			for p := range parts {
+				reqTopic.Partitions = append(reqTopic.Partitions, p)
+			}
+			fetchReq.Topics = append(fetchReq.Topics, reqTopic)
+		}
+
+		fetchRes, err := fetchReq.RequestWith(ctx, cl)
+		if err != nil {
+			return err
+		}
+		if err := kerr.ErrorForCode(fetchRes.ErrorCode); err != nil {
+			return fmt.Errorf("failed to fetch committed offsets: %w", err)
+		}
+
+		commit = map[string]map[int32]int64{}
+		for topic, parts := range starts {
+			commit[topic] = map[int32]int64{}
+			for p, offset := range parts {
+				commit[topic][p] = offset
+			}
+		}
+		for _, t := range fetchRes.Topics {
+			for _, p := range t.Partitions {
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+					return fmt.Errorf("failed to fetch committed offset of topic %v partition %v: %w", t.Topic, p.Partition, err)
+				}
+				if p.Offset >= 0 {
+					delete(commit[t.Topic], p.Partition)
+				}
+			}
+		}
+	}
+
+	// Offsets are committed outside of the group generation, which is only
+	// accepted by the coordinator while the group has no active members.
+	commitReq := kmsg.NewPtrOffsetCommitRequest()
+	commitReq.Group = group
+	commitReq.Generation = -1
+	for topic, parts := range commit {
+		if len(parts) == 0 {
+			continue
+		}
+		reqTopic := kmsg.NewOffsetCommitRequestTopic()
+		reqTopic.Topic = topic
+		for p, offset := range parts {
+			reqPart := kmsg.NewOffsetCommitRequestTopicPartition()
+			reqPart.Partition = p
+			reqPart.Offset = offset
+			reqTopic.Partitions = append(reqTopic.Partitions, reqPart)
+		}
+		commitReq.Topics = append(commitReq.Topics, reqTopic)
+	}
+	if len(commitReq.Topics) == 0 {
+		return nil
+	}
+
+	commitRes, err := commitReq.RequestWith(ctx, cl)
+	if err != nil {
+		return err
+	}
+	for _, t := range commitRes.Topics {
+		for _, p := range t.Partitions {
+			if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+				return fmt.Errorf("failed to commit offset of topic %v partition %v: %w", t.Topic, p.Partition, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isGroupActiveErr returns whether an error indicates that offsets could not
+// be committed outside of the consumer group as it has active members.
+func isGroupActiveErr(err error) bool {
+	return errors.Is(err, kerr.UnknownMemberID) ||
+		errors.Is(err, kerr.IllegalGeneration) ||
+		errors.Is(err, kerr.RebalanceInProgress)
+}
+
+//------------------------------------------------------------------------------
+
+// franzBounds tracks the progress of the partitions consumed by an input
+// towards their stop bounds.
+type franzBounds struct {
+	stopTimestamp time.Time
+
+	mut          sync.Mutex
+	ends         map[string]map[int32]int64
+	assigned     map[string]map[int32]struct{}
+	assignedOnce bool
+	done         map[string]map[int32]struct{}
+}
+
+func newFranzBounds(stopConf *franzStopConfig, pos *franzPositions) *franzBounds {
+	return &franzBounds{
+		stopTimestamp: stopConf.timestamp,
+		ends:          pos.ends,
+		assigned:      map[string]map[int32]struct{}{},
+		done:          map[string]map[int32]struct{}{},
+	}
+}
+
+func addTopicPartition(m map[string]map[int32]struct{}, topic string, partition int32) {
+	if m[topic] == nil {
+		m[topic] = map[int32]struct{}{}
+	}
+	m[topic][partition] = struct{}{}
+}
+
+// assign adds partitions to those consumed by the input, where partitions
+// positioned at or beyond their end offsets are immediately done.
+func (b *franzBounds) assign(m map[string][]int32, positions map[string]map[int32]int64) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	b.assignedOnce = true
+	for topic, partitions := range m {
+		for _, p := range partitions {
+			addTopicPartition(b.assigned, topic, p)
+			end, exists := b.ends[topic][p]
+			if !exists {
+				// Partitions created after the bounds were resolved are done
+				// immediately.
+				addTopicPartition(b.done, topic, p)
+				continue
+			}
+			if pos, exists := positions[topic][p]; exists && end >= 0 && pos >= end {
+				addTopicPartition(b.done, topic, p)
+			}
+		}
+	}
+}
+
+func (b *franzBounds) revoke(m map[string][]int32) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	for topic, partitions := range m {
+		for _, p := range partitions {
+			delete(b.assigned[topic], p)
+			delete(b.done[topic], p)
+		}
+	}
+}
+
+// markPositions marks partitions as done when their positions, such as their
+// committed offsets, have reached their end offsets.
+func (b *franzBounds) markPositions(positions map[string]map[int32]kgo.EpochOffset) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	for topic, partitions := range b.assigned {
+		for p := range partitions {
+			pos, exists := positions[topic][p]
+			if !exists {
+				continue
+			}
+			if end, exists := b.ends[topic][p]; exists && end >= 0 && pos.Offset >= end {
+				addTopicPartition(b.done, topic, p)
+			}
+		}
+	}
+}
+
+// check returns whether a record is within the bounds of its partition, and
+// whether its partition is done after the record. Records include transaction
+// markers, which are checked in order to reach the end offsets of partitions
+// written to by transactions but are never consumed.
+func (b *franzBounds) check(r *kgo.Record) (inBounds, partitionDone bool) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if _, done := b.done[r.Topic][r.Partition]; done {
+		return false, true
+	}
+
+	end, exists := b.ends[r.Topic][r.Partition]
+	if !exists || (end >= 0 && r.Offset >= end) ||
+		(!b.stopTimestamp.IsZero() && !r.Timestamp.Before(b.stopTimestamp)) {
+		addTopicPartition(b.done, r.Topic, r.Partition)
+		return false, true
+	}
+	if end >= 0 && r.Offset >= end-1 {
+		addTopicPartition(b.done, r.Topic, r.Partition)
+		return true, true
+	}
+	return true, false
+}
+
+func (b *franzBounds) isDone(topic string, partition int32) bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	_, done := b.done[topic][partition]
+	return done
+}
+
+// complete returns whether all partitions consumed by the input are done.
+func (b *franzBounds) complete() bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if !b.assignedOnce {
+		return false
+	}
+	for topic, partitions := range b.assigned {
+		for p := range partitions {
+			if _, done := b.done[topic][p]; !done {
+				return false
+			}
+		}
+	}
+	return true
+}
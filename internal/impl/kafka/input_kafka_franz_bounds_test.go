@@ -0,0 +1,258 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func TestFranzStartConfigFromParsed(t *testing.T) {
+	spec := service.NewConfigSpec().Field(franzStartOffsetField())
+
+	for _, test := range []struct {
+		name     string
+		conf     string
+		expected *franzStartConfig
+		errs     string
+	}{
+		{
+			name: "timestamp",
+			conf: `
+start_offset:
+  timestamp: 2023-10-01T00:00:00Z
+  reset_group: true
+`,
+			expected: &franzStartConfig{
+				timestamp:        time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+				partitionOffsets: map[string]map[int32]int64{},
+				resetGroup:       true,
+			},
+		},
+		{
+			name: "before latest and partition offsets",
+			conf: `
+start_offset:
+  before_latest: 100
+  partition_offsets:
+    foo:0: 10
+    foo:1: 20
+    bar:baz:2: 30
+`,
+			expected: &franzStartConfig{
+				hasBeforeLatest: true,
+				beforeLatest:    100,
+				partitionOffsets: map[string]map[int32]int64{
+					"foo":     {0: 10, 1: 20},
+					"bar:baz": {2: 30},
+				},
+			},
+		},
+		{
+			name: "zero before latest",
+			conf: `
+start_offset:
+  before_latest: 0
+`,
+			expected: &franzStartConfig{
+				hasBeforeLatest:  true,
+				partitionOffsets: map[string]map[int32]int64{},
+			},
+		},
+		{
+			name: "reset group without position",
+			conf: `
+start_offset:
+  reset_group: true
+`,
+			errs: "reset_group requires a timestamp, before_latest or partition_offsets",
+		},
+		{
+			name: "timestamp and before latest",
+			conf: `
+start_offset:
+  timestamp: 2023-10-01T00:00:00Z
+  before_latest: 100
+`,
+			errs: "cannot have both a timestamp and before_latest",
+		},
+		{
+			name: "bad timestamp",
+			conf: `
+start_offset:
+  timestamp: yesterday
+`,
+			errs: "failed to parse timestamp",
+		},
+		{
+			name: "missing partition",
+			conf: `
+start_offset:
+  partition_offsets:
+    foo: 10
+`,
+			errs: "must contain a topic and partition",
+		},
+		{
+			name: "bad partition",
+			conf: `
+start_offset:
+  partition_offsets:
+    foo:bar: 10
+`,
+			errs: "contains an invalid partition",
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pConf, err := spec.ParseYAML(test.conf, nil)
+			require.NoError(t, err)
+
+			startConf, err := franzStartConfigFromParsed(pConf.Namespace(kfiFieldStartOffset))
+			if test.errs != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errs)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, startConf)
+		})
+	}
+}
+
+func TestFranzStopConfigFromParsed(t *testing.T) {
+	spec := service.NewConfigSpec().Field(franzStopAtField())
+
+	pConf, err := spec.ParseYAML(`
+stop_at:
+  latest: true
+  partition_offsets:
+    foo:0: 10
+`, nil)
+	require.NoError(t, err)
+
+	stopConf, err := franzStopConfigFromParsed(pConf.Namespace(kfiFieldStopAt))
+	require.NoError(t, err)
+	assert.Equal(t, &franzStopConfig{
+		latest:           true,
+		partitionOffsets: map[string]map[int32]int64{"foo": {0: 10}},
+	}, stopConf)
+
+	pConf, err = spec.ParseYAML(`stop_at: {}`, nil)
+	require.NoError(t, err)
+
+	stopConf, err = franzStopConfigFromParsed(pConf.Namespace(kfiFieldStopAt))
+	require.NoError(t, err)
+	assert.Nil(t, stopConf)
+}
+
+func TestFranzInputBoundsConfigErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		conf string
+		errs string
+	}{
+		{
+			name: "start offset with regexp topics",
+			conf: `
+seed_brokers: [ localhost:9092 ]
+topics: [ 'foo.*' ]
+regexp_topics: true
+start_offset:
+  before_latest: 10
+`,
+			errs: "cannot be combined with regular expression topics",
+		},
+		{
+			name: "start offset with explicit partitions",
+			conf: `
+seed_brokers: [ localhost:9092 ]
+topics: [ 'foo:0' ]
+start_offset:
+  before_latest: 10
+`,
+			errs: "cannot be combined with explicit topic partitions",
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pConf, err := franzKafkaInputConfig().ParseYAML(test.conf, nil)
+			require.NoError(t, err)
+
+			_, err = newFranzKafkaReaderFromConfig(pConf, service.MockResources())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errs)
+		})
+	}
+}
+
+func TestFranzBounds(t *testing.T) {
+	stopTime := time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)
+	bounds := newFranzBounds(&franzStopConfig{timestamp: stopTime}, &franzPositions{
+		ends: map[string]map[int32]int64{
+			"foo": {0: 10, 1: 5, 2: -1, 3: 20, 5: 30},
+		},
+	})
+
+	assert.False(t, bounds.complete())
+
+	bounds.assign(map[string][]int32{"foo": {0, 1, 2, 3, 4, 5}}, map[string]map[int32]int64{
+		"foo": {0: 0, 1: 5, 2: 0, 3: 0, 5: 0},
+	})
+
+	// Partition 1 starts at its end and partition 4 is unknown to the bounds.
+	assert.True(t, bounds.isDone("foo", 1))
+	assert.True(t, bounds.isDone("foo", 4))
+	assert.False(t, bounds.isDone("foo", 0))
+
+	record := func(partition int32, offset int64, ts time.Time) *kgo.Record {
+		return &kgo.Record{Topic: "foo", Partition: partition, Offset: offset, Timestamp: ts}
+	}
+	before := stopTime.Add(-time.Hour)
+
+	inBounds, done := bounds.check(record(0, 8, before))
+	assert.True(t, inBounds)
+	assert.False(t, done)
+
+	inBounds, done = bounds.check(record(0, 9, before))
+	assert.True(t, inBounds)
+	assert.True(t, done)
+
+	inBounds, done = bounds.check(record(0, 10, before))
+	assert.False(t, inBounds)
+	assert.True(t, done)
+
+	// Partition 2 is only bounded by the stop timestamp.
+	inBounds, done = bounds.check(record(2, 1000, before))
+	assert.True(t, inBounds)
+	assert.False(t, done)
+
+	inBounds, done = bounds.check(record(2, 1001, stopTime))
+	assert.False(t, inBounds)
+	assert.True(t, done)
+
+	// Partition 5 was written to by a transaction, where the final offset is
+	// the commit marker, which is checked but not consumed.
+	inBounds, done = bounds.check(record(5, 28, before))
+	assert.True(t, inBounds)
+	assert.False(t, done)
+
+	inBounds, done = bounds.check(record(5, 29, before))
+	assert.True(t, inBounds)
+	assert.True(t, done)
+
+	assert.False(t, bounds.complete())
+
+	bounds.markPositions(map[string]map[int32]kgo.EpochOffset{
+		"foo": {3: {Offset: 20}},
+	})
+	assert.True(t, bounds.complete())
+
+	bounds.revoke(map[string][]int32{"foo": {3}})
+	bounds.assign(map[string][]int32{"foo": {3}}, nil)
+	assert.False(t, bounds.complete())
+}
@@ -0,0 +1,198 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+// consumerLagRefreshPeriod is the period at which the high watermarks of
+// partitions are listed independently of fetches, so that the lag of a stalled
+// pipeline continues to grow.
+const consumerLagRefreshPeriod = time.Second * 10
+
+// consumerLagDocs describes the metrics emitted by consumerLagMetrics, and is
+// shared by the docs of the Kafka inputs.
+const consumerLagDocs = `
+### Metrics
+
+This input emits the following gauges labelled by ` + "`topic`" + ` and ` + "`partition`" + ` for each partition it consumes:
+
+- ` + "`kafka_high_watermark`" + `: The offset following the last record of the partition, as reported by the latest fetch or by listing the offsets of the partition, which is done every 10 seconds even while consumption is stalled.
+- ` + "`kafka_committed_offset`" + `: The offset following the last message of the partition that was acknowledged, which is the offset committed to the consumer group (when applicable) at the next commit.
+- ` + "`kafka_consumer_lag`" + `: The number of records between the committed offset and the high watermark.
+
+The lag of a partition is reset to zero when it is no longer consumed by this input, for example after being assigned to another member of a consumer group.
+`
+
+type lagPosition struct {
+	highWatermark int64
+	committed     int64
+}
+
+// consumerLagMetrics tracks the high watermark and committed offset of each
+// partition consumed by an input in order to emit the lag of the partition.
+type consumerLagMetrics struct {
+	mLag           *service.MetricGauge
+	mCommitted     *service.MetricGauge
+	mHighWatermark *service.MetricGauge
+
+	mut       sync.Mutex
+	positions map[string]map[int32]*lagPosition
+}
+
+func newConsumerLagMetrics(m *service.Metrics) *consumerLagMetrics {
+	return &consumerLagMetrics{
+		mLag:           m.NewGauge("kafka_consumer_lag", "topic", "partition"),
+		mCommitted:     m.NewGauge("kafka_committed_offset", "topic", "partition"),
+		mHighWatermark: m.NewGauge("kafka_high_watermark", "topic", "partition"),
+		positions:      map[string]map[int32]*lagPosition{},
+	}
+}
+
+func (c *consumerLagMetrics) position(topic string, partition int32) *lagPosition {
+	parts := c.positions[topic]
+	if parts == nil {
+		parts = map[int32]*lagPosition{}
+		c.positions[topic] = parts
+	}
+	pos := parts[partition]
+	if pos == nil {
+		pos = &lagPosition{highWatermark: -1, committed: -1}
+		parts[partition] = pos
+	}
+	return pos
+}
+
+// emitLag sets the lag of a partition once both its high watermark and
+// committed offset are known.
+func (c *consumerLagMetrics) emitLag(pos *lagPosition, topic, partition string) {
+	if pos.highWatermark < 0 || pos.committed < 0 {
+		return
+	}
+	lag := pos.highWatermark - pos.committed
+	if lag < 0 {
+		lag = 0
+	}
+	c.mLag.Set(lag, topic, partition)
+}
+
+func (c *consumerLagMetrics) setHighWatermark(topic string, partition int32, offset int64) {
+	if offset < 0 {
+		return
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.setPositionHighWatermark(c.position(topic, partition), topic, partition, offset)
+}
+
+func (c *consumerLagMetrics) setPositionHighWatermark(pos *lagPosition, topic string, partition int32, offset int64) {
+	if pos.highWatermark == offset {
+		return
+	}
+	pos.highWatermark = offset
+
+	partStr := strconv.Itoa(int(partition))
+	c.mHighWatermark.Set(offset, topic, partStr)
+	c.emitLag(pos, topic, partStr)
+}
+
+func (c *consumerLagMetrics) setCommitted(topic string, partition int32, offset int64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	pos := c.position(topic, partition)
+	if pos.committed == offset {
+		return
+	}
+	pos.committed = offset
+
+	partStr := strconv.Itoa(int(partition))
+	c.mCommitted.Set(offset, topic, partStr)
+	c.emitLag(pos, topic, partStr)
+}
+
+// remove stops tracking partitions that are no longer consumed by the input,
+// resetting their lag.
+func (c *consumerLagMetrics) remove(m map[string][]int32) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for topic, partitions := range m {
+		parts := c.positions[topic]
+		for _, p := range partitions {
+			if _, exists := parts[p]; !exists {
+				continue
+			}
+			delete(parts, p)
+			c.mLag.Set(0, topic, strconv.Itoa(int(p)))
+		}
+		if len(parts) == 0 {
+			delete(c.positions, topic)
+		}
+	}
+}
+
+// partitions returns the partitions currently tracked.
+func (c *consumerLagMetrics) partitions() map[string][]int32 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	m := make(map[string][]int32, len(c.positions))
+	for topic, parts := range c.positions {
+		for p := range parts {
+			m[topic] = append(m[topic], p)
+		}
+	}
+	return m
+}
+
+// updateHighWatermarks sets the high watermarks of partitions that are still
+// tracked.
+func (c *consumerLagMetrics) updateHighWatermarks(offsets map[string]map[int32]int64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for topic, parts := range offsets {
+		for p, offset := range parts {
+			if pos, tracked := c.positions[topic][p]; tracked && offset >= 0 {
+				c.setPositionHighWatermark(pos, topic, p, offset)
+			}
+		}
+	}
+}
+
+// refreshHighWatermarks periodically lists the high watermarks of the tracked
+// partitions until the context is cancelled.
+func (c *consumerLagMetrics) refreshHighWatermarks(
+	ctx context.Context,
+	period time.Duration,
+	log *service.Logger,
+	listEnds func(ctx context.Context, partitions map[string][]int32) (map[string]map[int32]int64, error),
+) {
+	for {
+		select {
+		case <-time.After(period):
+		case <-ctx.Done():
+			return
+		}
+
+		partitions := c.partitions()
+		if len(partitions) == 0 {
+			continue
+		}
+		offsets, err := listEnds(ctx, partitions)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Debugf("Failed to list high watermarks: %v", err)
+			}
+			continue
+		}
+		c.updateHighWatermarks(offsets)
+	}
+}
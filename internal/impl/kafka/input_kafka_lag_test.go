@@ -0,0 +1,132 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/usedatabrew/benthos/v4/internal/component/metrics"
+	"github.com/usedatabrew/benthos/v4/internal/manager/mock"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func TestConsumerLagMetricsPositions(t *testing.T) {
+	lag := newConsumerLagMetrics(service.MockResources().Metrics())
+
+	lag.setHighWatermark("foo", 0, 100)
+	lag.setHighWatermark("foo", 1, -1)
+	lag.setCommitted("foo", 0, 40)
+	lag.setCommitted("foo", 1, 10)
+	lag.setCommitted("bar", 0, 5)
+
+	assert.Equal(t, map[string]map[int32]*lagPosition{
+		"foo": {
+			0: {highWatermark: 100, committed: 40},
+			1: {highWatermark: -1, committed: 10},
+		},
+		"bar": {
+			0: {highWatermark: -1, committed: 5},
+		},
+	}, lag.positions)
+
+	lag.remove(map[string][]int32{"foo": {0}, "bar": {0}, "baz": {3}})
+
+	assert.Equal(t, map[string]map[int32]*lagPosition{
+		"foo": {
+			1: {highWatermark: -1, committed: 10},
+		},
+	}, lag.positions)
+}
+
+func newLocalLagMetrics() (*consumerLagMetrics, *metrics.Local) {
+	local := metrics.NewLocal()
+	res := service.MockResources(func(m *mock.Manager) {
+		m.M = local
+	})
+	return newConsumerLagMetrics(res.Metrics()), local
+}
+
+func TestConsumerLagMetricsGauges(t *testing.T) {
+	lag, local := newLocalLagMetrics()
+
+	lag.setHighWatermark("foo", 0, 100)
+	lag.setCommitted("foo", 0, 40)
+	lag.setCommitted("foo", 1, 10)
+
+	assert.Equal(t, map[string]int64{
+		`kafka_high_watermark{partition="0",topic="foo"}`:   100,
+		`kafka_committed_offset{partition="0",topic="foo"}`: 40,
+		`kafka_committed_offset{partition="1",topic="foo"}`: 10,
+		`kafka_consumer_lag{partition="0",topic="foo"}`:     60,
+	}, local.GetCounters())
+
+	lag.setHighWatermark("foo", 1, 15)
+	lag.setCommitted("foo", 0, 100)
+	lag.remove(map[string][]int32{"foo": {1}})
+
+	assert.Equal(t, map[string]int64{
+		`kafka_high_watermark{partition="0",topic="foo"}`:   100,
+		`kafka_high_watermark{partition="1",topic="foo"}`:   15,
+		`kafka_committed_offset{partition="0",topic="foo"}`: 100,
+		`kafka_committed_offset{partition="1",topic="foo"}`: 10,
+		`kafka_consumer_lag{partition="0",topic="foo"}`:     0,
+		`kafka_consumer_lag{partition="1",topic="foo"}`:     0,
+	}, local.GetCounters())
+}
+
+func TestConsumerLagMetricsRefresh(t *testing.T) {
+	lag, local := newLocalLagMetrics()
+
+	lag.setHighWatermark("foo", 0, 100)
+	lag.setCommitted("foo", 0, 100)
+	lag.setCommitted("foo", 1, 20)
+
+	var mut sync.Mutex
+	var listed []map[string][]int32
+	failed := false
+	listEnds := func(ctx context.Context, partitions map[string][]int32) (map[string]map[int32]int64, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		if !failed {
+			failed = true
+			return nil, errors.New("nope")
+		}
+		listed = append(listed, partitions)
+		return map[string]map[int32]int64{
+			"foo": {0: 150, 1: 25},
+			"bar": {0: 10},
+		}, nil
+	}
+
+	ctx, done := context.WithCancel(context.Background())
+	refreshDone := make(chan struct{})
+	go func() {
+		lag.refreshHighWatermarks(ctx, time.Millisecond, service.MockResources().Logger(), listEnds)
+		close(refreshDone)
+	}()
+
+	// The lag grows without any records being fetched or committed.
+	assert.Eventually(t, func() bool {
+		return local.GetCounters()[`kafka_consumer_lag{partition="0",topic="foo"}`] == 50
+	}, time.Second*5, time.Millisecond)
+
+	done()
+	<-refreshDone
+
+	mut.Lock()
+	assert.ElementsMatch(t, []int32{0, 1}, listed[0]["foo"])
+	mut.Unlock()
+
+	counters := local.GetCounters()
+	assert.Equal(t, int64(150), counters[`kafka_high_watermark{partition="0",topic="foo"}`])
+	assert.Equal(t, int64(25), counters[`kafka_high_watermark{partition="1",topic="foo"}`])
+	assert.Equal(t, int64(5), counters[`kafka_consumer_lag{partition="1",topic="foo"}`])
+
+	// Partitions that are not tracked are ignored.
+	_, exists := counters[`kafka_high_watermark{partition="0",topic="bar"}`]
+	assert.False(t, exists)
+}
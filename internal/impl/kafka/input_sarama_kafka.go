@@ -65,7 +65,7 @@ This input adds the following metadata fields to each message:
 The field `+"`kafka_lag`"+` is the calculated difference between the high water mark offset of the partition at the time of ingestion and the current message offset.
 
 You can access these metadata fields using [function interpolation](/docs/configuration/interpolation#bloblang-queries).
-
+`+consumerLagDocs+`
 ### Ordering
 
 By default messages of a topic partition can be processed in parallel, up to a limit determined by the field `+"`checkpoint_limit`"+`. However, if strict ordered processing is required then this value must be set to 1 in order to process shard messages in lock-step. When doing so it is recommended that you perform batching at this component for performance as it will not be possible to batch lock-stepped messages at the output level.
@@ -191,6 +191,7 @@ type kafkaReader struct {
 	msgChan         chan asyncMessage
 	session         offsetMarker
 
+	lag *consumerLagMetrics
 	mgr *service.Resources
 
 	closeOnce  sync.Once
@@ -202,6 +203,7 @@ var errCannotMixBalanced = errors.New("it is not currently possible to include b
 func newKafkaReaderFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (*kafkaReader, error) {
 	k := kafkaReader{
 		consumerCloseFn: nil,
+		lag:             newConsumerLagMetrics(mgr.Metrics()),
 		mgr:             mgr,
 		closedChan:      make(chan struct{}),
 		topicPartitions: map[string][]int32{},
@@ -303,6 +305,7 @@ func (k *kafkaReader) asyncCheckpointer(topic string, partition int32) func(cont
 				if maxOffset == nil {
 					return nil
 				}
+				k.lag.setCommitted(topic, partition, *maxOffset)
 				k.cMut.Lock()
 				if k.session != nil {
 					k.mgr.Logger().Tracef("Marking offset for topic '%v' partition '%v'.\n", topic, partition)
@@ -333,6 +336,7 @@ func (k *kafkaReader) syncCheckpointer(topic string, partition int32) func(conte
 			ackFn: func(ctx context.Context, res error) error {
 				resErr := res
 				if resErr == nil {
+					k.lag.setCommitted(topic, partition, offset)
 					k.cMut.Lock()
 					if k.session != nil {
 						k.mgr.Logger().Debugf("Marking offset for topic '%v' partition '%v'.\n", topic, partition)
@@ -402,6 +406,28 @@ func dataToPart(highestOffset int64, data *sarama.ConsumerMessage, multiHeader b
 	return part
 }
 
+// saramaListEnds returns a function that lists the high watermarks of
+// partitions with a client, for refreshing consumer lag metrics.
+func saramaListEnds(client sarama.Client) func(context.Context, map[string][]int32) (map[string]map[int32]int64, error) {
+	return func(ctx context.Context, partitions map[string][]int32) (map[string]map[int32]int64, error) {
+		offsets := make(map[string]map[int32]int64, len(partitions))
+		for topic, parts := range partitions {
+			offsets[topic] = make(map[int32]int64, len(parts))
+			for _, p := range parts {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				offset, err := client.GetOffset(topic, p, sarama.OffsetNewest)
+				if err != nil {
+					return nil, err
+				}
+				offsets[topic][p] = offset
+			}
+		}
+		return offsets, nil
+	}
+}
+
 //------------------------------------------------------------------------------
 
 func (k *kafkaReader) closeGroupAndConsumers() {
@@ -34,6 +34,7 @@ func (k *kafkaReader) ConsumeClaim(sess sarama.ConsumerGroupSession, claim saram
 	topic, partition := claim.Topic(), claim.Partition()
 	k.mgr.Logger().Debugf("Consuming messages from topic '%v' partition '%v'\n", topic, partition)
 	defer k.mgr.Logger().Debugf("Stopped consuming messages from topic '%v' partition '%v'\n", topic, partition)
+	defer k.lag.remove(map[string][]int32{topic: {partition}})
 
 	latestOffset := claim.InitialOffset()
 
@@ -78,6 +79,7 @@ func (k *kafkaReader) ConsumeClaim(sess sarama.ConsumerGroupSession, claim saram
 			}
 
 			latestOffset = data.Offset
+			k.lag.setHighWatermark(topic, partition, claim.HighWaterMarkOffset())
 			part := dataToPart(claim.HighWaterMarkOffset(), data, k.multiHeader)
 
 			if batchPolicy.Add(part) {
@@ -100,9 +102,17 @@ func (k *kafkaReader) ConsumeClaim(sess sarama.ConsumerGroupSession, claim saram
 //------------------------------------------------------------------------------
 
 func (k *kafkaReader) connectBalancedTopics(ctx context.Context, config *sarama.Config) error {
+	// The client is created separately from the group so that it can also be
+	// used to list the high watermarks of claimed partitions.
+	client, err := sarama.NewClient(k.addresses, config)
+	if err != nil {
+		return err
+	}
+
 	// Start a new consumer group
-	group, err := sarama.NewConsumerGroup(k.addresses, k.consumerGroup, config)
+	group, err := sarama.NewConsumerGroupFromClient(k.consumerGroup, client)
 	if err != nil {
+		client.Close()
 		return err
 	}
 
@@ -126,6 +136,8 @@ func (k *kafkaReader) connectBalancedTopics(ctx context.Context, config *sarama.
 	}()
 
 	consumerDoneCtx, finishedFn := context.WithCancel(context.Background())
+	refreshCtx, refreshDoneFn := context.WithCancel(context.Background())
+	go k.lag.refreshHighWatermarks(refreshCtx, consumerLagRefreshPeriod, k.mgr.Logger(), saramaListEnds(client))
 	go func() {
 		defer finishedFn()
 	groupLoop:
@@ -153,7 +165,9 @@ func (k *kafkaReader) connectBalancedTopics(ctx context.Context, config *sarama.
 		}
 		k.mgr.Logger().Debug("Closing consumer group")
 
+		refreshDoneFn()
 		group.Close()
+		client.Close()
 
 		k.cMut.Lock()
 		if k.msgChan != nil {
@@ -32,6 +32,7 @@ func (k *kafkaReader) runPartitionConsumer(
 	k.mgr.Logger().Debugf("Consuming messages from topic '%v' partition '%v'\n", topic, partition)
 	defer k.mgr.Logger().Debugf("Stopped consuming messages from topic '%v' partition '%v'\n", topic, partition)
 	defer wg.Done()
+	defer k.lag.remove(map[string][]int32{topic: {partition}})
 
 	batchPolicy, err := k.batching.NewBatcher(k.mgr)
 	if err != nil {
@@ -78,6 +79,7 @@ partMsgLoop:
 			k.mgr.Logger().Tracef("Received message from topic %v partition %v\n", topic, partition)
 
 			latestOffset = data.Offset
+			k.lag.setHighWatermark(topic, partition, consumer.HighWaterMarkOffset())
 			part := dataToPart(consumer.HighWaterMarkOffset(), data, k.multiHeader)
 
 			if batchPolicy.Add(part) {
@@ -250,6 +252,7 @@ func (k *kafkaReader) connectExplicitTopics(ctx context.Context, config *sarama.
 	}
 
 	doneCtx, doneFn := context.WithCancel(context.Background())
+	go k.lag.refreshHighWatermarks(doneCtx, consumerLagRefreshPeriod, k.mgr.Logger(), saramaListEnds(client))
 	go func() {
 		defer doneFn()
 		looping := true
@@ -5,7 +5,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -19,6 +21,8 @@ import (
 	"github.com/twmb/franz-go/pkg/kgo"
 	"github.com/twmb/franz-go/pkg/kmsg"
 	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
 )
 
 func createKafkaTopic(ctx context.Context, address, id string, partitions int32) error {
@@ -173,6 +177,314 @@ input:
 		})
 	})
 
+	t.Run("transactions", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, done := context.WithTimeout(context.Background(), time.Minute*2)
+		defer done()
+
+		address := "localhost:" + kafkaPortStr
+		require.NoError(t, createKafkaTopic(ctx, address, "txnin", 2))
+		require.NoError(t, createKafkaTopic(ctx, address, "txnout", 2))
+
+		cl, err := kgo.NewClient(kgo.SeedBrokers(address))
+		require.NoError(t, err)
+		t.Cleanup(cl.Close)
+
+		var records []*kgo.Record
+		for i := 0; i < 100; i++ {
+			records = append(records, &kgo.Record{Topic: "topic-txnin", Value: []byte(strconv.Itoa(i))})
+		}
+		require.NoError(t, cl.ProduceSync(ctx, records...).FirstErr())
+
+		builder := service.NewStreamBuilder()
+		require.NoError(t, builder.SetYAML(fmt.Sprintf(`
+input:
+  kafka_franz:
+    seed_brokers: [ %v ]
+    topics: [ topic-txnin ]
+    consumer_group: txngroup
+    checkpoint_limit: 1
+    isolation_level: read_committed
+    transactional_offsets: true
+    batching:
+      count: 10
+      period: 100ms
+
+output:
+  kafka_franz:
+    seed_brokers: [ %v ]
+    topic: topic-txnout
+    transactional_id: txn-test
+`, address, address)))
+		require.NoError(t, builder.SetLoggerYAML(`level: none`))
+
+		stream, err := builder.Build()
+		require.NoError(t, err)
+		go func() {
+			_ = stream.Run(ctx)
+		}()
+		t.Cleanup(func() {
+			_ = stream.StopWithin(time.Second * 10)
+		})
+
+		consumer, err := kgo.NewClient(
+			kgo.SeedBrokers(address),
+			kgo.ConsumeTopics("topic-txnout"),
+			kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+			kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		)
+		require.NoError(t, err)
+		t.Cleanup(consumer.Close)
+
+		var total int
+		seen := map[string]struct{}{}
+		for len(seen) < 100 {
+			fetches := consumer.PollFetches(ctx)
+			require.NoError(t, ctx.Err())
+			fetches.EachRecord(func(r *kgo.Record) {
+				seen[string(r.Value)] = struct{}{}
+				total++
+			})
+		}
+		assert.Equal(t, 100, total)
+
+		assert.Eventually(t, func() bool {
+			req := kmsg.NewPtrOffsetFetchRequest()
+			req.Group = "txngroup"
+			reqTopic := kmsg.NewOffsetFetchRequestTopic()
+			reqTopic.Topic = "topic-txnin"
+			reqTopic.Partitions = []int32{0, 1}
+			req.Topics = append(req.Topics, reqTopic)
+
+			res, err := req.RequestWith(ctx, cl)
+			if err != nil || len(res.Topics) != 1 {
+				return false
+			}
+			var committed int64
+			for _, p := range res.Topics[0].Partitions {
+				if p.Offset > 0 {
+					committed += p.Offset
+				}
+			}
+			return committed == 100
+		}, time.Second*30, time.Millisecond*500)
+	})
+
+	t.Run("start and stop bounds", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, done := context.WithTimeout(context.Background(), time.Minute*2)
+		defer done()
+
+		address := "localhost:" + kafkaPortStr
+		require.NoError(t, createKafkaTopic(ctx, address, "bounds", 2))
+
+		cl, err := kgo.NewClient(kgo.SeedBrokers(address), kgo.RecordPartitioner(kgo.ManualPartitioner()))
+		require.NoError(t, err)
+		t.Cleanup(cl.Close)
+
+		var records []*kgo.Record
+		for i := 0; i < 100; i++ {
+			records = append(records, &kgo.Record{Topic: "topic-bounds", Partition: int32(i % 2), Value: []byte(strconv.Itoa(i))})
+		}
+		require.NoError(t, cl.ProduceSync(ctx, records...).FirstErr())
+
+		for _, test := range []struct {
+			name     string
+			conf     string
+			expected []string
+		}{
+			{
+				name: "before latest",
+				conf: `
+  start_offset:
+    before_latest: 2
+  stop_at:
+    latest: true
+`,
+				expected: []string{"96", "97", "98", "99"},
+			},
+			{
+				name: "zero before latest",
+				conf: `
+  start_offset:
+    before_latest: 0
+  stop_at:
+    latest: true
+`,
+			},
+			{
+				name: "consumer group",
+				conf: `
+  consumer_group: boundsgroup
+  start_offset:
+    partition_offsets:
+      topic-bounds:0: 10
+      topic-bounds:1: 20
+  stop_at:
+    partition_offsets:
+      topic-bounds:0: 12
+      topic-bounds:1: 21
+`,
+				expected: []string{"20", "22", "41"},
+			},
+		} {
+			builder := service.NewStreamBuilder()
+			require.NoError(t, builder.AddInputYAML(fmt.Sprintf(`
+kafka_franz:
+  seed_brokers: [ %v ]
+  topics: [ topic-bounds ]%v`, address, test.conf)), test.name)
+			require.NoError(t, builder.SetLoggerYAML(`level: none`))
+
+			var values []string
+			require.NoError(t, builder.AddConsumerFunc(func(_ context.Context, m *service.Message) error {
+				b, err := m.AsBytes()
+				values = append(values, string(b))
+				return err
+			}))
+
+			stream, err := builder.Build()
+			require.NoError(t, err)
+			require.NoError(t, stream.Run(ctx), test.name)
+
+			sort.Strings(values)
+			assert.Equal(t, test.expected, values, test.name)
+		}
+
+		req := kmsg.NewPtrOffsetFetchRequest()
+		req.Group = "boundsgroup"
+		reqTopic := kmsg.NewOffsetFetchRequestTopic()
+		reqTopic.Topic = "topic-bounds"
+		reqTopic.Partitions = []int32{0, 1}
+		req.Topics = append(req.Topics, reqTopic)
+
+		res, err := req.RequestWith(ctx, cl)
+		require.NoError(t, err)
+		require.Len(t, res.Topics, 1)
+		committed := map[int32]int64{}
+		for _, p := range res.Topics[0].Partitions {
+			committed[p.Partition] = p.Offset
+		}
+		assert.Equal(t, map[int32]int64{0: 12, 1: 21}, committed)
+	})
+
+	t.Run("stop bounds of transactional topic", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, done := context.WithTimeout(context.Background(), time.Minute*2)
+		defer done()
+
+		address := "localhost:" + kafkaPortStr
+		require.NoError(t, createKafkaTopic(ctx, address, "txnbounds", 1))
+
+		cl, err := kgo.NewClient(kgo.SeedBrokers(address), kgo.TransactionalID("txn-bounds"))
+		require.NoError(t, err)
+		t.Cleanup(cl.Close)
+
+		require.NoError(t, cl.BeginTransaction())
+		var records []*kgo.Record
+		for i := 0; i < 10; i++ {
+			records = append(records, &kgo.Record{Topic: "topic-txnbounds", Value: []byte(strconv.Itoa(i))})
+		}
+		require.NoError(t, cl.ProduceSync(ctx, records...).FirstErr())
+		require.NoError(t, cl.EndTransaction(ctx, kgo.TryCommit))
+
+		// The final offset of the partition is the commit marker, which is
+		// never consumed.
+		builder := service.NewStreamBuilder()
+		require.NoError(t, builder.AddInputYAML(fmt.Sprintf(`
+kafka_franz:
+  seed_brokers: [ %v ]
+  topics: [ topic-txnbounds ]
+  isolation_level: read_committed
+  stop_at:
+    latest: true
+`, address)))
+		require.NoError(t, builder.SetLoggerYAML(`level: none`))
+
+		var values int
+		require.NoError(t, builder.AddConsumerFunc(func(context.Context, *service.Message) error {
+			values++
+			return nil
+		}))
+
+		stream, err := builder.Build()
+		require.NoError(t, err)
+		require.NoError(t, stream.Run(ctx))
+		assert.Equal(t, 10, values)
+	})
+
+	t.Run("topic management", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, done := context.WithTimeout(context.Background(), time.Minute)
+		defer done()
+
+		address := "localhost:" + kafkaPortStr
+
+		builder := service.NewStreamBuilder()
+		require.NoError(t, builder.SetYAML(fmt.Sprintf(`
+input:
+  generate:
+    count: 3
+    interval: ""
+    mapping: 'root.n = counter()'
+
+pipeline:
+  processors:
+    - kafka_admin:
+        seed_brokers: [ %v ]
+        operation: create_topic
+        topic: 'topic-admin-${! json("n") }'
+        partitions: 2
+        configs:
+          cleanup.policy: compact
+
+output:
+  kafka_franz:
+    seed_brokers: [ %v ]
+    topic: 'topic-managed-${! json("n") }'
+    topic_management:
+      enabled: true
+      partitions: 3
+      configs:
+        retention.ms: "3600000"
+`, address, address)))
+		require.NoError(t, builder.SetLoggerYAML(`level: none`))
+
+		stream, err := builder.Build()
+		require.NoError(t, err)
+		require.NoError(t, stream.Run(ctx))
+
+		cl, err := kgo.NewClient(kgo.SeedBrokers(address))
+		require.NoError(t, err)
+		t.Cleanup(cl.Close)
+
+		var topics []string
+		for i := 1; i <= 3; i++ {
+			topics = append(topics, fmt.Sprintf("topic-admin-%v", i), fmt.Sprintf("topic-managed-%v", i))
+		}
+
+		req := kmsg.NewPtrMetadataRequest()
+		for _, topic := range topics {
+			reqTopic := kmsg.NewMetadataRequestTopic()
+			reqTopic.Topic = kmsg.StringPtr(topic)
+			req.Topics = append(req.Topics, reqTopic)
+		}
+		res, err := req.RequestWith(ctx, cl)
+		require.NoError(t, err)
+		require.Len(t, res.Topics, 6)
+		for _, topic := range res.Topics {
+			require.NoError(t, kerr.ErrorForCode(topic.ErrorCode), *topic.Topic)
+			if strings.HasPrefix(*topic.Topic, "topic-admin-") {
+				assert.Len(t, topic.Partitions, 2, *topic.Topic)
+			} else {
+				assert.Len(t, topic.Partitions, 3, *topic.Topic)
+			}
+		}
+	})
+
 	manualPartitionTemplate := `
 output:
   kafka_franz:
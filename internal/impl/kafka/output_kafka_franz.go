@@ -3,6 +3,7 @@ package kafka
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
@@ -10,12 +11,16 @@ import (
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kgo"
 	"github.com/twmb/franz-go/pkg/sasl"
 
+	"github.com/usedatabrew/benthos/v4/internal/impl/confluent"
 	"github.com/usedatabrew/benthos/v4/public/service"
 )
 
+const kfoFieldSchemaRegistry = "schema_registry"
+
 func franzKafkaOutputConfig() *service.ConfigSpec {
 	return service.NewConfigSpec().
 		Beta().
@@ -26,6 +31,18 @@ func franzKafkaOutputConfig() *service.ConfigSpec {
 Writes a batch of messages to Kafka brokers and waits for acknowledgement before propagating it back to the input.
 
 This output often out-performs the traditional ` + "`kafka`" + ` output as well as providing more useful logs and error messages.
+
+### Transactions
+
+When a ` + "`transactional_id`" + ` is specified each batch is written within a transaction, and therefore either all messages of a batch are made visible to consumers with an ` + "`isolation_level`" + ` of ` + "`read_committed`" + ` or none of them are. Batches are written one at a time, and the field ` + "`max_in_flight`" + ` is ignored.
+
+When messages are consumed by a ` + "[`kafka_franz` input](/docs/components/inputs/kafka_franz)" + ` with ` + "`transactional_offsets`" + ` enabled their consumer group offsets are committed within the same transaction, providing exactly-once delivery from the input topics to the output topics. Messages consumed from partitions that have since been revoked from the input are dropped, as they will be consumed again by the new owner of the partition.
+
+If another producer starts with the same ` + "`transactional_id`" + ` this producer is fenced, at which point its current transaction is aborted and it reconnects, fencing the other producer in turn. Therefore each running instance of a pipeline must be configured with a unique ` + "`transactional_id`" + `, which should remain the same across restarts of the instance.
+
+### Schema Registry
+
+When the field ` + "[`schema_registry`](#schema_registry)" + ` is specified the values, and optionally the keys, of records are serialized with schemas from a Confluent Schema Registry service. Keys and values are serialized independently with their own subject name strategy and schema, and keys are only serialized when they are not empty.
 `).
 		Field(service.NewStringListField("seed_brokers").
 			Description("A list of broker addresses to connect to in order to establish connections. If an item of the list contains commas it will be expanded into multiple addresses.").
@@ -77,6 +94,18 @@ This output often out-performs the traditional ` + "`kafka`" + ` output as well
 			Description("Optionally set an explicit compression type. The default preference is to use snappy when the broker supports it, and fall back to none if not.").
 			Optional().
 			Advanced()).
+		Field(confluent.RecordSerializerField(kfoFieldSchemaRegistry).Version("4.24.0")).
+		Field(franzTopicManagementField()).
+		Field(service.NewStringField("transactional_id").
+			Description("An optional transactional ID, when specified each batch is written within a transaction, along with the consumer group offsets of messages consumed by a `kafka_franz` input with `transactional_offsets` enabled.").
+			Optional().
+			Advanced().
+			Version("4.24.0")).
+		Field(service.NewDurationField("transaction_timeout").
+			Description("The maximum period of time a transaction may remain open before it is aborted by the transaction coordinator. This field is only relevant when a `transactional_id` is specified.").
+			Default("1m").
+			Advanced().
+			Version("4.24.0")).
 		Field(service.NewTLSToggledField("tls")).
 		Field(saslField()).
 		LintRule(`
@@ -103,7 +132,15 @@ func init() {
 			if batchPolicy, err = conf.FieldBatchPolicy("batching"); err != nil {
 				return
 			}
-			output, err = newFranzKafkaWriterFromConfig(conf, mgr.Logger())
+			var w *franzKafkaWriter
+			if w, err = newFranzKafkaWriterFromConfig(conf, mgr); err != nil {
+				return
+			}
+			if w.transactionalID != "" {
+				// Transactions of a client cannot be interleaved.
+				maxInFlight = 1
+			}
+			output = w
 			return
 		})
 	if err != nil {
@@ -128,15 +165,19 @@ type franzKafkaWriter struct {
 	timeout          time.Duration
 	produceMaxBytes  int32
 	compressionPrefs []kgo.CompressionCodec
+	transactionalID  string
+	txnTimeout       time.Duration
+	topicManager     *franzTopicManager
+	serializer       *confluent.RecordSerializer
 
 	client *kgo.Client
 
 	log *service.Logger
 }
 
-func newFranzKafkaWriterFromConfig(conf *service.ParsedConfig, log *service.Logger) (*franzKafkaWriter, error) {
+func newFranzKafkaWriterFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*franzKafkaWriter, error) {
 	f := franzKafkaWriter{
-		log: log,
+		log: mgr.Logger(),
 	}
 
 	brokerList, err := conf.FieldStringList("seed_brokers")
@@ -252,6 +293,36 @@ func newFranzKafkaWriterFromConfig(conf *service.ParsedConfig, log *service.Logg
 		return nil, err
 	}
 
+	if conf.Contains("transactional_id") {
+		if f.transactionalID, err = conf.FieldString("transactional_id"); err != nil {
+			return nil, err
+		}
+	}
+	if f.txnTimeout, err = conf.FieldDuration("transaction_timeout"); err != nil {
+		return nil, err
+	}
+
+	if conf.Contains(ftmFieldTopicManagement) {
+		tmConf := conf.Namespace(ftmFieldTopicManagement)
+		enabled, err := tmConf.FieldBool(ftmFieldEnabled)
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			spec, err := franzTopicSpecFromParsed(tmConf)
+			if err != nil {
+				return nil, err
+			}
+			f.topicManager = newFranzTopicManager(spec, f.timeout)
+		}
+	}
+
+	if conf.Contains(kfoFieldSchemaRegistry) {
+		if f.serializer, err = confluent.RecordSerializerFromParsed(conf.Namespace(kfoFieldSchemaRegistry), mgr); err != nil {
+			return nil, fmt.Errorf("%v: %w", kfoFieldSchemaRegistry, err)
+		}
+	}
+
 	return &f, nil
 }
 
@@ -265,13 +336,15 @@ func (f *franzKafkaWriter) Connect(ctx context.Context) error {
 	clientOpts := []kgo.Opt{
 		kgo.SeedBrokers(f.seedBrokers...),
 		kgo.SASL(f.saslConfs...),
-		kgo.AllowAutoTopicCreation(), // TODO: Configure this
 		kgo.ProducerBatchMaxBytes(f.produceMaxBytes),
 		kgo.ProduceRequestTimeout(f.timeout),
 		kgo.ClientID(f.clientID),
 		kgo.Rack(f.rackID),
 		kgo.WithLogger(&kgoLogger{f.log}),
 	}
+	if f.topicManager == nil {
+		clientOpts = append(clientOpts, kgo.AllowAutoTopicCreation())
+	}
 	if f.tlsConf != nil {
 		clientOpts = append(clientOpts, kgo.DialTLSConfig(f.tlsConf))
 	}
@@ -281,6 +354,12 @@ func (f *franzKafkaWriter) Connect(ctx context.Context) error {
 	if len(f.compressionPrefs) > 0 {
 		clientOpts = append(clientOpts, kgo.ProducerBatchCompression(f.compressionPrefs...))
 	}
+	if f.transactionalID != "" {
+		clientOpts = append(clientOpts,
+			kgo.TransactionalID(f.transactionalID),
+			kgo.TransactionTimeout(f.txnTimeout),
+		)
+	}
 
 	cl, err := kgo.NewClient(clientOpts...)
 	if err != nil {
@@ -297,11 +376,32 @@ func (f *franzKafkaWriter) WriteBatch(ctx context.Context, b service.MessageBatc
 		return service.ErrNotConnected
 	}
 
-	records := make([]*kgo.Record, 0, len(b))
+	if f.transactionalID != "" {
+		return f.writeTransaction(ctx, b)
+	}
+
+	records, err := f.batchToRecords(ctx, b)
+	if err != nil {
+		return err
+	}
+	if f.topicManager != nil {
+		if err := f.topicManager.ensureTopics(ctx, f.client, records); err != nil {
+			return err
+		}
+	}
+
+	// TODO: This is very cool and allows us to easily return granular errors,
+	// so we should honor travis by doing it.
+	err = f.client.ProduceSync(ctx, records...).FirstErr()
+	return
+}
+
+func (f *franzKafkaWriter) batchToRecords(ctx context.Context, b service.MessageBatch) (records []*kgo.Record, err error) {
+	records = make([]*kgo.Record, 0, len(b))
 	for i, msg := range b {
 		var topic string
 		if topic, err = b.TryInterpolatedString(i, f.topic); err != nil {
-			return fmt.Errorf("topic interpolation error: %w", err)
+			return nil, fmt.Errorf("topic interpolation error: %w", err)
 		}
 
 		record := &kgo.Record{Topic: topic}
@@ -310,17 +410,25 @@ func (f *franzKafkaWriter) WriteBatch(ctx context.Context, b service.MessageBatc
 		}
 		if f.key != nil {
 			if record.Key, err = b.TryInterpolatedBytes(i, f.key); err != nil {
-				return fmt.Errorf("key interpolation error: %w", err)
+				return nil, fmt.Errorf("key interpolation error: %w", err)
+			}
+		}
+		if f.serializer != nil {
+			if record.Value, err = f.serializer.SerializeValue(ctx, topic, record.Value); err != nil {
+				return nil, fmt.Errorf("value serialization error: %w", err)
+			}
+			if record.Key, err = f.serializer.SerializeKey(ctx, topic, record.Key); err != nil {
+				return nil, fmt.Errorf("key serialization error: %w", err)
 			}
 		}
 		if f.partition != nil {
 			partStr, err := b.TryInterpolatedString(i, f.partition)
 			if err != nil {
-				return fmt.Errorf("partition interpolation error: %w", err)
+				return nil, fmt.Errorf("partition interpolation error: %w", err)
 			}
 			partInt, err := strconv.Atoi(partStr)
 			if err != nil {
-				return fmt.Errorf("partition parse error: %w", err)
+				return nil, fmt.Errorf("partition parse error: %w", err)
 			}
 			record.Partition = int32(partInt)
 		}
@@ -333,11 +441,80 @@ func (f *franzKafkaWriter) WriteBatch(ctx context.Context, b service.MessageBatc
 		})
 		records = append(records, record)
 	}
+	return
+}
+
+// writeTransaction writes a batch, along with the consumer group offsets of
+// messages consumed by a transactional kafka_franz input, within a transaction.
+func (f *franzKafkaWriter) writeTransaction(ctx context.Context, b service.MessageBatch) error {
+	offsets, indexes := franzTxnOffsetsFromBatch(b)
+	defer offsets.unlock()
+
+	if dropped := len(b) - len(indexes); dropped > 0 {
+		f.log.Warnf("Dropping %v messages consumed from partitions that are no longer assigned to the input", dropped)
+		if len(indexes) == 0 {
+			return nil
+		}
+		filtered := make(service.MessageBatch, 0, len(indexes))
+		for _, i := range indexes {
+			filtered = append(filtered, b[i])
+		}
+		b = filtered
+	}
+
+	records, err := f.batchToRecords(ctx, b)
+	if err != nil {
+		return err
+	}
+	if f.topicManager != nil {
+		if err := f.topicManager.ensureTopics(ctx, f.client, records); err != nil {
+			return err
+		}
+	}
+
+	if err := f.client.BeginTransaction(); err != nil {
+		return f.transactionErr(err)
+	}
 
-	// TODO: This is very cool and allows us to easily return granular errors,
-	// so we should honor travis by doing it.
 	err = f.client.ProduceSync(ctx, records...).FirstErr()
-	return
+	if err == nil {
+		err = offsets.commit(ctx, f.client, f.transactionalID)
+	}
+	if err != nil {
+		return f.abortTransaction(ctx, err)
+	}
+
+	if err := f.client.EndTransaction(ctx, kgo.TryCommit); err != nil {
+		if errors.Is(err, kerr.OperationNotAttempted) {
+			return f.abortTransaction(ctx, err)
+		}
+		return f.transactionErr(fmt.Errorf("failed to commit transaction: %w", err))
+	}
+	return nil
+}
+
+// abortTransaction aborts the current transaction after a failure.
+func (f *franzKafkaWriter) abortTransaction(ctx context.Context, cause error) error {
+	if err := f.client.AbortBufferedRecords(ctx); err != nil {
+		f.log.Errorf("Failed to abort buffered records: %v", err)
+	}
+	if err := f.client.EndTransaction(ctx, kgo.TryAbort); err != nil {
+		f.log.Errorf("Failed to abort transaction after error '%v': %v", cause, err)
+		f.disconnect()
+		return service.ErrNotConnected
+	}
+	return f.transactionErr(cause)
+}
+
+// transactionErr resets the client when the producer has been fenced, as a new
+// producer epoch must be obtained before writing further transactions.
+func (f *franzKafkaWriter) transactionErr(err error) error {
+	if isFencedErr(err) {
+		f.log.Errorf("Transactional producer fenced, reconnecting: %v", err)
+		f.disconnect()
+		return service.ErrNotConnected
+	}
+	return err
 }
 
 func (f *franzKafkaWriter) disconnect() {
@@ -350,5 +527,8 @@ func (f *franzKafkaWriter) disconnect() {
 
 func (f *franzKafkaWriter) Close(ctx context.Context) error {
 	f.disconnect()
+	if f.serializer != nil {
+		return f.serializer.Close(ctx)
+	}
 	return nil
 }
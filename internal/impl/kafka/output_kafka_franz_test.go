@@ -1,6 +1,9 @@
 package kafka
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -53,6 +56,16 @@ kafka_franz:
 `,
 			errContains: "a partition cannot be specified unless the partitioner is set to manual",
 		},
+		{
+			name: "transactional id",
+			conf: `
+kafka_franz:
+  seed_brokers: [ foo:1234 ]
+  topic: foo
+  transactional_id: foo-txn
+  transaction_timeout: 30s
+`,
+		},
 	}
 
 	for _, test := range testCases {
@@ -68,3 +81,69 @@ kafka_franz:
 		})
 	}
 }
+
+func TestKafkaFranzOutputSchemaRegistry(t *testing.T) {
+	var registered []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		registered = append(registered, r.URL.Path)
+		_, _ = w.Write([]byte(`{"id":7}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	pConf, err := franzKafkaOutputConfig().ParseYAML(`
+seed_brokers: [ foo:1234 ]
+topic: ${! meta("topic") }
+key: ${! @key.or("") }
+schema_registry:
+  url: `+ts.URL+`
+  key:
+    enabled: true
+    schema: '{"type":"string"}'
+    auto_register: true
+  value:
+    schema: '{"type":"record","name":"foo","namespace":"bar","fields":[{"name":"a","type":"long"}]}'
+    subject_name_strategy: record_name
+    auto_register: true
+`, nil)
+	require.NoError(t, err)
+
+	w, err := newFranzKafkaWriterFromConfig(pConf, service.MockResources())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, w.Close(context.Background()))
+	})
+
+	batch := service.MessageBatch{
+		service.NewMessage([]byte(`{"a":1}`)),
+		service.NewMessage([]byte(`{"a":2}`)),
+		service.NewMessage([]byte(`{"a":3}`)),
+	}
+	batch[0].MetaSetMut("topic", "foo")
+	batch[0].MetaSetMut("key", `"k1"`)
+	batch[1].MetaSetMut("topic", "baz")
+	batch[1].MetaSetMut("key", `"k2"`)
+	batch[2].MetaSetMut("topic", "foo")
+
+	records, err := w.batchToRecords(context.Background(), batch)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, "\x00\x00\x00\x00\x07\x04k1", string(records[0].Key))
+	assert.Equal(t, "\x00\x00\x00\x00\x07\x02", string(records[0].Value))
+	assert.Equal(t, "\x00\x00\x00\x00\x07\x04k2", string(records[1].Key))
+	assert.Equal(t, "\x00\x00\x00\x00\x07\x04", string(records[1].Value))
+
+	// Empty keys are not serialized.
+	assert.Empty(t, records[2].Key)
+	assert.Equal(t, "\x00\x00\x00\x00\x07\x06", string(records[2].Value))
+
+	assert.ElementsMatch(t, []string{
+		"/subjects/foo-key/versions",
+		"/subjects/bar.foo/versions",
+		"/subjects/baz-key/versions",
+	}, registered)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/usedatabrew/benthos/v4/internal/bloblang/query"
 	"github.com/usedatabrew/benthos/v4/internal/component/output"
 	"github.com/usedatabrew/benthos/v4/internal/component/output/span"
+	"github.com/usedatabrew/benthos/v4/internal/impl/confluent"
 	"github.com/usedatabrew/benthos/v4/public/service"
 )
 
@@ -43,6 +44,7 @@ const (
 	oskFieldBatching                     = "batching"
 	oskFieldMaxRetries                   = "max_retries"
 	oskFieldBackoff                      = "backoff"
+	oskFieldSchemaRegistry               = "schema_registry"
 )
 
 // OSKConfigSpec creates a new config spec for a kafka output.
@@ -58,6 +60,8 @@ Both the `+"`key` and `topic`"+` fields can be dynamically set using function in
 
 [Metadata](/docs/configuration/metadata) will be added to each message sent as headers (version 0.11+), but can be restricted using the field `+"[`metadata`](#metadata)"+`.
 
+When the field `+"[`schema_registry`](#schema_registry)"+` is specified the values, and optionally the keys, of messages are serialized with schemas from a Confluent Schema Registry service. Keys are only serialized when they are not empty.
+
 ### Strict Ordering and Retries
 
 When strict ordering is required for messages written to topic partitions it is important to ensure that both the field `+"`max_in_flight` is set to `1` and that the field `retry_as_batch` is set to `true`"+`.
@@ -124,6 +128,7 @@ Unfortunately this error message will appear for a wide range of connection prob
 				Optional(),
 			service.NewMetadataExcludeFilterField(oskFieldMetadata).
 				Description("Specify criteria for which metadata values are sent with messages as headers."),
+			confluent.RecordSerializerField(oskFieldSchemaRegistry).Version("4.24.0"),
 			span.InjectTracingSpanMappingDocs(),
 			service.NewOutputMaxInFlightField(),
 			service.NewBoolField(oskFieldAckReplicas).
@@ -183,6 +188,7 @@ type kafkaWriter struct {
 	staticHeaders map[string]string
 	metaFilter    *service.MetadataExcludeFilter
 	retryAsBatch  bool
+	serializer    *confluent.RecordSerializer
 
 	customTopicCreation bool
 	customTopicParts    int
@@ -291,6 +297,12 @@ func NewKafkaWriterFromParsed(conf *service.ParsedConfig, mgr *service.Resources
 		return nil, err
 	}
 
+	if conf.Contains(oskFieldSchemaRegistry) {
+		if k.serializer, err = confluent.RecordSerializerFromParsed(conf.Namespace(oskFieldSchemaRegistry), mgr); err != nil {
+			return nil, fmt.Errorf("%v: %w", oskFieldSchemaRegistry, err)
+		}
+	}
+
 	return &k, nil
 }
 
@@ -498,6 +510,14 @@ func (k *kafkaWriter) WriteBatch(ctx context.Context, msg service.MessageBatch)
 		if err != nil {
 			return err
 		}
+		if k.serializer != nil {
+			if msgBytes, err = k.serializer.SerializeValue(ctx, topic, msgBytes); err != nil {
+				return fmt.Errorf("value serialization error: %w", err)
+			}
+			if key, err = k.serializer.SerializeKey(ctx, topic, key); err != nil {
+				return fmt.Errorf("key serialization error: %w", err)
+			}
+		}
 		nextMsg := &sarama.ProducerMessage{
 			Topic:    topic,
 			Value:    sarama.ByteEncoder(msgBytes),
@@ -586,7 +606,7 @@ func (k *kafkaWriter) WriteBatch(ctx context.Context, msg service.MessageBatch)
 }
 
 // Close shuts down the Kafka writer and stops processing messages.
-func (k *kafkaWriter) Close(context.Context) error {
+func (k *kafkaWriter) Close(ctx context.Context) error {
 	k.connMut.Lock()
 	defer k.connMut.Unlock()
 
@@ -595,6 +615,11 @@ func (k *kafkaWriter) Close(context.Context) error {
 		err = k.producer.Close()
 		k.producer = nil
 	}
+	if k.serializer != nil {
+		if sErr := k.serializer.Close(ctx); err == nil {
+			err = sErr
+		}
+	}
 
 	return err
 }
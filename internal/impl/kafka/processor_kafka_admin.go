@@ -0,0 +1,302 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	kapFieldSeedBrokers       = "seed_brokers"
+	kapFieldOperation         = "operation"
+	kapFieldTopic             = "topic"
+	kapFieldPartitions        = "partitions"
+	kapFieldReplicationFactor = "replication_factor"
+	kapFieldConfigs           = "configs"
+	kapFieldClientID          = "client_id"
+	kapFieldTimeout           = "timeout"
+	kapFieldTLS               = "tls"
+)
+
+func kafkaAdminProcessorConfig() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Integration").
+		Version("4.24.0").
+		Summary("Performs administrative operations on the topics of a Kafka cluster, such as creating and deleting topics, for each message of a batch.").
+		Description(`
+The topic of each operation is obtained from the interpolated field `+"`topic`"+`, and operations on the same topic within a batch are performed once. The contents of messages remain unchanged, and when an operation fails the messages of its topic are flagged as failed, where they can be handled using the [error handling methods](/docs/configuration/error_handling).
+
+Creating a topic that already exists, or deleting a topic that does not exist, is not considered an error.`).
+		Field(service.NewStringListField(kapFieldSeedBrokers).
+			Description("A list of broker addresses to connect to in order to establish connections. If an item of the list contains commas it will be expanded into multiple addresses.").
+			Example([]string{"localhost:9092"}).
+			Example([]string{"foo:9092", "bar:9092"})).
+		Field(service.NewStringAnnotatedEnumField(kapFieldOperation, map[string]string{
+			"create_topic":      "Create the topic with the configured `partitions`, `replication_factor` and `configs`.",
+			"delete_topic":      "Delete the topic.",
+			"alter_configs":     "Set the `configs` of the topic, where configs with an empty value are reset to their default.",
+			"create_partitions": "Increase the number of partitions of the topic to the total of `partitions`.",
+		}).
+			Description("The operation to perform on each topic.")).
+		Field(service.NewInterpolatedStringField(kapFieldTopic).
+			Description("The topic to perform the operation on.").
+			Example(`${! json("topic") }`)).
+		Field(service.NewIntField(kapFieldPartitions).
+			Description("The number of partitions of created topics, or `-1` to use the default of the broker. For the `create_partitions` operation this is the total number of partitions the topic should have.").
+			Default(-1)).
+		Field(service.NewIntField(kapFieldReplicationFactor).
+			Description("The replication factor of created topics, or `-1` to use the default of the broker.").
+			Default(-1)).
+		Field(service.NewInterpolatedStringMapField(kapFieldConfigs).
+			Description("Configs of created topics, or the configs to set for the `alter_configs` operation.").
+			Default(map[string]any{}).
+			Example(map[string]any{
+				"retention.ms":   `${! json("retention_ms") }`,
+				"cleanup.policy": "delete",
+			})).
+		Field(service.NewStringField(kapFieldClientID).
+			Description("An identifier for the client connection.").
+			Default("benthos").
+			Advanced()).
+		Field(service.NewDurationField(kapFieldTimeout).
+			Description("The maximum period of time to wait for each operation to complete.").
+			Default("10s").
+			Advanced()).
+		Field(service.NewTLSToggledField(kapFieldTLS)).
+		Field(saslField()).
+		LintRule(`
+root = if this.operation == "create_partitions" && this.partitions.or(-1) < 1 {
+  "partitions must be specified for the create_partitions operation"
+}
+`).
+		Example(
+			"Create Topics",
+			"Messages describing tenants are used to create a compacted topic for each tenant before they are written to it.",
+			`
+pipeline:
+  processors:
+    - kafka_admin:
+        seed_brokers: [ localhost:9092 ]
+        operation: create_topic
+        topic: 'tenant-${! json("tenant_id") }'
+        partitions: 6
+        replication_factor: 3
+        configs:
+          cleanup.policy: compact
+`,
+		)
+}
+
+func init() {
+	err := service.RegisterBatchProcessor(
+		"kafka_admin", kafkaAdminProcessorConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchProcessor, error) {
+			return newKafkaAdminProcessorFromConfig(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type kafkaAdminProcessor struct {
+	operation         string
+	topic             *service.InterpolatedString
+	partitions        int32
+	replicationFactor int16
+	configs           map[string]*service.InterpolatedString
+	timeout           time.Duration
+
+	client *kgo.Client
+	log    *service.Logger
+}
+
+func newKafkaAdminProcessorFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*kafkaAdminProcessor, error) {
+	k := &kafkaAdminProcessor{
+		log: mgr.Logger(),
+	}
+
+	brokerList, err := conf.FieldStringList(kapFieldSeedBrokers)
+	if err != nil {
+		return nil, err
+	}
+	var seedBrokers []string
+	for _, b := range brokerList {
+		seedBrokers = append(seedBrokers, strings.Split(b, ",")...)
+	}
+
+	if k.operation, err = conf.FieldString(kapFieldOperation); err != nil {
+		return nil, err
+	}
+	if k.topic, err = conf.FieldInterpolatedString(kapFieldTopic); err != nil {
+		return nil, err
+	}
+
+	partitions, err := conf.FieldInt(kapFieldPartitions)
+	if err != nil {
+		return nil, err
+	}
+	k.partitions = int32(partitions)
+
+	replicationFactor, err := conf.FieldInt(kapFieldReplicationFactor)
+	if err != nil {
+		return nil, err
+	}
+	k.replicationFactor = int16(replicationFactor)
+
+	if k.configs, err = conf.FieldInterpolatedStringMap(kapFieldConfigs); err != nil {
+		return nil, err
+	}
+
+	switch k.operation {
+	case "create_topic", "delete_topic":
+	case "alter_configs":
+		if len(k.configs) == 0 {
+			return nil, fmt.Errorf("configs must be specified for the %v operation", k.operation)
+		}
+	case "create_partitions":
+		if k.partitions < 1 {
+			return nil, fmt.Errorf("partitions must be specified for the %v operation", k.operation)
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation: %v", k.operation)
+	}
+
+	if k.timeout, err = conf.FieldDuration(kapFieldTimeout); err != nil {
+		return nil, err
+	}
+
+	clientID, err := conf.FieldString(kapFieldClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConf, tlsEnabled, err := conf.FieldTLSToggled(kapFieldTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	saslConfs, err := saslMechanismsFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	clientOpts := []kgo.Opt{
+		kgo.SeedBrokers(seedBrokers...),
+		kgo.SASL(saslConfs...),
+		kgo.ClientID(clientID),
+		kgo.WithLogger(&kgoLogger{k.log}),
+	}
+	if tlsEnabled {
+		clientOpts = append(clientOpts, kgo.DialTLSConfig(tlsConf))
+	}
+	if k.client, err = kgo.NewClient(clientOpts...); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *kafkaAdminProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	batch = batch.Copy()
+
+	// Group messages by topic so that each topic is only operated on once.
+	topicIndexes := map[string][]int{}
+	specs := map[string]*franzTopicSpec{}
+	for i, msg := range batch {
+		topic, err := batch.TryInterpolatedString(i, k.topic)
+		if err != nil {
+			msg.SetError(fmt.Errorf("topic interpolation error: %w", err))
+			continue
+		}
+		if topic == "" {
+			msg.SetError(errors.New("topic interpolation resulted in an empty string"))
+			continue
+		}
+		if _, exists := specs[topic]; !exists {
+			spec := &franzTopicSpec{
+				partitions:        k.partitions,
+				replicationFactor: k.replicationFactor,
+				configs:           make(map[string]string, len(k.configs)),
+			}
+			for name, value := range k.configs {
+				if spec.configs[name], err = batch.TryInterpolatedString(i, value); err != nil {
+					msg.SetError(fmt.Errorf("config %v interpolation error: %w", name, err))
+					break
+				}
+			}
+			if err != nil {
+				continue
+			}
+			specs[topic] = spec
+		}
+		topicIndexes[topic] = append(topicIndexes[topic], i)
+	}
+	if len(specs) == 0 {
+		return []service.MessageBatch{batch}, nil
+	}
+
+	ctx, done := context.WithTimeout(ctx, k.timeout)
+	defer done()
+
+	var results map[string]error
+	var err error
+	switch k.operation {
+	case "create_topic":
+		results, err = franzCreateTopics(ctx, k.client, k.timeout, specs)
+	case "delete_topic":
+		topics := make([]string, 0, len(specs))
+		for topic := range specs {
+			topics = append(topics, topic)
+		}
+		results, err = franzDeleteTopics(ctx, k.client, k.timeout, topics)
+	case "alter_configs":
+		configs := make(map[string]map[string]string, len(specs))
+		for topic, spec := range specs {
+			configs[topic] = spec.configs
+		}
+		results, err = franzAlterTopicConfigs(ctx, k.client, configs)
+	case "create_partitions":
+		counts := make(map[string]int32, len(specs))
+		for topic := range specs {
+			counts[topic] = k.partitions
+		}
+		results, err = franzCreatePartitions(ctx, k.client, k.timeout, counts)
+	}
+	if err != nil {
+		k.log.Debugf("Kafka admin operation %v failed: %v", k.operation, err)
+		for _, indexes := range topicIndexes {
+			for _, i := range indexes {
+				batch[i].SetError(err)
+			}
+		}
+		return []service.MessageBatch{batch}, nil
+	}
+
+	for topic, indexes := range topicIndexes {
+		topicErr, exists := results[topic]
+		if !exists {
+			topicErr = fmt.Errorf("no result returned for topic %v", topic)
+		}
+		if topicErr == nil {
+			continue
+		}
+		k.log.Debugf("Kafka admin operation %v failed for topic %v: %v", k.operation, topic, topicErr)
+		for _, i := range indexes {
+			batch[i].SetError(fmt.Errorf("%v of topic %v failed: %w", k.operation, topic, topicErr))
+		}
+	}
+	return []service.MessageBatch{batch}, nil
+}
+
+func (k *kafkaAdminProcessor) Close(ctx context.Context) error {
+	k.client.Close()
+	return nil
+}
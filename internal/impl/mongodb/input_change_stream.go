@@ -0,0 +1,451 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/usedatabrew/benthos/v4/internal/checkpoint"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	csiFieldCollection               = "collection"
+	csiFieldPipeline                 = "pipeline"
+	csiFieldFullDocument             = "full_document"
+	csiFieldFullDocumentBeforeChange = "full_document_before_change"
+	csiFieldJSONMarshalMode          = "json_marshal_mode"
+	csiFieldCheckpoint               = "checkpoint"
+	csiFieldCheckpointCache          = "cache"
+	csiFieldCheckpointKey            = "key"
+	csiFieldCheckpointLimit          = "limit"
+)
+
+func mongoChangeStreamConfigSpec() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Services").
+		Summary("Watches a MongoDB collection, database or cluster for changes and creates a message for each change event.").
+		Description(`
+The change stream is opened against the collection named by the field `+"`collection`"+`, or when it is empty all collections of the configured database. When both `+"`database`"+` and `+"`collection`"+` are empty the changes of all databases within the cluster are watched. Change streams are only available for replica sets and sharded clusters.
+
+Each message contains the full [change event](https://www.mongodb.com/docs/manual/reference/change-events/) serialized as JSON, which includes the `+"`fullDocument`"+` and `+"`updateDescription`"+` of the change when present. The field `+"`full_document`"+` controls whether the current version of documents is looked up for update events.
+
+### Resuming
+
+The resume token of the last change acknowledged in order is written to the cache resource named by `+"`checkpoint.cache`"+`, and when connecting the stream is resumed from the stored token, allowing a pipeline to be restarted without missing changes. Changes that were dispatched but not acknowledged before a restart are delivered again. When no cache is configured the resume token is only kept in memory and is used to resume after a lost connection.
+
+### Metadata
+
+This input adds the following metadata fields to each message:
+
+`+"```text"+`
+- operation_type
+- database
+- collection
+- cluster_time
+- resume_token
+`+"```"+`
+
+You can access these metadata fields using [function interpolation](/docs/configuration/interpolation#bloblang-queries).`).
+		Fields(clientFields()...).
+		Fields(
+			service.NewStringField(csiFieldCollection).
+				Description("The collection to watch, when empty all collections of the database are watched.").
+				Default(""),
+			service.NewBloblangField(csiFieldPipeline).
+				Description("An optional Bloblang mapping resulting in an array of aggregation stages applied to change events, which can be used to filter or reshape events at the server.").
+				Example(`root = [ { "$match": { "operationType": { "$in": [ "insert", "update" ] } } } ]`).
+				Optional(),
+			service.NewStringAnnotatedEnumField(csiFieldFullDocument, map[string]string{
+				string(options.Default):       "Update events only contain the `updateDescription` of the change.",
+				string(options.UpdateLookup):  "Update events also contain the `fullDocument` as it currently exists, which may include changes made after the event.",
+				string(options.WhenAvailable): "Events contain the `fullDocument` as of the change when post-images are enabled for the collection.",
+				string(options.Required):      "Events contain the `fullDocument` as of the change and an error is raised when a post-image is not available.",
+			}).
+				Description("Controls whether the full document is added to change events.").
+				Default(string(options.UpdateLookup)),
+			service.NewStringAnnotatedEnumField(csiFieldFullDocumentBeforeChange, map[string]string{
+				string(options.Off):           "Events do not contain the document as it existed before the change.",
+				string(options.WhenAvailable): "Events contain the `fullDocumentBeforeChange` when pre-images are enabled for the collection.",
+				string(options.Required):      "Events contain the `fullDocumentBeforeChange` and an error is raised when a pre-image is not available.",
+			}).
+				Description("Controls whether the document as it existed before the change is added to update, replace and delete events, requires MongoDB 6.0 or later.").
+				Default(string(options.Off)).
+				Advanced(),
+			service.NewStringAnnotatedEnumField(csiFieldJSONMarshalMode, map[string]string{
+				string(JSONMarshalModeCanonical): "A string format that emphasizes type preservation at the expense of readability and interoperability. " +
+					"That is, conversion from canonical to BSON will generally preserve type information except in certain specific cases. ",
+				string(JSONMarshalModeRelaxed): "A string format that emphasizes readability and interoperability at the expense of type preservation." +
+					"That is, conversion from relaxed format to BSON can lose type information.",
+			}).
+				Description("The json_marshal_mode setting is optional and controls the format of the output message.").
+				Default(string(JSONMarshalModeCanonical)).
+				Advanced(),
+			service.NewObjectField(csiFieldCheckpoint,
+				service.NewStringField(csiFieldCheckpointCache).
+					Description("A [cache resource](/docs/components/caches/about) in which the resume token of the last acknowledged change is stored and from which it is restored when connecting.").
+					Default(""),
+				service.NewStringField(csiFieldCheckpointKey).
+					Description("The key under which the resume token is stored within the cache.").
+					Default("mongodb_change_stream"),
+				service.NewIntField(csiFieldCheckpointLimit).
+					Description("The maximum number of changes that can be dispatched without being acknowledged.").
+					Default(1024),
+			).
+				Description("Configures where the resume token of the stream is persisted."),
+		).
+		Example("Resume After Restarts", "Watch a collection for inserts and updates, storing the resume token of acknowledged changes in a Redis cache.", `
+input:
+  mongodb_change_stream:
+    url: mongodb://localhost:27017
+    database: shop
+    collection: orders
+    pipeline: |
+      root = [ { "$match": { "operationType": { "$in": [ "insert", "update" ] } } } ]
+    checkpoint:
+      cache: tokens
+
+cache_resources:
+  - label: tokens
+    redis:
+      url: redis://localhost:6379
+`)
+}
+
+func init() {
+	err := service.RegisterInput(
+		"mongodb_change_stream", mongoChangeStreamConfigSpec(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+			return newMongoChangeStreamInput(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func newMongoChangeStreamInput(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+	m := &mongoChangeStreamInput{log: mgr.Logger()}
+
+	var err error
+	if m.collection, err = conf.FieldString(csiFieldCollection); err != nil {
+		return nil, err
+	}
+	if conf.Contains(csiFieldPipeline) {
+		pipelineExec, err := conf.FieldBloblang(csiFieldPipeline)
+		if err != nil {
+			return nil, err
+		}
+		pipeline, err := pipelineExec.Query(struct{}{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute pipeline mapping: %w", err)
+		}
+		var ok bool
+		if m.pipeline, ok = pipeline.([]any); !ok {
+			return nil, fmt.Errorf("pipeline mapping must result in an array of stages, got %T", pipeline)
+		}
+	}
+
+	m.opts = options.ChangeStream()
+	fullDocument, err := conf.FieldString(csiFieldFullDocument)
+	if err != nil {
+		return nil, err
+	}
+	if fullDocument != string(options.Default) {
+		m.opts.SetFullDocument(options.FullDocument(fullDocument))
+	}
+	beforeChange, err := conf.FieldString(csiFieldFullDocumentBeforeChange)
+	if err != nil {
+		return nil, err
+	}
+	if beforeChange != string(options.Off) {
+		m.opts.SetFullDocumentBeforeChange(options.FullDocument(beforeChange))
+	}
+
+	marshalMode, err := conf.FieldString(csiFieldJSONMarshalMode)
+	if err != nil {
+		return nil, err
+	}
+	m.marshalCanon = marshalMode == string(JSONMarshalModeCanonical)
+
+	cpConf := conf.Namespace(csiFieldCheckpoint)
+	cache, err := cpConf.FieldString(csiFieldCheckpointCache)
+	if err != nil {
+		return nil, err
+	}
+	if cache != "" && !mgr.HasCache(cache) {
+		return nil, fmt.Errorf("cache resource '%v' was not found", cache)
+	}
+	cacheKey, err := cpConf.FieldString(csiFieldCheckpointKey)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := cpConf.FieldInt(csiFieldCheckpointLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 1 {
+		return nil, fmt.Errorf("checkpoint limit must be at least 1, got %v", limit)
+	}
+	m.tokens = newResumeTokenStore(mgr, cache, cacheKey, int64(limit))
+
+	if m.client, m.database, err = getClient(conf); err != nil {
+		return nil, err
+	}
+	return service.AutoRetryNacks(m), nil
+}
+
+type mongoChangeStreamInput struct {
+	client       *mongo.Client
+	database     *mongo.Database
+	collection   string
+	pipeline     []any
+	opts         *options.ChangeStreamOptions
+	marshalCanon bool
+	tokens       *resumeTokenStore
+	log          *service.Logger
+
+	streamMut sync.Mutex
+	stream    *mongo.ChangeStream
+}
+
+func (m *mongoChangeStreamInput) Connect(ctx context.Context) error {
+	m.streamMut.Lock()
+	defer m.streamMut.Unlock()
+	if m.stream != nil {
+		return nil
+	}
+
+	token, err := m.tokens.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain resume token: %w", err)
+	}
+
+	opts := *m.opts
+	if token != nil {
+		// Starting after rather than resuming after the token allows streams
+		// to be reopened following an invalidate event.
+		opts.SetStartAfter(token)
+	}
+
+	pipeline := m.pipeline
+	if pipeline == nil {
+		pipeline = []any{}
+	}
+
+	var stream *mongo.ChangeStream
+	switch {
+	case m.collection != "":
+		stream, err = m.database.Collection(m.collection).Watch(ctx, pipeline, &opts)
+	case m.database.Name() != "":
+		stream, err = m.database.Watch(ctx, pipeline, &opts)
+	default:
+		stream, err = m.client.Watch(ctx, pipeline, &opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open change stream: %w", err)
+	}
+	if token != nil {
+		m.log.Infof("Resuming change stream from token %s", token.String())
+	}
+	m.stream = stream
+	return nil
+}
+
+func (m *mongoChangeStreamInput) closeStream(ctx context.Context) {
+	m.streamMut.Lock()
+	defer m.streamMut.Unlock()
+	if m.stream != nil {
+		_ = m.stream.Close(ctx)
+		m.stream = nil
+	}
+}
+
+func (m *mongoChangeStreamInput) Read(ctx context.Context) (*service.Message, service.AckFunc, error) {
+	m.streamMut.Lock()
+	stream := m.stream
+	m.streamMut.Unlock()
+	if stream == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	if !stream.Next(ctx) {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err := stream.Err(); err != nil {
+			m.log.Errorf("Change stream failed: %v", err)
+		}
+		// The stream is closed by the server following invalidate events, in
+		// which case it is reopened after the last acknowledged change.
+		m.closeStream(ctx)
+		return nil, nil, service.ErrNotConnected
+	}
+
+	event := append(bson.Raw(nil), stream.Current...)
+	token := append(bson.Raw(nil), stream.ResumeToken()...)
+
+	msg, err := m.newChangeMessage(event, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	release, err := m.tokens.Track(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, func(ctx context.Context, err error) error {
+		if err != nil {
+			return nil
+		}
+		return m.tokens.Commit(ctx, release())
+	}, nil
+}
+
+// newChangeMessage creates a message from a change event along with metadata
+// extracted from the event.
+func (m *mongoChangeStreamInput) newChangeMessage(event, token bson.Raw) (*service.Message, error) {
+	data, err := bson.MarshalExtJSON(event, m.marshalCanon, false)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := service.NewMessage(data)
+	if v, ok := event.Lookup("operationType").StringValueOK(); ok {
+		msg.MetaSet("operation_type", v)
+	}
+	if v, ok := event.Lookup("ns", "db").StringValueOK(); ok {
+		msg.MetaSet("database", v)
+	}
+	if v, ok := event.Lookup("ns", "coll").StringValueOK(); ok {
+		msg.MetaSet("collection", v)
+	}
+	if t, _, ok := event.Lookup("clusterTime").TimestampOK(); ok {
+		msg.MetaSet("cluster_time", time.Unix(int64(t), 0).UTC().Format(time.RFC3339))
+	}
+	if v, ok := token.Lookup("_data").StringValueOK(); ok {
+		msg.MetaSet("resume_token", v)
+	}
+	return msg, nil
+}
+
+func (m *mongoChangeStreamInput) Close(ctx context.Context) error {
+	m.closeStream(ctx)
+	return m.client.Disconnect(ctx)
+}
+
+//------------------------------------------------------------------------------
+
+type trackedToken struct {
+	seq   int64
+	token bson.Raw
+}
+
+// resumeTokenStore tracks the resume tokens of change events that have been
+// dispatched and persists the token of the last event acknowledged in order
+// to a cache resource.
+type resumeTokenStore struct {
+	mgr      *service.Resources
+	cache    string
+	cacheKey string
+
+	tracker *checkpoint.Capped[trackedToken]
+
+	mut       sync.Mutex
+	seq       int64
+	committed *trackedToken
+}
+
+func newResumeTokenStore(mgr *service.Resources, cache, cacheKey string, limit int64) *resumeTokenStore {
+	return &resumeTokenStore{
+		mgr:      mgr,
+		cache:    cache,
+		cacheKey: cacheKey,
+		tracker:  checkpoint.NewCapped[trackedToken](limit),
+	}
+}
+
+// Track the resume token of a dispatched event, the returned func must be
+// called once the event is acknowledged and returns the latest token that can
+// be committed, or nil if there isn't one.
+func (r *resumeTokenStore) Track(ctx context.Context, token bson.Raw) (func() *trackedToken, error) {
+	r.mut.Lock()
+	r.seq++
+	seq := r.seq
+	r.mut.Unlock()
+	return r.tracker.Track(ctx, trackedToken{seq: seq, token: token}, 1)
+}
+
+// Commit a tracked token, persisting it to the cache resource when one is
+// configured. Tokens older than the last committed token are ignored.
+func (r *resumeTokenStore) Commit(ctx context.Context, t *trackedToken) error {
+	if t == nil {
+		return nil
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.committed != nil && r.committed.seq >= t.seq {
+		return nil
+	}
+	r.committed = t
+
+	if r.cache == "" {
+		return nil
+	}
+
+	tokenBytes, err := bson.MarshalExtJSON(t.token, true, false)
+	if err != nil {
+		return err
+	}
+
+	var setErr error
+	if err := r.mgr.AccessCache(ctx, r.cache, func(c service.Cache) {
+		setErr = c.Set(ctx, r.cacheKey, tokenBytes, nil)
+	}); err != nil {
+		return err
+	}
+	return setErr
+}
+
+// Get the last committed resume token, which is read from the cache resource
+// unless a token has been committed since the input was created. A nil token
+// is returned when none exists.
+func (r *resumeTokenStore) Get(ctx context.Context) (bson.Raw, error) {
+	r.mut.Lock()
+	committed := r.committed
+	r.mut.Unlock()
+	if committed != nil {
+		return committed.token, nil
+	}
+
+	if r.cache == "" {
+		return nil, nil
+	}
+
+	var tokenBytes []byte
+	var cacheErr error
+	if err := r.mgr.AccessCache(ctx, r.cache, func(c service.Cache) {
+		tokenBytes, cacheErr = c.Get(ctx, r.cacheKey)
+	}); err != nil {
+		return nil, err
+	}
+	if errors.Is(cacheErr, service.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if cacheErr != nil {
+		return nil, cacheErr
+	}
+
+	var token bson.Raw
+	if err := bson.UnmarshalExtJSON(tokenBytes, true, &token); err != nil {
+		return nil, fmt.Errorf("failed to parse stored resume token %q: %w", tokenBytes, err)
+	}
+	return token, nil
+}
@@ -0,0 +1,144 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func TestChangeStreamInputConfig(t *testing.T) {
+	conf := `
+url: "mongodb://localhost:27017"
+database: "foo"
+collection: "bar"
+pipeline: |
+  root = [ { "$match": { "operationType": "insert" } } ]
+full_document: whenAvailable
+checkpoint:
+  cache: foo
+`
+
+	spec := mongoChangeStreamConfigSpec()
+	env := service.NewEnvironment()
+
+	parsed, err := spec.ParseYAML(conf, env)
+	require.NoError(t, err)
+
+	mgr := service.MockResources(service.MockResourcesOptAddCache("foo"))
+	input, err := newMongoChangeStreamInput(parsed, mgr)
+	require.NoError(t, err)
+	require.NoError(t, input.Close(context.Background()))
+
+	parsed, err = spec.ParseYAML(`
+url: "mongodb://localhost:27017"
+database: "foo"
+checkpoint:
+  cache: nope
+`, env)
+	require.NoError(t, err)
+
+	_, err = newMongoChangeStreamInput(parsed, mgr)
+	require.ErrorContains(t, err, "cache resource 'nope' was not found")
+
+	parsed, err = spec.ParseYAML(`
+url: "mongodb://localhost:27017"
+database: "foo"
+pipeline: 'root = { "$match": {} }'
+`, env)
+	require.NoError(t, err)
+
+	_, err = newMongoChangeStreamInput(parsed, mgr)
+	require.ErrorContains(t, err, "must result in an array of stages")
+}
+
+func TestChangeStreamResumeTokenStore(t *testing.T) {
+	ctx := context.Background()
+	mgr := service.MockResources(service.MockResourcesOptAddCache("foo"))
+
+	tokenA, err := bson.Marshal(bson.D{{Key: "_data", Value: "8263A0"}})
+	require.NoError(t, err)
+	tokenB, err := bson.Marshal(bson.D{{Key: "_data", Value: "8263A1"}})
+	require.NoError(t, err)
+
+	store := newResumeTokenStore(mgr, "foo", "tokens", 10)
+
+	token, err := store.Get(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, token)
+
+	releaseA, err := store.Track(ctx, tokenA)
+	require.NoError(t, err)
+	releaseB, err := store.Track(ctx, tokenB)
+	require.NoError(t, err)
+
+	// Acknowledging out of order does not commit until prior events are done.
+	require.NoError(t, store.Commit(ctx, releaseB()))
+	token, err = store.Get(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, token)
+
+	require.NoError(t, store.Commit(ctx, releaseA()))
+	token, err = store.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, bson.Raw(tokenB), token)
+
+	// A fresh store restores the token from the cache.
+	restored, err := newResumeTokenStore(mgr, "foo", "tokens", 10).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, bson.Raw(tokenB), restored)
+
+	// Tokens are only kept in memory without a cache.
+	memStore := newResumeTokenStore(mgr, "", "tokens", 10)
+	release, err := memStore.Track(ctx, tokenA)
+	require.NoError(t, err)
+	require.NoError(t, memStore.Commit(ctx, release()))
+	token, err = memStore.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, bson.Raw(tokenA), token)
+}
+
+func TestChangeStreamMessage(t *testing.T) {
+	event, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: bson.D{{Key: "_data", Value: "8263A0"}}},
+		{Key: "operationType", Value: "update"},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "shop"}, {Key: "coll", Value: "orders"}}},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: int32(5)}}},
+		{Key: "updateDescription", Value: bson.D{
+			{Key: "updatedFields", Value: bson.D{{Key: "status", Value: "paid"}}},
+			{Key: "removedFields", Value: bson.A{}},
+		}},
+	})
+	require.NoError(t, err)
+	token, err := bson.Marshal(bson.D{{Key: "_data", Value: "8263A0"}})
+	require.NoError(t, err)
+
+	input := &mongoChangeStreamInput{marshalCanon: false}
+	msg, err := input.newChangeMessage(event, token)
+	require.NoError(t, err)
+
+	body, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "_id": {"_data": "8263A0"},
+  "operationType": "update",
+  "ns": {"db": "shop", "coll": "orders"},
+  "documentKey": {"_id": 5},
+  "updateDescription": {"updatedFields": {"status": "paid"}, "removedFields": []}
+}`, string(body))
+
+	for k, v := range map[string]string{
+		"operation_type": "update",
+		"database":       "shop",
+		"collection":     "orders",
+		"resume_token":   "8263A0",
+	} {
+		actual, ok := msg.MetaGet(k)
+		assert.True(t, ok, k)
+		assert.Equal(t, v, actual, k)
+	}
+}
@@ -0,0 +1,189 @@
+package mysql_cdc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+
+	"github.com/usedatabrew/benthos/v4/internal/checkpoint"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+// binlogPosition identifies a point within the binlog from which streaming
+// can resume, either by file and offset or, when GTIDs are enabled, by the
+// set of executed GTIDs.
+type binlogPosition struct {
+	File    string `json:"file,omitempty"`
+	Pos     uint32 `json:"pos,omitempty"`
+	GTIDSet string `json:"gtid_set,omitempty"`
+
+	// Set for positions that can not be resumed from, such as those of
+	// snapshot rows or of changes within a transaction, which are tracked to
+	// preserve ordering but are never committed.
+	partial bool
+}
+
+// String returns a human readable representation of the position.
+func (p binlogPosition) String() string {
+	if p.GTIDSet != "" {
+		return p.GTIDSet
+	}
+	return p.File + ":" + strconv.FormatUint(uint64(p.Pos), 10)
+}
+
+// gtidSet parses the GTID set of the position, which is nil when the
+// position has no GTID set.
+func (p binlogPosition) gtidSet(flavor string) (gomysql.GTIDSet, error) {
+	if p.GTIDSet == "" {
+		return nil, nil
+	}
+	return gomysql.ParseGTIDSet(flavor, p.GTIDSet)
+}
+
+// BinlogCheckPointer tracks the binlog positions of changes that have been
+// dispatched downstream and persists the highest position that is safe to
+// commit (all prior changes acknowledged) to a cache resource, where it can
+// be restored from after a restart.
+type BinlogCheckPointer struct {
+	mgr      *service.Resources
+	cache    string
+	cacheKey string
+
+	tracker *checkpoint.Capped[binlogPosition]
+
+	committedMut sync.Mutex
+	committed    *binlogPosition
+	persisted    time.Time
+}
+
+// NewBinlogCheckPointer creates a checkpointer that stores binlog positions
+// within the cache resource of the given name under the given key. If the
+// cache name is empty the positions are still tracked but only kept in
+// memory, which allows streaming to resume after a reconnect.
+func NewBinlogCheckPointer(mgr *service.Resources, cache, cacheKey string, limit int64) *BinlogCheckPointer {
+	return &BinlogCheckPointer{
+		mgr:      mgr,
+		cache:    cache,
+		cacheKey: cacheKey,
+		tracker:  checkpoint.NewCapped[binlogPosition](limit),
+	}
+}
+
+// Enabled returns true when a cache resource has been configured for
+// persisting checkpoints.
+func (b *BinlogCheckPointer) Enabled() bool {
+	return b.cache != ""
+}
+
+// Track the position of a batch of changes that has been dispatched
+// downstream, the returned func must be called once the batch has been
+// acknowledged and returns the highest position that can now be committed, or
+// nil if there isn't one.
+func (b *BinlogCheckPointer) Track(ctx context.Context, pos binlogPosition, batchSize int64) (func() *binlogPosition, error) {
+	return b.tracker.Track(ctx, pos, batchSize)
+}
+
+// Committed returns whether a position has been committed since the
+// checkpointer was created.
+func (b *BinlogCheckPointer) Committed() bool {
+	b.committedMut.Lock()
+	defer b.committedMut.Unlock()
+	return b.committed != nil
+}
+
+// SetCommitted records a position as committed without persisting it.
+func (b *BinlogCheckPointer) SetCommitted(pos binlogPosition) {
+	b.committedMut.Lock()
+	b.committed = &pos
+	b.committedMut.Unlock()
+}
+
+// SetCheckPoint records a position as committed and persists it to the cache
+// resource.
+func (b *BinlogCheckPointer) SetCheckPoint(ctx context.Context, pos binlogPosition) error {
+	b.SetCommitted(pos)
+
+	if !b.Enabled() {
+		return nil
+	}
+
+	posBytes, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+
+	var setErr error
+	if err := b.mgr.AccessCache(ctx, b.cache, func(c service.Cache) {
+		setErr = c.Set(ctx, b.cacheKey, posBytes, nil)
+	}); err != nil {
+		return err
+	}
+	if setErr != nil {
+		return setErr
+	}
+
+	b.committedMut.Lock()
+	b.persisted = time.Now()
+	b.committedMut.Unlock()
+	return nil
+}
+
+// SetCheckPointThrottled records a position as committed and persists it to
+// the cache resource only when no position has been persisted within the
+// given interval.
+func (b *BinlogCheckPointer) SetCheckPointThrottled(ctx context.Context, pos binlogPosition, interval time.Duration) error {
+	b.committedMut.Lock()
+	due := b.persisted.IsZero() || time.Since(b.persisted) >= interval
+	b.committedMut.Unlock()
+
+	if !due {
+		b.SetCommitted(pos)
+		return nil
+	}
+	return b.SetCheckPoint(ctx, pos)
+}
+
+// GetCheckPoint obtains the last committed position, which is read from the
+// cache resource unless a position has been committed since the input was
+// created. The returned bool is false when no checkpoint exists.
+func (b *BinlogCheckPointer) GetCheckPoint(ctx context.Context) (binlogPosition, bool, error) {
+	b.committedMut.Lock()
+	committed := b.committed
+	b.committedMut.Unlock()
+	if committed != nil {
+		return *committed, true, nil
+	}
+
+	if !b.Enabled() {
+		return binlogPosition{}, false, nil
+	}
+
+	var posBytes []byte
+	var cacheErr error
+	if err := b.mgr.AccessCache(ctx, b.cache, func(c service.Cache) {
+		posBytes, cacheErr = c.Get(ctx, b.cacheKey)
+	}); err != nil {
+		return binlogPosition{}, false, err
+	}
+	if errors.Is(cacheErr, service.ErrKeyNotFound) {
+		return binlogPosition{}, false, nil
+	}
+	if cacheErr != nil {
+		return binlogPosition{}, false, cacheErr
+	}
+
+	var pos binlogPosition
+	if err := json.Unmarshal(posBytes, &pos); err != nil {
+		return binlogPosition{}, false, fmt.Errorf("failed to parse stored checkpoint %q: %w", posBytes, err)
+	}
+	if pos.File == "" && pos.GTIDSet == "" {
+		return binlogPosition{}, false, fmt.Errorf("stored checkpoint %q has neither a binlog file nor a GTID set", posBytes)
+	}
+	return pos, true, nil
+}
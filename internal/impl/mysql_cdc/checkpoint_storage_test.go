@@ -0,0 +1,116 @@
+package mysql_cdc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func TestBinlogCheckPointerOutOfOrderAcks(t *testing.T) {
+	ctx := context.Background()
+	mgr := service.MockResources(service.MockResourcesOptAddCache("foo"))
+
+	cp := NewBinlogCheckPointer(mgr, "foo", "bar", 10)
+	require.True(t, cp.Enabled())
+
+	_, exists, err := cp.GetCheckPoint(ctx)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	releaseA, err := cp.Track(ctx, binlogPosition{File: "binlog.000001", Pos: 100}, 1)
+	require.NoError(t, err)
+	releaseB, err := cp.Track(ctx, binlogPosition{File: "binlog.000001", Pos: 200}, 1)
+	require.NoError(t, err)
+
+	assert.Nil(t, releaseB())
+
+	highest := releaseA()
+	require.NotNil(t, highest)
+	assert.Equal(t, binlogPosition{File: "binlog.000001", Pos: 200}, *highest)
+	require.NoError(t, cp.SetCheckPoint(ctx, *highest))
+
+	// A fresh checkpointer restores the position from the cache.
+	pos, exists, err := NewBinlogCheckPointer(mgr, "foo", "bar", 10).GetCheckPoint(ctx)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, binlogPosition{File: "binlog.000001", Pos: 200}, pos)
+}
+
+func TestBinlogCheckPointerGTID(t *testing.T) {
+	ctx := context.Background()
+	mgr := service.MockResources(service.MockResourcesOptAddCache("foo"))
+
+	gtidPos := binlogPosition{
+		File:    "binlog.000002",
+		Pos:     4,
+		GTIDSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23",
+	}
+	require.NoError(t, NewBinlogCheckPointer(mgr, "foo", "bar", 10).SetCheckPoint(ctx, gtidPos))
+
+	pos, exists, err := NewBinlogCheckPointer(mgr, "foo", "bar", 10).GetCheckPoint(ctx)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, gtidPos, pos)
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23", pos.String())
+
+	gset, err := pos.gtidSet("mysql")
+	require.NoError(t, err)
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23", gset.String())
+}
+
+func TestBinlogCheckPointerInMemory(t *testing.T) {
+	ctx := context.Background()
+
+	cp := NewBinlogCheckPointer(service.MockResources(), "", "bar", 10)
+	assert.False(t, cp.Enabled())
+	assert.False(t, cp.Committed())
+
+	_, exists, err := cp.GetCheckPoint(ctx)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	cp.SetCommitted(binlogPosition{File: "binlog.000001", Pos: 100})
+	assert.True(t, cp.Committed())
+
+	pos, exists, err := cp.GetCheckPoint(ctx)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "binlog.000001:100", pos.String())
+}
+
+func TestBinlogCheckPointerThrottled(t *testing.T) {
+	ctx := context.Background()
+	mgr := service.MockResources(service.MockResourcesOptAddCache("foo"))
+
+	stored := func() binlogPosition {
+		t.Helper()
+		pos, exists, err := NewBinlogCheckPointer(mgr, "foo", "bar", 10).GetCheckPoint(ctx)
+		require.NoError(t, err)
+		require.True(t, exists)
+		return pos
+	}
+
+	cp := NewBinlogCheckPointer(mgr, "foo", "bar", 10)
+
+	// The first position is always persisted.
+	require.NoError(t, cp.SetCheckPointThrottled(ctx, binlogPosition{File: "binlog.000001", Pos: 100}, time.Hour))
+	assert.Equal(t, "binlog.000001:100", stored().String())
+
+	// Subsequent positions within the interval are only committed in memory.
+	require.NoError(t, cp.SetCheckPointThrottled(ctx, binlogPosition{File: "binlog.000001", Pos: 200}, time.Hour))
+	assert.Equal(t, "binlog.000001:100", stored().String())
+
+	pos, exists, err := cp.GetCheckPoint(ctx)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, "binlog.000001:200", pos.String())
+
+	// Once the interval has passed the position is persisted again.
+	require.NoError(t, cp.SetCheckPointThrottled(ctx, binlogPosition{File: "binlog.000002", Pos: 4}, 0))
+	assert.Equal(t, "binlog.000002:4", stored().String())
+}
@@ -0,0 +1,433 @@
+package mysql_cdc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+var mysqlCDCConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Services").
+	Summary("Streams changes from the binlog of a MySQL or MariaDB server, optionally preceded by a snapshot of the existing rows.").
+	Description(`
+The server must have binary logging enabled with `+"`binlog_format=ROW`"+` and `+"`binlog_row_image=FULL`"+`, and the user requires the `+"`REPLICATION SLAVE`"+`, `+"`REPLICATION CLIENT`"+` and `+"`SELECT`"+` privileges, as well as `+"`RELOAD`"+` when `+"`stream_snapshot`"+` is enabled.
+
+When GTIDs are enabled on the server the position of the stream is tracked by GTID set, which allows streaming to resume after a failover to another server of the topology, otherwise it is tracked by binlog file and offset.
+
+The columns of streamed tables are discovered from `+"`information_schema`"+` and rediscovered after DDL statements, the columns of a table must therefore match the binlog events being read, which is not the case when resuming from a position prior to a change of the table definition.
+
+### Metadata
+
+This input adds the following metadata fields to each message:
+
+`+"```text"+`
+- table
+- schema
+- event
+- table_schema
+- snapshot
+- snapshot_table_complete
+- binlog_position
+- gtid
+- commit_timestamp
+`+"```"+`
+
+The fields `+"`table`"+`, `+"`schema`"+`, `+"`event`"+` (`+"`insert`"+`, `+"`update`"+` or `+"`delete`"+`) and `+"`table_schema`"+` follow the same conventions as the `+"`pg_stream`"+` input, where the schema is the database of the table. Snapshot rows have `+"`snapshot`"+` set to `+"`true`"+`, and other messages have the `+"`binlog_position`"+` following their transaction, the `+"`gtid`"+` of their transaction when GTIDs are enabled, and their `+"`commit_timestamp`"+`.`).
+	Field(service.NewStringField("dsn").
+		Description("A Data Source Name to connect to the server with, in the format of the `mysql` driver of the `sql` components. The database of the DSN is the default database of tables that are not qualified.").
+		Example("replicator:secret@tcp(localhost:3306)/shop")).
+	Field(service.NewStringAnnotatedEnumField("flavor", map[string]string{
+		gomysql.MySQLFlavor:   "A MySQL server.",
+		gomysql.MariaDBFlavor: "A MariaDB server.",
+	}).
+		Description("The flavor of the server, which determines the format of GTIDs.").
+		Default(gomysql.MySQLFlavor)).
+	Field(service.NewIntField("server_id").
+		Description("The server ID the input registers as a replica with, which must be unique among the replicas of the server. A random ID is used when set to `0`.").
+		Default(0).
+		Advanced()).
+	Field(service.NewTLSToggledField("tls").
+		Description("Custom TLS settings used for connecting to the server, which override any TLS parameters of the DSN.")).
+	Field(service.NewStringListField("tables").
+		Description("The tables to stream, either qualified by database or within the database of the DSN.").
+		Example([]any{"shop.orders", "customers"})).
+	Field(service.NewBoolField("stream_snapshot").
+		Description("Whether to read the existing rows of the tables before streaming changes when there is no stored checkpoint. The snapshot is consistent with the position streaming begins from, which is obtained while holding a global read lock for a brief moment. An interrupted snapshot is restarted from the beginning. The last row of each table has the metadata field `snapshot_table_complete` set to `true`.").
+		Default(false)).
+	Field(service.NewIntField("snapshot_batch_size").
+		Description("The maximum number of rows read by each query of a snapshot.").
+		Default(defaultSnapshotBatchSize).
+		Advanced()).
+	Field(service.NewBoolField("batch_transactions").
+		Description("When `true` all changes of a source transaction are dispatched together as a single batch, and the transaction is only committed once the whole batch has been acknowledged. When `false` each change is dispatched as an individual message.").
+		Default(false)).
+	Field(service.NewObjectField("checkpoint",
+		service.NewStringField("cache").
+			Description("A cache resource used to persist the binlog position of the last change acknowledged downstream. When set the stored position is restored on connect. When empty the position is kept in memory only and streaming begins at the current position of the server after a restart. The positions of transactions that do not change any of the streamed tables are persisted at most once every 10 seconds.").
+			Default(""),
+		service.NewStringField("key").
+			Description("The key under which the position is stored within the cache.").
+			Default("mysql_cdc"),
+		service.NewIntField("limit").
+			Description("The maximum number of changes that can be pending acknowledgement at any given time. Changes are only committed once all prior changes have been acknowledged.").
+			Default(1024),
+	).
+		Description("Persist the position of the stream to a cache resource so that restarts resume from exactly the last acknowledged change.")).
+	Example("Stream Orders", "Stream the existing and future rows of a table, persisting the position of the stream in a Redis cache.", `
+input:
+  mysql_cdc:
+    dsn: replicator:secret@tcp(localhost:3306)/shop
+    tables: [ orders ]
+    stream_snapshot: true
+    checkpoint:
+      cache: positions
+
+cache_resources:
+  - label: positions
+    redis:
+      url: redis://localhost:6379
+`)
+
+func init() {
+	err := service.RegisterBatchInput(
+		"mysql_cdc", mysqlCDCConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+			i, err := mysqlCDCInputFromConfig(conf, mgr)
+			if err != nil {
+				return nil, err
+			}
+			return service.AutoRetryNacksBatched(i), nil
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type mysqlCDCInput struct {
+	dbConfig          *mysql.Config
+	syncerConfig      replication.BinlogSyncerConfig
+	tables            []tableSchema
+	streamSnapshot    bool
+	snapshotBatchSize int
+	batchTransactions bool
+	checkPointer      *BinlogCheckPointer
+	logger            *service.Logger
+
+	db      *sql.DB
+	stream  *binlogStream
+	pending []change
+}
+
+func mysqlCDCInputFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*mysqlCDCInput, error) {
+	dsn, err := conf.FieldString("dsn")
+	if err != nil {
+		return nil, err
+	}
+	dbConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn: %w", err)
+	}
+	if dbConfig.Net != "tcp" {
+		return nil, fmt.Errorf("dsn network must be tcp, got %v", dbConfig.Net)
+	}
+
+	// Values are read as text and timestamps are rendered in UTC for both
+	// snapshots and the binlog.
+	dbConfig.ParseTime = false
+	if dbConfig.Params == nil {
+		dbConfig.Params = map[string]string{}
+	}
+	dbConfig.Params["time_zone"] = "'+00:00'"
+
+	tlsConf, tlsEnabled, err := conf.FieldTLSToggled("tls")
+	if err != nil {
+		return nil, err
+	}
+	if tlsEnabled {
+		dbConfig.TLS = tlsConf
+	}
+
+	host, portStr, err := net.SplitHostPort(dbConfig.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn address: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn port: %w", err)
+	}
+	if dbConfig.TLS != nil && dbConfig.TLS.ServerName == "" && !dbConfig.TLS.InsecureSkipVerify {
+		dbConfig.TLS = dbConfig.TLS.Clone()
+		dbConfig.TLS.ServerName = host
+	}
+
+	flavor, err := conf.FieldString("flavor")
+	if err != nil {
+		return nil, err
+	}
+
+	serverID, err := conf.FieldInt("server_id")
+	if err != nil {
+		return nil, err
+	}
+	if serverID < 0 || serverID > 1<<32-1 {
+		return nil, fmt.Errorf("server_id must be between 0 and %d, got %d", uint32(1<<32-1), serverID)
+	}
+	if serverID == 0 {
+		// Avoid the low IDs commonly assigned to servers of the topology.
+		serverID = 1001 + rand.Intn(1<<30)
+	}
+
+	tableNames, err := conf.FieldStringList("tables")
+	if err != nil {
+		return nil, err
+	}
+	if len(tableNames) == 0 {
+		return nil, errors.New("at least one table must be specified")
+	}
+	known := map[string]struct{}{}
+	var tables []tableSchema
+	for _, name := range tableNames {
+		var t tableSchema
+		if t.Schema, t.Name = splitTableName(name, dbConfig.DBName); t.Schema == "" {
+			return nil, fmt.Errorf("table %v must be qualified by database as the dsn has no database", name)
+		}
+		if _, exists := known[t.FullName()]; exists {
+			continue
+		}
+		known[t.FullName()] = struct{}{}
+		tables = append(tables, t)
+	}
+
+	i := &mysqlCDCInput{
+		dbConfig: dbConfig,
+		syncerConfig: replication.BinlogSyncerConfig{
+			ServerID:                uint32(serverID),
+			Flavor:                  flavor,
+			Host:                    host,
+			Port:                    uint16(port),
+			User:                    dbConfig.User,
+			Password:                dbConfig.Passwd,
+			Charset:                 "utf8mb4",
+			TLSConfig:               dbConfig.TLS,
+			UseDecimal:              true,
+			TimestampStringLocation: time.UTC,
+			HeartbeatPeriod:         30 * time.Second,
+			ReadTimeout:             90 * time.Second,
+			// Connection failures are surfaced so that streaming resumes from
+			// the last committed position when reconnecting.
+			DisableRetrySync: true,
+			Logger:           binlogLogger{log: mgr.Logger()},
+		},
+		tables: tables,
+		logger: mgr.Logger(),
+	}
+
+	if i.streamSnapshot, err = conf.FieldBool("stream_snapshot"); err != nil {
+		return nil, err
+	}
+	if i.snapshotBatchSize, err = conf.FieldInt("snapshot_batch_size"); err != nil {
+		return nil, err
+	}
+	if i.batchTransactions, err = conf.FieldBool("batch_transactions"); err != nil {
+		return nil, err
+	}
+
+	checkpointCache, err := conf.FieldString("checkpoint", "cache")
+	if err != nil {
+		return nil, err
+	}
+	checkpointKey, err := conf.FieldString("checkpoint", "key")
+	if err != nil {
+		return nil, err
+	}
+	checkpointLimit, err := conf.FieldInt("checkpoint", "limit")
+	if err != nil {
+		return nil, err
+	}
+	if checkpointLimit < 1 {
+		return nil, fmt.Errorf("checkpoint limit must be at least 1, got %d", checkpointLimit)
+	}
+	i.checkPointer = NewBinlogCheckPointer(mgr, checkpointCache, checkpointKey, int64(checkpointLimit))
+	return i, nil
+}
+
+// discoverSchemas obtains the columns of the streamed tables.
+func (i *mysqlCDCInput) discoverSchemas(ctx context.Context) ([]tableSchema, error) {
+	tables := make([]tableSchema, 0, len(i.tables))
+	for _, t := range i.tables {
+		columns, err := discoverColumns(ctx, i.db, t.Schema, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		t.setColumns(columns)
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+func (i *mysqlCDCInput) Connect(ctx context.Context) error {
+	if i.stream != nil {
+		if err := i.stream.Close(ctx); err != nil {
+			return err
+		}
+		i.stream = nil
+	}
+
+	if i.db == nil {
+		connector, err := mysql.NewConnector(i.dbConfig)
+		if err != nil {
+			return err
+		}
+		i.db = sql.OpenDB(connector)
+	}
+
+	tables, err := i.discoverSchemas(ctx)
+	if err != nil {
+		return err
+	}
+
+	start, exists, err := i.checkPointer.GetCheckPoint(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain checkpoint: %w", err)
+	}
+
+	conf := binlogStreamConfig{
+		syncer:            i.syncerConfig,
+		db:                i.db,
+		tables:            tables,
+		streamSnapshot:    i.streamSnapshot,
+		snapshotBatchSize: i.snapshotBatchSize,
+	}
+	if exists {
+		conf.start = &start
+		i.logger.Infof("Resuming binlog stream from stored checkpoint %s", start)
+	}
+
+	stream, err := newBinlogStream(ctx, conf, i.logger)
+	if err != nil {
+		return err
+	}
+	i.stream = stream
+	i.pending = nil
+	return nil
+}
+
+func (i *mysqlCDCInput) changesBatch(ctx context.Context, changes []change, ackPos binlogPosition) (service.MessageBatch, service.AckFunc, error) {
+	batch := make(service.MessageBatch, 0, len(changes))
+	for _, c := range changes {
+		msg, err := newChangeMessage(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		batch = append(batch, msg)
+	}
+
+	release, err := i.checkPointer.Track(ctx, ackPos, int64(len(batch)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return batch, func(ctx context.Context, err error) error {
+		highest := release()
+		if highest == nil || highest.partial {
+			return nil
+		}
+		return i.checkPointer.SetCheckPoint(ctx, *highest)
+	}, nil
+}
+
+func (i *mysqlCDCInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	if i.stream == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	// Changes of a transaction that are yet to be dispatched when transactions
+	// aren't batched, only the last of which commits the transaction.
+	if len(i.pending) > 0 {
+		c := i.pending[0]
+		i.pending = i.pending[1:]
+		return i.changesBatch(ctx, []change{c}, i.ackPosition(c, len(i.pending) == 0))
+	}
+
+	for {
+		select {
+		case tx := <-i.stream.MessageC():
+			if len(tx.Changes) == 0 {
+				if err := i.skipTransaction(ctx, tx.Position); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			if i.batchTransactions {
+				return i.changesBatch(ctx, tx.Changes, tx.Position)
+			}
+			i.pending = tx.Changes[1:]
+			return i.changesBatch(ctx, tx.Changes[:1], i.ackPosition(tx.Changes[0], len(i.pending) == 0))
+		case <-i.stream.ClosedChan():
+			// The cause has already been logged by the stream.
+			i.stream = nil
+			return nil, nil, service.ErrNotConnected
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// ackPosition returns the position committed once a change is acknowledged,
+// which is the position following its transaction for the last change of
+// the transaction. Other changes have a position that is never committed, as
+// a position within a transaction can not be resumed from.
+func (i *mysqlCDCInput) ackPosition(c change, last bool) binlogPosition {
+	if last {
+		return c.Position
+	}
+	return binlogPosition{partial: true}
+}
+
+// skippedCheckpointInterval is the minimum interval between persisting the
+// positions of transactions without changes to streamed tables.
+const skippedCheckpointInterval = time.Second * 10
+
+// skipTransaction acknowledges a transaction without changes to streamed
+// tables, such as the end of a snapshot. Its position is persisted at most once
+// per skippedCheckpointInterval, which avoids writing to the checkpoint cache
+// for every unrelated transaction whilst ensuring that the stored position
+// keeps advancing when streamed tables are rarely changed, as a stale position
+// may refer to binlogs that have since been purged from the server.
+func (i *mysqlCDCInput) skipTransaction(ctx context.Context, pos binlogPosition) error {
+	release, err := i.checkPointer.Track(ctx, pos, 1)
+	if err != nil {
+		return err
+	}
+	highest := release()
+	if highest == nil || highest.partial {
+		return nil
+	}
+	return i.checkPointer.SetCheckPointThrottled(ctx, *highest, skippedCheckpointInterval)
+}
+
+func (i *mysqlCDCInput) Close(ctx context.Context) error {
+	if i.stream != nil {
+		if err := i.stream.Close(ctx); err != nil {
+			return err
+		}
+		i.stream = nil
+	}
+	if i.db != nil {
+		err := i.db.Close()
+		i.db = nil
+		return err
+	}
+	return nil
+}
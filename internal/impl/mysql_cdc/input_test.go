@@ -0,0 +1,79 @@
+package mysql_cdc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func testMySQLCDCInput(t *testing.T, yamlStr string) (*mysqlCDCInput, error) {
+	t.Helper()
+
+	conf, err := mysqlCDCConfigSpec.ParseYAML(yamlStr, nil)
+	require.NoError(t, err)
+
+	return mysqlCDCInputFromConfig(conf, service.MockResources())
+}
+
+func TestMySQLCDCConfig(t *testing.T) {
+	i, err := testMySQLCDCInput(t, `
+dsn: replicator:secret@tcp(db.example.com:3307)/shop?tls=skip-verify
+server_id: 1234
+tables: [ orders, billing.invoices, orders ]
+`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "db.example.com", i.syncerConfig.Host)
+	assert.Equal(t, uint16(3307), i.syncerConfig.Port)
+	assert.Equal(t, "replicator", i.syncerConfig.User)
+	assert.Equal(t, "secret", i.syncerConfig.Password)
+	assert.Equal(t, uint32(1234), i.syncerConfig.ServerID)
+	assert.Equal(t, "mysql", i.syncerConfig.Flavor)
+	require.NotNil(t, i.syncerConfig.TLSConfig)
+	assert.True(t, i.syncerConfig.TLSConfig.InsecureSkipVerify)
+
+	assert.Equal(t, "'+00:00'", i.dbConfig.Params["time_zone"])
+	assert.False(t, i.dbConfig.ParseTime)
+
+	require.Len(t, i.tables, 2)
+	assert.Equal(t, "shop.orders", i.tables[0].FullName())
+	assert.Equal(t, "billing.invoices", i.tables[1].FullName())
+}
+
+func TestMySQLCDCConfigDefaults(t *testing.T) {
+	i, err := testMySQLCDCInput(t, `
+dsn: replicator:secret@tcp(localhost)/shop
+tables: [ orders ]
+`)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint16(3306), i.syncerConfig.Port)
+	assert.Greater(t, i.syncerConfig.ServerID, uint32(1000))
+	assert.Nil(t, i.syncerConfig.TLSConfig)
+	assert.False(t, i.checkPointer.Enabled())
+}
+
+func TestMySQLCDCConfigErrors(t *testing.T) {
+	_, err := testMySQLCDCInput(t, `
+dsn: replicator:secret@tcp(localhost:3306)/
+tables: [ orders ]
+`)
+	require.Error(t, err)
+
+	_, err = testMySQLCDCInput(t, `
+dsn: replicator:secret@unix(/tmp/mysql.sock)/shop
+tables: [ orders ]
+`)
+	require.Error(t, err)
+
+	_, err = testMySQLCDCInput(t, `
+dsn: replicator:secret@tcp(localhost:3306)/shop
+tables: [ orders ]
+checkpoint:
+  limit: 0
+`)
+	require.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package mysql_cdc
+
+import (
+	"fmt"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+// binlogLogger adapts a service logger to the logger interface of the binlog
+// syncer, the syncer is chatty and so its info logs are demoted to debug.
+type binlogLogger struct {
+	log *service.Logger
+}
+
+func (l binlogLogger) Fatal(args ...any)                 { l.log.Error(fmt.Sprint(args...)) }
+func (l binlogLogger) Fatalf(format string, args ...any) { l.log.Errorf(format, args...) }
+func (l binlogLogger) Fatalln(args ...any)               { l.log.Error(fmt.Sprint(args...)) }
+func (l binlogLogger) Panic(args ...any)                 { l.log.Error(fmt.Sprint(args...)) }
+func (l binlogLogger) Panicf(format string, args ...any) { l.log.Errorf(format, args...) }
+func (l binlogLogger) Panicln(args ...any)               { l.log.Error(fmt.Sprint(args...)) }
+func (l binlogLogger) Print(args ...any)                 { l.log.Debug(fmt.Sprint(args...)) }
+func (l binlogLogger) Printf(format string, args ...any) { l.log.Debugf(format, args...) }
+func (l binlogLogger) Println(args ...any)               { l.log.Debug(fmt.Sprint(args...)) }
+func (l binlogLogger) Debug(args ...any)                 { l.log.Debug(fmt.Sprint(args...)) }
+func (l binlogLogger) Debugf(format string, args ...any) { l.log.Debugf(format, args...) }
+func (l binlogLogger) Debugln(args ...any)               { l.log.Debug(fmt.Sprint(args...)) }
+func (l binlogLogger) Error(args ...any)                 { l.log.Error(fmt.Sprint(args...)) }
+func (l binlogLogger) Errorf(format string, args ...any) { l.log.Errorf(format, args...) }
+func (l binlogLogger) Errorln(args ...any)               { l.log.Error(fmt.Sprint(args...)) }
+func (l binlogLogger) Info(args ...any)                  { l.log.Debug(fmt.Sprint(args...)) }
+func (l binlogLogger) Infof(format string, args ...any)  { l.log.Debugf(format, args...) }
+func (l binlogLogger) Infoln(args ...any)                { l.log.Debug(fmt.Sprint(args...)) }
+func (l binlogLogger) Warn(args ...any)                  { l.log.Warn(fmt.Sprint(args...)) }
+func (l binlogLogger) Warnf(format string, args ...any)  { l.log.Warnf(format, args...) }
+func (l binlogLogger) Warnln(args ...any)                { l.log.Warn(fmt.Sprint(args...)) }
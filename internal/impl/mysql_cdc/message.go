@@ -0,0 +1,45 @@
+package mysql_cdc
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+// newChangeMessage creates a message from a change containing the row after
+// the change was applied, or the row before it was removed for deletes.
+func newChangeMessage(c change) (*service.Message, error) {
+	body := c.After
+	if c.Kind == "delete" {
+		body = c.Before
+	}
+
+	msgBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := service.NewMessage(msgBytes)
+	msg.MetaSet("table", c.Table)
+	msg.MetaSet("schema", c.Schema)
+	msg.MetaSet("event", c.Kind)
+	if columns := c.TableSchema.ColumnsJSON(); columns != "" {
+		msg.MetaSet("table_schema", columns)
+	}
+	if c.Snapshot {
+		msg.MetaSet("snapshot", "true")
+		if c.snapshotTableComplete {
+			msg.MetaSet("snapshot_table_complete", "true")
+		}
+		return msg, nil
+	}
+
+	msg.MetaSet("binlog_position", c.Position.File+":"+strconv.FormatUint(uint64(c.Position.Pos), 10))
+	if c.GTID != "" {
+		msg.MetaSet("gtid", c.GTID)
+	}
+	msg.MetaSet("commit_timestamp", c.Timestamp.UTC().Format(time.RFC3339Nano))
+	return msg, nil
+}
@@ -0,0 +1,65 @@
+package mysql_cdc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewChangeMessage(t *testing.T) {
+	table := &tableSchema{Schema: "shop", Name: "orders"}
+	table.setColumns([]columnSchema{{Name: "id", DatabrewType: "Int32", NativeConnectorType: "int", Pk: true}})
+
+	msg, err := newChangeMessage(change{
+		Timestamp:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Kind:        "delete",
+		Schema:      "shop",
+		Table:       "orders",
+		Before:      map[string]any{"id": int64(5)},
+		GTID:        "3e11fa47-71ca-11e1-9e33-c80aa9429562:23",
+		Position:    binlogPosition{File: "binlog.000001", Pos: 400},
+		TableSchema: table,
+	})
+	require.NoError(t, err)
+
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":5}`, string(b))
+
+	meta := map[string]any{}
+	_ = msg.MetaWalkMut(func(k string, v any) error {
+		meta[k] = v
+		return nil
+	})
+	assert.Equal(t, map[string]any{
+		"table":            "orders",
+		"schema":           "shop",
+		"event":            "delete",
+		"table_schema":     table.ColumnsJSON(),
+		"binlog_position":  "binlog.000001:400",
+		"gtid":             "3e11fa47-71ca-11e1-9e33-c80aa9429562:23",
+		"commit_timestamp": "2024-01-02T03:04:05Z",
+	}, meta)
+
+	msg, err = newChangeMessage(change{
+		Kind:                  "insert",
+		Schema:                "shop",
+		Table:                 "orders",
+		After:                 map[string]any{"id": int64(5)},
+		Snapshot:              true,
+		TableSchema:           table,
+		snapshotTableComplete: true,
+	})
+	require.NoError(t, err)
+
+	v, exists := msg.MetaGet("snapshot")
+	assert.True(t, exists)
+	assert.Equal(t, "true", v)
+	v, exists = msg.MetaGet("snapshot_table_complete")
+	assert.True(t, exists)
+	assert.Equal(t, "true", v)
+	_, exists = msg.MetaGet("binlog_position")
+	assert.False(t, exists)
+}
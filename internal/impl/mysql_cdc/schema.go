@@ -0,0 +1,362 @@
+package mysql_cdc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+type columnSchema struct {
+	Name                string `json:"name"`
+	DatabrewType        string `json:"databrewType"`
+	NativeConnectorType string `json:"nativeConnectorType"`
+	Pk                  bool   `json:"pk"`
+	Nullable            bool   `json:"nullable"`
+
+	unsigned bool
+	values   []string
+}
+
+// tableSchema describes a table being streamed along with its columns in
+// ordinal order, which is the order of the values within binlog row events.
+type tableSchema struct {
+	Schema  string
+	Name    string
+	Columns []columnSchema
+
+	columnsJSON string
+}
+
+// FullName returns the database qualified name of the table.
+func (t tableSchema) FullName() string {
+	return t.Schema + "." + t.Name
+}
+
+// ColumnsJSON returns the columns of the table serialized as a JSON array, or
+// an empty string when the columns are unknown.
+func (t *tableSchema) ColumnsJSON() string {
+	if t == nil {
+		return ""
+	}
+	return t.columnsJSON
+}
+
+func (t *tableSchema) setColumns(columns []columnSchema) {
+	t.Columns = columns
+	t.columnsJSON = ""
+	if len(t.Columns) > 0 {
+		b, _ := json.Marshal(t.Columns)
+		t.columnsJSON = string(b)
+	}
+}
+
+// primaryKey returns the primary key columns of the table.
+func (t *tableSchema) primaryKey() []string {
+	var keys []string
+	for _, col := range t.Columns {
+		if col.Pk {
+			keys = append(keys, col.Name)
+		}
+	}
+	return keys
+}
+
+func (t tableSchema) identifier() string {
+	return quoteIdentifier(t.Schema) + "." + quoteIdentifier(t.Name)
+}
+
+func (t tableSchema) selectColumns() string {
+	names := make([]string, 0, len(t.Columns))
+	for _, col := range t.Columns {
+		names = append(names, quoteIdentifier(col.Name))
+	}
+	return strings.Join(names, ", ")
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func splitTableName(name, defaultSchema string) (schema, table string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return defaultSchema, name
+}
+
+const discoverColumnsQuery = `SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE = 'YES', COLUMN_KEY = 'PRI'
+FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+ORDER BY ORDINAL_POSITION`
+
+// discoverColumns obtains the columns of a table from information_schema.
+func discoverColumns(ctx context.Context, db *sql.DB, schema, table string) ([]columnSchema, error) {
+	rows, err := db.QueryContext(ctx, discoverColumnsQuery, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover columns of table %s.%s: %w", schema, table, err)
+	}
+	defer rows.Close()
+
+	var columns []columnSchema
+	for rows.Next() {
+		var col columnSchema
+		var dataType, columnType string
+		if err := rows.Scan(&col.Name, &dataType, &columnType, &col.Nullable, &col.Pk); err != nil {
+			return nil, fmt.Errorf("failed to discover columns of table %s.%s: %w", schema, table, err)
+		}
+		col.NativeConnectorType = strings.ToLower(columnType)
+		col.unsigned = strings.Contains(col.NativeConnectorType, "unsigned")
+		col.DatabrewType = arrowType(dataType, col.unsigned)
+		if dataType == "enum" || dataType == "set" {
+			col.values = parseEnumValues(columnType)
+		}
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to discover columns of table %s.%s: %w", schema, table, err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s.%s does not exist", schema, table)
+	}
+	return columns, nil
+}
+
+// parseEnumValues extracts the permitted values from the column type of an
+// enum or set column, e.g. `enum('a','b')`.
+func parseEnumValues(columnType string) []string {
+	start, end := strings.Index(columnType, "("), strings.LastIndex(columnType, ")")
+	if start < 0 || end <= start {
+		return nil
+	}
+
+	var values []string
+	var current strings.Builder
+	quoted := false
+	body := columnType[start+1 : end]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\'' && quoted && i+1 < len(body) && body[i+1] == '\'':
+			current.WriteByte('\'')
+			i++
+		case c == '\'':
+			if quoted {
+				values = append(values, current.String())
+				current.Reset()
+			}
+			quoted = !quoted
+		case c == '\\' && quoted && i+1 < len(body):
+			current.WriteByte(body[i+1])
+			i++
+		case quoted:
+			current.WriteByte(c)
+		}
+	}
+	return values
+}
+
+// arrowType maps a MySQL data type onto the Apache Arrow type used to
+// represent its values.
+func arrowType(dataType string, unsigned bool) string {
+	switch strings.ToLower(dataType) {
+	case "tinyint":
+		if unsigned {
+			return "Int16"
+		}
+		return "Int8"
+	case "smallint":
+		if unsigned {
+			return "Int32"
+		}
+		return "Int16"
+	case "mediumint", "int", "integer":
+		if unsigned {
+			return "Int64"
+		}
+		return "Int32"
+	case "bigint":
+		if unsigned {
+			return "Uint64"
+		}
+		return "Int64"
+	case "bit", "year":
+		return "Int64"
+	case "float":
+		return "Float32"
+	case "double", "real":
+		return "Float64"
+	case "decimal", "numeric":
+		return "Decimal128"
+	case "date":
+		return "Date32"
+	case "datetime", "timestamp":
+		return "Timestamp"
+	case "time":
+		return "Time64"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "geometry":
+		return "Binary"
+	}
+	return "String"
+}
+
+func (c columnSchema) isBinary() bool {
+	return c.DatabrewType == "Binary"
+}
+
+func (c columnSchema) isInteger() bool {
+	switch c.DatabrewType {
+	case "Int8", "Int16", "Int32", "Int64", "Uint64":
+		return true
+	}
+	return false
+}
+
+// binlogValue converts a value decoded from a binlog row event into the
+// representation used within messages, which matches that of textValue.
+func (c columnSchema) binlogValue(v any) any {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case int8:
+		if c.unsigned {
+			return int64(uint8(t))
+		}
+		return int64(t)
+	case int16:
+		if c.unsigned {
+			return int64(uint16(t))
+		}
+		return int64(t)
+	case int32:
+		if c.unsigned {
+			if strings.HasPrefix(c.NativeConnectorType, "mediumint") {
+				return int64(uint32(t) & 0xFFFFFF)
+			}
+			return int64(uint32(t))
+		}
+		return int64(t)
+	case int64:
+		if len(c.values) > 0 {
+			if strings.HasPrefix(c.NativeConnectorType, "set") {
+				return setValue(c.values, t)
+			}
+			return enumValue(c.values, t)
+		}
+		if c.unsigned && t < 0 {
+			return uint64(t)
+		}
+		return t
+	case int:
+		return int64(t)
+	case uint64:
+		if t <= math.MaxInt64 {
+			return int64(t)
+		}
+		return t
+	case float32:
+		// Widen by the shortest decimal representation so that values match
+		// those read during snapshots.
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(t), 'g', -1, 32), 64)
+		return f
+	case decimal.Decimal:
+		return t.String()
+	case []byte:
+		if c.isBinary() {
+			return t
+		}
+		return string(t)
+	case string:
+		// Fixed length binary columns are decoded as strings.
+		if c.isBinary() {
+			return []byte(t)
+		}
+		return t
+	}
+	return v
+}
+
+// textValue converts a value read with the text protocol into the
+// representation used within messages.
+func (c columnSchema) textValue(b []byte) (any, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if c.isBinary() {
+		return append([]byte(nil), b...), nil
+	}
+
+	s := string(b)
+	switch {
+	case strings.HasPrefix(c.NativeConnectorType, "bit"):
+		var padded [8]byte
+		if len(b) > len(padded) {
+			return nil, fmt.Errorf("bit value of column %s is too long", c.Name)
+		}
+		copy(padded[len(padded)-len(b):], b)
+		return int64(binary.BigEndian.Uint64(padded[:])), nil
+	case c.isInteger():
+		if c.unsigned {
+			u, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse value of column %s: %w", c.Name, err)
+			}
+			if u <= math.MaxInt64 {
+				return int64(u), nil
+			}
+			return u, nil
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse value of column %s: %w", c.Name, err)
+		}
+		return i, nil
+	case c.DatabrewType == "Float32" || c.DatabrewType == "Float64":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse value of column %s: %w", c.Name, err)
+		}
+		return f, nil
+	}
+	return s, nil
+}
+
+// enumValue returns the value of an enum from its one based index, where zero
+// is the empty string assigned to invalid values.
+func enumValue(values []string, index int64) string {
+	if index < 1 || index > int64(len(values)) {
+		return ""
+	}
+	return values[index-1]
+}
+
+// setValue returns the comma separated members of a set from its bitmask.
+func setValue(values []string, mask int64) string {
+	var members []string
+	for i, v := range values {
+		if mask&(1<<uint(i)) != 0 {
+			members = append(members, v)
+		}
+	}
+	return strings.Join(members, ",")
+}
+
+// binlogRow converts the values of a binlog row event into a row keyed by
+// column name.
+func (t *tableSchema) binlogRow(values []any) (map[string]any, error) {
+	if len(values) != len(t.Columns) {
+		return nil, fmt.Errorf("row of table %s has %d values but %d columns are known", t.FullName(), len(values), len(t.Columns))
+	}
+	row := make(map[string]any, len(values))
+	for i, v := range values {
+		col := t.Columns[i]
+		row[col.Name] = col.binlogValue(v)
+	}
+	return row, nil
+}
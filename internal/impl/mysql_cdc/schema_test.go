@@ -0,0 +1,116 @@
+package mysql_cdc
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnumValues(t *testing.T) {
+	assert.Equal(t, []string{"a", "b c", "it's", "x,y"}, parseEnumValues(`enum('a','b c','it''s','x,y')`))
+	assert.Equal(t, []string{"read", "write"}, parseEnumValues(`set('read','write')`))
+	assert.Nil(t, parseEnumValues("int"))
+}
+
+func TestBinlogValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		column columnSchema
+		value  any
+		output any
+	}{
+		{"tinyint", columnSchema{DatabrewType: "Int8"}, int8(-1), int64(-1)},
+		{"unsigned tinyint", columnSchema{DatabrewType: "Int16", unsigned: true}, int8(-1), int64(255)},
+		{"unsigned mediumint", columnSchema{NativeConnectorType: "mediumint unsigned", DatabrewType: "Int64", unsigned: true}, int32(-1), int64(16777215)},
+		{"unsigned int", columnSchema{DatabrewType: "Int64", unsigned: true}, int32(-1), int64(4294967295)},
+		{"unsigned bigint", columnSchema{DatabrewType: "Uint64", unsigned: true}, int64(-1), uint64(18446744073709551615)},
+		{"float", columnSchema{DatabrewType: "Float32"}, float32(0.1), 0.1},
+		{"decimal", columnSchema{DatabrewType: "Decimal128"}, decimal.RequireFromString("12.50"), "12.5"},
+		{"text", columnSchema{DatabrewType: "String"}, []byte("foo"), "foo"},
+		{"blob", columnSchema{DatabrewType: "Binary"}, []byte("foo"), []byte("foo")},
+		{"binary", columnSchema{DatabrewType: "Binary"}, "foo", []byte("foo")},
+		{"enum", columnSchema{NativeConnectorType: "enum('a','b')", values: []string{"a", "b"}}, int64(2), "b"},
+		{"invalid enum", columnSchema{NativeConnectorType: "enum('a','b')", values: []string{"a", "b"}}, int64(0), ""},
+		{"set", columnSchema{NativeConnectorType: "set('a','b','c')", values: []string{"a", "b", "c"}}, int64(5), "a,c"},
+		{"year", columnSchema{DatabrewType: "Int64"}, 2024, int64(2024)},
+		{"null", columnSchema{DatabrewType: "Int64"}, nil, nil},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.output, test.column.binlogValue(test.value))
+		})
+	}
+}
+
+func TestTextValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		column columnSchema
+		value  []byte
+		output any
+	}{
+		{"int", columnSchema{DatabrewType: "Int32"}, []byte("-5"), int64(-5)},
+		{"unsigned bigint", columnSchema{DatabrewType: "Uint64", unsigned: true}, []byte("18446744073709551615"), uint64(18446744073709551615)},
+		{"double", columnSchema{DatabrewType: "Float64"}, []byte("1.5"), 1.5},
+		{"bit", columnSchema{NativeConnectorType: "bit(10)", DatabrewType: "Int64"}, []byte{0x02, 0x01}, int64(513)},
+		{"decimal", columnSchema{DatabrewType: "Decimal128"}, []byte("12.50"), "12.50"},
+		{"datetime", columnSchema{DatabrewType: "Timestamp"}, []byte("2024-01-02 03:04:05"), "2024-01-02 03:04:05"},
+		{"blob", columnSchema{DatabrewType: "Binary"}, []byte("foo"), []byte("foo")},
+		{"null", columnSchema{DatabrewType: "Int32"}, nil, nil},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			v, err := test.column.textValue(test.value)
+			require.NoError(t, err)
+			assert.Equal(t, test.output, v)
+		})
+	}
+
+	_, err := columnSchema{Name: "id", DatabrewType: "Int32"}.textValue([]byte("foo"))
+	require.Error(t, err)
+}
+
+func TestBinlogRow(t *testing.T) {
+	table := &tableSchema{Schema: "shop", Name: "orders"}
+	table.setColumns([]columnSchema{
+		{Name: "id", DatabrewType: "Int32", NativeConnectorType: "int", Pk: true},
+		{Name: "status", DatabrewType: "String", NativeConnectorType: "enum('new','paid')", Nullable: true, values: []string{"new", "paid"}},
+	})
+
+	row, err := table.binlogRow([]any{int32(1), int64(2)})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"id": int64(1), "status": "paid"}, row)
+
+	_, err = table.binlogRow([]any{int32(1)})
+	require.Error(t, err)
+
+	assert.Equal(t, `[{"name":"id","databrewType":"Int32","nativeConnectorType":"int","pk":true,"nullable":false},{"name":"status","databrewType":"String","nativeConnectorType":"enum('new','paid')","pk":false,"nullable":true}]`, table.ColumnsJSON())
+}
+
+func TestSnapshotQuery(t *testing.T) {
+	table := &tableSchema{Schema: "shop", Name: "orders"}
+	table.setColumns([]columnSchema{
+		{Name: "id", Pk: true},
+		{Name: "line", Pk: true},
+		{Name: "total"},
+	})
+
+	query, args := snapshotQuery(table, nil, 100)
+	assert.Equal(t, "SELECT `id`, `line`, `total` FROM `shop`.`orders` ORDER BY `id`, `line` LIMIT 101", query)
+	assert.Empty(t, args)
+
+	query, args = snapshotQuery(table, []any{int64(5), int64(2)}, 100)
+	assert.Equal(t, "SELECT `id`, `line`, `total` FROM `shop`.`orders` WHERE (`id`, `line`) > (?, ?) ORDER BY `id`, `line` LIMIT 101", query)
+	assert.Equal(t, []any{int64(5), int64(2)}, args)
+
+	noKey := &tableSchema{Schema: "shop", Name: "events"}
+	noKey.setColumns([]columnSchema{{Name: "payload"}})
+	query, _ = snapshotQuery(noKey, nil, 100)
+	assert.Equal(t, "SELECT `payload` FROM `shop`.`events`", query)
+}
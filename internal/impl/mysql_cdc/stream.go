@@ -0,0 +1,671 @@
+package mysql_cdc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+
+	"github.com/usedatabrew/benthos/v4/internal/shutdown"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const defaultSnapshotBatchSize = 10_000
+
+// change is a single row level change either decoded from the binlog or read
+// from the initial snapshot of a table.
+type change struct {
+	Timestamp time.Time
+	Kind      string
+	Schema    string
+	Table     string
+	Before    map[string]any
+	After     map[string]any
+	Snapshot  bool
+
+	// The GTID of the transaction of the change, if GTIDs are enabled.
+	GTID string
+
+	// The position following the transaction of the change.
+	Position binlogPosition
+
+	// The schema of the table at the time of the change.
+	TableSchema *tableSchema
+
+	// Set for the last snapshot row of a table.
+	snapshotTableComplete bool
+}
+
+// transaction is the group of changes committed by a single source
+// transaction, or a chunk of rows read during the snapshot. Position is the
+// point within the binlog that can be committed once all changes of the
+// transaction have been acknowledged.
+type transaction struct {
+	Position  binlogPosition
+	Timestamp time.Time
+	Changes   []change
+}
+
+type binlogStreamConfig struct {
+	syncer replication.BinlogSyncerConfig
+
+	// A connection pool used for discovering table schemas and taking the
+	// snapshot.
+	db *sql.DB
+
+	tables            []tableSchema
+	start             *binlogPosition
+	streamSnapshot    bool
+	snapshotBatchSize int
+}
+
+// binlogStream tails the binlog of a server and emits the changes to the
+// streamed tables through a channel. When there is no position to start from
+// the stream starts at the current position of the server, after taking a
+// snapshot of the tables if enabled.
+type binlogStream struct {
+	conf binlogStreamConfig
+	log  *service.Logger
+
+	syncer *replication.BinlogSyncer
+	start  binlogPosition
+
+	// A connection holding the transaction the snapshot is read from.
+	snapshotConn *sql.Conn
+
+	// The streamed tables by full name, which are only accessed by the loop.
+	tables map[string]*tableSchema
+
+	messages chan transaction
+
+	errMut sync.Mutex
+	err    error
+
+	shutSig *shutdown.Signaller
+}
+
+// newBinlogStream determines the position to start streaming from, taking a
+// snapshot if required, and begins streaming changes in the background.
+func newBinlogStream(ctx context.Context, conf binlogStreamConfig, log *service.Logger) (*binlogStream, error) {
+	s := &binlogStream{
+		conf:     conf,
+		log:      log,
+		tables:   make(map[string]*tableSchema, len(conf.tables)),
+		messages: make(chan transaction),
+		shutSig:  shutdown.NewSignaller(),
+	}
+	for i := range conf.tables {
+		t := conf.tables[i]
+		s.tables[t.FullName()] = &t
+	}
+
+	switch {
+	case conf.start != nil:
+		s.start = *conf.start
+	case conf.streamSnapshot:
+		if err := s.beginSnapshot(ctx); err != nil {
+			return nil, err
+		}
+	default:
+		pos, err := masterStatus(ctx, conf.db, conf.syncer.Flavor)
+		if err != nil {
+			return nil, err
+		}
+		s.start = pos
+	}
+
+	s.syncer = replication.NewBinlogSyncer(conf.syncer)
+	go s.loop()
+	return s, nil
+}
+
+// beginSnapshot opens a transaction with a consistent snapshot of the
+// database and obtains the binlog position it corresponds to. A global read
+// lock is held until the position has been obtained, which requires the
+// RELOAD privilege.
+func (s *binlogStream) beginSnapshot(ctx context.Context) (err error) {
+	conn, err := s.conf.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot connection: %w", err)
+	}
+
+	locked := false
+	defer func() {
+		if locked {
+			_, _ = conn.ExecContext(context.Background(), "UNLOCK TABLES")
+		}
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
+
+	if _, err = conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return fmt.Errorf("failed to set snapshot isolation level: %w", err)
+	}
+	if _, err = conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		return fmt.Errorf("failed to lock tables for snapshot: %w", err)
+	}
+	locked = true
+	if _, err = conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		return fmt.Errorf("failed to start snapshot transaction: %w", err)
+	}
+	if s.start, err = masterStatus(ctx, conn, s.conf.syncer.Flavor); err != nil {
+		return err
+	}
+	if _, err = conn.ExecContext(ctx, "UNLOCK TABLES"); err != nil {
+		return fmt.Errorf("failed to unlock tables after snapshot: %w", err)
+	}
+	locked = false
+
+	s.snapshotConn = conn
+	return nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// masterStatus obtains the current binlog position of the server, including
+// the executed GTID set when GTIDs are enabled.
+func masterStatus(ctx context.Context, q queryer, flavor string) (binlogPosition, error) {
+	rows, err := q.QueryContext(ctx, "SHOW MASTER STATUS")
+	if err != nil {
+		// MySQL 8.4 removed SHOW MASTER STATUS in favour of SHOW BINARY LOG
+		// STATUS.
+		var statusErr error
+		if rows, statusErr = q.QueryContext(ctx, "SHOW BINARY LOG STATUS"); statusErr != nil {
+			return binlogPosition{}, fmt.Errorf("failed to obtain binlog position: %w", err)
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("failed to obtain binlog position: %w", err)
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return binlogPosition{}, fmt.Errorf("failed to obtain binlog position: %w", err)
+		}
+		return binlogPosition{}, errors.New("binary logging is not enabled on the server")
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return binlogPosition{}, fmt.Errorf("failed to obtain binlog position: %w", err)
+	}
+	rows.Close()
+
+	var pos binlogPosition
+	for i, col := range columns {
+		switch col {
+		case "File":
+			pos.File = values[i].String
+		case "Position":
+			var offset uint64
+			if _, err := fmt.Sscan(values[i].String, &offset); err != nil {
+				return binlogPosition{}, fmt.Errorf("failed to parse binlog position %q: %w", values[i].String, err)
+			}
+			pos.Pos = uint32(offset)
+		case "Executed_Gtid_Set":
+			pos.GTIDSet = strings.ReplaceAll(strings.TrimSpace(values[i].String), "\n", "")
+		}
+	}
+
+	if flavor == gomysql.MariaDBFlavor {
+		var gtidPos sql.NullString
+		if err := q.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_binlog_pos").Scan(&gtidPos); err != nil {
+			return binlogPosition{}, fmt.Errorf("failed to obtain GTID position: %w", err)
+		}
+		pos.GTIDSet = gtidPos.String
+	}
+	return pos, nil
+}
+
+// MessageC returns a channel of transactions decoded from the binlog or read
+// from the snapshot.
+func (s *binlogStream) MessageC() <-chan transaction {
+	return s.messages
+}
+
+// ClosedChan returns a channel that is closed once the stream has stopped,
+// either due to being closed or due to an error, which can be obtained with
+// Err.
+func (s *binlogStream) ClosedChan() <-chan struct{} {
+	return s.shutSig.HasClosedChan()
+}
+
+// Err returns the error that caused the stream to stop, if any.
+func (s *binlogStream) Err() error {
+	s.errMut.Lock()
+	defer s.errMut.Unlock()
+	return s.err
+}
+
+func (s *binlogStream) setErr(err error) {
+	s.errMut.Lock()
+	s.err = err
+	s.errMut.Unlock()
+}
+
+// Snapshotting returns whether a snapshot is taken before streaming changes.
+func (s *binlogStream) Snapshotting() bool {
+	return s.snapshotConn != nil
+}
+
+// StartPosition returns the binlog position streaming starts from.
+func (s *binlogStream) StartPosition() binlogPosition {
+	return s.start
+}
+
+func (s *binlogStream) loop() {
+	defer func() {
+		s.syncer.Close()
+		if s.snapshotConn != nil {
+			_ = s.snapshotConn.Close()
+		}
+		s.shutSig.ShutdownComplete()
+	}()
+
+	ctx, done := s.shutSig.CloseAtLeisureCtx(context.Background())
+	defer done()
+
+	if s.snapshotConn != nil {
+		err := s.processSnapshot(ctx)
+		_ = s.snapshotConn.Close()
+		s.snapshotConn = nil
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log.Errorf("Failed to stream snapshot: %v", err)
+				s.setErr(err)
+			}
+			return
+		}
+	}
+
+	if err := s.streamEvents(ctx); err != nil && ctx.Err() == nil {
+		s.log.Errorf("Binlog stream stopped: %v", err)
+		s.setErr(err)
+	}
+}
+
+func (s *binlogStream) send(ctx context.Context, tx transaction) error {
+	select {
+	case s.messages <- tx:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// processSnapshot reads all rows of the streamed tables within the snapshot
+// transaction. Rows are emitted in chunks, the positions of which are
+// partial, followed by an empty transaction at the snapshot position
+// which commits the snapshot once all of its rows have been acknowledged.
+func (s *binlogStream) processSnapshot(ctx context.Context) error {
+	s.log.Infof("Streaming snapshot of %d tables at binlog position %s", len(s.conf.tables), s.start)
+
+	batchSize := s.conf.snapshotBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSnapshotBatchSize
+	}
+
+	for _, t := range s.conf.tables {
+		table, err := s.table(ctx, t.Schema, t.Name)
+		if err != nil {
+			return err
+		}
+		if err := s.snapshotTable(ctx, table, batchSize); err != nil {
+			return fmt.Errorf("failed to snapshot table %s: %w", table.FullName(), err)
+		}
+	}
+
+	if _, err := s.snapshotConn.ExecContext(ctx, "COMMIT"); err != nil {
+		return fmt.Errorf("failed to commit snapshot transaction: %w", err)
+	}
+	s.log.Infof("Snapshot completed, streaming binlog from %s", s.start)
+	return s.send(ctx, transaction{Position: s.start})
+}
+
+// snapshotQuery returns a query for the next chunk of rows of a table
+// snapshot along with its arguments. Tables with a primary key are paginated
+// by key, other tables are read with a single query. One row more than the
+// limit is requested in order to detect the last chunk.
+func snapshotQuery(t *tableSchema, lastKey []any, limit int) (string, []any) {
+	keys := t.primaryKey()
+	if len(keys) == 0 {
+		return fmt.Sprintf("SELECT %s FROM %s", t.selectColumns(), t.identifier()), nil
+	}
+
+	quotedKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		quotedKeys = append(quotedKeys, quoteIdentifier(k))
+	}
+	keyList := strings.Join(quotedKeys, ", ")
+
+	var where string
+	if len(lastKey) == len(keys) {
+		where = fmt.Sprintf(" WHERE (%s) > (%s)", keyList, strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", "))
+	}
+	return fmt.Sprintf(
+		"SELECT %s FROM %s%s ORDER BY %s LIMIT %d",
+		t.selectColumns(), t.identifier(), where, keyList, limit+1,
+	), lastKey
+}
+
+func (s *binlogStream) snapshotTable(ctx context.Context, table *tableSchema, batchSize int) error {
+	paginated := len(table.primaryKey()) > 0
+
+	var lastKey []any
+	for {
+		query, args := snapshotQuery(table, lastKey, batchSize)
+		rows, err := s.snapshotConn.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		var changes []change
+		complete := true
+		raw := make([]sql.RawBytes, len(table.Columns))
+		dest := make([]any, len(raw))
+		for i := range raw {
+			dest[i] = &raw[i]
+		}
+
+		for rows.Next() {
+			if paginated && len(changes) == batchSize {
+				complete = false
+				break
+			}
+			if err = rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+
+			row := make(map[string]any, len(raw))
+			for i, col := range table.Columns {
+				if row[col.Name], err = col.textValue(raw[i]); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			changes = append(changes, change{
+				Timestamp:   time.Now(),
+				Kind:        "insert",
+				Schema:      table.Schema,
+				Table:       table.Name,
+				After:       row,
+				Snapshot:    true,
+				Position:    binlogPosition{partial: true},
+				TableSchema: table,
+			})
+
+			// Non paginated tables are emitted in chunks as they are read. A
+			// chunk is only sent once the row following it has been read, so
+			// that the last row of the table is always held back and can be
+			// marked as completing the table.
+			if !paginated && len(changes) > batchSize {
+				if err = s.send(ctx, transaction{Position: binlogPosition{partial: true}, Changes: changes[:batchSize]}); err != nil {
+					rows.Close()
+					return err
+				}
+				changes = []change{changes[batchSize]}
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if complete && len(changes) > 0 {
+			changes[len(changes)-1].snapshotTableComplete = true
+		}
+		if len(changes) > 0 {
+			if err = s.send(ctx, transaction{Position: binlogPosition{partial: true}, Changes: changes}); err != nil {
+				return err
+			}
+		}
+		if complete {
+			return nil
+		}
+
+		last := changes[len(changes)-1].After
+		lastKey = nil
+		for _, k := range table.primaryKey() {
+			lastKey = append(lastKey, last[k])
+		}
+	}
+}
+
+// table returns the schema of a streamed table, discovering its columns if
+// they are not yet known. Returns nil for tables that are not streamed.
+func (s *binlogStream) table(ctx context.Context, schema, name string) (*tableSchema, error) {
+	t, exists := s.tables[schema+"."+name]
+	if !exists {
+		return nil, nil
+	}
+	if len(t.Columns) > 0 {
+		return t, nil
+	}
+
+	columns, err := discoverColumns(ctx, s.conf.db, schema, name)
+	if err != nil {
+		return nil, err
+	}
+	refreshed := &tableSchema{Schema: schema, Name: name}
+	refreshed.setColumns(columns)
+	s.tables[refreshed.FullName()] = refreshed
+	return refreshed, nil
+}
+
+// invalidateTables discards the known columns of all tables so that they are
+// rediscovered on their next change. Tables are replaced rather than modified
+// as changes referencing them may still be in flight.
+func (s *binlogStream) invalidateTables() {
+	for k, t := range s.tables {
+		s.tables[k] = &tableSchema{Schema: t.Schema, Name: t.Name}
+	}
+}
+
+var ddlPattern = regexp.MustCompile(`(?i)^\s*(ALTER|CREATE|DROP|RENAME|TRUNCATE)\s`)
+
+// streamEvents reads events from the binlog and groups the row changes of
+// streamed tables into transactions.
+func (s *binlogStream) streamEvents(ctx context.Context) error {
+	var streamer *replication.BinlogStreamer
+	gset, err := s.start.gtidSet(s.conf.syncer.Flavor)
+	if err != nil {
+		return fmt.Errorf("failed to parse GTID set %q: %w", s.start.GTIDSet, err)
+	}
+	if gset != nil {
+		streamer, err = s.syncer.StartSyncGTID(gset)
+	} else {
+		streamer, err = s.syncer.StartSync(gomysql.Position{Name: s.start.File, Pos: s.start.Pos})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start binlog sync: %w", err)
+	}
+	s.log.Infof("Binlog streaming started from %s", s.start)
+
+	file := s.start.File
+	var tx *transaction
+	var gtid string
+
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		pos := binlogPosition{File: file, Pos: ev.Header.LogPos}
+		timestamp := time.Unix(int64(ev.Header.Timestamp), 0)
+
+		switch e := ev.Event.(type) {
+		case *replication.RotateEvent:
+			file = string(e.NextLogName)
+		case *replication.GTIDEvent:
+			if u, err := uuid.FromBytes(e.SID); err == nil {
+				gtid = fmt.Sprintf("%s:%d", u, e.GNO)
+			}
+		case *replication.MariadbGTIDEvent:
+			gtid = e.GTID.String()
+			tx = &transaction{Timestamp: timestamp}
+		case *replication.QueryEvent:
+			query := string(e.Query)
+			if e.GSet != nil {
+				pos.GTIDSet = e.GSet.String()
+			}
+			switch {
+			case strings.EqualFold(query, "BEGIN"):
+				tx = &transaction{Timestamp: timestamp}
+				continue
+			case strings.EqualFold(query, "COMMIT"):
+			case ddlPattern.MatchString(query):
+				// DDL statements are committed implicitly.
+				s.invalidateTables()
+			default:
+				continue
+			}
+			if err := s.commit(ctx, tx, pos, gtid); err != nil {
+				return err
+			}
+			tx, gtid = nil, ""
+		case *replication.XIDEvent:
+			if e.GSet != nil {
+				pos.GTIDSet = e.GSet.String()
+			}
+			if err := s.commit(ctx, tx, pos, gtid); err != nil {
+				return err
+			}
+			tx, gtid = nil, ""
+		case *replication.RowsEvent:
+			if tx == nil {
+				tx = &transaction{Timestamp: timestamp}
+			}
+			changes, err := s.rowChanges(ctx, ev.Header.EventType, e, timestamp)
+			if err != nil {
+				return err
+			}
+			tx.Changes = append(tx.Changes, changes...)
+		}
+	}
+}
+
+// commit emits a transaction with the position that follows it. Transactions
+// without changes to streamed tables are only offered, as they merely advance
+// the position.
+func (s *binlogStream) commit(ctx context.Context, tx *transaction, pos binlogPosition, gtid string) error {
+	if tx == nil {
+		tx = &transaction{}
+	}
+	tx.Position = pos
+	for i := range tx.Changes {
+		tx.Changes[i].Position = pos
+		tx.Changes[i].GTID = gtid
+	}
+
+	if len(tx.Changes) == 0 {
+		select {
+		case s.messages <- *tx:
+		default:
+		}
+		return nil
+	}
+	return s.send(ctx, *tx)
+}
+
+// rowChanges decodes the changes of a rows event, events of tables that are
+// not streamed are ignored.
+func (s *binlogStream) rowChanges(ctx context.Context, eventType replication.EventType, e *replication.RowsEvent, timestamp time.Time) ([]change, error) {
+	var kind string
+	switch eventType {
+	case replication.WRITE_ROWS_EVENTv0, replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
+		kind = "insert"
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+		kind = "update"
+	case replication.DELETE_ROWS_EVENTv0, replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
+		kind = "delete"
+	default:
+		return nil, nil
+	}
+
+	schema, name := string(e.Table.Schema), string(e.Table.Table)
+	table, err := s.table(ctx, schema, name)
+	if err != nil || table == nil {
+		return nil, err
+	}
+
+	// The columns of the table may have changed without a DDL statement being
+	// observed, for example when streaming resumed after an ALTER.
+	if len(e.Rows) > 0 && len(e.Rows[0]) != len(table.Columns) {
+		s.invalidateTable(schema, name)
+		if table, err = s.table(ctx, schema, name); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []change
+	step := 1
+	if kind == "update" {
+		step = 2
+	}
+	for i := 0; i+step <= len(e.Rows); i += step {
+		c := change{
+			Timestamp:   timestamp,
+			Kind:        kind,
+			Schema:      schema,
+			Table:       name,
+			TableSchema: table,
+		}
+		row, err := table.binlogRow(e.Rows[i])
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "insert":
+			c.After = row
+		case "delete":
+			c.Before = row
+		case "update":
+			c.Before = row
+			if c.After, err = table.binlogRow(e.Rows[i+1]); err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+func (s *binlogStream) invalidateTable(schema, name string) {
+	if _, exists := s.tables[schema+"."+name]; exists {
+		s.tables[schema+"."+name] = &tableSchema{Schema: schema, Name: name}
+	}
+}
+
+// Close stops the stream and waits for the binlog connection to be closed.
+func (s *binlogStream) Close(ctx context.Context) error {
+	s.shutSig.CloseAtLeisure()
+	select {
+	case <-s.shutSig.HasClosedChan():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
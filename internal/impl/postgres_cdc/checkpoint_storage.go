@@ -1,44 +1,210 @@
 package postgres_cdc
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/go-redis/redis/v7"
+	"sync"
+
+	"github.com/jackc/pglogrepl"
+
+	"github.com/usedatabrew/benthos/v4/internal/checkpoint"
+	"github.com/usedatabrew/benthos/v4/public/service"
 )
 
+// PgStreamCheckPointer tracks the LSNs of changes that have been dispatched
+// downstream and persists the highest LSN that is safe to commit (all prior
+// changes acknowledged) to a cache resource, where it can be restored from
+// after a restart.
 type PgStreamCheckPointer struct {
-	redisConn *redis.Client
+	mgr      *service.Resources
+	cache    string
+	cacheKey string
+
+	tracker *checkpoint.Capped[pglogrepl.LSN]
+
+	snapshotTracker *checkpoint.Capped[snapshotPosition]
+	snapshotMut     sync.Mutex
+	snapshot        map[string]snapshotProgress
 }
 
-func NewPgStreamCheckPointer(addr, user, password string) (*PgStreamCheckPointer, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Username: user,
-		Password: password,
-	})
-	conn := client.Conn()
-	result := conn.Ping()
-	if result.Err() != nil {
-		return nil, result.Err()
+// NewPgStreamCheckPointer creates a checkpointer that stores LSNs within the
+// cache resource of the given name under the given key. If the cache name is
+// empty the LSNs are still tracked but never persisted.
+func NewPgStreamCheckPointer(mgr *service.Resources, cache, cacheKey string, limit int64) *PgStreamCheckPointer {
+	return &PgStreamCheckPointer{
+		mgr:      mgr,
+		cache:    cache,
+		cacheKey: cacheKey,
+		tracker:  checkpoint.NewCapped[pglogrepl.LSN](limit),
+
+		snapshotTracker: checkpoint.NewCapped[snapshotPosition](limit),
 	}
+}
 
-	return &PgStreamCheckPointer{
-		redisConn: client,
-	}, nil
+// Enabled returns true when a cache resource has been configured for
+// persisting checkpoints.
+func (p *PgStreamCheckPointer) Enabled() bool {
+	return p.cache != ""
+}
+
+// Track an LSN of a batch of changes that has been dispatched downstream, the
+// returned func must be called once the batch has been acknowledged and
+// returns the highest LSN that can now be committed, or nil if there isn't
+// one.
+func (p *PgStreamCheckPointer) Track(ctx context.Context, lsn pglogrepl.LSN, batchSize int64) (func() *pglogrepl.LSN, error) {
+	return p.tracker.Track(ctx, lsn, batchSize)
+}
+
+// SetCheckPoint persists an LSN to the cache resource.
+func (p *PgStreamCheckPointer) SetCheckPoint(ctx context.Context, lsn pglogrepl.LSN) error {
+	if !p.Enabled() {
+		return nil
+	}
+	var setErr error
+	if err := p.mgr.AccessCache(ctx, p.cache, func(c service.Cache) {
+		setErr = c.Set(ctx, p.cacheKey, []byte(lsn.String()), nil)
+	}); err != nil {
+		return err
+	}
+	return setErr
+}
+
+// GetCheckPoint obtains the last persisted LSN from the cache resource, the
+// returned bool is false when no checkpoint has been stored yet.
+func (p *PgStreamCheckPointer) GetCheckPoint(ctx context.Context) (pglogrepl.LSN, bool, error) {
+	if !p.Enabled() {
+		return 0, false, nil
+	}
+
+	var lsnBytes []byte
+	var cacheErr error
+	if err := p.mgr.AccessCache(ctx, p.cache, func(c service.Cache) {
+		lsnBytes, cacheErr = c.Get(ctx, p.cacheKey)
+	}); err != nil {
+		return 0, false, err
+	}
+	if errors.Is(cacheErr, service.ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	if cacheErr != nil {
+		return 0, false, cacheErr
+	}
+
+	lsn, err := pglogrepl.ParseLSN(string(lsnBytes))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse stored checkpoint %q: %w", lsnBytes, err)
+	}
+	return lsn, true, nil
 }
 
-func (p *PgStreamCheckPointer) SetCheckPoint(lnsCheckPoint, replicationSlot string) error {
-	return p.redisConn.Set(fmt.Sprintf("rs_checkpoint_%s", replicationSlot), lnsCheckPoint, 0).Err()
+func (p *PgStreamCheckPointer) snapshotCacheKey() string {
+	return p.cacheKey + "_snapshot"
 }
 
-func (p *PgStreamCheckPointer) GetCheckPoint(replicationSlot string) string {
-	result, _ := p.redisConn.Get(fmt.Sprintf("rs_checkpoint_%s", replicationSlot)).Result()
-	return result
+// TrackSnapshot tracks the position of a snapshot change that has been
+// dispatched downstream, the returned func must be called once the change has
+// been acknowledged and returns the highest position that can now be
+// committed, or nil if there isn't one.
+func (p *PgStreamCheckPointer) TrackSnapshot(ctx context.Context, pos snapshotPosition) (func() *snapshotPosition, error) {
+	return p.snapshotTracker.Track(ctx, pos, 1)
 }
 
-func (p *PgStreamCheckPointer) Close() error {
-	if p.redisConn != nil {
-		return p.redisConn.Close()
+// GetSnapshotProgress obtains the snapshot progress of each table from the
+// cache resource, the returned map is nil when no progress has been stored.
+func (p *PgStreamCheckPointer) GetSnapshotProgress(ctx context.Context) (map[string]snapshotProgress, error) {
+	p.snapshotMut.Lock()
+	defer p.snapshotMut.Unlock()
+
+	// Without a cache the progress is only kept in memory, which still allows
+	// a snapshot to resume when reconnecting.
+	if !p.Enabled() {
+		if p.snapshot == nil {
+			return nil, nil
+		}
+		progress := make(map[string]snapshotProgress, len(p.snapshot))
+		for k, v := range p.snapshot {
+			progress[k] = v
+		}
+		return progress, nil
 	}
 
-	return nil
+	var progressBytes []byte
+	var cacheErr error
+	if err := p.mgr.AccessCache(ctx, p.cache, func(c service.Cache) {
+		progressBytes, cacheErr = c.Get(ctx, p.snapshotCacheKey())
+	}); err != nil {
+		return nil, err
+	}
+	if errors.Is(cacheErr, service.ErrKeyNotFound) {
+		p.snapshot = nil
+		return nil, nil
+	}
+	if cacheErr != nil {
+		return nil, cacheErr
+	}
+
+	progress := map[string]snapshotProgress{}
+	if err := json.Unmarshal(progressBytes, &progress); err != nil {
+		return nil, fmt.Errorf("failed to parse stored snapshot progress: %w", err)
+	}
+
+	p.snapshot = make(map[string]snapshotProgress, len(progress))
+	for k, v := range progress {
+		p.snapshot[k] = v
+	}
+	return progress, nil
+}
+
+// ResetSnapshotProgress discards the stored snapshot progress and replaces it
+// with empty progress for each of the given tables, this is called when a new
+// snapshot begins.
+func (p *PgStreamCheckPointer) ResetSnapshotProgress(ctx context.Context, tables []string) error {
+	p.snapshotMut.Lock()
+	defer p.snapshotMut.Unlock()
+
+	p.snapshot = make(map[string]snapshotProgress, len(tables))
+	for _, t := range tables {
+		p.snapshot[t] = snapshotProgress{}
+	}
+	return p.storeSnapshotProgress(ctx)
+}
+
+// CommitSnapshotProgress records the progress of the snapshot up to a position
+// and persists the progress of all tables to the cache resource.
+func (p *PgStreamCheckPointer) CommitSnapshotProgress(ctx context.Context, pos snapshotPosition) error {
+	p.snapshotMut.Lock()
+	defer p.snapshotMut.Unlock()
+
+	if p.snapshot == nil {
+		p.snapshot = map[string]snapshotProgress{}
+	}
+	for _, table := range pos.Completed {
+		if progress := p.snapshot[table]; !progress.Complete {
+			progress.Complete = true
+			p.snapshot[table] = progress
+		}
+	}
+	p.snapshot[pos.Table] = pos.Progress
+	return p.storeSnapshotProgress(ctx)
+}
+
+func (p *PgStreamCheckPointer) storeSnapshotProgress(ctx context.Context) error {
+	if !p.Enabled() {
+		return nil
+	}
+
+	progressBytes, err := json.Marshal(p.snapshot)
+	if err != nil {
+		return err
+	}
+
+	var setErr error
+	if err := p.mgr.AccessCache(ctx, p.cache, func(c service.Cache) {
+		setErr = c.Set(ctx, p.snapshotCacheKey(), progressBytes, nil)
+	}); err != nil {
+		return err
+	}
+	return setErr
 }
@@ -0,0 +1,94 @@
+package postgres_cdc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func TestCheckPointerOutOfOrderAcks(t *testing.T) {
+	ctx := context.Background()
+	mgr := service.MockResources(service.MockResourcesOptAddCache("foo"))
+
+	cp := NewPgStreamCheckPointer(mgr, "foo", "bar", 10)
+	require.True(t, cp.Enabled())
+
+	_, exists, err := cp.GetCheckPoint(ctx)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	releaseA, err := cp.Track(ctx, pglogrepl.LSN(10), 1)
+	require.NoError(t, err)
+	releaseB, err := cp.Track(ctx, pglogrepl.LSN(20), 1)
+	require.NoError(t, err)
+
+	assert.Nil(t, releaseB())
+
+	highest := releaseA()
+	require.NotNil(t, highest)
+	assert.Equal(t, pglogrepl.LSN(20), *highest)
+
+	require.NoError(t, cp.SetCheckPoint(ctx, *highest))
+
+	lsn, exists, err := cp.GetCheckPoint(ctx)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, pglogrepl.LSN(20), lsn)
+}
+
+func TestCheckPointerDisabled(t *testing.T) {
+	ctx := context.Background()
+
+	cp := NewPgStreamCheckPointer(service.MockResources(), "", "bar", 10)
+	assert.False(t, cp.Enabled())
+	require.NoError(t, cp.SetCheckPoint(ctx, pglogrepl.LSN(10)))
+
+	_, exists, err := cp.GetCheckPoint(ctx)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestCheckPointerSnapshotProgress(t *testing.T) {
+	ctx := context.Background()
+	mgr := service.MockResources(service.MockResourcesOptAddCache("foo"))
+
+	cp := NewPgStreamCheckPointer(mgr, "foo", "bar", 10)
+
+	progress, err := cp.GetSnapshotProgress(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, progress)
+
+	require.NoError(t, cp.ResetSnapshotProgress(ctx, []string{"public.a", "public.b", "public.c"}))
+
+	releaseA, err := cp.TrackSnapshot(ctx, snapshotPosition{
+		Table:    "public.a",
+		Progress: snapshotProgress{Rows: 1, LastKey: []string{"1"}, Complete: true},
+	})
+	require.NoError(t, err)
+	releaseC, err := cp.TrackSnapshot(ctx, snapshotPosition{
+		Table:     "public.c",
+		Progress:  snapshotProgress{Rows: 1, LastKey: []string{"7"}},
+		Completed: []string{"public.a", "public.b"},
+	})
+	require.NoError(t, err)
+
+	assert.Nil(t, releaseC())
+	highest := releaseA()
+	require.NotNil(t, highest)
+	require.NoError(t, cp.CommitSnapshotProgress(ctx, *highest))
+
+	// A fresh checkpointer must restore progress from the cache.
+	cp = NewPgStreamCheckPointer(mgr, "foo", "bar", 10)
+	progress, err = cp.GetSnapshotProgress(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]snapshotProgress{
+		"public.a": {Complete: true},
+		"public.b": {Complete: true},
+		"public.c": {Rows: 1, LastKey: []string{"7"}},
+	}, progress)
+}
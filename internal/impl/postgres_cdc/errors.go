@@ -0,0 +1,32 @@
+package postgres_cdc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrSlotInUse is returned when the replication slot is already being
+	// streamed by another connection.
+	ErrSlotInUse = errors.New("replication slot in use")
+
+	// ErrConnectionLost is returned when the replication connection to the
+	// server is dropped.
+	ErrConnectionLost = errors.New("replication connection lost")
+)
+
+// pgErrCodeObjectInUse is the SQLSTATE returned when starting replication on,
+// or advancing, a slot that is active on another connection.
+const pgErrCodeObjectInUse = "55006"
+
+// classifyErr wraps errors of known server conditions with the corresponding
+// typed error.
+func classifyErr(slotName string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgErrCodeObjectInUse {
+		return fmt.Errorf("%w: %s: %w", ErrSlotInUse, slotName, err)
+	}
+	return err
+}
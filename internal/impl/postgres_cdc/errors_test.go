@@ -0,0 +1,22 @@
+package postgres_cdc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyErr(t *testing.T) {
+	inUse := &pgconn.PgError{Code: pgErrCodeObjectInUse, Message: `replication slot "rs_foo" is active for PID 123`}
+	err := classifyErr("rs_foo", inUse)
+	assert.ErrorIs(t, err, ErrSlotInUse)
+	assert.ErrorIs(t, err, inUse)
+
+	other := &pgconn.PgError{Code: "42704", Message: `replication slot "rs_foo" does not exist`}
+	assert.Equal(t, other, classifyErr("rs_foo", other))
+
+	plain := errors.New("foo")
+	assert.Equal(t, plain, classifyErr("rs_foo", plain))
+}
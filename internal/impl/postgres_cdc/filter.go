@@ -0,0 +1,208 @@
+package postgres_cdc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/usedatabrew/benthos/v4/public/bloblang"
+)
+
+// parseTablePattern parses a pattern matching schema qualified table names.
+// Patterns wrapped in slashes are regular expressions, all other patterns are
+// globs where `*` matches any number of characters other than `.` and `?`
+// matches a single one. Globs without a schema match tables of the default
+// schema.
+func parseTablePattern(pattern, defaultSchema string) (*regexp.Regexp, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse table pattern %v: %w", pattern, err)
+		}
+		return re, nil
+	}
+
+	if !strings.Contains(pattern, ".") {
+		pattern = defaultSchema + "." + pattern
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(`[^.]*`)
+		case '?':
+			expr.WriteString(`[^.]`)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+func parseTablePatterns(patterns []string, defaultSchema string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := parseTablePattern(p, defaultSchema)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnFilter restricts the columns of tables matching a pattern.
+type columnFilter struct {
+	table   *regexp.Regexp
+	include []string
+	exclude []string
+}
+
+// rowFilter drops the changes of tables matching a pattern for which a
+// Bloblang query does not return true.
+type rowFilter struct {
+	table *regexp.Regexp
+	check *bloblang.Executor
+}
+
+// tableFilters determines which tables are streamed and which of their
+// columns and rows are emitted.
+type tableFilters struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	columns []columnFilter
+	rows    []rowFilter
+}
+
+const listTablesQuery = `SELECT table_schema, table_name FROM information_schema.tables
+WHERE table_type = 'BASE TABLE' AND table_schema NOT IN ('pg_catalog', 'information_schema')
+ORDER BY table_schema, table_name`
+
+// resolveTables adds the tables of the database that match an include
+// pattern to the given tables, removes the tables that match an exclude
+// pattern, and attaches the column and row filters of each table.
+func (f *tableFilters) resolveTables(ctx context.Context, conn *pgx.Conn, tables []tableSchema) ([]tableSchema, error) {
+	known := map[string]struct{}{}
+	for _, t := range tables {
+		known[t.FullName()] = struct{}{}
+	}
+
+	if len(f.include) > 0 {
+		rows, err := conn.Query(ctx, listTablesQuery)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		for rows.Next() {
+			var t tableSchema
+			if err = rows.Scan(&t.Schema, &t.Name); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to list tables: %w", err)
+			}
+			if _, exists := known[t.FullName()]; exists || !matchesAny(f.include, t.FullName()) {
+				continue
+			}
+			known[t.FullName()] = struct{}{}
+			tables = append(tables, t)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+	}
+
+	resolved := make([]tableSchema, 0, len(tables))
+	for _, t := range tables {
+		if matchesAny(f.exclude, t.FullName()) {
+			continue
+		}
+		f.apply(&t)
+		resolved = append(resolved, t)
+	}
+	return resolved, nil
+}
+
+// apply attaches the column and row filters that match a table.
+func (f *tableFilters) apply(t *tableSchema) {
+	for _, cf := range f.columns {
+		if !cf.table.MatchString(t.FullName()) {
+			continue
+		}
+		if len(cf.include) > 0 {
+			if t.includeColumns == nil {
+				t.includeColumns = map[string]struct{}{}
+			}
+			for _, c := range cf.include {
+				t.includeColumns[c] = struct{}{}
+			}
+		}
+		if len(cf.exclude) > 0 {
+			if t.excludeColumns == nil {
+				t.excludeColumns = map[string]struct{}{}
+			}
+			for _, c := range cf.exclude {
+				t.excludeColumns[c] = struct{}{}
+			}
+		}
+	}
+	for _, rf := range f.rows {
+		if rf.table.MatchString(t.FullName()) {
+			t.rowChecks = append(t.rowChecks, rf.check)
+		}
+	}
+	t.setColumns(t.Columns)
+}
+
+// columnAllowed returns whether a column passes the column filters of the
+// table.
+func (t *tableSchema) columnAllowed(name string) bool {
+	if t.includeColumns != nil {
+		if _, exists := t.includeColumns[name]; !exists {
+			return false
+		}
+	}
+	_, excluded := t.excludeColumns[name]
+	return !excluded
+}
+
+// rowAllowed returns whether a change passes the row filters of its table,
+// the filters are applied to the row after the change, or the row before it
+// for deletes. Changes without a row, such as truncates, are always allowed.
+func (t *tableSchema) rowAllowed(c *change) (bool, error) {
+	if t == nil || len(t.rowChecks) == 0 {
+		return true, nil
+	}
+
+	row := c.After
+	if c.Kind == "delete" {
+		row = c.Before
+	}
+	if row == nil {
+		return true, nil
+	}
+
+	for _, check := range t.rowChecks {
+		res, err := check.Query(row)
+		if err != nil {
+			return false, fmt.Errorf("failed to execute row filter of table %s: %w", t.FullName(), err)
+		}
+		if allowed, _ := res.(bool); !allowed {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,102 @@
+package postgres_cdc
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/public/bloblang"
+)
+
+func TestParseTablePattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern  string
+		matches  []string
+		excludes []string
+	}{
+		{
+			pattern:  "users",
+			matches:  []string{"public.users"},
+			excludes: []string{"sales.users", "public.users2"},
+		},
+		{
+			pattern:  "*.users",
+			matches:  []string{"public.users", "sales.users"},
+			excludes: []string{"public.users_archive"},
+		},
+		{
+			pattern:  "sales.order_*",
+			matches:  []string{"sales.order_items", "sales.order_"},
+			excludes: []string{"public.order_items", "sales.orders"},
+		},
+		{
+			pattern:  "public.user?",
+			matches:  []string{"public.users"},
+			excludes: []string{"public.user", "public.user.s"},
+		},
+		{
+			pattern:  `/^tenant_[0-9]+\.events$/`,
+			matches:  []string{"tenant_1.events", "tenant_42.events"},
+			excludes: []string{"tenant_a.events", "public.events"},
+		},
+	} {
+		re, err := parseTablePattern(test.pattern, "public")
+		require.NoError(t, err, test.pattern)
+		for _, m := range test.matches {
+			assert.True(t, re.MatchString(m), "%v should match %v", test.pattern, m)
+		}
+		for _, m := range test.excludes {
+			assert.False(t, re.MatchString(m), "%v should not match %v", test.pattern, m)
+		}
+	}
+
+	_, err := parseTablePattern("/[/", "public")
+	require.Error(t, err)
+}
+
+func TestTableFiltersApply(t *testing.T) {
+	check, err := bloblang.Parse(`this.status != "draft"`)
+	require.NoError(t, err)
+
+	f := tableFilters{
+		columns: []columnFilter{
+			{table: regexp.MustCompile(`^public\.users$`), exclude: []string{"email"}},
+			{table: regexp.MustCompile(`^public\.orders$`), include: []string{"id", "status"}},
+		},
+		rows: []rowFilter{
+			{table: regexp.MustCompile(`^public\.orders$`), check: check},
+		},
+	}
+
+	users := tableSchema{Schema: "public", Name: "users"}
+	f.apply(&users)
+	users.setColumns([]columnSchema{{Name: "id"}, {Name: "email"}})
+	assert.Equal(t, []columnSchema{{Name: "id"}}, users.Columns)
+	assert.Equal(t, map[string]any{"id": "1"}, users.filterRow(map[string]any{"id": "1", "email": "foo@example.com"}))
+
+	refreshed := users.withColumns([]columnSchema{{Name: "id"}, {Name: "email"}, {Name: "name"}})
+	assert.Equal(t, []columnSchema{{Name: "id"}, {Name: "name"}}, refreshed.Columns)
+	assert.Same(t, refreshed, refreshed.withColumns([]columnSchema{{Name: "id"}, {Name: "email"}, {Name: "name"}}))
+
+	orders := tableSchema{Schema: "public", Name: "orders"}
+	f.apply(&orders)
+	assert.Equal(t, map[string]any{"id": "1", "status": "draft"}, orders.filterRow(map[string]any{"id": "1", "status": "draft", "total": "5"}))
+
+	allowed, err := orders.rowAllowed(&change{Kind: "insert", After: map[string]any{"status": "draft"}})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	allowed, err = orders.rowAllowed(&change{Kind: "delete", Before: map[string]any{"status": "paid"}})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = orders.rowAllowed(&change{Kind: "truncate"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = users.rowAllowed(&change{Kind: "insert", After: map[string]any{"status": "draft"}})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
@@ -0,0 +1,126 @@
+package postgres_cdc
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	messageFormatRow      = "row"
+	messageFormatDebezium = "debezium"
+)
+
+// debeziumOperation maps a change kind to the operation code used within
+// Debezium change events.
+func debeziumOperation(c change) string {
+	if c.Snapshot {
+		return "r"
+	}
+	switch c.Kind {
+	case "insert":
+		return "c"
+	case "update":
+		return "u"
+	case "delete":
+		return "d"
+	case "truncate":
+		return "t"
+	}
+	return c.Kind
+}
+
+type debeziumSource struct {
+	Connector string `json:"connector"`
+	DB        string `json:"db"`
+	Schema    string `json:"schema"`
+	Table     string `json:"table"`
+	Lsn       uint64 `json:"lsn"`
+	TxID      uint32 `json:"txId"`
+	TsMs      int64  `json:"ts_ms"`
+	Snapshot  string `json:"snapshot"`
+}
+
+type debeziumEnvelope struct {
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after"`
+	Op     string         `json:"op"`
+	TsMs   int64          `json:"ts_ms"`
+	Source debeziumSource `json:"source"`
+}
+
+// newChangeMessage creates a message from a change in the given format.
+func newChangeMessage(c change, format, database string) (*service.Message, error) {
+	var body any
+	switch format {
+	case messageFormatDebezium:
+		body = debeziumEnvelope{
+			Before: c.Before,
+			After:  c.After,
+			Op:     debeziumOperation(c),
+			TsMs:   time.Now().UnixMilli(),
+			Source: debeziumSource{
+				Connector: "postgresql",
+				DB:        database,
+				Schema:    c.Schema,
+				Table:     c.Table,
+				Lsn:       uint64(c.Lsn),
+				TxID:      c.Xid,
+				TsMs:      c.Timestamp.UnixMilli(),
+				Snapshot:  strconv.FormatBool(c.Snapshot),
+			},
+		}
+	default:
+		switch c.Kind {
+		case "delete":
+			body = nullRow(c)
+		case "truncate":
+			// A truncate has no row, the table is identified by metadata.
+			body = map[string]any{}
+		default:
+			body = c.After
+		}
+	}
+
+	msgBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := service.NewMessage(msgBytes)
+	msg.MetaSet("table", c.Table)
+	msg.MetaSet("schema", c.Schema)
+	msg.MetaSet("event", c.Kind)
+	if columns := c.TableSchema.ColumnsJSON(); columns != "" {
+		msg.MetaSet("table_schema", columns)
+	}
+	if c.Snapshot {
+		msg.MetaSet("snapshot", "true")
+		if c.snapshotPos != nil && c.snapshotPos.Progress.Complete {
+			msg.MetaSet("snapshot_table_complete", "true")
+		}
+	} else {
+		msg.MetaSet("lsn", c.Lsn.String())
+		msg.MetaSet("xid", strconv.FormatUint(uint64(c.Xid), 10))
+		msg.MetaSet("commit_timestamp", c.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+	return msg, nil
+}
+
+// nullRow returns the row emitted for deletes in the row format, where every
+// column of the table is null.
+func nullRow(c change) map[string]any {
+	row := map[string]any{}
+	if c.TableSchema != nil && len(c.TableSchema.Columns) > 0 {
+		for _, col := range c.TableSchema.Columns {
+			row[col.Name] = nil
+		}
+		return row
+	}
+	for k := range c.Before {
+		row[k] = nil
+	}
+	return row
+}
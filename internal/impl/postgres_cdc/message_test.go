@@ -0,0 +1,156 @@
+package postgres_cdc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeMessageFormats(t *testing.T) {
+	c := change{
+		Lsn:       pglogrepl.LSN(0x16B3748),
+		Xid:       580,
+		Timestamp: time.UnixMilli(1698920130123),
+		Kind:      "delete",
+		Schema:    "public",
+		Table:     "users",
+		Before:    map[string]any{"id": json.Number("1"), "name": "foo"},
+	}
+
+	msg, err := newChangeMessage(c, messageFormatRow, "shop")
+	require.NoError(t, err)
+
+	mBytes, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":null,"name":null}`, string(mBytes))
+
+	for k, v := range map[string]string{
+		"table":            "users",
+		"schema":           "public",
+		"event":            "delete",
+		"lsn":              "0/16B3748",
+		"xid":              "580",
+		"commit_timestamp": "2023-11-02T10:15:30.123Z",
+	} {
+		actual, exists := msg.MetaGet(k)
+		assert.True(t, exists, k)
+		assert.Equal(t, v, actual, k)
+	}
+
+	msg, err = newChangeMessage(c, messageFormatDebezium, "shop")
+	require.NoError(t, err)
+
+	structured, err := msg.AsStructured()
+	require.NoError(t, err)
+
+	envelope := structured.(map[string]any)
+	delete(envelope, "ts_ms")
+	assert.Equal(t, map[string]any{
+		"before": map[string]any{"id": json.Number("1"), "name": "foo"},
+		"after":  nil,
+		"op":     "d",
+		"source": map[string]any{
+			"connector": "postgresql",
+			"db":        "shop",
+			"schema":    "public",
+			"table":     "users",
+			"lsn":       json.Number("23803720"),
+			"txId":      json.Number("580"),
+			"ts_ms":     json.Number("1698920130123"),
+			"snapshot":  "false",
+		},
+	}, envelope)
+}
+
+func TestChangeMessageTruncate(t *testing.T) {
+	c := change{
+		Lsn:       pglogrepl.LSN(0x16B3748),
+		Xid:       581,
+		Timestamp: time.UnixMilli(1698920130123),
+		Kind:      "truncate",
+		Schema:    "public",
+		Table:     "users",
+	}
+
+	msg, err := newChangeMessage(c, messageFormatRow, "shop")
+	require.NoError(t, err)
+
+	mBytes, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(mBytes))
+
+	for k, v := range map[string]string{
+		"table":  "users",
+		"schema": "public",
+		"event":  "truncate",
+		"xid":    "581",
+	} {
+		actual, exists := msg.MetaGet(k)
+		assert.True(t, exists, k)
+		assert.Equal(t, v, actual, k)
+	}
+
+	msg, err = newChangeMessage(c, messageFormatDebezium, "shop")
+	require.NoError(t, err)
+
+	structured, err := msg.AsStructured()
+	require.NoError(t, err)
+	assert.Equal(t, "t", structured.(map[string]any)["op"])
+}
+
+func TestChangeMessageTableSchema(t *testing.T) {
+	table := &tableSchema{Schema: "public", Name: "users"}
+	table.setColumns([]columnSchema{
+		{Name: "id", DatabrewType: "Int32", NativeConnectorType: "int4", Pk: true},
+	})
+
+	msg, err := newChangeMessage(change{
+		Kind:        "insert",
+		Schema:      "public",
+		Table:       "users",
+		After:       map[string]any{"id": int64(1)},
+		TableSchema: table,
+	}, messageFormatRow, "shop")
+	require.NoError(t, err)
+
+	v, exists := msg.MetaGet("table_schema")
+	require.True(t, exists)
+	assert.JSONEq(t, `[{"name":"id","databrewType":"Int32","nativeConnectorType":"int4","pk":true,"nullable":false}]`, v)
+}
+
+func TestDebeziumSnapshotOperation(t *testing.T) {
+	assert.Equal(t, "r", debeziumOperation(change{Kind: "insert", Snapshot: true}))
+	assert.Equal(t, "c", debeziumOperation(change{Kind: "insert"}))
+	assert.Equal(t, "u", debeziumOperation(change{Kind: "update"}))
+	assert.Equal(t, "d", debeziumOperation(change{Kind: "delete"}))
+}
+
+func TestSnapshotCompleteMetadata(t *testing.T) {
+	c := change{
+		Kind:     "insert",
+		Schema:   "public",
+		Table:    "users",
+		After:    map[string]any{"id": int64(1)},
+		Snapshot: true,
+		snapshotPos: &snapshotPosition{
+			Table:    "public.users",
+			Progress: snapshotProgress{Rows: 1},
+		},
+	}
+
+	msg, err := newChangeMessage(c, messageFormatRow, "shop")
+	require.NoError(t, err)
+	_, exists := msg.MetaGet("snapshot_table_complete")
+	assert.False(t, exists)
+
+	c.snapshotPos.Progress.Complete = true
+	msg, err = newChangeMessage(c, messageFormatRow, "shop")
+	require.NoError(t, err)
+	v, exists := msg.MetaGet("snapshot_table_complete")
+	assert.True(t, exists)
+	assert.Equal(t, "true", v)
+}
@@ -0,0 +1,201 @@
+package postgres_cdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// pgoutputDecoder decodes messages of the native pgoutput logical replication
+// plugin. Changes are buffered until the commit message of their transaction
+// is received.
+type pgoutputDecoder struct {
+	tables      map[string]*tableSchema
+	publication string
+
+	typeMap   *pgtype.Map
+	relations map[uint32]*pglogrepl.RelationMessage
+	types     map[uint32]string
+
+	tx *transaction
+}
+
+func newPgOutputDecoder(tables []tableSchema, publication string) *pgoutputDecoder {
+	tablesMap := make(map[string]*tableSchema, len(tables))
+	for i := range tables {
+		t := tables[i]
+		tablesMap[t.FullName()] = &t
+	}
+	return &pgoutputDecoder{
+		tables:      tablesMap,
+		publication: publication,
+		typeMap:     pgtype.NewMap(),
+		relations:   map[uint32]*pglogrepl.RelationMessage{},
+		types:       map[uint32]string{},
+	}
+}
+
+func (d *pgoutputDecoder) pluginArgs() []string {
+	return []string{
+		"proto_version '1'",
+		fmt.Sprintf("publication_names %s", quoteLiteral(d.publication)),
+	}
+}
+
+func (d *pgoutputDecoder) decode(lsn pglogrepl.LSN, data []byte) (*transaction, error) {
+	logicalMsg, err := pglogrepl.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pgoutput message: %w", err)
+	}
+
+	switch msg := logicalMsg.(type) {
+	case *pglogrepl.RelationMessage:
+		d.relations[msg.RelationID] = msg
+		d.refreshTable(msg)
+
+	case *pglogrepl.TypeMessage:
+		d.types[msg.DataType] = msg.Name
+
+	case *pglogrepl.BeginMessage:
+		d.tx = &transaction{
+			Xid:       msg.Xid,
+			Timestamp: msg.CommitTime,
+		}
+
+	case *pglogrepl.CommitMessage:
+		tx := d.tx
+		d.tx = nil
+		if tx == nil {
+			return nil, fmt.Errorf("received commit at %s without a prior begin message", msg.CommitLSN)
+		}
+		tx.Lsn = lsn
+		for i := range tx.Changes {
+			tx.Changes[i].Lsn = lsn
+		}
+		return tx, nil
+
+	case *pglogrepl.InsertMessage:
+		return nil, d.addChange(msg.RelationID, "insert", nil, msg.Tuple)
+
+	case *pglogrepl.UpdateMessage:
+		return nil, d.addChange(msg.RelationID, "update", msg.OldTuple, msg.NewTuple)
+
+	case *pglogrepl.DeleteMessage:
+		return nil, d.addChange(msg.RelationID, "delete", msg.OldTuple, nil)
+
+	case *pglogrepl.TruncateMessage:
+		for _, relationID := range msg.RelationIDs {
+			if err := d.addChange(relationID, "truncate", nil, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (d *pgoutputDecoder) addChange(relationID uint32, kind string, before, after *pglogrepl.TupleData) error {
+	if d.tx == nil {
+		return fmt.Errorf("received %s change outside of a transaction", kind)
+	}
+
+	rel, exists := d.relations[relationID]
+	if !exists {
+		return fmt.Errorf("received %s change for unknown relation %d", kind, relationID)
+	}
+
+	table, exists := d.tables[rel.Namespace+"."+rel.RelationName]
+	if !exists {
+		return nil
+	}
+
+	c := change{
+		Xid:         d.tx.Xid,
+		Timestamp:   d.tx.Timestamp,
+		Kind:        kind,
+		Schema:      rel.Namespace,
+		Table:       rel.RelationName,
+		TableSchema: table,
+	}
+	if before != nil {
+		c.Before = table.filterRow(d.decodeTuple(rel, before))
+	}
+	if after != nil {
+		c.After = table.filterRow(d.decodeTuple(rel, after))
+	}
+	d.tx.Changes = append(d.tx.Changes, c)
+	return nil
+}
+
+// refreshTable updates the schema of a streamed table from a relation message,
+// which is sent before the first change of a relation and after every change
+// to its definition. The nullability of columns is not part of the message
+// and is therefore carried over from the known schema.
+func (d *pgoutputDecoder) refreshTable(rel *pglogrepl.RelationMessage) {
+	key := rel.Namespace + "." + rel.RelationName
+	table, exists := d.tables[key]
+	if !exists {
+		return
+	}
+
+	columns := make([]columnSchema, 0, len(rel.Columns))
+	for _, relCol := range rel.Columns {
+		col := columnSchema{
+			Name:                relCol.Name,
+			NativeConnectorType: d.typeName(relCol.DataType),
+			Pk:                  relCol.Flags&1 == 1,
+			Nullable:            true,
+		}
+		col.DatabrewType = arrowType(col.NativeConnectorType)
+		if known, exists := table.column(col.Name); exists {
+			col.Nullable = known.Nullable
+		}
+		columns = append(columns, col)
+	}
+	d.tables[key] = table.withColumns(columns)
+}
+
+// decodeTuple converts tuple data into a row, values are represented the same
+// way as they are by wal2json, where numbers and booleans are native JSON
+// values and all other types are strings. Unchanged TOAST values are omitted.
+func (d *pgoutputDecoder) decodeTuple(rel *pglogrepl.RelationMessage, tuple *pglogrepl.TupleData) map[string]any {
+	row := make(map[string]any, len(tuple.Columns))
+	for i, col := range tuple.Columns {
+		if i >= len(rel.Columns) {
+			break
+		}
+		name := rel.Columns[i].Name
+		switch col.DataType {
+		case pglogrepl.TupleDataTypeNull:
+			row[name] = nil
+		case pglogrepl.TupleDataTypeText:
+			row[name] = textValue(d.typeName(rel.Columns[i].DataType), string(col.Data))
+		case pglogrepl.TupleDataTypeBinary:
+			row[name] = col.Data
+		}
+	}
+	return row
+}
+
+func (d *pgoutputDecoder) typeName(oid uint32) string {
+	if t, exists := d.typeMap.TypeForOID(oid); exists {
+		return t.Name
+	}
+	return d.types[oid]
+}
+
+func textValue(typeName, value string) any {
+	switch typeName {
+	case "int2", "int4", "int8", "oid", "float4", "float8", "numeric":
+		switch strings.ToLower(value) {
+		case "nan", "infinity", "-infinity":
+			return value
+		}
+		return json.Number(value)
+	case "bool":
+		return value == "t"
+	}
+	return value
+}
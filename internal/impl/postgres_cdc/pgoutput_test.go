@@ -0,0 +1,99 @@
+package postgres_cdc
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pgoutputMsgBuilder []byte
+
+func (b pgoutputMsgBuilder) byte(v byte) pgoutputMsgBuilder {
+	return append(b, v)
+}
+
+func (b pgoutputMsgBuilder) str(v string) pgoutputMsgBuilder {
+	return append(append(b, v...), 0)
+}
+
+func (b pgoutputMsgBuilder) u16(v uint16) pgoutputMsgBuilder {
+	return binary.BigEndian.AppendUint16(b, v)
+}
+
+func (b pgoutputMsgBuilder) u32(v uint32) pgoutputMsgBuilder {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func (b pgoutputMsgBuilder) u64(v uint64) pgoutputMsgBuilder {
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+func (b pgoutputMsgBuilder) text(v string) pgoutputMsgBuilder {
+	return append(b.byte('t').u32(uint32(len(v))), v...)
+}
+
+func TestPgOutputDecode(t *testing.T) {
+	decoder := newPgOutputDecoder([]tableSchema{{Schema: "public", Name: "users"}}, "pub")
+
+	relation := pgoutputMsgBuilder{}.byte('R').u32(16384).str("public").str("users").byte('d').u16(3).
+		byte(1).str("id").u32(23).u32(0xFFFFFFFF).
+		byte(0).str("name").u32(25).u32(0xFFFFFFFF).
+		byte(0).str("active").u32(16).u32(0xFFFFFFFF)
+	ignored := pgoutputMsgBuilder{}.byte('R').u32(16385).str("public").str("ignored").byte('d').u16(1).
+		byte(1).str("id").u32(23).u32(0xFFFFFFFF)
+	begin := pgoutputMsgBuilder{}.byte('B').u64(200).u64(0).u32(580)
+	insert := pgoutputMsgBuilder{}.byte('I').u32(16384).byte('N').u16(3).text("1").text("foo").text("t")
+	update := pgoutputMsgBuilder{}.byte('U').u32(16384).byte('N').u16(3).text("1").text("bar").byte('n')
+	del := pgoutputMsgBuilder{}.byte('D').u32(16385).byte('K').u16(1).text("1")
+	truncate := pgoutputMsgBuilder{}.byte('T').u32(1).byte(0).u32(16384)
+	commit := pgoutputMsgBuilder{}.byte('C').byte(0).u64(200).u64(210).u64(0)
+
+	for _, msg := range [][]byte{relation, ignored, begin, insert, update, del, truncate} {
+		tx, err := decoder.decode(pglogrepl.LSN(150), msg)
+		require.NoError(t, err)
+		assert.Nil(t, tx)
+	}
+
+	tx, err := decoder.decode(pglogrepl.LSN(210), commit)
+	require.NoError(t, err)
+	require.NotNil(t, tx)
+
+	assert.Equal(t, uint32(580), tx.Xid)
+	assert.Equal(t, pglogrepl.LSN(210), tx.Lsn)
+	require.Len(t, tx.Changes, 3)
+
+	assert.Equal(t, "insert", tx.Changes[0].Kind)
+	assert.Equal(t, pglogrepl.LSN(210), tx.Changes[0].Lsn)
+	assert.Equal(t, map[string]any{"id": int64(1), "name": "foo", "active": true}, tx.Changes[0].After)
+
+	assert.Equal(t, "update", tx.Changes[1].Kind)
+	assert.Nil(t, tx.Changes[1].Before)
+	assert.Equal(t, map[string]any{"id": int64(1), "name": "bar", "active": nil}, tx.Changes[1].After)
+
+	assert.Equal(t, "truncate", tx.Changes[2].Kind)
+	assert.Equal(t, "users", tx.Changes[2].Table)
+
+	assert.Equal(t, []columnSchema{
+		{Name: "id", DatabrewType: "Int32", NativeConnectorType: "int4", Pk: true, Nullable: true},
+		{Name: "name", DatabrewType: "String", NativeConnectorType: "text", Nullable: true},
+		{Name: "active", DatabrewType: "Boolean", NativeConnectorType: "bool", Nullable: true},
+	}, tx.Changes[0].TableSchema.Columns)
+}
+
+func TestPgOutputChangeOutsideTransaction(t *testing.T) {
+	decoder := newPgOutputDecoder([]tableSchema{{Schema: "public", Name: "users"}}, "pub")
+
+	_, err := decoder.decode(pglogrepl.LSN(150), pgoutputMsgBuilder{}.byte('I').u32(16384).byte('N').u16(1).text("1"))
+	require.Error(t, err)
+}
+
+func TestPgOutputPluginArgs(t *testing.T) {
+	decoder := newPgOutputDecoder(nil, "pglog_stream_rs_foo")
+	assert.Equal(t, []string{
+		"proto_version '1'",
+		"publication_names 'pglog_stream_rs_foo'",
+	}, decoder.pluginArgs())
+}
@@ -1,49 +1,386 @@
 package postgres_cdc
 
 import (
-	"github.com/apache/arrow/go/arrow"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/usedatabrew/benthos/v4/public/bloblang"
 	"github.com/usedatabrew/benthos/v4/public/service"
-	"github.com/usedatabrew/pglogicalstream"
 )
 
-type DataSchema struct {
-	TableName string
-	Schema    *arrow.Schema
+type columnSchema struct {
+	Name                string `json:"name"`
+	DatabrewType        string `json:"databrewType"`
+	NativeConnectorType string `json:"nativeConnectorType"`
+	Pk                  bool   `json:"pk"`
+	Nullable            bool   `json:"nullable"`
 }
 
-func buildDataSchemas(config []*service.ParsedConfig) (schemas []pglogicalstream.DbTablesSchema) {
-	for _, tableConfig := range config {
-		name, err := tableConfig.FieldString("table")
-		if err != nil {
-			panic("Can't build schema")
+// tableSchema describes a table being streamed, when no columns are specified
+// all columns of the table are emitted.
+type tableSchema struct {
+	Schema  string
+	Name    string
+	Columns []columnSchema
+
+	// Pinned is set for tables with columns configured explicitly via
+	// plugin_schema, which are neither discovered nor refreshed.
+	Pinned bool
+
+	includeColumns map[string]struct{}
+	excludeColumns map[string]struct{}
+	rowChecks      []*bloblang.Executor
+
+	columnsJSON string
+}
+
+// FullName returns the schema qualified name of the table.
+func (t tableSchema) FullName() string {
+	return t.Schema + "." + t.Name
+}
+
+// ColumnsJSON returns the columns of the table serialized as a JSON array, or
+// an empty string when the columns are unknown.
+func (t *tableSchema) ColumnsJSON() string {
+	if t == nil {
+		return ""
+	}
+	return t.columnsJSON
+}
+
+func (t *tableSchema) setColumns(columns []columnSchema) {
+	t.Columns = t.allowedColumns(columns)
+	t.columnsJSON = ""
+	if len(t.Columns) > 0 {
+		b, _ := json.Marshal(t.Columns)
+		t.columnsJSON = string(b)
+	}
+}
+
+// allowedColumns returns the columns that pass the column filters.
+func (t *tableSchema) allowedColumns(columns []columnSchema) []columnSchema {
+	if t.includeColumns == nil && t.excludeColumns == nil {
+		return columns
+	}
+	allowed := make([]columnSchema, 0, len(columns))
+	for _, col := range columns {
+		if t.columnAllowed(col.Name) {
+			allowed = append(allowed, col)
+		}
+	}
+	return allowed
+}
+
+// withColumns returns a copy of the table with the given columns, or the table
+// itself when the columns are unchanged or the table is pinned. Tables are
+// never modified in place as changes referencing them may still be in flight.
+func (t *tableSchema) withColumns(columns []columnSchema) *tableSchema {
+	if t.Pinned {
+		return t
+	}
+	if columns = t.allowedColumns(columns); columnsEqual(t.Columns, columns) {
+		return t
+	}
+	refreshed := &tableSchema{
+		Schema:         t.Schema,
+		Name:           t.Name,
+		includeColumns: t.includeColumns,
+		excludeColumns: t.excludeColumns,
+		rowChecks:      t.rowChecks,
+	}
+	refreshed.setColumns(columns)
+	return refreshed
+}
+
+// column returns the column of the given name.
+func (t *tableSchema) column(name string) (columnSchema, bool) {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return columnSchema{}, false
+}
+
+func columnsEqual(a, b []columnSchema) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (t tableSchema) identifier() string {
+	return pgx.Identifier{t.Schema, t.Name}.Sanitize()
+}
+
+func (t tableSchema) selectColumns() string {
+	if len(t.Columns) == 0 {
+		return "*"
+	}
+	names := make([]string, 0, len(t.Columns))
+	for _, col := range t.Columns {
+		names = append(names, pgx.Identifier{col.Name}.Sanitize())
+	}
+	return strings.Join(names, ", ")
+}
+
+// filterRow removes any values of a row that do not belong to a column of the
+// schema and coerces the remaining values into their configured types.
+func (t tableSchema) filterRow(row map[string]any) map[string]any {
+	if row == nil {
+		return row
+	}
+	if len(t.Columns) == 0 {
+		if t.includeColumns == nil && t.excludeColumns == nil {
+			return row
+		}
+		filtered := make(map[string]any, len(row))
+		for k, v := range row {
+			if t.columnAllowed(k) {
+				filtered[k] = v
+			}
+		}
+		return filtered
+	}
+	filtered := make(map[string]any, len(t.Columns))
+	for _, col := range t.Columns {
+		v, exists := row[col.Name]
+		if !exists {
+			continue
+		}
+		filtered[col.Name] = coerceValue(col.DatabrewType, v)
+	}
+	return filtered
+}
+
+// coerceValue attempts to convert a value decoded from JSON into the type
+// described by a databrew type name, values that cannot be converted are
+// returned as is.
+func coerceValue(databrewType string, v any) any {
+	if v == nil {
+		return nil
+	}
+	switch databrewType {
+	case "Boolean":
+		switch t := v.(type) {
+		case bool:
+			return t
+		case string:
+			if b, err := strconv.ParseBool(t); err == nil {
+				return b
+			}
+			switch t {
+			case "t":
+				return true
+			case "f":
+				return false
+			}
 		}
+	case "Int16", "Int32", "Int64", "Uint64":
+		switch t := v.(type) {
+		case json.Number:
+			if i, err := t.Int64(); err == nil {
+				return i
+			}
+		case string:
+			if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+				return i
+			}
+		}
+	case "Float32", "Float64":
+		switch t := v.(type) {
+		case json.Number:
+			if f, err := t.Float64(); err == nil {
+				return f
+			}
+		case string:
+			if f, err := strconv.ParseFloat(t, 64); err == nil {
+				return f
+			}
+		}
+	case "", "Date32", "Decimal128", "Binary", "bytea":
+	default:
+		switch t := v.(type) {
+		case string:
+			return t
+		case json.Number:
+			return t.String()
+		case bool:
+			return strconv.FormatBool(t)
+		default:
+			if b, err := json.Marshal(t); err == nil {
+				return string(b)
+			}
+		}
+	}
+	return v
+}
+
+func buildDataSchemas(config []*service.ParsedConfig, defaultSchema string) (schemas []tableSchema, err error) {
+	for i, tableConfig := range config {
+		var name string
+		if name, err = tableConfig.FieldString("table"); err != nil {
+			return nil, fmt.Errorf("plugin_schema %d: %w", i, err)
+		}
+
+		dbTableSchema := tableSchema{Pinned: true}
+		dbTableSchema.Schema, dbTableSchema.Name = splitTableName(name, defaultSchema)
 
-		var dbTableSchema pglogicalstream.DbTablesSchema
-		dbTableSchema.Table = name
 		var columnsConfig []*service.ParsedConfig
 		if columnsConfig, err = tableConfig.FieldObjectList("columns"); err != nil {
-			panic("Can't build schema")
+			return nil, fmt.Errorf("plugin_schema %d: %w", i, err)
 		}
 
-		for _, columnConfig := range columnsConfig {
-			columnType, _ := columnConfig.FieldString("databrewType")
-			nativeColumnType, _ := columnConfig.FieldString("nativeConnectorType")
-			columnName, _ := columnConfig.FieldString("name")
-			columnIsIdentity, _ := columnConfig.FieldBool("nullable")
-			columnNullable, _ := columnConfig.FieldBool("pk")
-
-			column := pglogicalstream.DbSchemaColumn{
-				Name:                columnName,
-				DatabrewType:        columnType,
-				NativeConnectorType: nativeColumnType,
-				Pk:                  columnIsIdentity,
-				Nullable:            columnNullable,
+		var columns []columnSchema
+		for j, columnConfig := range columnsConfig {
+			var col columnSchema
+			if col.Name, err = columnConfig.FieldString("name"); err != nil {
+				return nil, fmt.Errorf("plugin_schema %d column %d: %w", i, j, err)
+			}
+			if col.NativeConnectorType, err = columnConfig.FieldString("nativeConnectorType"); err != nil {
+				return nil, fmt.Errorf("plugin_schema %d column %d: %w", i, j, err)
+			}
+			if col.DatabrewType, err = columnConfig.FieldString("databrewType"); err != nil {
+				return nil, fmt.Errorf("plugin_schema %d column %d: %w", i, j, err)
 			}
-			dbTableSchema.Columns = append(dbTableSchema.Columns, column)
+			if col.DatabrewType == "" {
+				col.DatabrewType = arrowType(col.NativeConnectorType)
+			}
+			if col.Pk, err = columnConfig.FieldBool("pk"); err != nil {
+				return nil, fmt.Errorf("plugin_schema %d column %d: %w", i, j, err)
+			}
+			if col.Nullable, err = columnConfig.FieldBool("nullable"); err != nil {
+				return nil, fmt.Errorf("plugin_schema %d column %d: %w", i, j, err)
+			}
+			columns = append(columns, col)
 		}
+		dbTableSchema.setColumns(columns)
 
 		schemas = append(schemas, dbTableSchema)
 	}
-
 	return
 }
+
+const discoverColumnsQuery = `SELECT c.column_name, c.udt_name, c.is_nullable = 'YES', COALESCE(pk.is_pk, false)
+FROM information_schema.columns c
+LEFT JOIN (
+	SELECT a.attname, true AS is_pk
+	FROM pg_index i
+	JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+	WHERE i.indrelid = $3::regclass AND i.indisprimary
+) pk ON pk.attname = c.column_name
+WHERE c.table_schema = $1 AND c.table_name = $2
+ORDER BY c.ordinal_position`
+
+// discoverSchemas resolves the columns of all tables that are not pinned from
+// information_schema and pg_catalog.
+func discoverSchemas(ctx context.Context, conn *pgx.Conn, tables []tableSchema) ([]tableSchema, error) {
+	discovered := make([]tableSchema, 0, len(tables))
+	for _, t := range tables {
+		if t.Pinned {
+			discovered = append(discovered, t)
+			continue
+		}
+
+		rows, err := conn.Query(ctx, discoverColumnsQuery, t.Schema, t.Name, t.identifier())
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover schema of table %s: %w", t.FullName(), err)
+		}
+
+		var columns []columnSchema
+		for rows.Next() {
+			var col columnSchema
+			if err = rows.Scan(&col.Name, &col.NativeConnectorType, &col.Nullable, &col.Pk); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to discover schema of table %s: %w", t.FullName(), err)
+			}
+			col.DatabrewType = arrowType(col.NativeConnectorType)
+			columns = append(columns, col)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to discover schema of table %s: %w", t.FullName(), err)
+		}
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("table %s does not exist or has no columns", t.FullName())
+		}
+
+		t.setColumns(columns)
+		discovered = append(discovered, t)
+	}
+	return discovered, nil
+}
+
+// arrowType returns the name of the Apache Arrow type used to represent values
+// of a PostgreSQL type, which may be given either as an internal name such as
+// int4 or as an SQL name such as character varying(255).
+func arrowType(nativeType string) string {
+	nativeType = strings.ToLower(strings.TrimSpace(nativeType))
+	if strings.HasSuffix(nativeType, "[]") || strings.HasPrefix(nativeType, "_") {
+		return "String"
+	}
+	if i, j := strings.Index(nativeType, "("), strings.Index(nativeType, ")"); i >= 0 && j > i {
+		nativeType = strings.TrimSpace(nativeType[:i] + nativeType[j+1:])
+	}
+	switch nativeType {
+	case "bool", "boolean":
+		return "Boolean"
+	case "int2", "smallint", "smallserial":
+		return "Int16"
+	case "int4", "int", "integer", "serial":
+		return "Int32"
+	case "int8", "bigint", "bigserial", "oid":
+		return "Int64"
+	case "float4", "real":
+		return "Float32"
+	case "float8", "double precision":
+		return "Float64"
+	case "numeric", "decimal":
+		return "Decimal128"
+	case "date":
+		return "Date32"
+	case "timestamp", "timestamptz", "timestamp without time zone", "timestamp with time zone":
+		return "Timestamp"
+	case "time", "timetz", "time without time zone", "time with time zone":
+		return "Time64"
+	case "bytea":
+		return "Binary"
+	}
+	return "String"
+}
+
+// mergeTables adds tables that are listed without a plugin schema, such
+// tables are streamed with all of their columns.
+func mergeTables(schemas []tableSchema, tables []string, defaultSchema string) []tableSchema {
+	known := map[string]struct{}{}
+	for _, s := range schemas {
+		known[s.FullName()] = struct{}{}
+	}
+	for _, table := range tables {
+		var t tableSchema
+		t.Schema, t.Name = splitTableName(table, defaultSchema)
+		if _, exists := known[t.FullName()]; exists {
+			continue
+		}
+		known[t.FullName()] = struct{}{}
+		schemas = append(schemas, t)
+	}
+	return schemas
+}
+
+func splitTableName(name, defaultSchema string) (schema, table string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return defaultSchema, name
+}
@@ -0,0 +1,44 @@
+package postgres_cdc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArrowType(t *testing.T) {
+	for native, expected := range map[string]string{
+		"int4":                        "Int32",
+		"integer":                     "Int32",
+		"bigint":                      "Int64",
+		"bool":                        "Boolean",
+		"numeric(10,2)":               "Decimal128",
+		"character varying(255)":      "String",
+		"timestamp(3) with time zone": "Timestamp",
+		"date":                        "Date32",
+		"bytea":                       "Binary",
+		"_int4":                       "String",
+		"integer[]":                   "String",
+		"jsonb":                       "String",
+	} {
+		assert.Equal(t, expected, arrowType(native), native)
+	}
+}
+
+func TestTableSchemaWithColumns(t *testing.T) {
+	columns := []columnSchema{{Name: "id", DatabrewType: "Int32", NativeConnectorType: "int4"}}
+
+	table := &tableSchema{Schema: "public", Name: "users"}
+	table.setColumns(columns)
+	assert.Same(t, table, table.withColumns(columns))
+
+	refreshed := table.withColumns(append(columns, columnSchema{Name: "name", DatabrewType: "String", NativeConnectorType: "text"}))
+	assert.NotSame(t, table, refreshed)
+	assert.Len(t, table.Columns, 1)
+	assert.Len(t, refreshed.Columns, 2)
+	assert.Contains(t, refreshed.ColumnsJSON(), `"name":"name"`)
+
+	pinned := &tableSchema{Schema: "public", Name: "users", Pinned: true}
+	pinned.setColumns(columns)
+	assert.Same(t, pinned, pinned.withColumns(nil))
+}
@@ -0,0 +1,109 @@
+package postgres_cdc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+// slotOptions determine the lifecycle of the replication slot.
+type slotOptions struct {
+	createIfMissing bool
+	temporary       bool
+	dropOnClose     bool
+}
+
+// slotMetrics are gauges describing how far the replication slot is behind
+// the server, which are refreshed at an interval.
+type slotMetrics struct {
+	interval     time.Duration
+	lagBytes     *service.MetricGauge
+	confirmedLSN *service.MetricGauge
+	walRetained  *service.MetricGauge
+}
+
+func newSlotMetrics(m *service.Metrics, interval time.Duration) *slotMetrics {
+	return &slotMetrics{
+		interval:     interval,
+		lagBytes:     m.NewGauge("pg_stream_replication_lag_bytes", "slot"),
+		confirmedLSN: m.NewGauge("pg_stream_confirmed_flush_lsn", "slot"),
+		walRetained:  m.NewGauge("pg_stream_wal_retained_bytes", "slot"),
+	}
+}
+
+const slotMetricsQuery = `SELECT confirmed_flush_lsn::text,
+	COALESCE((pg_current_wal_lsn() - confirmed_flush_lsn)::bigint, 0),
+	COALESCE((pg_current_wal_lsn() - restart_lsn)::bigint, 0)
+FROM pg_replication_slots WHERE slot_name = $1`
+
+// pollSlotMetrics refreshes the slot metrics at their interval until the
+// context is cancelled.
+func (s *replicationStream) pollSlotMetrics(ctx context.Context) {
+	m := s.conf.slotMetrics
+	if m == nil || m.interval <= 0 {
+		return
+	}
+
+	var conn *pgx.Conn
+	defer func() {
+		if conn != nil {
+			_ = conn.Close(context.Background())
+		}
+	}()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if conn == nil || conn.IsClosed() {
+			var err error
+			if conn, err = pgx.ConnectConfig(ctx, s.conf.connConfig); err != nil {
+				s.log.Warnf("Failed to connect for replication slot metrics: %v", err)
+				conn = nil
+				continue
+			}
+		}
+
+		var confirmedLSNStr *string
+		var lagBytes, walRetained int64
+		if err := conn.QueryRow(ctx, slotMetricsQuery, s.conf.slotName).Scan(&confirmedLSNStr, &lagBytes, &walRetained); err != nil {
+			if ctx.Err() == nil {
+				s.log.Warnf("Failed to query replication slot metrics: %v", err)
+			}
+			continue
+		}
+
+		m.lagBytes.Set(lagBytes, s.conf.slotName)
+		m.walRetained.Set(walRetained, s.conf.slotName)
+		if confirmedLSNStr != nil {
+			if lsn, err := pglogrepl.ParseLSN(*confirmedLSNStr); err == nil {
+				m.confirmedLSN.Set(int64(lsn), s.conf.slotName)
+			}
+		}
+	}
+}
+
+// dropSlot drops a replication slot, which must not be active.
+func dropSlot(ctx context.Context, connConfig *pgx.ConnConfig, slotName string) error {
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err = conn.Exec(ctx, "SELECT pg_drop_replication_slot($1)", slotName); err != nil {
+		return fmt.Errorf("failed to drop replication slot %s: %w", slotName, classifyErr(slotName, err))
+	}
+	return nil
+}
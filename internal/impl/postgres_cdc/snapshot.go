@@ -0,0 +1,136 @@
+package postgres_cdc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// snapshotProgress is the progress of the snapshot of a single table.
+type snapshotProgress struct {
+	// The primary key values, as text, of the last row read. Empty for tables
+	// without a primary key, which are paginated by ctid instead.
+	LastKey []string `json:"last_key,omitempty"`
+
+	// The ctid of the last row read from a table without a primary key.
+	LastCtid string `json:"last_ctid,omitempty"`
+
+	// The number of rows read.
+	Rows int64 `json:"rows"`
+
+	// Whether all rows of the table have been read.
+	Complete bool `json:"complete"`
+}
+
+// snapshotPosition identifies a snapshot row, it is carried by snapshot
+// changes so that progress can be committed once they are acknowledged.
+type snapshotPosition struct {
+	Table    string
+	Progress snapshotProgress
+
+	// An estimate of the total number of rows of the table.
+	EstimatedRows int64
+
+	// Tables of the snapshot that were completed prior to this position. As
+	// acknowledgements are committed in order only the highest position is
+	// committed, which may belong to a table that follows a completed one.
+	Completed []string
+}
+
+// tableSnapshot is a table to be snapshotted and the progress to resume from.
+type tableSnapshot struct {
+	table    *tableSchema
+	progress snapshotProgress
+}
+
+// planSnapshot returns the tables that need to be snapshotted. All tables are
+// snapshotted when the replication slot has just been created. Otherwise
+// tables are only snapshotted when there is stored progress that shows they
+// are incomplete, or that they were added after the snapshot began.
+func planSnapshot(tables []tableSchema, freshSlot bool, stored map[string]snapshotProgress) []tableSnapshot {
+	if !freshSlot && stored == nil {
+		return nil
+	}
+
+	var plan []tableSnapshot
+	for i := range tables {
+		t := &tables[i]
+		var progress snapshotProgress
+		if !freshSlot {
+			if progress = stored[t.FullName()]; progress.Complete {
+				continue
+			}
+		}
+		plan = append(plan, tableSnapshot{table: t, progress: progress})
+	}
+	return plan
+}
+
+// primaryKey returns the primary key columns of the table.
+func (t *tableSchema) primaryKey() []string {
+	var keys []string
+	for _, col := range t.Columns {
+		if col.Pk {
+			keys = append(keys, col.Name)
+		}
+	}
+	return keys
+}
+
+// snapshotQuery returns a query for the next chunk of rows of a table
+// snapshot, along with its arguments. Tables with a primary key are paginated
+// by key, where each row is followed by the text representation of its key
+// values. Other tables are paginated by ctid, where each row is followed by
+// its ctid, as rows are not returned in a stable order otherwise.
+func snapshotQuery(t *tableSchema, progress snapshotProgress, limit int) (string, []any) {
+	keys := t.primaryKey()
+	if len(keys) == 0 {
+		columns := "s.*"
+		if len(t.Columns) > 0 {
+			names := make([]string, 0, len(t.Columns))
+			for _, col := range t.Columns {
+				names = append(names, "s."+pgx.Identifier{col.Name}.Sanitize())
+			}
+			columns = strings.Join(names, ", ")
+		}
+
+		var where string
+		var args []any
+		if progress.LastCtid != "" {
+			where = " WHERE s.ctid > $1::tid"
+			args = append(args, progress.LastCtid)
+		}
+		return fmt.Sprintf(
+			"SELECT row_to_json(t)::text, s.ctid::text FROM %s s CROSS JOIN LATERAL (SELECT %s) t%s ORDER BY s.ctid LIMIT %d",
+			t.identifier(), columns, where, limit,
+		), args
+	}
+
+	quotedKeys := make([]string, 0, len(keys))
+	outerKeys := make([]string, 0, len(keys))
+	keyValues := make([]string, 0, len(keys))
+	for _, k := range keys {
+		quoted := pgx.Identifier{k}.Sanitize()
+		quotedKeys = append(quotedKeys, quoted)
+		outerKeys = append(outerKeys, "t."+quoted)
+		keyValues = append(keyValues, "t."+quoted+"::text")
+	}
+	keyList := strings.Join(quotedKeys, ", ")
+
+	var where string
+	var args []any
+	if len(progress.LastKey) == len(keys) {
+		placeholders := make([]string, 0, len(keys))
+		for i, v := range progress.LastKey {
+			placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+			args = append(args, v)
+		}
+		where = fmt.Sprintf(" WHERE (%s) > (%s)", keyList, strings.Join(placeholders, ", "))
+	}
+
+	return fmt.Sprintf(
+		"SELECT row_to_json(t)::text, %s FROM (SELECT %s FROM %s%s ORDER BY %s LIMIT %d) t ORDER BY %s",
+		strings.Join(keyValues, ", "), t.selectColumns(), t.identifier(), where, keyList, limit, strings.Join(outerKeys, ", "),
+	), args
+}
@@ -0,0 +1,59 @@
+package postgres_cdc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanSnapshot(t *testing.T) {
+	tables := []tableSchema{
+		{Schema: "public", Name: "users"},
+		{Schema: "public", Name: "orders"},
+		{Schema: "public", Name: "items"},
+	}
+
+	plan := planSnapshot(tables, true, map[string]snapshotProgress{
+		"public.users": {Complete: true},
+	})
+	assert.Len(t, plan, 3)
+
+	assert.Empty(t, planSnapshot(tables, false, nil))
+
+	plan = planSnapshot(tables, false, map[string]snapshotProgress{
+		"public.users":  {Complete: true, Rows: 10},
+		"public.orders": {Rows: 5, LastKey: []string{"5"}},
+	})
+	if assert.Len(t, plan, 2) {
+		assert.Equal(t, "public.orders", plan[0].table.FullName())
+		assert.Equal(t, snapshotProgress{Rows: 5, LastKey: []string{"5"}}, plan[0].progress)
+		assert.Equal(t, "public.items", plan[1].table.FullName())
+		assert.Equal(t, snapshotProgress{}, plan[1].progress)
+	}
+}
+
+func TestSnapshotQuery(t *testing.T) {
+	table := &tableSchema{Schema: "public", Name: "users", Columns: []columnSchema{
+		{Name: "tenant", Pk: true},
+		{Name: "id", Pk: true},
+		{Name: "name"},
+	}}
+
+	query, args := snapshotQuery(table, snapshotProgress{}, 100)
+	assert.Equal(t, `SELECT row_to_json(t)::text, t."tenant"::text, t."id"::text FROM (SELECT "tenant", "id", "name" FROM "public"."users" ORDER BY "tenant", "id" LIMIT 100) t ORDER BY t."tenant", t."id"`, query)
+	assert.Empty(t, args)
+
+	query, args = snapshotQuery(table, snapshotProgress{Rows: 100, LastKey: []string{"a", "5"}}, 100)
+	assert.Equal(t, `SELECT row_to_json(t)::text, t."tenant"::text, t."id"::text FROM (SELECT "tenant", "id", "name" FROM "public"."users" WHERE ("tenant", "id") > ($1, $2) ORDER BY "tenant", "id" LIMIT 100) t ORDER BY t."tenant", t."id"`, query)
+	assert.Equal(t, []any{"a", "5"}, args)
+
+	noKey := &tableSchema{Schema: "public", Name: "logs"}
+	query, args = snapshotQuery(noKey, snapshotProgress{}, 100)
+	assert.Equal(t, `SELECT row_to_json(t)::text, s.ctid::text FROM "public"."logs" s CROSS JOIN LATERAL (SELECT s.*) t ORDER BY s.ctid LIMIT 100`, query)
+	assert.Empty(t, args)
+
+	noKey.Columns = []columnSchema{{Name: "level"}, {Name: "msg"}}
+	query, args = snapshotQuery(noKey, snapshotProgress{Rows: 200, LastCtid: "(4,12)"}, 100)
+	assert.Equal(t, `SELECT row_to_json(t)::text, s.ctid::text FROM "public"."logs" s CROSS JOIN LATERAL (SELECT s."level", s."msg") t WHERE s.ctid > $1::tid ORDER BY s.ctid LIMIT 100`, query)
+	assert.Equal(t, []any{"(4,12)"}, args)
+}
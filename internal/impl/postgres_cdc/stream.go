@@ -0,0 +1,662 @@
+package postgres_cdc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+
+	"github.com/usedatabrew/benthos/v4/internal/shutdown"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	standbyMessageTimeout    = time.Second * statusHeartbeatIntervalSeconds
+	defaultSnapshotBatchSize = 10_000
+)
+
+// change is a single row level change either decoded from the WAL or read
+// from the initial snapshot of a table.
+type change struct {
+	Lsn       pglogrepl.LSN
+	Xid       uint32
+	Timestamp time.Time
+	Kind      string
+	Schema    string
+	Table     string
+	Before    map[string]any
+	After     map[string]any
+	Snapshot  bool
+
+	// The schema of the table at the time of the change.
+	TableSchema *tableSchema
+
+	// The position of a snapshot change within the snapshot of its table.
+	snapshotPos *snapshotPosition
+
+	// Set for snapshot changes that only carry the progress of the snapshot,
+	// which is committed without emitting a message.
+	progressOnly bool
+
+	// The LSN that can be committed once this change and all prior changes
+	// have been acknowledged. This is only the LSN of the change for the last
+	// change of a transaction, otherwise it's the LSN of the prior
+	// transaction.
+	ackLSN pglogrepl.LSN
+}
+
+// transaction is the group of changes committed by a single source
+// transaction.
+type transaction struct {
+	Xid       uint32
+	Lsn       pglogrepl.LSN
+	Timestamp time.Time
+	Changes   []change
+}
+
+// changeDecoder decodes the output of a logical decoding plugin.
+type changeDecoder interface {
+	// pluginArgs returns the options passed to the plugin when starting
+	// replication.
+	pluginArgs() []string
+
+	// decode a message received at the given LSN, returns a transaction once
+	// all of its changes have been received and nil otherwise.
+	decode(lsn pglogrepl.LSN, data []byte) (*transaction, error)
+}
+
+type replicationStreamConfig struct {
+	// Replication connection config, must be parsed with replication=database.
+	replConfig *pgconn.Config
+	// Regular connection config used for taking the snapshot.
+	connConfig *pgx.ConnConfig
+
+	slotName          string
+	plugin            string
+	publication       string
+	tables            []tableSchema
+	streamSnapshot    bool
+	snapshotProgress  map[string]snapshotProgress
+	snapshotBatchSize int
+	slot              slotOptions
+	slotMetrics       *slotMetrics
+}
+
+// replicationStream consumes a logical replication slot and emits decoded
+// changes through a channel. Changes are only committed to the slot once they
+// have been acknowledged with AckLSN.
+type replicationStream struct {
+	conf    replicationStreamConfig
+	conn    *pgconn.PgConn
+	decoder changeDecoder
+	log     *service.Logger
+
+	snapshotName string
+	snapshotPlan []tableSnapshot
+	startLSN     pglogrepl.LSN
+	lastLSN      pglogrepl.LSN
+	committedLSN atomic.Uint64
+
+	messages         chan transaction
+	snapshotMessages chan change
+
+	errMut sync.Mutex
+	err    error
+
+	shutSig *shutdown.Signaller
+}
+
+// newReplicationStream connects to the database, creates the replication slot
+// if it does not yet exist and begins streaming changes in the background.
+func newReplicationStream(ctx context.Context, conf replicationStreamConfig, log *service.Logger) (*replicationStream, error) {
+	conn, err := pgconn.ConnectConfig(ctx, conf.replConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replication connection: %w", err)
+	}
+
+	s := &replicationStream{
+		conf:             conf,
+		conn:             conn,
+		log:              log,
+		messages:         make(chan transaction),
+		snapshotMessages: make(chan change, 100),
+		shutSig:          shutdown.NewSignaller(),
+	}
+
+	switch conf.plugin {
+	case pluginPgOutput:
+		s.decoder = newPgOutputDecoder(conf.tables, conf.publication)
+		err = s.ensurePublication(ctx)
+	default:
+		s.decoder = newWal2JSONDecoder(conf.tables)
+	}
+	if err != nil {
+		_ = conn.Close(context.Background())
+		return nil, err
+	}
+
+	freshSlot, err := s.ensureSlot(ctx)
+	if err != nil {
+		_ = conn.Close(context.Background())
+		return nil, err
+	}
+	s.lastLSN = s.startLSN
+	s.committedLSN.Store(uint64(s.startLSN))
+
+	if conf.streamSnapshot {
+		s.snapshotPlan = planSnapshot(conf.tables, freshSlot, conf.snapshotProgress)
+	}
+
+	go s.loop()
+	return s, nil
+}
+
+// ensureSlot obtains the position of the replication slot, creating it if it
+// does not yet exist. Returns true if the slot was freshly created.
+func (s *replicationStream) ensureSlot(ctx context.Context) (bool, error) {
+	results, err := s.conn.Exec(ctx, fmt.Sprintf(
+		"SELECT confirmed_flush_lsn, plugin, active, active_pid FROM pg_replication_slots WHERE slot_name = %s", quoteLiteral(s.conf.slotName),
+	)).ReadAll()
+	if err != nil {
+		return false, fmt.Errorf("failed to query replication slot: %w", err)
+	}
+
+	if len(results) > 0 && len(results[0].Rows) > 0 {
+		row := results[0].Rows[0]
+		if plugin := string(row[1]); plugin != s.conf.plugin {
+			return false, fmt.Errorf("replication slot %s uses plugin %s but %s is configured", s.conf.slotName, plugin, s.conf.plugin)
+		}
+		if string(row[2]) == "t" {
+			return false, fmt.Errorf("%w: %s is active on backend process %s", ErrSlotInUse, s.conf.slotName, row[3])
+		}
+		if s.startLSN, err = pglogrepl.ParseLSN(string(results[0].Rows[0][0])); err != nil {
+			return false, fmt.Errorf("failed to parse replication slot position: %w", err)
+		}
+		s.log.Infof("Resuming replication slot %s from %s", s.conf.slotName, s.startLSN)
+		return false, nil
+	}
+
+	if !s.conf.slot.createIfMissing {
+		return false, fmt.Errorf("replication slot %s does not exist", s.conf.slotName)
+	}
+
+	snapshotAction := "NOEXPORT_SNAPSHOT"
+	if s.conf.streamSnapshot {
+		snapshotAction = "EXPORT_SNAPSHOT"
+	}
+	res, err := pglogrepl.CreateReplicationSlot(ctx, s.conn, s.conf.slotName, s.conf.plugin, pglogrepl.CreateReplicationSlotOptions{
+		Temporary:      s.conf.slot.temporary,
+		SnapshotAction: snapshotAction,
+		Mode:           pglogrepl.LogicalReplication,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create replication slot: %w", classifyErr(s.conf.slotName, err))
+	}
+	if s.startLSN, err = pglogrepl.ParseLSN(res.ConsistentPoint); err != nil {
+		return false, fmt.Errorf("failed to parse replication slot consistent point: %w", err)
+	}
+	s.snapshotName = res.SnapshotName
+	s.log.Infof("Created replication slot %s at %s", s.conf.slotName, s.startLSN)
+	return true, nil
+}
+
+// ensurePublication creates the publication used by pgoutput if it does not
+// exist yet, or updates its tables to match the configured tables if it does.
+// Publications created for all tables are left untouched.
+func (s *replicationStream) ensurePublication(ctx context.Context) error {
+	results, err := s.conn.Exec(ctx, fmt.Sprintf(
+		"SELECT puballtables FROM pg_publication WHERE pubname = %s", quoteLiteral(s.conf.publication),
+	)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to query publication: %w", err)
+	}
+
+	tablesClause := "FOR ALL TABLES"
+	if len(s.conf.tables) > 0 {
+		identifiers := make([]string, 0, len(s.conf.tables))
+		for _, t := range s.conf.tables {
+			identifiers = append(identifiers, t.identifier())
+		}
+		tablesClause = "TABLE " + strings.Join(identifiers, ", ")
+	}
+
+	publication := pgx.Identifier{s.conf.publication}.Sanitize()
+
+	var query string
+	if len(results) == 0 || len(results[0].Rows) == 0 {
+		if len(s.conf.tables) > 0 {
+			tablesClause = "FOR " + tablesClause
+		}
+		query = fmt.Sprintf("CREATE PUBLICATION %s %s", publication, tablesClause)
+		s.log.Infof("Creating publication %s", s.conf.publication)
+	} else {
+		if string(results[0].Rows[0][0]) == "t" || len(s.conf.tables) == 0 {
+			return nil
+		}
+		query = fmt.Sprintf("ALTER PUBLICATION %s SET %s", publication, tablesClause)
+		s.log.Debugf("Updating tables of publication %s", s.conf.publication)
+	}
+
+	if _, err = s.conn.Exec(ctx, query).ReadAll(); err != nil {
+		return fmt.Errorf("failed to manage publication %s: %w", s.conf.publication, err)
+	}
+	return nil
+}
+
+// MessageC returns a channel of transactions decoded from the WAL.
+func (s *replicationStream) MessageC() <-chan transaction {
+	return s.messages
+}
+
+// SnapshotMessageC returns a channel of changes read from the initial
+// snapshot.
+func (s *replicationStream) SnapshotMessageC() <-chan change {
+	return s.snapshotMessages
+}
+
+// ClosedChan returns a channel that is closed once the stream has stopped,
+// either due to being closed or due to an error, which can be obtained with
+// Err.
+func (s *replicationStream) ClosedChan() <-chan struct{} {
+	return s.shutSig.HasClosedChan()
+}
+
+// Err returns the error that caused the stream to stop, if any.
+func (s *replicationStream) Err() error {
+	s.errMut.Lock()
+	defer s.errMut.Unlock()
+	return s.err
+}
+
+func (s *replicationStream) setErr(err error) {
+	s.errMut.Lock()
+	s.err = err
+	s.errMut.Unlock()
+}
+
+// AckLSN marks all changes up to and including the provided LSN as
+// committed, the position is reported to the server with the next status
+// update.
+func (s *replicationStream) AckLSN(lsn pglogrepl.LSN) {
+	for {
+		current := s.committedLSN.Load()
+		if uint64(lsn) <= current || s.committedLSN.CompareAndSwap(current, uint64(lsn)) {
+			return
+		}
+	}
+}
+
+// SnapshotPlan returns the tables that are snapshotted before streaming
+// changes, and whether the snapshot is consistent with the replication slot,
+// which is only the case when the slot has just been created.
+func (s *replicationStream) SnapshotPlan() ([]tableSnapshot, bool) {
+	return s.snapshotPlan, s.snapshotName != ""
+}
+
+func (s *replicationStream) loop() {
+	defer func() {
+		_ = s.conn.Close(context.Background())
+		s.shutSig.ShutdownComplete()
+	}()
+
+	ctx, done := s.shutSig.CloseAtLeisureCtx(context.Background())
+
+	metricsDone := make(chan struct{})
+	go func() {
+		s.pollSlotMetrics(ctx)
+		close(metricsDone)
+	}()
+	defer func() {
+		done()
+		<-metricsDone
+	}()
+
+	if len(s.snapshotPlan) > 0 {
+		if err := s.processSnapshot(ctx); err != nil {
+			if ctx.Err() == nil {
+				s.log.Errorf("Failed to stream snapshot: %v", err)
+				s.setErr(err)
+			}
+			return
+		}
+	}
+
+	if err := pglogrepl.StartReplication(ctx, s.conn, s.conf.slotName, s.startLSN, pglogrepl.StartReplicationOptions{
+		PluginArgs: s.decoder.pluginArgs(),
+	}); err != nil {
+		if ctx.Err() == nil {
+			err = classifyErr(s.conf.slotName, err)
+			s.log.Errorf("Failed to start replication: %v", err)
+			s.setErr(err)
+		}
+		return
+	}
+	s.log.Infof("Logical replication started on slot %s", s.conf.slotName)
+
+	if err := s.streamMessages(ctx); err != nil {
+		s.log.Errorf("Replication stream stopped: %v", err)
+		s.setErr(err)
+	}
+}
+
+func (s *replicationStream) sendStandbyStatus(ctx context.Context) error {
+	committed := pglogrepl.LSN(s.committedLSN.Load())
+	if err := pglogrepl.SendStandbyStatusUpdate(ctx, s.conn, pglogrepl.StandbyStatusUpdate{
+		WALWritePosition: committed,
+	}); err != nil {
+		return fmt.Errorf("failed to send standby status update: %w", err)
+	}
+	s.log.Tracef("Sent standby status update at %s", committed)
+	return nil
+}
+
+func (s *replicationStream) streamMessages(ctx context.Context) error {
+	nextStandbyDeadline := time.Now().Add(standbyMessageTimeout)
+	for {
+		if time.Now().After(nextStandbyDeadline) {
+			if err := s.sendStandbyStatus(ctx); err != nil {
+				return err
+			}
+			nextStandbyDeadline = time.Now().Add(standbyMessageTimeout)
+		}
+
+		recvCtx, cancel := context.WithDeadline(ctx, nextStandbyDeadline)
+		rawMsg, err := s.conn.ReceiveMessage(recvCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				// Flush the latest acknowledged position before shutting down.
+				return s.sendStandbyStatus(context.Background())
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			if s.conn.IsClosed() {
+				return fmt.Errorf("%w: %w", ErrConnectionLost, err)
+			}
+			return fmt.Errorf("failed to receive replication message: %w", err)
+		}
+
+		if errMsg, ok := rawMsg.(*pgproto3.ErrorResponse); ok {
+			return classifyErr(s.conf.slotName, pgconn.ErrorResponseToPgError(errMsg))
+		}
+
+		msg, ok := rawMsg.(*pgproto3.CopyData)
+		if !ok {
+			s.log.Debugf("Received unexpected replication message: %T", rawMsg)
+			continue
+		}
+
+		switch msg.Data[0] {
+		case pglogrepl.PrimaryKeepaliveMessageByteID:
+			pkm, err := pglogrepl.ParsePrimaryKeepaliveMessage(msg.Data[1:])
+			if err != nil {
+				return fmt.Errorf("failed to parse keepalive message: %w", err)
+			}
+			if pkm.ReplyRequested {
+				nextStandbyDeadline = time.Time{}
+			}
+
+		case pglogrepl.XLogDataByteID:
+			xld, err := pglogrepl.ParseXLogData(msg.Data[1:])
+			if err != nil {
+				return fmt.Errorf("failed to parse xlog data: %w", err)
+			}
+
+			lsn := xld.WALStart + pglogrepl.LSN(len(xld.WALData))
+			tx, err := s.decoder.decode(lsn, xld.WALData)
+			if err != nil {
+				return err
+			}
+			if tx == nil {
+				continue
+			}
+
+			tx.Changes = s.filterChanges(tx.Changes)
+
+			prevLSN := s.lastLSN
+			s.lastLSN = tx.Lsn
+			if len(tx.Changes) == 0 {
+				// Transactions without changes to streamed tables are offered
+				// so that the slot can advance past them once all prior
+				// changes are acknowledged, preventing the server from
+				// retaining WAL while streamed tables are idle. They are
+				// dropped when the consumer is busy, as a later transaction
+				// also advances the slot.
+				select {
+				case s.messages <- *tx:
+				default:
+				}
+				continue
+			}
+
+			for i := range tx.Changes {
+				tx.Changes[i].ackLSN = prevLSN
+			}
+			tx.Changes[len(tx.Changes)-1].ackLSN = tx.Lsn
+
+			select {
+			case s.messages <- *tx:
+			case <-ctx.Done():
+				return s.sendStandbyStatus(context.Background())
+			}
+		}
+	}
+}
+
+func (s *replicationStream) processSnapshot(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, s.conf.connConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot connection: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+
+	if s.snapshotName != "" {
+		if _, err = tx.Exec(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT %s", quoteLiteral(s.snapshotName))); err != nil {
+			return fmt.Errorf("failed to set transaction snapshot: %w", err)
+		}
+	} else {
+		s.log.Warnf("Resuming an interrupted snapshot, rows changed since the snapshot began may be emitted by both the snapshot and the replication stream")
+	}
+
+	batchSize := s.conf.snapshotBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSnapshotBatchSize
+	}
+
+	var completed []string
+	for _, ts := range s.snapshotPlan {
+		if err := s.snapshotTable(ctx, tx, ts.table, ts.progress, batchSize, completed); err != nil {
+			return err
+		}
+		completed = append(completed[:len(completed):len(completed)], ts.table.FullName())
+	}
+	return nil
+}
+
+// rowAllowed returns whether a change passes the row filters of its table,
+// changes whose filters fail to execute are dropped.
+func (s *replicationStream) rowAllowed(c *change) bool {
+	allowed, err := c.TableSchema.rowAllowed(c)
+	if err != nil {
+		s.log.Errorf("Dropping %s change of table %s.%s: %v", c.Kind, c.Schema, c.Table, err)
+	}
+	return allowed
+}
+
+// filterChanges removes the changes that do not pass the row filters of their
+// table.
+func (s *replicationStream) filterChanges(changes []change) []change {
+	filtered := changes[:0]
+	for i := range changes {
+		if s.rowAllowed(&changes[i]) {
+			filtered = append(filtered, changes[i])
+		}
+	}
+	return filtered
+}
+
+// snapshotTable emits the rows of a table from the given progress onwards.
+// Each row is sent once the following row has been read, so that the last
+// row of the table can be marked as completing the snapshot.
+func (s *replicationStream) snapshotTable(ctx context.Context, tx pgx.Tx, table *tableSchema, progress snapshotProgress, batchSize int, completed []string) error {
+	if progress.Rows > 0 {
+		s.log.Infof("Resuming snapshot for table %s after %d rows", table.FullName(), progress.Rows)
+	} else {
+		s.log.Infof("Processing snapshot for table %s", table.FullName())
+	}
+
+	var estimatedRows int64
+	if err := tx.QueryRow(ctx,
+		"SELECT GREATEST(reltuples, 0)::bigint FROM pg_class WHERE oid = $1::text::regclass", table.identifier(),
+	).Scan(&estimatedRows); err != nil {
+		return fmt.Errorf("failed to estimate rows of table %s: %w", table.FullName(), err)
+	}
+
+	keyed := len(table.primaryKey()) > 0
+
+	var held *change
+	send := func(c *change) error {
+		select {
+		case s.snapshotMessages <- *c:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		query, args := snapshotQuery(table, progress, batchSize)
+		rows, err := tx.Query(ctx, query, append([]any{pgx.QueryExecModeSimpleProtocol}, args...)...)
+		if err != nil {
+			return fmt.Errorf("failed to query snapshot data: %w", err)
+		}
+
+		rowsCount := 0
+		for rows.Next() {
+			rowsCount++
+
+			values, err := rows.Values()
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			rowJSON, _ := values[0].(string)
+			row, err := decodeJSONRow(rowJSON)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			progress.Rows++
+			if keyed {
+				progress.LastKey = make([]string, 0, len(values)-1)
+				for _, v := range values[1:] {
+					str, _ := v.(string)
+					progress.LastKey = append(progress.LastKey, str)
+				}
+			} else {
+				progress.LastCtid, _ = values[1].(string)
+			}
+
+			next := &change{
+				Kind:        "insert",
+				Schema:      table.Schema,
+				Table:       table.Name,
+				After:       table.filterRow(row),
+				Snapshot:    true,
+				Timestamp:   time.Now(),
+				TableSchema: table,
+				snapshotPos: &snapshotPosition{
+					Table:         table.FullName(),
+					Progress:      progress,
+					EstimatedRows: estimatedRows,
+					Completed:     completed,
+				},
+			}
+			if !s.rowAllowed(next) {
+				continue
+			}
+
+			if held != nil {
+				if err := send(held); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			held = next
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("failed to read snapshot data: %w", err)
+		}
+
+		if rowsCount < batchSize {
+			break
+		}
+	}
+
+	if held == nil {
+		// There are no rows left to mark as completing the table, so the
+		// completion is sent without a row in order to persist it.
+		progress.Complete = true
+		if err := send(&change{
+			Schema:       table.Schema,
+			Table:        table.Name,
+			Snapshot:     true,
+			TableSchema:  table,
+			progressOnly: true,
+			snapshotPos: &snapshotPosition{
+				Table:         table.FullName(),
+				Progress:      progress,
+				EstimatedRows: estimatedRows,
+				Completed:     completed,
+			},
+		}); err != nil {
+			return err
+		}
+		s.log.Infof("Snapshot for table %s contained no further rows", table.FullName())
+		return nil
+	}
+	held.snapshotPos.Progress.Complete = true
+	if err := send(held); err != nil {
+		return err
+	}
+	s.log.Infof("Finished snapshot for table %s after %d rows", table.FullName(), progress.Rows)
+	return nil
+}
+
+// Close stops the stream and waits for the underlying connection to be
+// closed.
+func (s *replicationStream) Close(ctx context.Context) error {
+	s.shutSig.CloseAtLeisure()
+	select {
+	case <-s.shutSig.HasClosedChan():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
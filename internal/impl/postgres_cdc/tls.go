@@ -0,0 +1,85 @@
+package postgres_cdc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	sslModeDisable    = "disable"
+	sslModeRequire    = "require"
+	sslModeVerifyCA   = "verify-ca"
+	sslModeVerifyFull = "verify-full"
+)
+
+// configureTLS sets the TLS configuration of a connection according to an SSL
+// mode, which follows the semantics of the libpq sslmode parameter. The given
+// TLS config is used as the base configuration when not nil, and an empty
+// mode uses it as is. Fallbacks are removed so that the mode is always
+// honoured.
+func configureTLS(connConfig *pgx.ConnConfig, sslMode string, tlsConf *tls.Config) error {
+	connConfig.Fallbacks = nil
+	if sslMode == sslModeDisable {
+		connConfig.TLSConfig = nil
+		return nil
+	}
+
+	if tlsConf == nil {
+		tlsConf = &tls.Config{}
+	} else {
+		tlsConf = tlsConf.Clone()
+	}
+	if tlsConf.ServerName == "" {
+		tlsConf.ServerName = connConfig.Host
+	}
+
+	switch sslMode {
+	case "":
+	case sslModeRequire:
+		tlsConf.InsecureSkipVerify = true
+	case sslModeVerifyCA:
+		// Skip the default verification, which includes the host name, and
+		// verify the certificate chain only.
+		tlsConf.InsecureSkipVerify = true
+		tlsConf.VerifyPeerCertificate = verifyCertificateChain(tlsConf.RootCAs)
+	case sslModeVerifyFull:
+		tlsConf.InsecureSkipVerify = false
+	default:
+		return fmt.Errorf("unrecognised sslmode: %v", sslMode)
+	}
+
+	connConfig.TLSConfig = tlsConf
+	return nil
+}
+
+func verifyCertificateChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server did not present a certificate")
+		}
+
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse server certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
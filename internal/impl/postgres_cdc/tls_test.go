@@ -0,0 +1,46 @@
+package postgres_cdc
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureTLS(t *testing.T) {
+	newConfig := func() *pgx.ConnConfig {
+		conf, err := pgx.ParseConfig("postgres://localhost:5432/shop?sslmode=prefer")
+		require.NoError(t, err)
+		require.NotEmpty(t, conf.Fallbacks)
+		return conf
+	}
+
+	conf := newConfig()
+	require.NoError(t, configureTLS(conf, sslModeDisable, nil))
+	assert.Nil(t, conf.TLSConfig)
+	assert.Empty(t, conf.Fallbacks)
+
+	conf = newConfig()
+	require.NoError(t, configureTLS(conf, sslModeRequire, nil))
+	require.NotNil(t, conf.TLSConfig)
+	assert.True(t, conf.TLSConfig.InsecureSkipVerify)
+	assert.Empty(t, conf.Fallbacks)
+
+	conf = newConfig()
+	require.NoError(t, configureTLS(conf, sslModeVerifyCA, nil))
+	require.NotNil(t, conf.TLSConfig)
+	assert.True(t, conf.TLSConfig.InsecureSkipVerify)
+	assert.NotNil(t, conf.TLSConfig.VerifyPeerCertificate)
+
+	base := &tls.Config{InsecureSkipVerify: true}
+	conf = newConfig()
+	require.NoError(t, configureTLS(conf, sslModeVerifyFull, base))
+	require.NotNil(t, conf.TLSConfig)
+	assert.False(t, conf.TLSConfig.InsecureSkipVerify)
+	assert.Equal(t, "localhost", conf.TLSConfig.ServerName)
+	assert.True(t, base.InsecureSkipVerify, "base config must not be modified")
+
+	require.Error(t, configureTLS(newConfig(), "prefer", nil))
+}
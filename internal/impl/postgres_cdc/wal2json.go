@@ -0,0 +1,187 @@
+package postgres_cdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// wal2jsonMessage is a single transaction as emitted by wal2json with
+// format-version 1.
+type wal2jsonMessage struct {
+	Xid       uint32           `json:"xid"`
+	Timestamp string           `json:"timestamp"`
+	Change    []wal2jsonChange `json:"change"`
+}
+
+type wal2jsonChange struct {
+	Kind         string   `json:"kind"`
+	Schema       string   `json:"schema"`
+	Table        string   `json:"table"`
+	Columnnames  []string `json:"columnnames"`
+	Columntypes  []string `json:"columntypes"`
+	Columnvalues []any    `json:"columnvalues"`
+	Oldkeys      struct {
+		Keynames  []string `json:"keynames"`
+		Keytypes  []string `json:"keytypes"`
+		Keyvalues []any    `json:"keyvalues"`
+	} `json:"oldkeys"`
+}
+
+var wal2jsonTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+}
+
+type wal2jsonDecoder struct {
+	tables map[string]*tableSchema
+}
+
+func newWal2JSONDecoder(tables []tableSchema) *wal2jsonDecoder {
+	tablesMap := make(map[string]*tableSchema, len(tables))
+	for i := range tables {
+		t := tables[i]
+		tablesMap[t.FullName()] = &t
+	}
+	return &wal2jsonDecoder{tables: tablesMap}
+}
+
+func (d *wal2jsonDecoder) pluginArgs() []string {
+	args := []string{
+		`"include-xids" '1'`,
+		`"include-timestamp" '1'`,
+	}
+	if len(d.tables) > 0 {
+		names := make([]string, 0, len(d.tables))
+		for name := range d.tables {
+			names = append(names, name)
+		}
+		args = append(args, fmt.Sprintf(`"add-tables" %s`, quoteLiteral(strings.Join(names, ","))))
+	}
+	return args
+}
+
+// decode a wal2json message, which contains a whole transaction, into the
+// changes of tables being streamed.
+func (d *wal2jsonDecoder) decode(lsn pglogrepl.LSN, data []byte) (*transaction, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var msg wal2jsonMessage
+	if err := dec.Decode(&msg); err != nil {
+		return nil, fmt.Errorf("failed to parse wal2json message: %w", err)
+	}
+
+	var ts time.Time
+	for _, layout := range wal2jsonTimestampLayouts {
+		var err error
+		if ts, err = time.Parse(layout, msg.Timestamp); err == nil {
+			break
+		}
+	}
+
+	tx := &transaction{
+		Xid:       msg.Xid,
+		Lsn:       lsn,
+		Timestamp: ts,
+		Changes:   make([]change, 0, len(msg.Change)),
+	}
+	for _, ch := range msg.Change {
+		key := ch.Schema + "." + ch.Table
+		table, exists := d.tables[key]
+		if !exists {
+			continue
+		}
+		if len(ch.Columnnames) > 0 {
+			table = table.withColumns(refreshWal2JSONColumns(table, ch.Columnnames, ch.Columntypes))
+			d.tables[key] = table
+		}
+
+		c := change{
+			Lsn:       lsn,
+			Xid:       msg.Xid,
+			Timestamp: ts,
+			Kind:      ch.Kind,
+			Schema:    ch.Schema,
+			Table:     ch.Table,
+		}
+		if len(ch.Columnnames) > 0 {
+			c.After = table.filterRow(zipRow(ch.Columnnames, ch.Columnvalues))
+		}
+		if len(ch.Oldkeys.Keynames) > 0 {
+			c.Before = table.filterRow(zipRow(ch.Oldkeys.Keynames, ch.Oldkeys.Keyvalues))
+		}
+		c.TableSchema = table
+		tx.Changes = append(tx.Changes, c)
+	}
+	return tx, nil
+}
+
+// refreshWal2JSONColumns returns the columns of a table updated with the
+// column names and types of a change. Columns are only ever added or have
+// their types changed, as wal2json omits unchanged TOAST values the absence of
+// a column does not imply it was dropped.
+func refreshWal2JSONColumns(table *tableSchema, names, types []string) []columnSchema {
+	columns := table.Columns
+	copied := false
+	for i, name := range names {
+		if i >= len(types) {
+			break
+		}
+		col := columnSchema{
+			Name:                name,
+			NativeConnectorType: types[i],
+			DatabrewType:        arrowType(types[i]),
+			Nullable:            true,
+		}
+
+		j := 0
+		for ; j < len(columns); j++ {
+			if columns[j].Name == name {
+				break
+			}
+		}
+		if j < len(columns) {
+			if columns[j].DatabrewType == col.DatabrewType {
+				continue
+			}
+			col.Pk, col.Nullable = columns[j].Pk, columns[j].Nullable
+		}
+
+		if !copied {
+			columns = append([]columnSchema(nil), columns...)
+			copied = true
+		}
+		if j < len(columns) {
+			columns[j] = col
+		} else {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+func zipRow(names []string, values []any) map[string]any {
+	row := make(map[string]any, len(names))
+	for i, name := range names {
+		if i < len(values) {
+			row[name] = values[i]
+		}
+	}
+	return row
+}
+
+func decodeJSONRow(rowJSON string) (map[string]any, error) {
+	dec := json.NewDecoder(strings.NewReader(rowJSON))
+	dec.UseNumber()
+
+	var row map[string]any
+	if err := dec.Decode(&row); err != nil {
+		return nil, fmt.Errorf("failed to parse row: %w", err)
+	}
+	return row, nil
+}
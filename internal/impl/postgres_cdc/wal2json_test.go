@@ -0,0 +1,110 @@
+package postgres_cdc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWal2JSONDecode(t *testing.T) {
+	decoder := newWal2JSONDecoder([]tableSchema{
+		{Schema: "public", Name: "users"},
+		{Schema: "public", Name: "orders", Pinned: true, Columns: []columnSchema{
+			{Name: "id", DatabrewType: "Int64"},
+			{Name: "total", DatabrewType: "Float64"},
+		}},
+	})
+
+	input := `{
+  "xid": 580,
+  "timestamp": "2023-11-02 10:15:30.123456+00",
+  "change": [
+    {
+      "kind": "update",
+      "schema": "public",
+      "table": "users",
+      "columnnames": ["id", "name"],
+      "columntypes": ["integer", "text"],
+      "columnvalues": [1, "bar"],
+      "oldkeys": {"keynames": ["id", "name"], "keytypes": ["integer", "text"], "keyvalues": [1, "foo"]}
+    },
+    {
+      "kind": "insert",
+      "schema": "public",
+      "table": "orders",
+      "columnnames": ["id", "total", "secret"],
+      "columntypes": ["integer", "numeric", "text"],
+      "columnvalues": [5, "10.5", "hidden"]
+    },
+    {
+      "kind": "delete",
+      "schema": "public",
+      "table": "ignored",
+      "oldkeys": {"keynames": ["id"], "keytypes": ["integer"], "keyvalues": [1]}
+    }
+  ]
+}`
+
+	tx, err := decoder.decode(pglogrepl.LSN(100), []byte(input))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(580), tx.Xid)
+	assert.Equal(t, pglogrepl.LSN(100), tx.Lsn)
+
+	changes := tx.Changes
+	require.Len(t, changes, 2)
+
+	ts := time.Date(2023, 11, 2, 10, 15, 30, 123456000, time.UTC)
+
+	assert.Equal(t, "update", changes[0].Kind)
+	assert.Equal(t, uint32(580), changes[0].Xid)
+	assert.True(t, ts.Equal(changes[0].Timestamp))
+	assert.Equal(t, pglogrepl.LSN(100), changes[0].Lsn)
+	assert.Equal(t, map[string]any{"id": int64(1), "name": "foo"}, changes[0].Before)
+	assert.Equal(t, map[string]any{"id": int64(1), "name": "bar"}, changes[0].After)
+
+	assert.Equal(t, "insert", changes[1].Kind)
+	assert.Nil(t, changes[1].Before)
+	assert.Equal(t, map[string]any{"id": int64(5), "total": 10.5}, changes[1].After)
+}
+
+func TestWal2JSONSchemaRefresh(t *testing.T) {
+	users := tableSchema{Schema: "public", Name: "users"}
+	users.setColumns([]columnSchema{
+		{Name: "id", DatabrewType: "Int32", NativeConnectorType: "int4", Pk: true},
+		{Name: "name", DatabrewType: "String", NativeConnectorType: "text", Nullable: true},
+	})
+	decoder := newWal2JSONDecoder([]tableSchema{users})
+
+	tx, err := decoder.decode(pglogrepl.LSN(100), []byte(`{"xid": 1, "change": [{
+  "kind": "insert", "schema": "public", "table": "users",
+  "columnnames": ["id", "name"], "columntypes": ["integer", "text"], "columnvalues": [1, "foo"]
+}]}`))
+	require.NoError(t, err)
+	require.Len(t, tx.Changes, 1)
+	assert.Equal(t, users.Columns, tx.Changes[0].TableSchema.Columns)
+
+	tx, err = decoder.decode(pglogrepl.LSN(200), []byte(`{"xid": 2, "change": [{
+  "kind": "insert", "schema": "public", "table": "users",
+  "columnnames": ["id", "name", "age"], "columntypes": ["bigint", "text", "smallint"], "columnvalues": [2, "bar", 30]
+}]}`))
+	require.NoError(t, err)
+	require.Len(t, tx.Changes, 1)
+	assert.Equal(t, []columnSchema{
+		{Name: "id", DatabrewType: "Int64", NativeConnectorType: "bigint", Pk: true},
+		{Name: "name", DatabrewType: "String", NativeConnectorType: "text", Nullable: true},
+		{Name: "age", DatabrewType: "Int16", NativeConnectorType: "smallint", Nullable: true},
+	}, tx.Changes[0].TableSchema.Columns)
+	assert.Equal(t, map[string]any{"id": int64(2), "name": "bar", "age": int64(30)}, tx.Changes[0].After)
+}
+
+func TestWal2JSONPluginArgs(t *testing.T) {
+	decoder := newWal2JSONDecoder([]tableSchema{{Schema: "public", Name: "users"}})
+	assert.Equal(t, []string{
+		`"include-xids" '1'`,
+		`"include-timestamp" '1'`,
+		`"add-tables" 'public.users'`,
+	}, decoder.pluginArgs())
+}
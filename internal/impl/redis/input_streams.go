@@ -25,13 +25,27 @@ const (
 	siFieldStartFromOldest = "start_from_oldest"
 	siFieldCommitPeriod    = "commit_period"
 	siFieldTimeout         = "timeout"
+
+	siFieldClaim                 = "claim"
+	siFieldClaimMinIdleTime      = "min_idle_time"
+	siFieldClaimInterval         = "interval"
+	siFieldClaimMaxDeliveries    = "max_deliveries"
+	siFieldClaimDeadLetterStream = "dead_letter_stream"
 )
 
 func redisStreamsInputConfig() *service.ConfigSpec {
 	return service.NewConfigSpec().
 		Stable().
 		Summary(`Pulls messages from Redis (v5.0+) streams with the XREADGROUP command. The `+"`client_id`"+` should be unique for each consumer of a group.`).
-		Description(`Redis stream entries are key/value pairs, as such it is necessary to specify the key that contains the body of the message. All other keys/value pairs are saved as metadata fields.`).
+		Description(`Redis stream entries are key/value pairs, as such it is necessary to specify the key that contains the body of the message. All other keys/value pairs are saved as metadata fields.
+
+### Pending Entries
+
+Entries that were read by a consumer of the group but never acknowledged, for example because the consumer crashed, remain pending within the group. When the field `+"`claim`"+` is set pending entries that have been idle for at least `+"`claim.min_idle_time`"+` are periodically claimed with the XAUTOCLAIM command (Redis v6.2+) and consumed again. Entries that have already been delivered `+"`claim.max_deliveries`"+` times are instead moved to a dead letter stream, preventing messages that repeatedly fail from blocking the group.
+
+### Metrics
+
+The gauges `+"`redis_streams_pending`"+` and `+"`redis_streams_lag`"+`, labelled by `+"`stream`"+`, track the number of entries pending acknowledgement within the consumer group and the number of entries yet to be delivered to the group (Redis v7.0+) respectively. The counters `+"`redis_streams_claimed`"+` and `+"`redis_streams_dead_lettered`"+` track entries claimed from other consumers and entries moved to the dead letter stream.`).
 		Categories("Services").
 		Fields(clientFields()...).
 		Fields(
@@ -65,9 +79,58 @@ func redisStreamsInputConfig() *service.ConfigSpec {
 				Description("The length of time to poll for new messages before reattempting.").
 				Advanced().
 				Default("1s"),
+			service.NewObjectField(siFieldClaim,
+				service.NewDurationField(siFieldClaimMinIdleTime).
+					Description("The minimum period of time an entry must have been pending without being acknowledged before it is claimed by this consumer. This should be comfortably longer than the time taken to process and acknowledge a message, otherwise entries being processed by healthy consumers are claimed and duplicated.").
+					Example("5m"),
+				service.NewDurationField(siFieldClaimInterval).
+					Description("The period of time between each attempt to claim idle pending entries.").
+					Default("30s"),
+				service.NewIntField(siFieldClaimMaxDeliveries).
+					Description("The maximum number of times an entry can be delivered before it is moved to the dead letter stream rather than being claimed again. When zero entries are claimed regardless of their number of deliveries.").
+					Default(0),
+				service.NewStringField(siFieldClaimDeadLetterStream).
+					Description("A stream to which entries exceeding `max_deliveries` are added, with the fields `dead_letter_source_stream`, `dead_letter_source_id` and `dead_letter_delivery_count` added to the original fields of the entry. When empty entries exceeding `max_deliveries` are acknowledged and dropped.").
+					Default("").
+					Example("dead-letters"),
+			).
+				Description("Claim entries left pending by other consumers of the group, such as consumers that crashed before acknowledging them.").
+				Optional().
+				Advanced(),
 		)
 }
 
+type redisStreamsClaimConfig struct {
+	minIdleTime      time.Duration
+	interval         time.Duration
+	maxDeliveries    int64
+	deadLetterStream string
+}
+
+func claimConfigFromParsed(conf *service.ParsedConfig) (c *redisStreamsClaimConfig, err error) {
+	conf = conf.Namespace(siFieldClaim)
+
+	c = &redisStreamsClaimConfig{}
+	if c.minIdleTime, err = conf.FieldDuration(siFieldClaimMinIdleTime); err != nil {
+		return nil, err
+	}
+	if c.interval, err = conf.FieldDuration(siFieldClaimInterval); err != nil {
+		return nil, err
+	}
+	var maxDeliveries int
+	if maxDeliveries, err = conf.FieldInt(siFieldClaimMaxDeliveries); err != nil {
+		return nil, err
+	}
+	if maxDeliveries < 0 {
+		return nil, fmt.Errorf("max deliveries must not be negative, got %v", maxDeliveries)
+	}
+	c.maxDeliveries = int64(maxDeliveries)
+	if c.deadLetterStream, err = conf.FieldString(siFieldClaimDeadLetterStream); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 func init() {
 	err := service.RegisterBatchInput(
 		"redis_streams", redisStreamsInputConfig(),
@@ -109,6 +172,15 @@ type redisStreamsReader struct {
 
 	backlogs map[string]string
 
+	claim        *redisStreamsClaimConfig
+	claimCursors map[string]string
+	lastClaim    time.Time
+
+	mPending      *service.MetricGauge
+	mLag          *service.MetricGauge
+	mClaimed      *service.MetricCounter
+	mDeadLettered *service.MetricCounter
+
 	aMut    sync.Mutex
 	ackSend map[string][]string // Acks that can be sent
 
@@ -134,6 +206,11 @@ func newRedisStreamsReader(conf *service.ParsedConfig, mgr *service.Resources) (
 		connBackoff: connBoff,
 		closeChan:   make(chan struct{}),
 		closedChan:  make(chan struct{}),
+
+		mPending:      mgr.Metrics().NewGauge("redis_streams_pending", "stream"),
+		mLag:          mgr.Metrics().NewGauge("redis_streams_lag", "stream"),
+		mClaimed:      mgr.Metrics().NewCounter("redis_streams_claimed", "stream"),
+		mDeadLettered: mgr.Metrics().NewCounter("redis_streams_dead_lettered", "stream"),
 	}
 	if _, err = getClient(conf); err != nil {
 		return
@@ -168,11 +245,18 @@ func newRedisStreamsReader(conf *service.ParsedConfig, mgr *service.Resources) (
 	if r.timeout, err = conf.FieldDuration(siFieldTimeout); err != nil {
 		return
 	}
+	if conf.Contains(siFieldClaim) {
+		if r.claim, err = claimConfigFromParsed(conf); err != nil {
+			return
+		}
+	}
 
 	r.ackSend = make(map[string][]string, len(r.streams))
 	r.backlogs = make(map[string]string, len(r.streams))
+	r.claimCursors = make(map[string]string, len(r.streams))
 	for _, str := range r.streams {
 		r.backlogs[str] = "0"
+		r.claimCursors[str] = "0-0"
 	}
 
 	go r.loop()
@@ -205,6 +289,38 @@ func (r *redisStreamsReader) loop() {
 			closed = true
 		}
 		r.sendAcks(ctx)
+		if !closed {
+			r.updateGroupMetrics(ctx)
+		}
+	}
+}
+
+// updateGroupMetrics sets the gauges of pending entries and lag of the consumer
+// group for each stream.
+func (r *redisStreamsReader) updateGroupMetrics(ctx context.Context) {
+	r.cMut.Lock()
+	client := r.client
+	r.cMut.Unlock()
+
+	if client == nil {
+		return
+	}
+
+	for _, str := range r.streams {
+		groups, err := client.XInfoGroups(ctx, str).Result()
+		if err != nil {
+			r.log.Debugf("Failed to obtain consumer groups of stream %v: %v\n", str, err)
+			continue
+		}
+		for _, g := range groups {
+			if g.Name != r.consumerGroup {
+				continue
+			}
+			r.mPending.Set(g.Pending, str)
+			if g.Lag >= 0 {
+				r.mLag.Set(g.Lag, str)
+			}
+		}
 	}
 }
 
@@ -304,6 +420,17 @@ func (r *redisStreamsReader) read(ctx context.Context) (pendingRedisStreamMsg, e
 		return msg, nil
 	}
 
+	if r.claim != nil && time.Since(r.lastClaim) >= r.claim.interval {
+		claimed, complete := r.claimPending(ctx, client)
+		if complete {
+			r.lastClaim = time.Now()
+		}
+		if len(claimed) > 0 {
+			msg, r.pendingMsgs = claimed[0], claimed[1:]
+			return msg, nil
+		}
+	}
+
 	strs := make([]string, len(r.streams)*2)
 	for i, str := range r.streams {
 		strs[i] = str
@@ -347,35 +474,10 @@ func (r *redisStreamsReader) read(ctx context.Context) (pendingRedisStreamMsg, e
 			}
 		}
 		for _, xmsg := range strRes.Messages {
-			body, exists := xmsg.Values[r.bodyKey]
-			if !exists {
+			nextMsg, ok := r.pendingFromEntry(strRes.Stream, xmsg)
+			if !ok {
 				continue
 			}
-			delete(xmsg.Values, r.bodyKey)
-
-			var bodyBytes []byte
-			switch t := body.(type) {
-			case string:
-				bodyBytes = []byte(t)
-			case []byte:
-				bodyBytes = t
-			}
-			if bodyBytes == nil {
-				continue
-			}
-
-			part := service.NewMessage(bodyBytes)
-			part.MetaSetMut("redis_stream", xmsg.ID)
-			for k, v := range xmsg.Values {
-				part.MetaSetMut(k, v)
-			}
-
-			nextMsg := pendingRedisStreamMsg{
-				payload: service.MessageBatch{},
-				stream:  strRes.Stream,
-				id:      xmsg.ID,
-			}
-			nextMsg.payload = append(nextMsg.payload, part)
 			if msg.payload == nil {
 				msg = nextMsg
 			} else {
@@ -391,6 +493,165 @@ func (r *redisStreamsReader) read(ctx context.Context) (pendingRedisStreamMsg, e
 	return msg, nil
 }
 
+// claimPending claims idle entries left pending by consumers of the group,
+// moving entries that have exceeded the maximum number of deliveries to the
+// dead letter stream. Returns false if more entries may be claimable.
+func (r *redisStreamsReader) claimPending(ctx context.Context, client redis.UniversalClient) (claimed []pendingRedisStreamMsg, complete bool) {
+	complete = true
+	for _, str := range r.streams {
+		xmsgs, cursor, err := client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   str,
+			Group:    r.consumerGroup,
+			MinIdle:  r.claim.minIdleTime,
+			Start:    r.claimCursors[str],
+			Count:    r.limit,
+			Consumer: r.clientID,
+		}).Result()
+		if err != nil {
+			r.log.Errorf("Failed to claim pending entries of stream %v: %v\n", str, err)
+			continue
+		}
+		r.claimCursors[str] = cursor
+		if cursor != "0-0" {
+			complete = false
+		}
+		if len(xmsgs) == 0 {
+			continue
+		}
+
+		deliveries, err := r.deliveryCounts(ctx, client, str, xmsgs)
+		if err != nil {
+			r.log.Errorf("Failed to obtain delivery counts of claimed entries of stream %v: %v\n", str, err)
+		}
+
+		var nClaimed int64
+		for _, xmsg := range xmsgs {
+			if xmsg.Values == nil {
+				// The entry was deleted from the stream while pending.
+				r.addAsyncAcks(str, xmsg.ID)
+				continue
+			}
+			if count := deliveries[xmsg.ID]; r.claim.maxDeliveries > 0 && count > r.claim.maxDeliveries {
+				if err := r.deadLetter(ctx, client, str, xmsg, count-1); err != nil {
+					r.log.Errorf("Failed to move entry %v of stream %v to dead letter stream: %v\n", xmsg.ID, str, err)
+				}
+				continue
+			}
+			if pending, ok := r.pendingFromEntry(str, xmsg); ok {
+				claimed = append(claimed, pending)
+				nClaimed++
+			}
+		}
+		if nClaimed > 0 {
+			r.mClaimed.Incr(nClaimed, str)
+			r.log.Debugf("Claimed %v pending entries of stream %v\n", nClaimed, str)
+		}
+	}
+	return
+}
+
+// deliveryCounts returns the number of times each claimed entry has been
+// delivered, including the delivery of the claim itself.
+func (r *redisStreamsReader) deliveryCounts(ctx context.Context, client redis.UniversalClient, stream string, xmsgs []redis.XMessage) (map[string]int64, error) {
+	counts := make(map[string]int64, len(xmsgs))
+	if r.claim.maxDeliveries <= 0 {
+		return counts, nil
+	}
+
+	cmds, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, xmsg := range xmsgs {
+			pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: stream,
+				Group:  r.consumerGroup,
+				Start:  xmsg.ID,
+				End:    xmsg.ID,
+				Count:  1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return counts, err
+	}
+	for _, cmd := range cmds {
+		pending, err := cmd.(*redis.XPendingExtCmd).Result()
+		if err != nil {
+			return counts, err
+		}
+		for _, p := range pending {
+			counts[p.ID] = p.RetryCount
+		}
+	}
+	return counts, nil
+}
+
+// deadLetter adds an entry that has been delivered the given number of times to
+// the dead letter stream, when one is configured, and acknowledges it within
+// the source stream.
+func (r *redisStreamsReader) deadLetter(ctx context.Context, client redis.UniversalClient, stream string, xmsg redis.XMessage, deliveries int64) error {
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if r.claim.deadLetterStream != "" {
+			values := make(map[string]any, len(xmsg.Values)+3)
+			for k, v := range xmsg.Values {
+				values[k] = v
+			}
+			values["dead_letter_source_stream"] = stream
+			values["dead_letter_source_id"] = xmsg.ID
+			values["dead_letter_delivery_count"] = deliveries
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: r.claim.deadLetterStream,
+				Values: values,
+			})
+		}
+		pipe.XAck(ctx, stream, r.consumerGroup, xmsg.ID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mDeadLettered.Incr(1, stream)
+	if r.claim.deadLetterStream != "" {
+		r.log.Warnf("Moved entry %v of stream %v to dead letter stream %v after %v deliveries\n", xmsg.ID, stream, r.claim.deadLetterStream, deliveries)
+	} else {
+		r.log.Warnf("Dropped entry %v of stream %v after %v deliveries\n", xmsg.ID, stream, deliveries)
+	}
+	return nil
+}
+
+// pendingFromEntry converts a stream entry into a message, returning false if
+// the entry does not contain a body.
+func (r *redisStreamsReader) pendingFromEntry(stream string, xmsg redis.XMessage) (pendingRedisStreamMsg, bool) {
+	body, exists := xmsg.Values[r.bodyKey]
+	if !exists {
+		return pendingRedisStreamMsg{}, false
+	}
+	delete(xmsg.Values, r.bodyKey)
+
+	var bodyBytes []byte
+	switch t := body.(type) {
+	case string:
+		bodyBytes = []byte(t)
+	case []byte:
+		bodyBytes = t
+	}
+	if bodyBytes == nil {
+		return pendingRedisStreamMsg{}, false
+	}
+
+	part := service.NewMessage(bodyBytes)
+	part.MetaSetMut("redis_stream", xmsg.ID)
+	for k, v := range xmsg.Values {
+		part.MetaSetMut(k, v)
+	}
+
+	return pendingRedisStreamMsg{
+		payload: service.MessageBatch{part},
+		stream:  stream,
+		id:      xmsg.ID,
+	}, true
+}
+
 func (r *redisStreamsReader) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
 	msg, err := r.read(ctx)
 	if err != nil {
@@ -13,6 +13,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/usedatabrew/benthos/v4/internal/integration"
+	"github.com/usedatabrew/benthos/v4/public/service"
+
 	_ "github.com/usedatabrew/benthos/v4/public/components/pure"
 )
 
@@ -103,6 +105,88 @@ input:
 		})
 	})
 
+	t.Run("streams claim pending", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, done := context.WithTimeout(context.Background(), time.Second*30)
+		defer done()
+
+		require.NoError(t, client.XGroupCreateMkStream(ctx, "claim-stream", "claim-group", "0").Err())
+		for _, body := range []string{"foo", "bar", "baz"} {
+			require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "claim-stream",
+				Values: map[string]any{"body": body},
+			}).Err())
+		}
+
+		// Read all entries with a consumer that never acknowledges them, and
+		// then claim the first entry repeatedly so that it exceeds the maximum
+		// number of deliveries.
+		res, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    "claim-group",
+			Consumer: "crashed",
+			Streams:  []string{"claim-stream", ">"},
+		}).Result()
+		require.NoError(t, err)
+		require.Len(t, res[0].Messages, 3)
+		poisonID := res[0].Messages[0].ID
+		for i := 0; i < 2; i++ {
+			require.NoError(t, client.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   "claim-stream",
+				Group:    "claim-group",
+				Consumer: "crashed",
+				Messages: []string{poisonID},
+			}).Err())
+		}
+
+		conf, err := redisStreamsInputConfig().ParseYAML(fmt.Sprintf(`
+url: %v
+body_key: body
+streams: [ claim-stream ]
+client_id: claimer
+consumer_group: claim-group
+commit_period: 10ms
+claim:
+  min_idle_time: 0s
+  max_deliveries: 2
+  dead_letter_stream: claim-dead-letters
+`, urlStr), nil)
+		require.NoError(t, err)
+
+		reader, err := newRedisStreamsReader(conf, service.MockResources())
+		require.NoError(t, err)
+		require.NoError(t, reader.Connect(ctx))
+		t.Cleanup(func() {
+			_ = reader.Close(context.Background())
+		})
+
+		var bodies []string
+		for len(bodies) < 2 {
+			batch, ackFn, err := reader.ReadBatch(ctx)
+			require.NoError(t, err)
+			b, err := batch[0].AsBytes()
+			require.NoError(t, err)
+			bodies = append(bodies, string(b))
+			require.NoError(t, ackFn(ctx, nil))
+		}
+		assert.ElementsMatch(t, []string{"bar", "baz"}, bodies)
+
+		dead, err := client.XRange(ctx, "claim-dead-letters", "-", "+").Result()
+		require.NoError(t, err)
+		require.Len(t, dead, 1)
+		assert.Equal(t, map[string]any{
+			"body":                       "foo",
+			"dead_letter_source_stream":  "claim-stream",
+			"dead_letter_source_id":      poisonID,
+			"dead_letter_delivery_count": "3",
+		}, dead[0].Values)
+
+		assert.Eventually(t, func() bool {
+			pending, err := client.XPending(ctx, "claim-stream", "claim-group").Result()
+			return err == nil && pending.Count == 0
+		}, time.Second*10, time.Millisecond*50)
+	})
+
 	t.Run("pubsub", func(t *testing.T) {
 		t.Parallel()
 		template := `
@@ -0,0 +1,401 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+
+	"github.com/usedatabrew/benthos/v4/internal/checkpoint"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	ssiFieldIncremental           = "incremental"
+	ssiFieldIncCursorColumn       = "cursor_column"
+	ssiFieldIncTiebreakerColumn   = "tiebreaker_column"
+	ssiFieldIncInitialValue       = "initial_value"
+	ssiFieldIncPageSize           = "page_size"
+	ssiFieldIncInterval           = "interval"
+	ssiFieldIncCache              = "cache"
+	ssiFieldIncCacheKey           = "cache_key"
+	ssiFieldIncCheckpointLimit    = "checkpoint_limit"
+	ssiDefaultIncrementalCacheKey = "sql_select_cursor"
+)
+
+func incrementalSelectField() *service.ConfigField {
+	return service.NewObjectField(ssiFieldIncremental,
+		service.NewStringField(ssiFieldIncCursorColumn).
+			Description("A column whose values only ever increase as rows are added or changed, such as an auto incrementing id or a last updated timestamp. Rows are selected in ascending order of this column and only rows with a value greater than that of the last row read are selected by subsequent queries.").
+			Example("id").
+			Example("updated_at"),
+		service.NewStringField(ssiFieldIncTiebreakerColumn).
+			Description("An optional unique column, such as a primary key, used to order rows sharing the same cursor value. This must be set when the cursor column is not unique, otherwise rows sharing a cursor value across the boundary of a page may be skipped.").
+			Example("id").
+			Default(""),
+		service.NewStringField(ssiFieldIncInitialValue).
+			Description("An optional cursor value to start from when no cursor has been stored, only rows with a greater cursor value are selected. When not set all rows are selected initially.").
+			Example("2023-01-01T00:00:00Z").
+			Optional(),
+		service.NewIntField(ssiFieldIncPageSize).
+			Description("The maximum number of rows selected by each query.").
+			Default(1000),
+		service.NewDurationField(ssiFieldIncInterval).
+			Description("The period to wait before querying for new rows once all existing rows have been read.").
+			Default("10s"),
+		service.NewStringField(ssiFieldIncCache).
+			Description("A [cache resource](/docs/components/caches/about) in which the cursor of the last acknowledged row is stored, and from which it is restored when the input starts. When empty the cursor is only kept in memory.").
+			Default(""),
+		service.NewStringField(ssiFieldIncCacheKey).
+			Description("The key under which the cursor is stored within the cache.").
+			Default(ssiDefaultIncrementalCacheKey),
+		service.NewIntField(ssiFieldIncCheckpointLimit).
+			Description("The maximum number of rows that can be pending acknowledgement at any given time. The stored cursor is only advanced once all prior rows have been acknowledged.").
+			Default(1024).
+			Advanced(),
+	).
+		Description(`
+When set the input runs indefinitely, repeatedly selecting rows with a cursor column value greater than that of the last row read using keyset pagination, and waiting for ` + "`interval`" + ` whenever all existing rows have been read. The cursor of the last row acknowledged in order is persisted to a cache resource so that the input resumes where it left off after a restart.
+
+The cursor column should only be populated with values that increase in commit order, as rows committed with a lower value than rows already read are not selected.`).
+		Optional()
+}
+
+// sqlCursor is the position of a row within the keyset of a table.
+type sqlCursor struct {
+	Value      any `json:"value"`
+	Tiebreaker any `json:"tiebreaker,omitempty"`
+
+	seq int64
+}
+
+type sqlIncrementalConfig struct {
+	cursorColumn     string
+	tiebreakerColumn string
+	initialValue     *string
+	pageSize         int
+	interval         time.Duration
+}
+
+func incrementalConfigFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (*sqlIncrementalConfig, *sqlCursorStore, error) {
+	conf = conf.Namespace(ssiFieldIncremental)
+
+	c := &sqlIncrementalConfig{}
+	var err error
+	if c.cursorColumn, err = conf.FieldString(ssiFieldIncCursorColumn); err != nil {
+		return nil, nil, err
+	}
+	if c.tiebreakerColumn, err = conf.FieldString(ssiFieldIncTiebreakerColumn); err != nil {
+		return nil, nil, err
+	}
+	if conf.Contains(ssiFieldIncInitialValue) {
+		initialValue, err := conf.FieldString(ssiFieldIncInitialValue)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.initialValue = &initialValue
+	}
+	if c.pageSize, err = conf.FieldInt(ssiFieldIncPageSize); err != nil {
+		return nil, nil, err
+	}
+	if c.pageSize < 1 {
+		return nil, nil, fmt.Errorf("page size must be at least 1, got %v", c.pageSize)
+	}
+	if c.interval, err = conf.FieldDuration(ssiFieldIncInterval); err != nil {
+		return nil, nil, err
+	}
+
+	cache, err := conf.FieldString(ssiFieldIncCache)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cache != "" && !mgr.HasCache(cache) {
+		return nil, nil, fmt.Errorf("cache resource '%v' was not found", cache)
+	}
+	cacheKey, err := conf.FieldString(ssiFieldIncCacheKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	limit, err := conf.FieldInt(ssiFieldIncCheckpointLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	if limit < 1 {
+		return nil, nil, fmt.Errorf("checkpoint limit must be at least 1, got %v", limit)
+	}
+	return c, newSQLCursorStore(mgr, cache, cacheKey, int64(limit)), nil
+}
+
+// selectColumns returns the columns to select, including the cursor and
+// tiebreaker columns when they are not already selected.
+func (c *sqlIncrementalConfig) selectColumns(columns []string) []string {
+	return ensureColumns(columns, c.cursorColumn, c.tiebreakerColumn)
+}
+
+// pageQuery adds the conditions, ordering and limit for selecting the page of
+// rows following the given cursor to a select builder.
+func (c *sqlIncrementalConfig) pageQuery(driver string, builder squirrel.SelectBuilder, after *sqlCursor) squirrel.SelectBuilder {
+	builder = builder.Where(c.cursorColumn + " IS NOT NULL")
+	if after != nil {
+		if c.tiebreakerColumn == "" {
+			builder = builder.Where(c.cursorColumn+" > ?", after.Value)
+		} else {
+			builder = builder.Where(
+				"("+c.cursorColumn+" > ? OR ("+c.cursorColumn+" = ? AND "+c.tiebreakerColumn+" > ?))",
+				after.Value, after.Value, after.Tiebreaker,
+			)
+		}
+	}
+
+	if c.tiebreakerColumn == "" {
+		builder = builder.OrderBy(c.cursorColumn + " ASC")
+	} else {
+		builder = builder.OrderBy(c.cursorColumn+" ASC", c.tiebreakerColumn+" ASC")
+	}
+
+	switch driver {
+	case "mssql":
+		builder = builder.Suffix(fmt.Sprintf("OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", c.pageSize))
+	case "oracle":
+		builder = builder.Suffix(fmt.Sprintf("FETCH FIRST %d ROWS ONLY", c.pageSize))
+	default:
+		builder = builder.Limit(uint64(c.pageSize))
+	}
+	return builder
+}
+
+// rowCursor extracts the cursor of a row.
+func (c *sqlIncrementalConfig) rowCursor(row map[string]any) (sqlCursor, error) {
+	var cursor sqlCursor
+	var exists bool
+	if cursor.Value, exists = lookupColumn(row, c.cursorColumn); !exists || cursor.Value == nil {
+		return cursor, fmt.Errorf("row does not contain a value for cursor column %v", c.cursorColumn)
+	}
+	if c.tiebreakerColumn != "" {
+		if cursor.Tiebreaker, exists = lookupColumn(row, c.tiebreakerColumn); !exists || cursor.Tiebreaker == nil {
+			return cursor, fmt.Errorf("row does not contain a value for tiebreaker column %v", c.tiebreakerColumn)
+		}
+	}
+	return cursor, nil
+}
+
+//------------------------------------------------------------------------------
+
+// sqlCursorStore tracks the cursors of rows that have been dispatched and
+// persists the cursor of the last row acknowledged in order to a cache
+// resource.
+type sqlCursorStore struct {
+	mgr      *service.Resources
+	cache    string
+	cacheKey string
+
+	tracker *checkpoint.Capped[sqlCursor]
+
+	mut       sync.Mutex
+	seq       int64
+	committed *sqlCursor
+}
+
+func newSQLCursorStore(mgr *service.Resources, cache, cacheKey string, limit int64) *sqlCursorStore {
+	return &sqlCursorStore{
+		mgr:      mgr,
+		cache:    cache,
+		cacheKey: cacheKey,
+		tracker:  checkpoint.NewCapped[sqlCursor](limit),
+	}
+}
+
+// Track the cursor of a dispatched row, the returned func must be called once
+// the row is acknowledged and returns the latest cursor that can be
+// committed, or nil if there isn't one.
+func (s *sqlCursorStore) Track(ctx context.Context, cursor sqlCursor) (func() *sqlCursor, error) {
+	s.mut.Lock()
+	s.seq++
+	cursor.seq = s.seq
+	s.mut.Unlock()
+	return s.tracker.Track(ctx, cursor, 1)
+}
+
+// Commit a tracked cursor, persisting it to the cache resource when one is
+// configured. Cursors older than the last committed cursor are ignored.
+func (s *sqlCursorStore) Commit(ctx context.Context, cursor *sqlCursor) error {
+	if cursor == nil {
+		return nil
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.committed != nil && s.committed.seq >= cursor.seq {
+		return nil
+	}
+	s.committed = cursor
+
+	if s.cache == "" {
+		return nil
+	}
+
+	cursorBytes, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+
+	var setErr error
+	if err := s.mgr.AccessCache(ctx, s.cache, func(c service.Cache) {
+		setErr = c.Set(ctx, s.cacheKey, cursorBytes, nil)
+	}); err != nil {
+		return err
+	}
+	return setErr
+}
+
+// Get the stored cursor from the cache resource, or nil when none exists.
+func (s *sqlCursorStore) Get(ctx context.Context) (*sqlCursor, error) {
+	if s.cache == "" {
+		return nil, nil
+	}
+
+	var cursorBytes []byte
+	var cacheErr error
+	if err := s.mgr.AccessCache(ctx, s.cache, func(c service.Cache) {
+		cursorBytes, cacheErr = c.Get(ctx, s.cacheKey)
+	}); err != nil {
+		return nil, err
+	}
+	if errors.Is(cacheErr, service.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if cacheErr != nil {
+		return nil, cacheErr
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(cursorBytes))
+	dec.UseNumber()
+
+	var cursor sqlCursor
+	if err := dec.Decode(&cursor); err != nil {
+		return nil, fmt.Errorf("failed to parse stored cursor %q: %w", cursorBytes, err)
+	}
+	if cursor.Value == nil {
+		return nil, fmt.Errorf("stored cursor %q has no value", cursorBytes)
+	}
+	cursor.Value = cursorArg(cursor.Value)
+	cursor.Tiebreaker = cursorArg(cursor.Tiebreaker)
+	return &cursor, nil
+}
+
+// cursorArg converts a decoded cursor value into a query argument, numbers are
+// kept as integers where possible in order to preserve their precision.
+func cursorArg(v any) any {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+//------------------------------------------------------------------------------
+
+// readIncremental reads the next row in incremental mode, running a query for
+// the next page of rows when the current page has been exhausted.
+func (s *sqlSelectInput) readIncremental(ctx context.Context) (*service.Message, service.AckFunc, error) {
+	for {
+		s.dbMut.Lock()
+		if s.db == nil {
+			s.dbMut.Unlock()
+			return nil, nil, service.ErrNotConnected
+		}
+
+		if s.rows == nil {
+			if wait := time.Until(s.nextQuery); wait > 0 {
+				s.dbMut.Unlock()
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return nil, nil, ctx.Err()
+				case <-s.shutSig.CloseAtLeisureChan():
+					return nil, nil, service.ErrEndOfInput
+				}
+				continue
+			}
+
+			rows, err := s.queryPage(ctx)
+			if err != nil {
+				s.nextQuery = time.Now().Add(s.incremental.interval)
+				s.dbMut.Unlock()
+				return nil, nil, err
+			}
+			s.rows, s.pageRows = rows, 0
+		}
+
+		if !s.rows.Next() {
+			err := s.rows.Err()
+			_ = s.rows.Close()
+			s.rows = nil
+			if s.pageRows < s.incremental.pageSize {
+				s.nextQuery = time.Now().Add(s.incremental.interval)
+			}
+			s.dbMut.Unlock()
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		obj, err := sqlRowToMap(s.rows)
+		if err == nil {
+			var cursor sqlCursor
+			if cursor, err = s.incremental.rowCursor(obj); err == nil {
+				s.pageRows++
+				s.lastRead = &cursor
+				s.dbMut.Unlock()
+
+				release, err := s.cursors.Track(ctx, cursor)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				msg := service.NewMessage(nil)
+				msg.SetStructuredMut(obj)
+				return msg, func(ctx context.Context, err error) error {
+					if err != nil {
+						return nil
+					}
+					return s.cursors.Commit(ctx, release())
+				}, nil
+			}
+		}
+		_ = s.rows.Close()
+		s.rows = nil
+		s.dbMut.Unlock()
+		return nil, nil, err
+	}
+}
+
+func (s *sqlSelectInput) queryPage(ctx context.Context) (*sql.Rows, error) {
+	args, err := s.whereArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	queryBuilder := s.builder
+	if s.where != "" {
+		queryBuilder = queryBuilder.Where("("+s.where+")", args...)
+	}
+	queryBuilder = s.incremental.pageQuery(s.driver, queryBuilder, s.lastRead)
+	for _, suffix := range s.suffixes {
+		queryBuilder = queryBuilder.Suffix(suffix)
+	}
+	return queryBuilder.RunWith(s.db).QueryContext(ctx)
+}
@@ -0,0 +1,428 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	ssiFieldPartition       = "partition"
+	ssiFieldPartitionColumn = "column"
+	ssiFieldPartitionCount  = "count"
+	ssiFieldPartitionMin    = "min"
+	ssiFieldPartitionMax    = "max"
+)
+
+func partitionSelectField() *service.ConfigField {
+	return service.NewObjectField(ssiFieldPartition,
+		service.NewStringField(ssiFieldPartitionColumn).
+			Description("A numeric or timestamp column by which rows are split into ranges. The column should be indexed, as each range is selected in order of the column.").
+			Example("id").
+			Example("created_at"),
+		service.NewIntField(ssiFieldPartitionCount).
+			Description("The number of ranges to split the rows into, each of which is selected concurrently with its own query.").
+			Default(4),
+		service.NewStringField(ssiFieldPartitionMin).
+			Description("An optional lower bound of the column, when not set the minimum value of the column is queried.").
+			Optional(),
+		service.NewStringField(ssiFieldPartitionMax).
+			Description("An optional upper bound of the column, when not set the maximum value of the column is queried.").
+			Optional(),
+	).
+		Description(`
+When set the rows selected are split into ` + "`count`" + ` ranges of equal width between the minimum and maximum values of a column, which are selected concurrently and merged into the stream in no particular order. Rows with a null value in the column are not selected. Each message contains the index of its range within the metadata field ` + "`partition`" + `, and the metrics ` + "`sql_select_partition_rows`" + ` (labelled by ` + "`partition`" + `) and ` + "`sql_select_partitions_remaining`" + ` report the progress of the ranges.
+
+When the query of a range fails it is retried from the value of the column of the last row read, in which case rows sharing that value are selected again.`).
+		Optional()
+}
+
+type sqlPartitionConfig struct {
+	column   string
+	count    int
+	min, max *string
+}
+
+func partitionConfigFromParsed(conf *service.ParsedConfig) (*sqlPartitionConfig, error) {
+	conf = conf.Namespace(ssiFieldPartition)
+
+	p := &sqlPartitionConfig{}
+	var err error
+	if p.column, err = conf.FieldString(ssiFieldPartitionColumn); err != nil {
+		return nil, err
+	}
+	if p.count, err = conf.FieldInt(ssiFieldPartitionCount); err != nil {
+		return nil, err
+	}
+	if p.count < 1 {
+		return nil, fmt.Errorf("partition count must be at least 1, got %v", p.count)
+	}
+	for _, bound := range []struct {
+		field string
+		dst   **string
+	}{
+		{ssiFieldPartitionMin, &p.min},
+		{ssiFieldPartitionMax, &p.max},
+	} {
+		if conf.Contains(bound.field) {
+			v, err := conf.FieldString(bound.field)
+			if err != nil {
+				return nil, err
+			}
+			*bound.dst = &v
+		}
+	}
+	return p, nil
+}
+
+// sqlPartitionRange is a range of values of the partition column, where the
+// upper bound is exclusive except for the last range.
+type sqlPartitionRange struct {
+	index        int
+	lower, upper any
+	last         bool
+}
+
+var partitionTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// partitionValue converts a bound of the partition column into an int64,
+// float64 or time.Time.
+func partitionValue(v any) (any, error) {
+	switch t := v.(type) {
+	case int:
+		return int64(t), nil
+	case int8:
+		return int64(t), nil
+	case int16:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case uint8:
+		return int64(t), nil
+	case uint16:
+		return int64(t), nil
+	case uint32:
+		return int64(t), nil
+	case uint64:
+		return int64(t), nil
+	case float32:
+		return float64(t), nil
+	case float64:
+		return t, nil
+	case time.Time:
+		return t, nil
+	case []byte:
+		return partitionValue(string(t))
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return f, nil
+		}
+		for _, layout := range partitionTimeLayouts {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("partition bound %v of type %T is not a number or timestamp", v, v)
+}
+
+// partitionRanges splits the values between bounds into ranges of equal width.
+func partitionRanges(minV, maxV any, count int) ([]sqlPartitionRange, error) {
+	lower, err := partitionValue(minV)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := partitionValue(maxV)
+	if err != nil {
+		return nil, err
+	}
+
+	// Integer and floating point bounds are both treated as floating point.
+	switch l := lower.(type) {
+	case int64:
+		if _, isFloat := upper.(float64); isFloat {
+			lower = float64(l)
+		}
+	case float64:
+		if u, isInt := upper.(int64); isInt {
+			upper = float64(u)
+		}
+	}
+
+	var boundary func(i int) any
+	switch l := lower.(type) {
+	case int64:
+		u, ok := upper.(int64)
+		if !ok {
+			return nil, fmt.Errorf("partition bounds %v and %v are of different types", minV, maxV)
+		}
+		span := uint64(u - l)
+		boundary = func(i int) any {
+			n := uint64(count)
+			return l + int64(span/n*uint64(i)+span%n*uint64(i)/n)
+		}
+	case float64:
+		u, ok := upper.(float64)
+		if !ok {
+			return nil, fmt.Errorf("partition bounds %v and %v are of different types", minV, maxV)
+		}
+		boundary = func(i int) any {
+			return l + (u-l)*float64(i)/float64(count)
+		}
+	case time.Time:
+		u, ok := upper.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("partition bounds %v and %v are of different types", minV, maxV)
+		}
+		span := u.Sub(l)
+		boundary = func(i int) any {
+			return l.Add(time.Duration(int64(span) / int64(count) * int64(i)))
+		}
+	}
+
+	ranges := make([]sqlPartitionRange, count)
+	for i := range ranges {
+		ranges[i] = sqlPartitionRange{
+			index: i,
+			lower: boundary(i),
+			upper: boundary(i + 1),
+			last:  i == count-1,
+		}
+	}
+	ranges[0].lower = lower
+	ranges[count-1].upper = upper
+	return ranges, nil
+}
+
+//------------------------------------------------------------------------------
+
+type partitionedRow struct {
+	partition int
+	row       map[string]any
+}
+
+// discoverPartitions resolves the ranges of partitions, querying the minimum
+// and maximum values of the partition column when they are not configured.
+func (s *sqlSelectInput) discoverPartitions(ctx context.Context, db *sql.DB) ([]sqlPartitionRange, error) {
+	var minV, maxV any
+	if s.partition.min != nil {
+		minV = *s.partition.min
+	}
+	if s.partition.max != nil {
+		maxV = *s.partition.max
+	}
+
+	if minV == nil || maxV == nil {
+		args, err := s.whereArgs()
+		if err != nil {
+			return nil, err
+		}
+		queryBuilder := s.boundsBuilder
+		if s.where != "" {
+			queryBuilder = queryBuilder.Where(s.where, args...)
+		}
+		var queriedMin, queriedMax any
+		if err := queryBuilder.RunWith(db).QueryRowContext(ctx).Scan(&queriedMin, &queriedMax); err != nil {
+			return nil, fmt.Errorf("failed to query bounds of partition column: %w", err)
+		}
+		if minV == nil {
+			minV = queriedMin
+		}
+		if maxV == nil {
+			maxV = queriedMax
+		}
+	}
+	if minV == nil || maxV == nil {
+		// The table contains no rows to partition.
+		return nil, nil
+	}
+	return partitionRanges(minV, maxV, s.partition.count)
+}
+
+func (s *sqlSelectInput) startPartitions(db *sql.DB, ranges []sqlPartitionRange) {
+	rowsCounter := s.metrics.NewCounter("sql_select_partition_rows", "partition")
+	remainingGauge := s.metrics.NewGauge("sql_select_partitions_remaining")
+
+	s.partitionRows = make(chan partitionedRow)
+
+	var remainingMut sync.Mutex
+	remaining := len(ranges)
+	remainingGauge.Set(int64(remaining))
+
+	ctx, done := s.shutSig.CloseNowCtx(context.Background())
+	for _, r := range ranges {
+		r := r
+		s.partitionsWG.Add(1)
+		go func() {
+			defer s.partitionsWG.Done()
+
+			read := s.readPartition(ctx, db, r, func() {
+				rowsCounter.Incr(1, strconv.Itoa(r.index))
+			})
+			if ctx.Err() != nil {
+				return
+			}
+
+			remainingMut.Lock()
+			remaining--
+			remainingGauge.Set(int64(remaining))
+			remainingMut.Unlock()
+			s.logger.Infof("Finished reading partition %v of %v with %v rows", r.index+1, len(ranges), read)
+		}()
+	}
+
+	go func() {
+		s.partitionsWG.Wait()
+		done()
+		close(s.partitionRows)
+	}()
+}
+
+// readPartition sends the rows of a range, retrying from the last row read
+// when the query fails, and returns the number of rows read.
+func (s *sqlSelectInput) readPartition(ctx context.Context, db *sql.DB, r sqlPartitionRange, onRow func()) (read int) {
+	lower := r.lower
+	for {
+		err := s.queryPartition(ctx, db, r, lower, func(row map[string]any) error {
+			v, _ := lookupColumn(row, s.partition.column)
+			select {
+			case s.partitionRows <- partitionedRow{partition: r.index, row: row}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if v != nil {
+				lower = v
+			}
+			read++
+			onRow()
+			return nil
+		})
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		s.logger.Errorf("Failed to read partition %v, retrying from %v: %v", r.index+1, lower, err)
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *sqlSelectInput) queryPartition(ctx context.Context, db *sql.DB, r sqlPartitionRange, lower any, fn func(row map[string]any) error) error {
+	args, err := s.whereArgs()
+	if err != nil {
+		return err
+	}
+
+	column := s.partition.column
+	queryBuilder := s.builder
+	if s.where != "" {
+		queryBuilder = queryBuilder.Where("("+s.where+")", args...)
+	}
+	queryBuilder = queryBuilder.Where(column+" >= ?", lower)
+	if r.last {
+		queryBuilder = queryBuilder.Where(column+" <= ?", r.upper)
+	} else {
+		queryBuilder = queryBuilder.Where(column+" < ?", r.upper)
+	}
+	queryBuilder = queryBuilder.OrderBy(column + " ASC")
+	for _, suffix := range s.suffixes {
+		queryBuilder = queryBuilder.Suffix(suffix)
+	}
+
+	rows, err := queryBuilder.RunWith(db).QueryContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := sqlRowToMap(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqlSelectInput) readPartitioned(ctx context.Context) (*service.Message, service.AckFunc, error) {
+	s.dbMut.Lock()
+	partitionRows := s.partitionRows
+	s.dbMut.Unlock()
+	if partitionRows == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	var pRow partitionedRow
+	var open bool
+	select {
+	case pRow, open = <-partitionRows:
+		if !open {
+			return nil, nil, service.ErrEndOfInput
+		}
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	msg := service.NewMessage(nil)
+	msg.SetStructuredMut(pRow.row)
+	msg.MetaSet("partition", strconv.Itoa(pRow.partition))
+	return msg, func(ctx context.Context, err error) error {
+		return nil
+	}, nil
+}
+
+// ensureColumns adds columns to a list of columns to select when they are not
+// already selected.
+func ensureColumns(columns []string, names ...string) []string {
+	has := func(name string) bool {
+		for _, col := range columns {
+			if col == "*" || strings.EqualFold(col, name) {
+				return true
+			}
+		}
+		return false
+	}
+	result := append([]string(nil), columns...)
+	for _, name := range names {
+		if name != "" && !has(name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// lookupColumn obtains the value of a column from a row, where the names of
+// columns may have been converted to upper or lower case by the driver.
+func lookupColumn(row map[string]any, name string) (any, bool) {
+	if v, exists := row[name]; exists {
+		return v, true
+	}
+	for k, v := range row {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
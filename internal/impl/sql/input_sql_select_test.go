@@ -2,9 +2,18 @@ package sql
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
 
 	"github.com/usedatabrew/benthos/v4/public/service"
 )
@@ -29,3 +38,245 @@ args_mapping: 'root = [ this.id ]'
 	require.NoError(t, err)
 	require.NoError(t, selectInput.Close(context.Background()))
 }
+
+func TestSQLSelectIncrementalPageQuery(t *testing.T) {
+	inc := &sqlIncrementalConfig{
+		cursorColumn:     "updated_at",
+		tiebreakerColumn: "id",
+		pageSize:         10,
+	}
+
+	builder := squirrel.Select(inc.selectColumns([]string{"name"})...).From("things").
+		PlaceholderFormat(squirrel.Dollar).
+		Where("(type = ?)", "a")
+
+	sqlStr, args, err := inc.pageQuery("postgres", builder, nil).ToSql()
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT name, updated_at, id FROM things WHERE (type = $1) AND updated_at IS NOT NULL ORDER BY updated_at ASC, id ASC LIMIT 10", sqlStr)
+	assert.Equal(t, []any{"a"}, args)
+
+	sqlStr, args, err = inc.pageQuery("postgres", builder, &sqlCursor{Value: "2023", Tiebreaker: int64(5)}).ToSql()
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT name, updated_at, id FROM things WHERE (type = $1) AND updated_at IS NOT NULL AND (updated_at > $2 OR (updated_at = $3 AND id > $4)) ORDER BY updated_at ASC, id ASC LIMIT 10", sqlStr)
+	assert.Equal(t, []any{"a", "2023", "2023", int64(5)}, args)
+
+	inc.tiebreakerColumn = ""
+	sqlStr, _, err = inc.pageQuery("mssql", squirrel.Select("*").From("things"), &sqlCursor{Value: int64(1)}).ToSql()
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM things WHERE updated_at IS NOT NULL AND updated_at > ? ORDER BY updated_at ASC OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY", sqlStr)
+}
+
+func TestSQLSelectIncrementalSQLite(t *testing.T) {
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "foo.db") + "?_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE things (id integer primary key, name varchar(50), version integer)`)
+	require.NoError(t, err)
+
+	insert := func(id, version int) {
+		t.Helper()
+		_, err := db.Exec(`INSERT INTO things (id, name, version) VALUES (?, ?, ?)`, id, fmt.Sprintf("thing %d", id), version)
+		require.NoError(t, err)
+	}
+	for i := 1; i <= 5; i++ {
+		insert(i, i/2)
+	}
+
+	conf := fmt.Sprintf(`
+driver: sqlite
+dsn: %v
+table: things
+columns: [ name ]
+incremental:
+  cursor_column: version
+  tiebreaker_column: id
+  page_size: 2
+  interval: 10ms
+  cache: foo
+`, dsn)
+
+	spec := sqlSelectInputConfig()
+	parsed, err := spec.ParseYAML(conf, service.NewEnvironment())
+	require.NoError(t, err)
+
+	mgr := service.MockResources(service.MockResourcesOptAddCache("foo"))
+
+	readNames := func(input *sqlSelectInput, n int) (names []string) {
+		t.Helper()
+		for len(names) < n {
+			msg, ackFn, err := input.Read(tCtx)
+			require.NoError(t, err)
+
+			v, err := msg.AsStructured()
+			require.NoError(t, err)
+			names = append(names, v.(map[string]any)["name"].(string))
+			require.NoError(t, ackFn(tCtx, nil))
+		}
+		return
+	}
+
+	input, err := newSQLSelectInputFromConfig(parsed, mgr)
+	require.NoError(t, err)
+	require.NoError(t, input.Connect(tCtx))
+
+	assert.Equal(t, []string{"thing 1", "thing 2", "thing 3", "thing 4", "thing 5"}, readNames(input, 5))
+
+	insert(6, 2)
+	insert(7, 0)
+	insert(8, 3)
+	assert.Equal(t, []string{"thing 6", "thing 8"}, readNames(input, 2))
+	require.NoError(t, input.Close(tCtx))
+
+	// A new input resumes from the cursor stored in the cache.
+	insert(9, 3)
+	input, err = newSQLSelectInputFromConfig(parsed, mgr)
+	require.NoError(t, err)
+	require.NoError(t, input.Connect(tCtx))
+
+	assert.Equal(t, []string{"thing 9"}, readNames(input, 1))
+	require.NoError(t, input.Close(tCtx))
+}
+
+func TestSQLSelectPartitionRanges(t *testing.T) {
+	bounds := func(ranges []sqlPartitionRange) (res [][2]any) {
+		for _, r := range ranges {
+			res = append(res, [2]any{r.lower, r.upper})
+		}
+		return
+	}
+
+	ranges, err := partitionRanges(int64(1), int64(10), 3)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]any{{int64(1), int64(4)}, {int64(4), int64(7)}, {int64(7), int64(10)}}, bounds(ranges))
+	assert.True(t, ranges[2].last)
+	assert.False(t, ranges[1].last)
+
+	ranges, err = partitionRanges("-9223372036854775808", []byte("9223372036854775807"), 2)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]any{
+		{int64(math.MinInt64), int64(-1)},
+		{int64(-1), int64(math.MaxInt64)},
+	}, bounds(ranges))
+
+	ranges, err = partitionRanges(int64(0), 1.0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]any{{0.0, 0.25}, {0.25, 0.5}, {0.5, 0.75}, {0.75, 1.0}}, bounds(ranges))
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	ranges, err = partitionRanges(start, "2023-01-03T00:00:00Z", 2)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]any{
+		{start, start.Add(time.Hour * 24)},
+		{start.Add(time.Hour * 24), start.Add(time.Hour * 48)},
+	}, bounds(ranges))
+
+	_, err = partitionRanges(int64(0), start, 2)
+	require.Error(t, err)
+
+	_, err = partitionRanges("foo", int64(1), 2)
+	require.Error(t, err)
+}
+
+func TestSQLSelectPartitionedSQLite(t *testing.T) {
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "foo.db") + "?_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE things (id integer primary key, name varchar(50))`)
+	require.NoError(t, err)
+	for i := 1; i <= 100; i++ {
+		_, err := db.Exec(`INSERT INTO things (id, name) VALUES (?, ?)`, i, fmt.Sprintf("thing %d", i))
+		require.NoError(t, err)
+	}
+
+	conf := fmt.Sprintf(`
+driver: sqlite
+dsn: %v
+table: things
+columns: [ name ]
+where: id != ?
+args_mapping: 'root = [ 50 ]'
+partition:
+  column: id
+  count: 3
+`, dsn)
+
+	spec := sqlSelectInputConfig()
+	parsed, err := spec.ParseYAML(conf, service.NewEnvironment())
+	require.NoError(t, err)
+
+	input, err := newSQLSelectInputFromConfig(parsed, service.MockResources())
+	require.NoError(t, err)
+	require.NoError(t, input.Connect(tCtx))
+
+	seen := map[string]int{}
+	partitions := map[string]struct{}{}
+	for {
+		msg, ackFn, err := input.Read(tCtx)
+		if errors.Is(err, service.ErrEndOfInput) {
+			break
+		}
+		require.NoError(t, err)
+
+		v, err := msg.AsStructured()
+		require.NoError(t, err)
+		seen[v.(map[string]any)["name"].(string)]++
+
+		p, _ := msg.MetaGet("partition")
+		partitions[p] = struct{}{}
+		require.NoError(t, ackFn(tCtx, nil))
+	}
+	require.NoError(t, input.Close(tCtx))
+
+	assert.Len(t, seen, 99)
+	for i := 1; i <= 100; i++ {
+		name := fmt.Sprintf("thing %d", i)
+		if i == 50 {
+			assert.NotContains(t, seen, name)
+		} else {
+			assert.Equal(t, 1, seen[name], name)
+		}
+	}
+	assert.Equal(t, map[string]struct{}{"0": {}, "1": {}, "2": {}}, partitions)
+}
+
+func TestSQLSelectPartitionedEmptyTable(t *testing.T) {
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "foo.db")
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE things (id integer primary key, name varchar(50))`)
+	require.NoError(t, err)
+
+	spec := sqlSelectInputConfig()
+	parsed, err := spec.ParseYAML(fmt.Sprintf(`
+driver: sqlite
+dsn: %v
+table: things
+columns: [ name ]
+partition:
+  column: id
+`, dsn), service.NewEnvironment())
+	require.NoError(t, err)
+
+	input, err := newSQLSelectInputFromConfig(parsed, service.MockResources())
+	require.NoError(t, err)
+	require.NoError(t, input.Connect(tCtx))
+
+	_, _, err = input.Read(tCtx)
+	assert.ErrorIs(t, err, service.ErrEndOfInput)
+	require.NoError(t, input.Close(tCtx))
+}
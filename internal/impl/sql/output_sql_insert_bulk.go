@@ -0,0 +1,262 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func bulkLoadField() *service.ConfigField {
+	return service.NewBoolField("bulk_load").
+		Description(`Whether to load batches with the bulk loading mechanism of the driver rather than multi-row insert statements, which is significantly faster for large batches. The ` + "`args_mapping`" + ` field is used in the same way and the ` + "`prefix` and `suffix`" + ` fields are not supported. The mechanism used depends on the driver:
+
+| Driver | Mechanism |
+|---|---|
+` + "| `clickhouse` | A native batch prepared from an `INSERT` statement without values. |" + `
+` + "| `mssql` | Bulk copy, which requires the driver to be imported via the sql components package. |" + `
+` + "| `mysql` | `LOAD DATA LOCAL INFILE`, which requires the server variable `local_infile` to be enabled. |" + `
+` + "| `postgres` | `COPY FROM STDIN` with the COPY protocol of the `lib/pq` driver. |" + `
+
+Other drivers do not support bulk loading.`).
+		Default(false).
+		Advanced()
+}
+
+var (
+	mysqlReaderHandlersMut sync.RWMutex
+	mysqlRegisterReader    func(name string, handler func() io.Reader)
+	mysqlDeregisterReader  func(name string)
+	mysqlReaderCounter     atomic.Int64
+
+	mssqlCopyInMut sync.RWMutex
+	mssqlCopyIn    func(table string, columns ...string) string
+)
+
+// SetMySQLReaderHandlers sets the functions of the mysql driver used for
+// registering readers to be streamed by LOAD DATA LOCAL INFILE statements,
+// which are required for bulk loading with the mysql driver. This allows the
+// sql components to be used without importing the driver.
+func SetMySQLReaderHandlers(register func(name string, handler func() io.Reader), deregister func(name string)) {
+	mysqlReaderHandlersMut.Lock()
+	mysqlRegisterReader, mysqlDeregisterReader = register, deregister
+	mysqlReaderHandlersMut.Unlock()
+}
+
+// SetMSSQLCopyIn sets the function of the mssql driver used for generating bulk
+// copy statements, which is required for bulk loading with the mssql driver.
+// This allows the sql components to be used without importing the driver.
+func SetMSSQLCopyIn(copyIn func(table string, columns ...string) string) {
+	mssqlCopyInMut.Lock()
+	mssqlCopyIn = copyIn
+	mssqlCopyInMut.Unlock()
+}
+
+func bulkInserterFromParsed(conf *service.ParsedConfig, driver, table string, columns []string) (*bulkInserter, error) {
+	enabled, err := conf.FieldBool("bulk_load")
+	if err != nil || !enabled {
+		return nil, err
+	}
+	if conf.Contains("prefix") || conf.Contains("suffix") {
+		return nil, errors.New("the prefix and suffix fields can not be used with bulk_load")
+	}
+	return newBulkInserter(driver, table, columns)
+}
+
+// bulkInserter loads batches of rows into a table with the bulk loading
+// mechanism of a driver.
+type bulkInserter struct {
+	driver  string
+	table   string
+	columns []string
+	quoted  bool
+}
+
+func newBulkInserter(driver, table string, columns []string) (*bulkInserter, error) {
+	switch driver {
+	case "clickhouse", "mssql", "mysql", "postgres":
+	default:
+		return nil, fmt.Errorf("bulk loading is not supported by the %v driver", driver)
+	}
+	return &bulkInserter{driver: driver, table: table, columns: columns}, nil
+}
+
+// withQuotedColumns returns a copy of the inserter for a different set of
+// columns, which are quoted as identifiers.
+func (b *bulkInserter) withQuotedColumns(columns []string) *bulkInserter {
+	c := *b
+	c.columns = columns
+	c.quoted = true
+	return &c
+}
+
+func (b *bulkInserter) columnList() string {
+	if b.quoted {
+		return quoteIdentifierList(b.driver, b.columns)
+	}
+	return strings.Join(b.columns, ", ")
+}
+
+func (b *bulkInserter) insert(ctx context.Context, db *sql.DB, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if b.driver == "mysql" {
+		return b.loadData(ctx, db, rows)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := b.copyIn(ctx, tx, rows); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// copyInStatement returns a statement that when prepared within a transaction
+// causes the driver to stream the arguments of each execution to the server,
+// where an execution without arguments flushes the stream.
+//
+// The postgres driver is lib/pq, which streams the arguments of a prepared
+// COPY FROM STDIN statement with the COPY protocol. The COPY support of pgx is
+// only available on its native connections and not through database/sql.
+func (b *bulkInserter) copyInStatement() (string, error) {
+	columnList := b.columnList()
+	switch b.driver {
+	case "postgres":
+		return fmt.Sprintf("COPY %v (%v) FROM STDIN", b.table, columnList), nil
+	case "mssql":
+		mssqlCopyInMut.RLock()
+		copyIn := mssqlCopyIn
+		mssqlCopyInMut.RUnlock()
+		if copyIn == nil {
+			return "", errors.New("bulk loading with the mssql driver requires the driver to be imported via the sql components package")
+		}
+		// The driver matches the names of columns with those of the table and
+		// quotes them itself.
+		return copyIn(b.table, b.columns...), nil
+	}
+	return fmt.Sprintf("INSERT INTO %v (%v)", b.table, columnList), nil
+}
+
+func (b *bulkInserter) copyIn(ctx context.Context, tx *sql.Tx, rows [][]any) error {
+	query, err := b.copyInStatement()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, args := range rows {
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	if b.driver != "clickhouse" {
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bulkInserter) loadData(ctx context.Context, db *sql.DB, rows [][]any) error {
+	mysqlReaderHandlersMut.RLock()
+	register, deregister := mysqlRegisterReader, mysqlDeregisterReader
+	mysqlReaderHandlersMut.RUnlock()
+	if register == nil {
+		return errors.New("bulk loading with the mysql driver requires the driver to be imported via the sql components package")
+	}
+
+	var data bytes.Buffer
+	for _, args := range rows {
+		for i, v := range args {
+			if i > 0 {
+				data.WriteByte('\t')
+			}
+			if err := writeLoadDataValue(&data, v); err != nil {
+				return err
+			}
+		}
+		data.WriteByte('\n')
+	}
+
+	name := "benthos_sql_insert_" + strconv.FormatInt(mysqlReaderCounter.Add(1), 10)
+	register(name, func() io.Reader {
+		return bytes.NewReader(data.Bytes())
+	})
+	defer deregister(name)
+
+	_, err := db.ExecContext(ctx, b.loadDataStatement(name))
+	return err
+}
+
+func (b *bulkInserter) loadDataStatement(readerName string) string {
+	return fmt.Sprintf(
+		"LOAD DATA LOCAL INFILE 'Reader::%v' INTO TABLE %v CHARACTER SET utf8mb4 FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (%v)",
+		readerName, b.table, b.columnList(),
+	)
+}
+
+var loadDataEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\x00", "\\0",
+)
+
+// writeLoadDataValue writes a value in the tab separated format expected by
+// LOAD DATA statements, where nulls are written as \N.
+func writeLoadDataValue(w *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		w.WriteString("\\N")
+	case string:
+		_, _ = loadDataEscaper.WriteString(w, t)
+	case []byte:
+		_, _ = loadDataEscaper.WriteString(w, string(t))
+	case jsonColumn:
+		_, _ = loadDataEscaper.WriteString(w, string(t))
+	case bool:
+		if t {
+			w.WriteByte('1')
+		} else {
+			w.WriteByte('0')
+		}
+	case time.Time:
+		w.WriteString(t.Format("2006-01-02 15:04:05.999999"))
+	case json.Number:
+		w.WriteString(t.String())
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		fmt.Fprintf(w, "%d", t)
+	case float32:
+		w.WriteString(strconv.FormatFloat(float64(t), 'f', -1, 32))
+	case float64:
+		w.WriteString(strconv.FormatFloat(t, 'f', -1, 64))
+	default:
+		jBytes, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Errorf("failed to serialize value of type %T: %w", v, err)
+		}
+		_, _ = loadDataEscaper.WriteString(w, string(jBytes))
+	}
+	return nil
+}
@@ -0,0 +1,490 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+const (
+	asFieldAutoSchema  = "auto_schema"
+	asFieldEnabled     = "enabled"
+	asFieldDryRun      = "dry_run"
+	asFieldColumnTypes = "column_types"
+	asFieldPrimaryKey  = "primary_key"
+)
+
+func autoSchemaField() *service.ConfigField {
+	return service.NewObjectField(asFieldAutoSchema,
+		service.NewBoolField(asFieldEnabled).
+			Description("Whether to create the table when it does not exist and add missing columns to it.").
+			Default(false),
+		service.NewBoolField(asFieldDryRun).
+			Description("When `true` the statements that would be executed in order to create or alter the table are logged but not executed.").
+			Default(false),
+		service.NewStringMapField(asFieldColumnTypes).
+			Description("An optional map of column names to the SQL types used for them, taking precedence over types inferred from the values of the first batch containing the column.").
+			Example(map[string]any{"id": "BIGINT", "created_at": "TIMESTAMP"}).
+			Default(map[string]any{}),
+		service.NewStringListField(asFieldPrimaryKey).
+			Description("An optional list of columns forming the primary key of created tables. For `clickhouse` these are used as the sorting key of the table.").
+			Example([]string{"id"}).
+			Default([]any{}),
+	).
+		Description(`
+Automatically create the target table and evolve its schema as new columns appear. When ` + "`columns`" + ` is omitted each message must be an object, and its fields are inserted as columns of the same name, with nested objects and arrays serialized as JSON.
+
+Before each batch is written the columns of the table are compared with the columns of the batch. When the table does not exist it is created with column types inferred from the values of the batch, and columns missing from the table are added with ` + "`ALTER TABLE`" + `. Added columns are always nullable. Columns are never removed or altered.
+
+Column names are quoted as identifiers in all statements, and a batch containing a field name that can not be used as an identifier, such as an empty name, is rejected. During a dry run nothing is recorded as created, and so the statements are logged for each batch that would change the table.`).
+		Advanced()
+}
+
+// autoSchema creates and alters the table written to by an output so that it
+// contains the columns being inserted.
+type autoSchema struct {
+	driver      string
+	table       string
+	dryRun      bool
+	columnTypes map[string]string
+	primaryKey  []string
+	logger      *service.Logger
+
+	mut sync.Mutex
+
+	// Maps the lower case names of the columns of the table to their names.
+	known map[string]string
+}
+
+func autoSchemaFromParsed(conf *service.ParsedConfig, driver, table string, logger *service.Logger) (*autoSchema, error) {
+	conf = conf.Namespace(asFieldAutoSchema)
+
+	enabled, err := conf.FieldBool(asFieldEnabled)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	if driver == "trino" {
+		return nil, fmt.Errorf("auto schema is not supported by the %v driver", driver)
+	}
+
+	a := &autoSchema{
+		driver: driver,
+		table:  table,
+		logger: logger,
+	}
+	if a.dryRun, err = conf.FieldBool(asFieldDryRun); err != nil {
+		return nil, err
+	}
+	if a.columnTypes, err = conf.FieldStringMap(asFieldColumnTypes); err != nil {
+		return nil, err
+	}
+	if a.primaryKey, err = conf.FieldStringList(asFieldPrimaryKey); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// apply ensures the table exists and contains the given columns, returning
+// the names of the columns as they are known by the table.
+func (a *autoSchema) apply(ctx context.Context, db *sql.DB, columns []string, rows [][]any) ([]string, error) {
+	for _, c := range columns {
+		if err := checkIdentifier(a.driver, c); err != nil {
+			return nil, err
+		}
+	}
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if a.known == nil {
+		existing, err := a.tableColumns(ctx, db)
+		if err != nil {
+			if !isTableNotExistErr(a.driver, err) {
+				return nil, fmt.Errorf("failed to inspect table: %w", err)
+			}
+			if err := a.exec(ctx, db, a.createTableSQL(columns, rows)); err != nil {
+				return nil, fmt.Errorf("failed to create table: %w", err)
+			}
+			// Nothing is created during a dry run, and therefore the table is
+			// inspected again for the next batch.
+			if !a.dryRun {
+				a.known = map[string]string{}
+				for _, c := range columns {
+					a.known[strings.ToLower(c)] = c
+				}
+			}
+			return columns, nil
+		}
+		a.known = map[string]string{}
+		for _, c := range existing {
+			a.known[strings.ToLower(c)] = c
+		}
+	}
+
+	names := make([]string, 0, len(columns))
+	var missing []string
+	for _, c := range columns {
+		if name, exists := a.known[strings.ToLower(c)]; exists {
+			names = append(names, name)
+			continue
+		}
+		names = append(names, c)
+		missing = append(missing, c)
+	}
+	if len(missing) == 0 {
+		return names, nil
+	}
+
+	types := a.columnSQLTypes(columns, rows)
+	for _, c := range missing {
+		if err := a.exec(ctx, db, a.addColumnSQL(c, types[c])); err != nil {
+			return nil, fmt.Errorf("failed to add column %v: %w", c, err)
+		}
+		if !a.dryRun {
+			a.known[strings.ToLower(c)] = c
+		}
+	}
+	return names, nil
+}
+
+func (a *autoSchema) exec(ctx context.Context, db *sql.DB, statement string) error {
+	if a.dryRun {
+		a.logger.Infof("Skipping execution of schema change due to dry run: %v", statement)
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, statement); err != nil {
+		return err
+	}
+	a.logger.Infof("Executed schema change: %v", statement)
+	return nil
+}
+
+func (a *autoSchema) tableColumns(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %v WHERE 1 = 0", a.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// isTableNotExistErr returns true when an error returned by a driver means that
+// a table does not exist, as opposed to being unreachable or inaccessible.
+func isTableNotExistErr(driver string, err error) bool {
+	msg := err.Error()
+	switch driver {
+	case "postgres":
+		return strings.Contains(msg, "relation") && strings.Contains(msg, "does not exist")
+	case "mysql":
+		return strings.Contains(msg, "Error 1146")
+	case "sqlite":
+		return strings.Contains(msg, "no such table")
+	case "mssql":
+		return strings.Contains(msg, "Invalid object name")
+	case "oracle":
+		return strings.Contains(msg, "ORA-00942")
+	case "clickhouse":
+		return strings.Contains(msg, "code: 60,")
+	case "snowflake":
+		return strings.HasPrefix(msg, "002003 ")
+	}
+	return false
+}
+
+func (a *autoSchema) isKey(column string) bool {
+	for _, k := range a.primaryKey {
+		if strings.EqualFold(k, column) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *autoSchema) createTableSQL(columns []string, rows [][]any) string {
+	types := a.columnSQLTypes(columns, rows)
+
+	defs := make([]string, 0, len(columns)+1)
+	for _, c := range columns {
+		def := quoteIdentifier(a.driver, c) + " " + types[c]
+		if a.isKey(c) && a.driver != "clickhouse" {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+	}
+	if len(a.primaryKey) > 0 && a.driver != "clickhouse" {
+		defs = append(defs, "PRIMARY KEY ("+quoteIdentifierList(a.driver, a.primaryKey)+")")
+	}
+
+	statement := fmt.Sprintf("CREATE TABLE %v (%v)", a.table, strings.Join(defs, ", "))
+	if a.driver == "clickhouse" {
+		orderBy := "tuple()"
+		if len(a.primaryKey) > 0 {
+			orderBy = "(" + quoteIdentifierList(a.driver, a.primaryKey) + ")"
+		}
+		statement += " ENGINE = MergeTree ORDER BY " + orderBy
+	}
+	return statement
+}
+
+func (a *autoSchema) addColumnSQL(column, columnType string) string {
+	column = quoteIdentifier(a.driver, column)
+	switch a.driver {
+	case "mssql":
+		return fmt.Sprintf("ALTER TABLE %v ADD %v %v", a.table, column, columnType)
+	case "oracle":
+		return fmt.Sprintf("ALTER TABLE %v ADD (%v %v)", a.table, column, columnType)
+	}
+	return fmt.Sprintf("ALTER TABLE %v ADD COLUMN %v %v", a.table, column, columnType)
+}
+
+//------------------------------------------------------------------------------
+
+// maxIdentifierLengths are the maximum lengths of identifiers supported by
+// drivers, in bytes for postgres and characters otherwise.
+var maxIdentifierLengths = map[string]int{
+	"postgres":  63,
+	"mysql":     64,
+	"mssql":     128,
+	"oracle":    128,
+	"snowflake": 255,
+}
+
+// checkIdentifier returns an error when a column name can not be used as an
+// identifier by a driver, even when quoted.
+func checkIdentifier(driver, name string) error {
+	if name == "" {
+		return errors.New("column names must not be empty")
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("column name %q is not valid UTF-8", name)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("column name %q must not contain control characters", name)
+		}
+	}
+	if driver == "oracle" && strings.Contains(name, `"`) {
+		return fmt.Errorf("column name %q must not contain double quotes", name)
+	}
+	length := utf8.RuneCountInString(name)
+	if driver == "postgres" {
+		length = len(name)
+	}
+	if maxLength, exists := maxIdentifierLengths[driver]; exists && length > maxLength {
+		return fmt.Errorf("column name %q exceeds the maximum length of %v", name, maxLength)
+	}
+	return nil
+}
+
+// quoteIdentifier quotes an identifier with the quoting rules of a driver.
+func quoteIdentifier(driver, name string) string {
+	switch driver {
+	case "mysql":
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	case "mssql":
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+	case "clickhouse":
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdentifiers(driver string, names []string) []string {
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		quoted = append(quoted, quoteIdentifier(driver, n))
+	}
+	return quoted
+}
+
+func quoteIdentifierList(driver string, names []string) string {
+	return strings.Join(quoteIdentifiers(driver, names), ", ")
+}
+
+//------------------------------------------------------------------------------
+
+type valueKind int
+
+const (
+	kindNull valueKind = iota
+	kindBool
+	kindInt
+	kindFloat
+	kindTime
+	kindBytes
+	kindString
+	kindJSON
+)
+
+func kindOf(v any) valueKind {
+	switch t := v.(type) {
+	case nil:
+		return kindNull
+	case bool:
+		return kindBool
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return kindInt
+	case float32, float64:
+		return kindFloat
+	case json.Number:
+		if _, err := t.Int64(); err == nil {
+			return kindInt
+		}
+		return kindFloat
+	case time.Time:
+		return kindTime
+	case []byte:
+		return kindBytes
+	case string:
+		return kindString
+	case map[string]any, []any, jsonColumn:
+		return kindJSON
+	}
+	return kindString
+}
+
+func mergeKinds(a, b valueKind) valueKind {
+	switch {
+	case a == b:
+		return a
+	case a == kindNull:
+		return b
+	case b == kindNull:
+		return a
+	case (a == kindInt && b == kindFloat) || (a == kindFloat && b == kindInt):
+		return kindFloat
+	}
+	return kindString
+}
+
+// columnSQLTypes resolves the SQL types of columns from the configured types,
+// or otherwise from the values of the rows.
+func (a *autoSchema) columnSQLTypes(columns []string, rows [][]any) map[string]string {
+	types := make(map[string]string, len(columns))
+	for i, c := range columns {
+		if t, exists := a.columnTypes[c]; exists {
+			types[c] = t
+			continue
+		}
+		kind := kindNull
+		for _, row := range rows {
+			if i < len(row) {
+				kind = mergeKinds(kind, kindOf(row[i]))
+			}
+		}
+		types[c] = a.sqlType(kind, a.isKey(c))
+	}
+	return types
+}
+
+func (a *autoSchema) sqlType(kind valueKind, key bool) string {
+	switch a.driver {
+	case "postgres":
+		return [...]string{"TEXT", "BOOLEAN", "BIGINT", "DOUBLE PRECISION", "TIMESTAMPTZ", "BYTEA", "TEXT", "JSONB"}[kind]
+	case "mysql":
+		if key && (kind == kindString || kind == kindNull) {
+			return "VARCHAR(255)"
+		}
+		return [...]string{"TEXT", "BOOLEAN", "BIGINT", "DOUBLE", "DATETIME(6)", "LONGBLOB", "TEXT", "JSON"}[kind]
+	case "sqlite":
+		return [...]string{"TEXT", "BOOLEAN", "INTEGER", "REAL", "TIMESTAMP", "BLOB", "TEXT", "TEXT"}[kind]
+	case "mssql":
+		if key && (kind == kindString || kind == kindNull) {
+			return "NVARCHAR(450)"
+		}
+		return [...]string{"NVARCHAR(MAX)", "BIT", "BIGINT", "FLOAT", "DATETIME2", "VARBINARY(MAX)", "NVARCHAR(MAX)", "NVARCHAR(MAX)"}[kind]
+	case "oracle":
+		return [...]string{"VARCHAR2(4000)", "NUMBER(1)", "NUMBER(19)", "BINARY_DOUBLE", "TIMESTAMP", "BLOB", "VARCHAR2(4000)", "CLOB"}[kind]
+	case "clickhouse":
+		t := [...]string{"String", "Bool", "Int64", "Float64", "DateTime64(6)", "String", "String", "String"}[kind]
+		if !key {
+			t = "Nullable(" + t + ")"
+		}
+		return t
+	case "snowflake":
+		return [...]string{"VARCHAR", "BOOLEAN", "NUMBER(38,0)", "DOUBLE", "TIMESTAMP_TZ", "BINARY", "VARCHAR", "VARIANT"}[kind]
+	}
+	return "TEXT"
+}
+
+//------------------------------------------------------------------------------
+
+// structuredRows extracts the columns of a batch from the fields of its
+// messages, which must be objects, along with a row of values for each
+// message where columns missing from a message are null.
+func structuredRows(batch service.MessageBatch) ([]string, [][]any, error) {
+	objs := make([]map[string]any, 0, len(batch))
+	columnSet := map[string]struct{}{}
+	for i, msg := range batch {
+		v, err := msg.AsStructured()
+		if err != nil {
+			return nil, nil, fmt.Errorf("message %v: %w", i, err)
+		}
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("message %v: expected an object, got %T", i, v)
+		}
+		for k := range obj {
+			columnSet[k] = struct{}{}
+		}
+		objs = append(objs, obj)
+	}
+
+	columns := make([]string, 0, len(columnSet))
+	for c := range columnSet {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+
+	rows := make([][]any, 0, len(objs))
+	for _, obj := range objs {
+		row := make([]any, len(columns))
+		for i, c := range columns {
+			row[i] = columnValue(obj[c])
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// columnValue converts a structured value into an argument accepted by sql
+// drivers.
+func columnValue(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return t.String()
+	case map[string]any, []any:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return nil
+		}
+		return jsonColumn(b)
+	}
+	return v
+}
+
+// jsonColumn is a nested object or array serialized as JSON, which is
+// distinguished from strings when inferring column types.
+type jsonColumn string
+
+// Value implements driver.Valuer.
+func (j jsonColumn) Value() (driver.Value, error) {
+	return string(j), nil
+}
@@ -1,9 +1,18 @@
 package sql
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/usedatabrew/benthos/v4/public/service"
@@ -28,3 +37,360 @@ args_mapping: 'root = [ this.id ]'
 	require.NoError(t, err)
 	require.NoError(t, insertOutput.Close(context.Background()))
 }
+
+func TestSQLInsertOutputBulkLoadConfig(t *testing.T) {
+	spec := sqlInsertOutputConfig()
+	env := service.NewEnvironment()
+
+	for _, test := range []struct {
+		conf string
+		err  string
+	}{
+		{
+			conf: `
+driver: postgres
+dsn: woof
+table: quack
+columns: [ foo ]
+args_mapping: 'root = [ this.id ]'
+bulk_load: true
+`,
+		},
+		{
+			conf: `
+driver: sqlite
+dsn: woof
+table: quack
+columns: [ foo ]
+args_mapping: 'root = [ this.id ]'
+bulk_load: true
+`,
+			err: "bulk loading is not supported by the sqlite driver",
+		},
+		{
+			conf: `
+driver: mysql
+dsn: woof
+table: quack
+columns: [ foo ]
+args_mapping: 'root = [ this.id ]'
+suffix: ON DUPLICATE KEY UPDATE foo = foo
+bulk_load: true
+`,
+			err: "can not be used with bulk_load",
+		},
+	} {
+		insertConfig, err := spec.ParseYAML(test.conf, env)
+		require.NoError(t, err)
+
+		insertOutput, err := newSQLInsertOutputFromConfig(insertConfig, service.MockResources())
+		if test.err != "" {
+			require.ErrorContains(t, err, test.err)
+			continue
+		}
+		require.NoError(t, err)
+		require.NotNil(t, insertOutput.bulk)
+		require.NoError(t, insertOutput.Close(context.Background()))
+	}
+}
+
+func TestBulkInserterStatements(t *testing.T) {
+	for driver, exp := range map[string]string{
+		"postgres":   "COPY things (foo, bar) FROM STDIN",
+		"clickhouse": "INSERT INTO things (foo, bar)",
+	} {
+		b, err := newBulkInserter(driver, "things", []string{"foo", "bar"})
+		require.NoError(t, err)
+		stmt, err := b.copyInStatement()
+		require.NoError(t, err)
+		assert.Equal(t, exp, stmt, driver)
+	}
+
+	// The copy in function may have been set by the sql components package.
+	mssqlCopyInMut.RLock()
+	prevCopyIn := mssqlCopyIn
+	mssqlCopyInMut.RUnlock()
+	t.Cleanup(func() {
+		SetMSSQLCopyIn(prevCopyIn)
+	})
+
+	SetMSSQLCopyIn(nil)
+	b, err := newBulkInserter("mssql", "things", []string{"foo", "bar"})
+	require.NoError(t, err)
+	_, err = b.copyInStatement()
+	require.ErrorContains(t, err, "requires the driver to be imported")
+
+	SetMSSQLCopyIn(func(table string, columns ...string) string {
+		return mssql.CopyIn(table, mssql.BulkOptions{}, columns...)
+	})
+	stmt, err := b.copyInStatement()
+	require.NoError(t, err)
+	assert.Equal(t, mssql.CopyIn("things", mssql.BulkOptions{}, "foo", "bar"), stmt)
+
+	b, err = newBulkInserter("mysql", "things", []string{"foo", "bar"})
+	require.NoError(t, err)
+	assert.Equal(t,
+		`LOAD DATA LOCAL INFILE 'Reader::r1' INTO TABLE things CHARACTER SET utf8mb4 FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (foo, bar)`,
+		b.loadDataStatement("r1"))
+}
+
+func TestWriteLoadDataValue(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []any{
+		nil,
+		"tab\there\nnew \\ line",
+		[]byte("bytes"),
+		true,
+		int64(-5),
+		1.5,
+		time.Date(2023, 1, 2, 3, 4, 5, 6000, time.UTC),
+		map[string]any{"a": "b"},
+	} {
+		require.NoError(t, writeLoadDataValue(&buf, v))
+		buf.WriteByte('|')
+	}
+	assert.Equal(t, `\N|tab\there\nnew \\ line|bytes|1|-5|1.5|2023-01-02 03:04:05.000006|{"a":"b"}|`, buf.String())
+}
+
+func TestAutoSchemaStatements(t *testing.T) {
+	columns := []string{"id", "name", "score", "tags", "active"}
+	rows := [][]any{
+		{int64(1), "foo", nil, jsonColumn(`["a"]`), true},
+		{int64(2), nil, 1.5, nil, false},
+	}
+
+	for driver, exp := range map[string][2]string{
+		"postgres": {
+			`CREATE TABLE things ("id" BIGINT NOT NULL, "name" TEXT, "score" DOUBLE PRECISION, "tags" JSONB, "active" BOOLEAN, PRIMARY KEY ("id"))`,
+			`ALTER TABLE things ADD COLUMN "score" DOUBLE PRECISION`,
+		},
+		"mysql": {
+			"CREATE TABLE things (`id` BIGINT NOT NULL, `name` TEXT, `score` DOUBLE, `tags` JSON, `active` BOOLEAN, PRIMARY KEY (`id`))",
+			"ALTER TABLE things ADD COLUMN `score` DOUBLE",
+		},
+		"mssql": {
+			"CREATE TABLE things ([id] BIGINT NOT NULL, [name] NVARCHAR(MAX), [score] FLOAT, [tags] NVARCHAR(MAX), [active] BIT, PRIMARY KEY ([id]))",
+			"ALTER TABLE things ADD [score] FLOAT",
+		},
+		"oracle": {
+			`CREATE TABLE things ("id" NUMBER(19) NOT NULL, "name" VARCHAR2(4000), "score" BINARY_DOUBLE, "tags" CLOB, "active" NUMBER(1), PRIMARY KEY ("id"))`,
+			`ALTER TABLE things ADD ("score" BINARY_DOUBLE)`,
+		},
+		"clickhouse": {
+			`CREATE TABLE things ("id" Int64, "name" Nullable(String), "score" Nullable(Float64), "tags" Nullable(String), "active" Nullable(Bool)) ENGINE = MergeTree ORDER BY ("id")`,
+			`ALTER TABLE things ADD COLUMN "score" Nullable(Float64)`,
+		},
+	} {
+		a := &autoSchema{driver: driver, table: "things", primaryKey: []string{"id"}}
+		assert.Equal(t, exp[0], a.createTableSQL(columns, rows), driver)
+		assert.Equal(t, exp[1], a.addColumnSQL("score", a.columnSQLTypes(columns, rows)["score"]), driver)
+	}
+
+	a := &autoSchema{driver: "mysql", table: "things", primaryKey: []string{"name"}, columnTypes: map[string]string{"id": "INT"}}
+	assert.Equal(t, map[string]string{
+		"id":     "INT",
+		"name":   "VARCHAR(255)",
+		"score":  "DOUBLE",
+		"tags":   "JSON",
+		"active": "BOOLEAN",
+	}, a.columnSQLTypes(columns, rows))
+}
+
+func TestAutoSchemaIdentifiers(t *testing.T) {
+	for driver, exp := range map[string]string{
+		"postgres":   `"a""b"`,
+		"sqlite":     `"a""b"`,
+		"mysql":      "`a\"b`",
+		"mssql":      `[a"b]`,
+		"clickhouse": `"a\"b"`,
+	} {
+		assert.Equal(t, exp, quoteIdentifier(driver, `a"b`), driver)
+	}
+	assert.Equal(t, "`a``b`", quoteIdentifier("mysql", "a`b"))
+	assert.Equal(t, "[a]]b]", quoteIdentifier("mssql", "a]b"))
+	assert.Equal(t, `"a\\b"`, quoteIdentifier("clickhouse", `a\b`))
+
+	a := &autoSchema{driver: "postgres", table: "things"}
+	assert.Equal(t,
+		`CREATE TABLE things ("a"" TEXT); DROP TABLE things; --" TEXT)`,
+		a.createTableSQL([]string{`a" TEXT); DROP TABLE things; --`}, nil))
+
+	for _, name := range []string{"id", "first name", "ünïcödé", `a"b`} {
+		assert.NoError(t, checkIdentifier("postgres", name), name)
+	}
+	for driver, name := range map[string]string{
+		"postgres":  "",
+		"mysql":     "a\x00b",
+		"sqlite":    "a\nb",
+		"mssql":     "\xff",
+		"oracle":    `a"b`,
+		"snowflake": strings.Repeat("a", 256),
+	} {
+		assert.Error(t, checkIdentifier(driver, name), driver)
+	}
+	assert.Error(t, checkIdentifier("postgres", strings.Repeat("ü", 32)))
+}
+
+func TestAutoSchemaTableNotExistErr(t *testing.T) {
+	for driver, msg := range map[string]string{
+		"postgres":   `pq: relation "things" does not exist`,
+		"mysql":      "Error 1146 (42S02): Table 'foo.things' doesn't exist",
+		"sqlite":     "SQL logic error: no such table: things (1)",
+		"mssql":      "mssql: Invalid object name 'things'.",
+		"oracle":     "ORA-00942: table or view does not exist",
+		"clickhouse": "code: 60, message: Table default.things does not exist",
+		"snowflake":  "002003 (42S02): SQL compilation error:\nObject 'THINGS' does not exist or not authorized.",
+	} {
+		assert.True(t, isTableNotExistErr(driver, errors.New(msg)), driver)
+		assert.False(t, isTableNotExistErr(driver, errors.New("permission denied for table things")), driver)
+	}
+}
+
+func TestSQLInsertOutputAutoSchemaSQLite(t *testing.T) {
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "foo.db")
+
+	spec := sqlInsertOutputConfig()
+	insertConfig, err := spec.ParseYAML(fmt.Sprintf(`
+driver: sqlite
+dsn: %v
+table: things
+auto_schema:
+  enabled: true
+  primary_key: [ id ]
+`, dsn), service.NewEnvironment())
+	require.NoError(t, err)
+
+	out, err := newSQLInsertOutputFromConfig(insertConfig, service.MockResources())
+	require.NoError(t, err)
+	require.NoError(t, out.Connect(tCtx))
+	t.Cleanup(func() { _ = out.Close(context.Background()) })
+
+	require.NoError(t, out.WriteBatch(tCtx, service.MessageBatch{
+		service.NewMessage([]byte(`{"id":1,"name":"foo"}`)),
+		service.NewMessage([]byte(`{"id":2,"name":"bar","score":1.5}`)),
+	}))
+	require.NoError(t, out.WriteBatch(tCtx, service.MessageBatch{
+		service.NewMessage([]byte(`{"id":3,"name":"baz","tags":["a","b"],"my \"order\"":"qux"}`)),
+	}))
+	require.ErrorContains(t, out.WriteBatch(tCtx, service.MessageBatch{
+		service.NewMessage([]byte(`{"id":4,"":"empty"}`)),
+	}), "column names must not be empty")
+
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	rows, err := db.QueryContext(tCtx, `SELECT id, name, score, tags, "my ""order""" AS my_order FROM things ORDER BY id`)
+	require.NoError(t, err)
+
+	actual, err := sqlRowsToArray(rows)
+	require.NoError(t, err)
+	assert.Equal(t, []any{
+		map[string]any{"id": int64(1), "name": "foo", "score": nil, "tags": nil, "my_order": nil},
+		map[string]any{"id": int64(2), "name": "bar", "score": 1.5, "tags": nil, "my_order": nil},
+		map[string]any{"id": int64(3), "name": "baz", "score": nil, "tags": `["a","b"]`, "my_order": "qux"},
+	}, actual)
+}
+
+func TestSQLInsertOutputAutoSchemaDryRun(t *testing.T) {
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "foo.db")
+
+	spec := sqlInsertOutputConfig()
+	insertConfig, err := spec.ParseYAML(fmt.Sprintf(`
+driver: sqlite
+dsn: %v
+table: things
+columns: [ id, name ]
+args_mapping: 'root = [ this.id, this.name ]'
+init_statement: CREATE TABLE things (id INTEGER)
+auto_schema:
+  enabled: true
+  dry_run: true
+`, dsn), service.NewEnvironment())
+	require.NoError(t, err)
+
+	out, err := newSQLInsertOutputFromConfig(insertConfig, service.MockResources())
+	require.NoError(t, err)
+	require.NoError(t, out.Connect(tCtx))
+	t.Cleanup(func() { _ = out.Close(context.Background()) })
+
+	err = out.WriteBatch(tCtx, service.MessageBatch{
+		service.NewMessage([]byte(`{"id":1,"name":"foo"}`)),
+	})
+	require.ErrorContains(t, err, "name")
+}
+
+func TestSQLInsertOutputAutoSchemaDryRunCreate(t *testing.T) {
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "foo.db")
+
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	a := &autoSchema{driver: "sqlite", table: "things", dryRun: true, logger: service.MockResources().Logger()}
+	for i := 0; i < 2; i++ {
+		_, err = a.apply(tCtx, db, []string{"id"}, [][]any{{int64(1)}})
+		require.NoError(t, err)
+		assert.Nil(t, a.known)
+	}
+
+	_, err = db.QueryContext(tCtx, `SELECT * FROM things`)
+	require.ErrorContains(t, err, "no such table")
+
+	// Errors other than the table not existing are not followed by an
+	// attempt to create it.
+	a = &autoSchema{driver: "sqlite", table: "things WHERE", logger: service.MockResources().Logger()}
+	_, err = a.apply(tCtx, db, []string{"id"}, [][]any{{int64(1)}})
+	require.ErrorContains(t, err, "failed to inspect table")
+}
+
+func TestSQLInsertOutputColumnsRequired(t *testing.T) {
+	for _, test := range []struct {
+		conf string
+		err  string
+	}{
+		{
+			conf: `
+driver: sqlite
+dsn: woof
+table: quack
+`,
+			err: "columns must be specified",
+		},
+		{
+			conf: `
+driver: sqlite
+dsn: woof
+table: quack
+columns: [ foo ]
+`,
+			err: "args_mapping must be specified",
+		},
+		{
+			conf: `
+driver: sqlite
+dsn: woof
+table: quack
+args_mapping: 'root = [ this.id ]'
+auto_schema:
+  enabled: true
+`,
+			err: "args_mapping can not be used without columns",
+		},
+	} {
+		insertConfig, err := sqlInsertOutputConfig().ParseYAML(test.conf, service.NewEnvironment())
+		require.NoError(t, err)
+
+		_, err = newSQLInsertOutputFromConfig(insertConfig, service.MockResources())
+		require.ErrorContains(t, err, test.err)
+	}
+}
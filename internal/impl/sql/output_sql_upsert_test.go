@@ -0,0 +1,101 @@
+package sql_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos/v4/public/service"
+
+	_ "github.com/usedatabrew/benthos/v4/public/components/pure"
+	_ "github.com/usedatabrew/benthos/v4/public/components/sql"
+)
+
+func TestSQLUpsertOutputSQLite(t *testing.T) {
+	tCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	tmpDir := t.TempDir()
+
+	outputConf := fmt.Sprintf(`
+sql_upsert:
+  driver: sqlite
+  dsn: file:%v/foo.db
+  table: things
+  columns: [ foo, bar ]
+  key_columns: [ foo ]
+  args_mapping: 'root = [ this.foo, this.bar ]'
+  delete_condition: 'root = this.deleted | false'
+  init_statement: |
+    CREATE TABLE IF NOT EXISTS things (
+      foo varchar(50) not null,
+      bar varchar(50),
+      primary key (foo)
+    ) WITHOUT ROWID;
+`, tmpDir)
+
+	streamInBuilder := service.NewStreamBuilder()
+	require.NoError(t, streamInBuilder.SetLoggerYAML(`level: OFF`))
+	require.NoError(t, streamInBuilder.AddOutputYAML(outputConf))
+
+	inFn, err := streamInBuilder.AddBatchProducerFunc()
+	require.NoError(t, err)
+
+	streamIn, err := streamInBuilder.Build()
+	require.NoError(t, err)
+
+	go func() {
+		assert.NoError(t, streamIn.Run(tCtx))
+	}()
+
+	require.NoError(t, inFn(tCtx, service.MessageBatch{
+		service.NewMessage([]byte(`{"foo":"first","bar":"first bar"}`)),
+		service.NewMessage([]byte(`{"foo":"second","bar":"second bar"}`)),
+		service.NewMessage([]byte(`{"foo":"third","bar":"third bar"}`)),
+	}))
+	require.NoError(t, inFn(tCtx, service.MessageBatch{
+		service.NewMessage([]byte(`{"foo":"first","bar":"first bar updated"}`)),
+		service.NewMessage([]byte(`{"foo":"second","deleted":true}`)),
+		service.NewMessage([]byte(`{"foo":"fourth","bar":"fourth bar"}`)),
+		service.NewMessage([]byte(`{"foo":"third","deleted":true}`)),
+		service.NewMessage([]byte(`{"foo":"third","bar":"third bar again"}`)),
+	}))
+
+	require.NoError(t, streamIn.Stop(tCtx))
+
+	inputConf := fmt.Sprintf(`
+sql_select:
+  driver: sqlite
+  dsn: file:%v/foo.db
+  table: things
+  columns: [ foo, bar ]
+  suffix: ORDER BY foo ASC
+`, tmpDir)
+
+	streamOutBuilder := service.NewStreamBuilder()
+	require.NoError(t, streamOutBuilder.SetLoggerYAML(`level: OFF`))
+	require.NoError(t, streamOutBuilder.AddInputYAML(inputConf))
+
+	var msgs []string
+	require.NoError(t, streamOutBuilder.AddConsumerFunc(func(ctx context.Context, m *service.Message) error {
+		bMsg, err := m.AsBytes()
+		require.NoError(t, err)
+		msgs = append(msgs, string(bMsg))
+		return nil
+	}))
+
+	streamOut, err := streamOutBuilder.Build()
+	require.NoError(t, err)
+
+	assert.NoError(t, streamOut.Run(tCtx))
+
+	assert.Equal(t, []string{
+		`{"bar":"first bar updated","foo":"first"}`,
+		`{"bar":"fourth bar","foo":"fourth"}`,
+		`{"bar":"third bar again","foo":"third"}`,
+	}, msgs)
+}
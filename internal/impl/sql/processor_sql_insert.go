@@ -41,7 +41,8 @@ If the insert fails to execute then the message will still remain unchanged and
 			Description("An optional suffix to append to the insert query.").
 			Optional().
 			Advanced().
-			Example("ON CONFLICT (name) DO NOTHING"))
+			Example("ON CONFLICT (name) DO NOTHING")).
+		Field(bulkLoadField())
 
 	for _, f := range connFields() {
 		spec = spec.Field(f)
@@ -90,6 +91,7 @@ type sqlInsertProcessor struct {
 
 	useTxStmt   bool
 	argsMapping *bloblang.Executor
+	bulk        *bulkInserter
 
 	logger  *service.Logger
 	shutSig *shutdown.Signaller
@@ -166,6 +168,10 @@ func NewSQLInsertProcessorFromConfig(conf *service.ParsedConfig, mgr *service.Re
 		s.builder = s.builder.Suffix(suffixStr)
 	}
 
+	if s.bulk, err = bulkInserterFromParsed(conf, driverStr, tableStr, columns); err != nil {
+		return nil, err
+	}
+
 	connSettings, err := connSettingsFromParsed(conf, mgr)
 	if err != nil {
 		return nil, err
@@ -193,6 +199,10 @@ func (s *sqlInsertProcessor) ProcessBatch(ctx context.Context, batch service.Mes
 	s.dbMut.RLock()
 	defer s.dbMut.RUnlock()
 
+	if s.bulk != nil {
+		return s.processBulk(ctx, batch)
+	}
+
 	insertBuilder := s.builder
 
 	var tx *sql.Tx
@@ -213,28 +223,10 @@ func (s *sqlInsertProcessor) ProcessBatch(ctx context.Context, batch service.Mes
 	}
 
 	for i, msg := range batch {
-		var args []any
-		if s.argsMapping != nil {
-			resMsg, err := batch.BloblangQuery(i, s.argsMapping)
-			if err != nil {
-				s.logger.Debugf("Arguments mapping failed: %v", err)
-				msg.SetError(err)
-				continue
-			}
-
-			iargs, err := resMsg.AsStructured()
-			if err != nil {
-				s.logger.Debugf("Mapping returned non-structured result: %v", err)
-				msg.SetError(fmt.Errorf("mapping returned non-structured result: %w", err))
-				continue
-			}
-
-			var ok bool
-			if args, ok = iargs.([]any); !ok {
-				s.logger.Debugf("Mapping returned non-array result: %T", iargs)
-				msg.SetError(fmt.Errorf("mapping returned non-array result: %T", iargs))
-				continue
-			}
+		args, err := s.messageArgs(batch, i)
+		if err != nil {
+			msg.SetError(err)
+			continue
 		}
 
 		if tx == nil {
@@ -257,6 +249,51 @@ func (s *sqlInsertProcessor) ProcessBatch(ctx context.Context, batch service.Mes
 	return []service.MessageBatch{batch}, nil
 }
 
+// messageArgs executes the arguments mapping against a message of a batch,
+// returning the resulting arguments of the insert.
+func (s *sqlInsertProcessor) messageArgs(batch service.MessageBatch, i int) ([]any, error) {
+	if s.argsMapping == nil {
+		return nil, nil
+	}
+
+	resMsg, err := batch.BloblangQuery(i, s.argsMapping)
+	if err != nil {
+		s.logger.Debugf("Arguments mapping failed: %v", err)
+		return nil, err
+	}
+
+	iargs, err := resMsg.AsStructured()
+	if err != nil {
+		s.logger.Debugf("Mapping returned non-structured result: %v", err)
+		return nil, fmt.Errorf("mapping returned non-structured result: %w", err)
+	}
+
+	args, ok := iargs.([]any)
+	if !ok {
+		s.logger.Debugf("Mapping returned non-array result: %T", iargs)
+		return nil, fmt.Errorf("mapping returned non-array result: %T", iargs)
+	}
+	return args, nil
+}
+
+func (s *sqlInsertProcessor) processBulk(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	rows := make([][]any, 0, len(batch))
+	for i, msg := range batch {
+		args, err := s.messageArgs(batch, i)
+		if err != nil {
+			msg.SetError(err)
+			continue
+		}
+		rows = append(rows, args)
+	}
+
+	if err := s.bulk.insert(ctx, s.db, rows); err != nil {
+		s.logger.Debugf("Failed to run bulk load: %v", err)
+		return nil, err
+	}
+	return []service.MessageBatch{batch}, nil
+}
+
 func (s *sqlInsertProcessor) Close(ctx context.Context) error {
 	s.shutSig.CloseNow()
 	select {
@@ -0,0 +1,151 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/usedatabrew/benthos/v4/internal/shutdown"
+	"github.com/usedatabrew/benthos/v4/public/bloblang"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+// UpsertProcessorConfig returns a config spec for an sql_upsert processor.
+func UpsertProcessorConfig() *service.ConfigSpec {
+	spec := service.NewConfigSpec().
+		Beta().
+		Categories("Integration").
+		Summary("Upserts rows into an SQL database for each message, and leaves the message unchanged.").
+		Description(upsertDescription + `
+
+If the upsert fails to execute then the message will still remain unchanged and the error can be caught using error handling methods outlined [here](/docs/configuration/error_handling).`).
+		Fields(upsertFields()...)
+
+	for _, f := range connFields() {
+		spec = spec.Field(f)
+	}
+
+	spec = spec.Example("Table Upsert (MySQL)",
+		`
+Here we keep a table of the latest state of each user by upserting rows keyed by the user id:`,
+		`
+pipeline:
+  processors:
+    - sql_upsert:
+        driver: mysql
+        dsn: foouser:foopassword@tcp(localhost:3306)/foodb
+        table: users
+        columns: [ id, name, email ]
+        key_columns: [ id ]
+        args_mapping: |
+          root = [
+            this.user.id,
+            this.user.name,
+            this.user.email,
+          ]
+`,
+	)
+	return spec
+}
+
+func init() {
+	err := service.RegisterBatchProcessor(
+		"sql_upsert", UpsertProcessorConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchProcessor, error) {
+			return NewSQLUpsertProcessorFromConfig(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type sqlUpsertProcessor struct {
+	db      *sql.DB
+	builder *upsertBuilder
+	dbMut   sync.RWMutex
+
+	argsMapping     *bloblang.Executor
+	deleteCondition *bloblang.Executor
+
+	logger  *service.Logger
+	shutSig *shutdown.Signaller
+}
+
+// NewSQLUpsertProcessorFromConfig returns an internal sql_upsert processor.
+// nolint:revive // Not bothered as this is internal anyway
+func NewSQLUpsertProcessorFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*sqlUpsertProcessor, error) {
+	s := &sqlUpsertProcessor{
+		logger:  mgr.Logger(),
+		shutSig: shutdown.NewSignaller(),
+	}
+
+	driverStr, err := conf.FieldString("driver")
+	if err != nil {
+		return nil, err
+	}
+
+	dsnStr, err := conf.FieldString("dsn")
+	if err != nil {
+		return nil, err
+	}
+
+	if s.builder, s.argsMapping, s.deleteCondition, err = upsertBuilderFromParsed(conf, driverStr); err != nil {
+		return nil, err
+	}
+
+	connSettings, err := connSettingsFromParsed(conf, mgr)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.db, err = sqlOpenWithReworks(mgr.Logger(), driverStr, dsnStr); err != nil {
+		return nil, err
+	}
+
+	connSettings.apply(context.Background(), s.db, s.logger)
+
+	go func() {
+		<-s.shutSig.CloseNowChan()
+
+		s.dbMut.Lock()
+		_ = s.db.Close()
+		s.dbMut.Unlock()
+
+		s.shutSig.ShutdownComplete()
+	}()
+	return s, nil
+}
+
+func (s *sqlUpsertProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	s.dbMut.RLock()
+	defer s.dbMut.RUnlock()
+
+	ops := make([]upsertOp, 0, len(batch))
+	for i, msg := range batch {
+		op, err := s.builder.opFromMessage(batch, i, s.argsMapping, s.deleteCondition)
+		if err != nil {
+			s.logger.Debugf("Failed to resolve upsert of message: %v", err)
+			msg.SetError(err)
+			continue
+		}
+		ops = append(ops, op)
+	}
+
+	if err := s.builder.exec(ctx, s.db, ops); err != nil {
+		s.logger.Debugf("Failed to run query: %v", err)
+		return nil, err
+	}
+	return []service.MessageBatch{batch}, nil
+}
+
+func (s *sqlUpsertProcessor) Close(ctx context.Context) error {
+	s.shutSig.CloseNow()
+	select {
+	case <-s.shutSig.HasClosedChan():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,430 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/usedatabrew/benthos/v4/public/bloblang"
+	"github.com/usedatabrew/benthos/v4/public/service"
+)
+
+func upsertFields() []*service.ConfigField {
+	return []*service.ConfigField{
+		driverField,
+		dsnField,
+		service.NewStringField("table").
+			Description("The table to upsert to.").
+			Example("foo"),
+		service.NewStringListField("columns").
+			Description("A list of columns to upsert.").
+			Example([]string{"foo", "bar", "baz"}),
+		service.NewStringListField("key_columns").
+			Description("A list of columns that uniquely identify a row, which must be a subset of `columns` and, except for `clickhouse`, covered by a primary key or unique constraint of the table.").
+			Example([]string{"foo"}),
+		service.NewBloblangField("args_mapping").
+			Description("A [Bloblang mapping](/docs/guides/bloblang/about) which should evaluate to an array of values matching in size to the number of columns specified. For deletes only the values of key columns are used.").
+			Example("root = [ this.cat.meow, this.doc.woofs[0] ]").
+			Example(`root = [ meta("user.id") ]`),
+		service.NewBloblangField("delete_condition").
+			Description("An optional [Bloblang mapping](/docs/guides/bloblang/about) which should evaluate to a boolean, when `true` the row identified by the key columns of the message is deleted rather than upserted.").
+			Example(`root = meta("event") == "delete"`).
+			Example(`root = this.op == "d"`).
+			Optional(),
+	}
+}
+
+const upsertDescription = `
+The statement used depends on the driver:
+
+| Driver | Statement |
+|---|---|
+` + "| `clickhouse` | `INSERT`, the table is expected to use a `ReplacingMergeTree` engine sorted by the key columns so that rows sharing a key are replaced during merges, and deletes use lightweight `DELETE` statements |" + `
+` + "| `mysql` | `INSERT ... ON DUPLICATE KEY UPDATE` |" + `
+` + "| `postgres` | `INSERT ... ON CONFLICT DO UPDATE` |" + `
+` + "| `mssql` | `MERGE` |" + `
+` + "| `sqlite` | `INSERT ... ON CONFLICT DO UPDATE` |" + `
+` + "| `oracle` | `MERGE` |" + `
+` + "| `snowflake` | `MERGE` |" + `
+
+The ` + "`trino`" + ` driver is not supported.
+
+When a ` + "`delete_condition`" + ` is configured, messages for which it resolves to ` + "`true`" + ` delete the row matching their key columns instead, which allows change data capture streams to be applied directly to a table. Consecutive upserts and deletes of a batch are grouped into as few statements as possible, and when several messages of a group share a key only the last is applied. With the exception of ` + "`clickhouse`" + ` the statements of a batch are executed within a single transaction.`
+
+// upsertBuilder generates the statements used for upserting and deleting
+// rows with the syntax of a given driver.
+type upsertBuilder struct {
+	driver        string
+	table         string
+	columns       []string
+	keyColumns    []string
+	keyIndexes    []int
+	updateColumns []string
+}
+
+func newUpsertBuilder(driver, table string, columns, keyColumns []string) (*upsertBuilder, error) {
+	if driver == "trino" {
+		return nil, errors.New("upserts are not supported by the trino driver")
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("at least one column must be specified")
+	}
+	if len(keyColumns) == 0 {
+		return nil, errors.New("at least one key column must be specified")
+	}
+
+	u := &upsertBuilder{
+		driver:     driver,
+		table:      table,
+		columns:    columns,
+		keyColumns: keyColumns,
+	}
+
+	isKey := map[string]bool{}
+	for _, k := range keyColumns {
+		index := -1
+		for i, c := range columns {
+			if c == k {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("key column %v is not within the list of columns", k)
+		}
+		isKey[k] = true
+		u.keyIndexes = append(u.keyIndexes, index)
+	}
+	for _, c := range columns {
+		if !isKey[c] {
+			u.updateColumns = append(u.updateColumns, c)
+		}
+	}
+	return u, nil
+}
+
+// maxRows returns the maximum number of rows that can be upserted or deleted
+// by a single statement without exceeding the bind parameter limits of the
+// driver.
+func (u *upsertBuilder) maxRows() int {
+	maxParams := 65535
+	switch u.driver {
+	case "mssql":
+		maxParams = 2000
+	case "sqlite":
+		maxParams = 32766
+	case "oracle":
+		maxParams = 1000
+	}
+	if n := maxParams / len(u.columns); n > 0 {
+		return n
+	}
+	return 1
+}
+
+type placeholders struct {
+	driver string
+	n      int
+}
+
+func (p *placeholders) next() string {
+	p.n++
+	switch p.driver {
+	case "postgres", "clickhouse":
+		return "$" + strconv.Itoa(p.n)
+	case "oracle":
+		return ":" + strconv.Itoa(p.n)
+	}
+	return "?"
+}
+
+func (p *placeholders) tuple(n int) string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = p.next()
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+func prefixed(prefix string, columns []string) string {
+	values := make([]string, len(columns))
+	for i, c := range columns {
+		values[i] = prefix + c
+	}
+	return strings.Join(values, ", ")
+}
+
+func (u *upsertBuilder) keyMatch(left, right string) string {
+	conds := make([]string, len(u.keyColumns))
+	for i, k := range u.keyColumns {
+		conds[i] = left + k + " = " + right + k
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (u *upsertBuilder) updateSet(target string, value func(c string) string) string {
+	sets := make([]string, len(u.updateColumns))
+	for i, c := range u.updateColumns {
+		sets[i] = target + c + " = " + value(c)
+	}
+	return strings.Join(sets, ", ")
+}
+
+// upsertSQL returns a statement that upserts the given number of rows, with
+// placeholders for the values of all columns of each row in order.
+func (u *upsertBuilder) upsertSQL(rows int) string {
+	p := &placeholders{driver: u.driver}
+	columnList := strings.Join(u.columns, ", ")
+
+	valueRows := func() string {
+		tuples := make([]string, rows)
+		for i := range tuples {
+			tuples[i] = p.tuple(len(u.columns))
+		}
+		return strings.Join(tuples, ", ")
+	}
+
+	var b strings.Builder
+	switch u.driver {
+	case "clickhouse":
+		fmt.Fprintf(&b, "INSERT INTO %v (%v) VALUES %v", u.table, columnList, valueRows())
+	case "mysql":
+		fmt.Fprintf(&b, "INSERT INTO %v (%v) VALUES %v ON DUPLICATE KEY UPDATE ", u.table, columnList, valueRows())
+		if len(u.updateColumns) == 0 {
+			fmt.Fprintf(&b, "%v = %v", u.keyColumns[0], u.keyColumns[0])
+		} else {
+			b.WriteString(u.updateSet("", func(c string) string { return "VALUES(" + c + ")" }))
+		}
+	case "postgres", "sqlite":
+		fmt.Fprintf(&b, "INSERT INTO %v (%v) VALUES %v ON CONFLICT (%v) ", u.table, columnList, valueRows(), strings.Join(u.keyColumns, ", "))
+		if len(u.updateColumns) == 0 {
+			b.WriteString("DO NOTHING")
+		} else {
+			b.WriteString("DO UPDATE SET " + u.updateSet("", func(c string) string { return "EXCLUDED." + c }))
+		}
+	case "mssql":
+		fmt.Fprintf(&b, "MERGE INTO %v WITH (HOLDLOCK) AS target USING (VALUES %v) AS source (%v) ON %v",
+			u.table, valueRows(), columnList, u.keyMatch("target.", "source."))
+		u.writeMergeActions(&b)
+		b.WriteString(";")
+	case "oracle":
+		selects := make([]string, rows)
+		for i := range selects {
+			fields := make([]string, len(u.columns))
+			for j, c := range u.columns {
+				fields[j] = p.next() + " " + c
+			}
+			selects[i] = "SELECT " + strings.Join(fields, ", ") + " FROM dual"
+		}
+		fmt.Fprintf(&b, "MERGE INTO %v target USING (%v) source ON (%v)",
+			u.table, strings.Join(selects, " UNION ALL "), u.keyMatch("target.", "source."))
+		u.writeMergeActions(&b)
+	case "snowflake":
+		fields := make([]string, len(u.columns))
+		for i, c := range u.columns {
+			fields[i] = "column" + strconv.Itoa(i+1) + " AS " + c
+		}
+		fmt.Fprintf(&b, "MERGE INTO %v AS target USING (SELECT %v FROM VALUES %v) AS source ON %v",
+			u.table, strings.Join(fields, ", "), valueRows(), u.keyMatch("target.", "source."))
+		u.writeMergeActions(&b)
+	}
+	return b.String()
+}
+
+func (u *upsertBuilder) writeMergeActions(b *strings.Builder) {
+	if len(u.updateColumns) > 0 {
+		b.WriteString(" WHEN MATCHED THEN UPDATE SET ")
+		b.WriteString(u.updateSet("target.", func(c string) string { return "source." + c }))
+	}
+	fmt.Fprintf(b, " WHEN NOT MATCHED THEN INSERT (%v) VALUES (%v)", strings.Join(u.columns, ", "), prefixed("source.", u.columns))
+}
+
+// deleteSQL returns a statement that deletes the given number of rows, with
+// placeholders for the values of the key columns of each row in order.
+func (u *upsertBuilder) deleteSQL(rows int) string {
+	p := &placeholders{driver: u.driver}
+	conds := make([]string, rows)
+	for i := range conds {
+		keyConds := make([]string, len(u.keyColumns))
+		for j, k := range u.keyColumns {
+			keyConds[j] = k + " = " + p.next()
+		}
+		conds[i] = "(" + strings.Join(keyConds, " AND ") + ")"
+	}
+	return fmt.Sprintf("DELETE FROM %v WHERE %v", u.table, strings.Join(conds, " OR "))
+}
+
+//------------------------------------------------------------------------------
+
+// upsertOp is a row to either upsert or delete.
+type upsertOp struct {
+	delete bool
+	args   []any
+}
+
+// opFromMessage resolves the operation of a message of a batch.
+func (u *upsertBuilder) opFromMessage(batch service.MessageBatch, i int, argsMapping, deleteCondition *bloblang.Executor) (upsertOp, error) {
+	var op upsertOp
+	if deleteCondition != nil {
+		resMsg, err := batch.BloblangQuery(i, deleteCondition)
+		if err != nil {
+			return op, fmt.Errorf("delete condition failed: %w", err)
+		}
+		v, err := resMsg.AsStructured()
+		if err != nil {
+			return op, fmt.Errorf("delete condition returned non-structured result: %w", err)
+		}
+		var ok bool
+		if op.delete, ok = v.(bool); !ok {
+			return op, fmt.Errorf("delete condition returned non-boolean result: %T", v)
+		}
+	}
+
+	resMsg, err := batch.BloblangQuery(i, argsMapping)
+	if err != nil {
+		return op, err
+	}
+	iargs, err := resMsg.AsStructured()
+	if err != nil {
+		return op, fmt.Errorf("mapping returned non-structured result: %w", err)
+	}
+	var ok bool
+	if op.args, ok = iargs.([]any); !ok {
+		return op, fmt.Errorf("mapping returned non-array result: %T", iargs)
+	}
+	if len(op.args) != len(u.columns) {
+		return op, fmt.Errorf("mapping returned %v values but %v columns are configured", len(op.args), len(u.columns))
+	}
+	return op, nil
+}
+
+func (u *upsertBuilder) rowKey(args []any) string {
+	var b strings.Builder
+	for _, i := range u.keyIndexes {
+		fmt.Fprintf(&b, "%T:%v\x00", args[i], args[i])
+	}
+	return b.String()
+}
+
+// groupOps splits operations into consecutive groups of either upserts or
+// deletes, where only the last operation of each key within a group is kept.
+func (u *upsertBuilder) groupOps(ops []upsertOp) [][]upsertOp {
+	var groups [][]upsertOp
+	var current []upsertOp
+	var indexes map[string]int
+	for _, op := range ops {
+		if len(current) > 0 && current[0].delete != op.delete {
+			groups = append(groups, current)
+			current = nil
+		}
+		if current == nil {
+			indexes = map[string]int{}
+		}
+		key := u.rowKey(op.args)
+		if i, exists := indexes[key]; exists {
+			current[i] = op
+			continue
+		}
+		indexes[key] = len(current)
+		current = append(current, op)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (u *upsertBuilder) execGroup(ctx context.Context, execer sqlExecer, group []upsertOp) error {
+	for len(group) > 0 {
+		chunk := group
+		if maxRows := u.maxRows(); len(chunk) > maxRows {
+			chunk = chunk[:maxRows]
+		}
+		group = group[len(chunk):]
+
+		var query string
+		var args []any
+		if chunk[0].delete {
+			query = u.deleteSQL(len(chunk))
+			args = make([]any, 0, len(chunk)*len(u.keyIndexes))
+			for _, op := range chunk {
+				for _, i := range u.keyIndexes {
+					args = append(args, op.args[i])
+				}
+			}
+		} else {
+			query = u.upsertSQL(len(chunk))
+			args = make([]any, 0, len(chunk)*len(u.columns))
+			for _, op := range chunk {
+				args = append(args, op.args...)
+			}
+		}
+		if _, err := execer.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec applies operations to the table in order.
+func (u *upsertBuilder) exec(ctx context.Context, db *sql.DB, ops []upsertOp) error {
+	groups := u.groupOps(ops)
+	if len(groups) == 0 {
+		return nil
+	}
+
+	if u.driver == "clickhouse" {
+		// Inserts are batched by the clickhouse driver with prepared statements
+		// within a transaction, which can not contain other statements.
+		for _, group := range groups {
+			if group[0].delete {
+				if err := u.execGroup(ctx, db, group); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := u.execClickhouseInsert(ctx, db, group); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err := u.execGroup(ctx, tx, group); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (u *upsertBuilder) execClickhouseInsert(ctx context.Context, db *sql.DB, group []upsertOp) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, u.upsertSQL(1))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, op := range group {
+		if _, err := stmt.ExecContext(ctx, op.args...); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,132 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertBuilderSQL(t *testing.T) {
+	tests := []struct {
+		driver string
+		upsert string
+		delete string
+	}{
+		{
+			driver: "postgres",
+			upsert: "INSERT INTO things (id, name, age) VALUES ($1, $2, $3), ($4, $5, $6) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, age = EXCLUDED.age",
+			delete: "DELETE FROM things WHERE (id = $1) OR (id = $2)",
+		},
+		{
+			driver: "sqlite",
+			upsert: "INSERT INTO things (id, name, age) VALUES (?, ?, ?), (?, ?, ?) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, age = EXCLUDED.age",
+			delete: "DELETE FROM things WHERE (id = ?) OR (id = ?)",
+		},
+		{
+			driver: "mysql",
+			upsert: "INSERT INTO things (id, name, age) VALUES (?, ?, ?), (?, ?, ?) ON DUPLICATE KEY UPDATE name = VALUES(name), age = VALUES(age)",
+			delete: "DELETE FROM things WHERE (id = ?) OR (id = ?)",
+		},
+		{
+			driver: "clickhouse",
+			upsert: "INSERT INTO things (id, name, age) VALUES ($1, $2, $3), ($4, $5, $6)",
+			delete: "DELETE FROM things WHERE (id = $1) OR (id = $2)",
+		},
+		{
+			driver: "mssql",
+			upsert: "MERGE INTO things WITH (HOLDLOCK) AS target USING (VALUES (?, ?, ?), (?, ?, ?)) AS source (id, name, age) ON target.id = source.id" +
+				" WHEN MATCHED THEN UPDATE SET target.name = source.name, target.age = source.age" +
+				" WHEN NOT MATCHED THEN INSERT (id, name, age) VALUES (source.id, source.name, source.age);",
+			delete: "DELETE FROM things WHERE (id = ?) OR (id = ?)",
+		},
+		{
+			driver: "oracle",
+			upsert: "MERGE INTO things target USING (SELECT :1 id, :2 name, :3 age FROM dual UNION ALL SELECT :4 id, :5 name, :6 age FROM dual) source ON (target.id = source.id)" +
+				" WHEN MATCHED THEN UPDATE SET target.name = source.name, target.age = source.age" +
+				" WHEN NOT MATCHED THEN INSERT (id, name, age) VALUES (source.id, source.name, source.age)",
+			delete: "DELETE FROM things WHERE (id = :1) OR (id = :2)",
+		},
+		{
+			driver: "snowflake",
+			upsert: "MERGE INTO things AS target USING (SELECT column1 AS id, column2 AS name, column3 AS age FROM VALUES (?, ?, ?), (?, ?, ?)) AS source ON target.id = source.id" +
+				" WHEN MATCHED THEN UPDATE SET target.name = source.name, target.age = source.age" +
+				" WHEN NOT MATCHED THEN INSERT (id, name, age) VALUES (source.id, source.name, source.age)",
+			delete: "DELETE FROM things WHERE (id = ?) OR (id = ?)",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.driver, func(t *testing.T) {
+			u, err := newUpsertBuilder(test.driver, "things", []string{"id", "name", "age"}, []string{"id"})
+			require.NoError(t, err)
+			assert.Equal(t, test.upsert, u.upsertSQL(2))
+			assert.Equal(t, test.delete, u.deleteSQL(2))
+		})
+	}
+}
+
+func TestUpsertBuilderKeysOnly(t *testing.T) {
+	u, err := newUpsertBuilder("postgres", "things", []string{"a", "b"}, []string{"b", "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO things (a, b) VALUES ($1, $2) ON CONFLICT (b, a) DO NOTHING", u.upsertSQL(1))
+	assert.Equal(t, "DELETE FROM things WHERE (b = $1 AND a = $2)", u.deleteSQL(1))
+
+	u, err = newUpsertBuilder("mysql", "things", []string{"a", "b"}, []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO things (a, b) VALUES (?, ?) ON DUPLICATE KEY UPDATE a = a", u.upsertSQL(1))
+
+	u, err = newUpsertBuilder("mssql", "things", []string{"a"}, []string{"a"})
+	require.NoError(t, err)
+	assert.Equal(t, "MERGE INTO things WITH (HOLDLOCK) AS target USING (VALUES (?)) AS source (a) ON target.a = source.a WHEN NOT MATCHED THEN INSERT (a) VALUES (source.a);", u.upsertSQL(1))
+}
+
+func TestUpsertBuilderErrors(t *testing.T) {
+	_, err := newUpsertBuilder("trino", "things", []string{"a"}, []string{"a"})
+	require.ErrorContains(t, err, "not supported")
+
+	_, err = newUpsertBuilder("postgres", "things", []string{"a"}, nil)
+	require.ErrorContains(t, err, "at least one key column")
+
+	_, err = newUpsertBuilder("postgres", "things", []string{"a"}, []string{"b"})
+	require.ErrorContains(t, err, "key column b is not within the list of columns")
+}
+
+func TestUpsertBuilderGroupOps(t *testing.T) {
+	u, err := newUpsertBuilder("postgres", "things", []string{"id", "name"}, []string{"id"})
+	require.NoError(t, err)
+
+	groups := u.groupOps([]upsertOp{
+		{args: []any{1, "a"}},
+		{args: []any{2, "b"}},
+		{args: []any{1, "c"}},
+		{delete: true, args: []any{2, nil}},
+		{delete: true, args: []any{2, nil}},
+		{args: []any{2, "d"}},
+		{args: []any{"2", "e"}},
+	})
+	assert.Equal(t, [][]upsertOp{
+		{
+			{args: []any{1, "c"}},
+			{args: []any{2, "b"}},
+		},
+		{
+			{delete: true, args: []any{2, nil}},
+		},
+		{
+			{args: []any{2, "d"}},
+			{args: []any{"2", "e"}},
+		},
+	}, groups)
+}
+
+func TestUpsertBuilderMaxRows(t *testing.T) {
+	u, err := newUpsertBuilder("mssql", "things", []string{"a", "b", "c"}, []string{"a"})
+	require.NoError(t, err)
+	assert.Equal(t, 666, u.maxRows())
+
+	u, err = newUpsertBuilder("postgres", "things", []string{"a", "b", "c"}, []string{"a"})
+	require.NoError(t, err)
+	assert.Equal(t, 21845, u.maxRows())
+}
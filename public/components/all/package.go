@@ -30,6 +30,7 @@ import (
 	_ "github.com/usedatabrew/benthos/v4/public/components/mongodb"
 	_ "github.com/usedatabrew/benthos/v4/public/components/mqtt"
 	_ "github.com/usedatabrew/benthos/v4/public/components/msgpack"
+	_ "github.com/usedatabrew/benthos/v4/public/components/mysql_cdc"
 	_ "github.com/usedatabrew/benthos/v4/public/components/nanomsg"
 	_ "github.com/usedatabrew/benthos/v4/public/components/nats"
 	_ "github.com/usedatabrew/benthos/v4/public/components/nsq"
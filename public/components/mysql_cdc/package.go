@@ -0,0 +1,6 @@
+package mysql_cdc
+
+import (
+	// Bring in the internal plugin definitions.
+	_ "github.com/usedatabrew/benthos/v4/internal/impl/mysql_cdc"
+)
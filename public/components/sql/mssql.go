@@ -0,0 +1,14 @@
+package sql
+
+import (
+	mssql "github.com/denisenkom/go-mssqldb"
+
+	isql "github.com/usedatabrew/benthos/v4/internal/impl/sql"
+)
+
+func init() {
+	// Enables bulk loading with the bulk copy protocol.
+	isql.SetMSSQLCopyIn(func(table string, columns ...string) string {
+		return mssql.CopyIn(table, mssql.BulkOptions{}, columns...)
+	})
+}
@@ -0,0 +1,12 @@
+package sql
+
+import (
+	"github.com/go-sql-driver/mysql"
+
+	isql "github.com/usedatabrew/benthos/v4/internal/impl/sql"
+)
+
+func init() {
+	// Enables bulk loading with LOAD DATA LOCAL INFILE statements.
+	isql.SetMySQLReaderHandlers(mysql.RegisterReaderHandler, mysql.DeregisterReaderHandler)
+}